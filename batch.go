@@ -172,6 +172,9 @@ func (d DeferredBatchOp) Finish() error {
 //	InternalKeyKindRangeKeySet    varstring varstring
 //	InternalKeyKindRangeKeyUnset  varstring varstring
 //	InternalKeyKindRangeKeyDelete varstring varstring
+//	InternalKeyKindAssertAbsent   varstring
+//	InternalKeyKindAssertExists   varstring
+//	InternalKeyKindAssertValue    varstring varstring
 //
 // The intuitive understanding here are that the arguments to Delete, Set,
 // Merge, DeleteRange and RangeKeyDelete are encoded into the batch. The
@@ -358,6 +361,25 @@ type batchInternal struct {
 	commitStats BatchCommitStats
 
 	commitErr error
+	// applyErr is the error of the application of a pipelined batch to the
+	// memtable, which happens in the background. It is returned by SyncWait.
+	applyErr error
+
+	// commitMode is the mode in which the batch is committed, set from
+	// WriteOptions when the batch is applied. See WriteOptions.Pipelined and
+	// WriteOptions.Unordered.
+	commitMode commitMode
+
+	// durability is the durability level of the batch, set from WriteOptions
+	// when the batch is applied. syncWithin is WriteOptions.SyncWithin for
+	// DurabilitySyncWithin, else zero. See WriteOptions.Durability.
+	durability Durability
+	syncWithin time.Duration
+
+	// preparedTxnID is set on the batch committing or aborting a batch
+	// prepared by CommitAtomic, whose transaction ID it is. The prepared batch
+	// is forgotten once this batch is written to the WAL.
+	preparedTxnID []byte
 
 	// Position bools together to reduce the sizeof the struct.
 
@@ -366,6 +388,13 @@ type batchInternal struct {
 	// then it will only contain key kinds of IngestSST.
 	ingestedSSTBatch bool
 
+	// hasConditions is set if the batch contains conditions, which are
+	// evaluated when it is committed (see Batch.SetIfAbsent).
+	// conditionFailed is set if the commit failed because a condition didn't
+	// hold.
+	hasConditions   bool
+	conditionFailed bool
+
 	// committing is set to true when a batch begins to commit. It's used to
 	// ensure the batch is not mutated concurrently. It is not an atomic
 	// deliberately, so as to avoid the overhead on batch mutations. This is
@@ -549,6 +578,13 @@ func (b *Batch) refreshMemTableSize() error {
 		case InternalKeyKindLogData:
 			// LogData does not contribute to memtable size.
 			continue
+		case InternalKeyKindAssertAbsent, InternalKeyKindAssertExists, InternalKeyKindAssertValue:
+			b.hasConditions = true
+			if b.minimumFormatMajorVersion < FormatBatchConditions {
+				b.minimumFormatMajorVersion = FormatBatchConditions
+			}
+			// Conditions do not contribute to memtable size.
+			continue
 		case InternalKeyKindIngestSST:
 			if b.minimumFormatMajorVersion < FormatFlushableIngest {
 				b.minimumFormatMajorVersion = FormatFlushableIngest
@@ -616,6 +652,13 @@ func (b *Batch) Apply(batch *Batch, _ *WriteOptions) error {
 			case InternalKeyKindLogData:
 				// LogData does not contribute to memtable size.
 				continue
+			case InternalKeyKindAssertAbsent, InternalKeyKindAssertExists, InternalKeyKindAssertValue:
+				b.hasConditions = true
+				if b.minimumFormatMajorVersion < FormatBatchConditions {
+					b.minimumFormatMajorVersion = FormatBatchConditions
+				}
+				// Conditions do not contribute to memtable size.
+				continue
 			case InternalKeyKindSet, InternalKeyKindDelete, InternalKeyKindMerge,
 				InternalKeyKindSingleDelete, InternalKeyKindSetWithDelete, InternalKeyKindDeleteSized:
 				// fallthrough
@@ -1173,6 +1216,74 @@ func (b *Batch) LogData(data []byte, _ *WriteOptions) error {
 	return nil
 }
 
+// SetIfAbsent adds an action to the batch that sets the key to map to the
+// value, on the condition that the key is absent when the batch is committed.
+//
+// The conditions of a batch are evaluated atomically when the batch is
+// committed, against the state of the DB at the batch sequence number, which
+// excludes the actions of the batch itself. If any of them doesn't hold, the
+// commit fails with an error wrapping ErrConditionFailed, and none of the
+// actions of the batch are applied. Conditions require FormatBatchConditions,
+// and a batch with conditions can't be committed with WriteOptions.Unordered.
+//
+// Committing a batch with conditions is more expensive than committing other
+// batches, including for the concurrent commits. Each condition is read like
+// DB.Get before the batch enters the commit pipeline. Once the batches
+// committed before it are applied, the commit pipeline is held, blocking all
+// the concurrent commits, while the memtables are checked for writes to the
+// condition keys since they were read. If the conditions may have changed,
+// e.g. because of a write to one of the keys, a flush or an ingestion, they
+// are read again while the commit pipeline is held, which may require table
+// reads. See BenchmarkCommitConditions.
+//
+// It is safe to modify the contents of the arguments after SetIfAbsent
+// returns.
+func (b *Batch) SetIfAbsent(key, value []byte, opts *WriteOptions) error {
+	b.addCondition(InternalKeyKindAssertAbsent, key, nil)
+	return b.Set(key, value, opts)
+}
+
+// SetIfValueEquals adds an action to the batch that sets the key to map to the
+// value, on the condition that the key maps to expected when the batch is
+// committed. See SetIfAbsent for the evaluation of the conditions.
+//
+// It is safe to modify the contents of the arguments after SetIfValueEquals
+// returns.
+func (b *Batch) SetIfValueEquals(key, expected, value []byte, opts *WriteOptions) error {
+	b.addCondition(InternalKeyKindAssertValue, key, expected)
+	return b.Set(key, value, opts)
+}
+
+// DeleteIfExists adds an action to the batch that deletes the entry for key,
+// on the condition that the key exists when the batch is committed. See
+// SetIfAbsent for the evaluation of the conditions.
+//
+// It is safe to modify the contents of the arguments after DeleteIfExists
+// returns.
+func (b *Batch) DeleteIfExists(key []byte, opts *WriteOptions) error {
+	b.addCondition(InternalKeyKindAssertExists, key, nil)
+	return b.Delete(key, opts)
+}
+
+// addCondition adds a condition of the given kind on key to the batch. Like
+// LogData, conditions are written to the WAL, but are neither added to
+// memtables nor indexed.
+func (b *Batch) addCondition(kind InternalKeyKind, key, value []byte) {
+	origCount, origMemTableSize := b.count, b.memTableSize
+	if kind == InternalKeyKindAssertValue {
+		b.prepareDeferredKeyValueRecord(len(key), len(value), kind)
+		copy(b.deferredOp.Value, value)
+	} else {
+		b.prepareDeferredKeyRecord(len(key), kind)
+	}
+	copy(b.deferredOp.Key, key)
+	b.count, b.memTableSize = origCount, origMemTableSize
+	b.hasConditions = true
+	if b.minimumFormatMajorVersion < FormatBatchConditions {
+		b.minimumFormatMajorVersion = FormatBatchConditions
+	}
+}
+
 // IngestSST adds the FileNum for an sstable to the batch. The data will only be
 // written to the WAL (not added to memtables or sstables).
 func (b *Batch) ingestSST(fileNum base.FileNum) {
@@ -1636,14 +1747,17 @@ func (b *Batch) Reader() batchrepr.Reader {
 // SyncWait is to be used in conjunction with DB.ApplyNoSyncWait.
 func (b *Batch) SyncWait() error {
 	now := time.Now()
+	// A batch committed in the pipelined mode may not be published yet.
+	b.commit.Wait()
 	b.fsyncWait.Wait()
-	if b.commitErr != nil {
+	err := firstError(b.applyErr, b.commitErr)
+	if err != nil {
 		b.db = nil // prevent batch reuse on error
 	}
 	waitDuration := time.Since(now)
 	b.commitStats.CommitWaitDuration += waitDuration
 	b.commitStats.TotalDuration += waitDuration
-	return b.commitErr
+	return err
 }
 
 // CommitStats returns stats related to committing the batch. Should be called
@@ -1921,8 +2035,9 @@ func newFlushableBatch(batch *Batch, comparer *Comparer) (*flushableBatch, error
 				rangeDelOffsets = append(rangeDelOffsets, entry)
 			case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
 				rangeKeyOffsets = append(rangeKeyOffsets, entry)
-			case InternalKeyKindLogData:
-				// Skip it; we never want to iterate over LogDatas.
+			case InternalKeyKindLogData, InternalKeyKindAssertAbsent, InternalKeyKindAssertExists,
+				InternalKeyKindAssertValue:
+				// Skip it; we never want to iterate over LogDatas or conditions.
 				continue
 			case InternalKeyKindSet, InternalKeyKindDelete, InternalKeyKindMerge,
 				InternalKeyKindSingleDelete, InternalKeyKindSetWithDelete, InternalKeyKindDeleteSized:
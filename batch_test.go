@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1576,6 +1577,247 @@ func BenchmarkIndexedBatchSetDeferred(b *testing.B) {
 	b.StopTimer()
 }
 
+func TestBatchConditions(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem, FormatMajorVersion: internalFormatNewest}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	get := func(key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if err == ErrNotFound {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	commit := func(fn func(b *Batch) error) error {
+		b := d.NewBatch()
+		defer b.Close()
+		require.NoError(t, fn(b))
+		return b.Commit(nil)
+	}
+
+	// SetIfAbsent only sets keys which don't exist.
+	require.NoError(t, commit(func(b *Batch) error {
+		return b.SetIfAbsent([]byte("a"), []byte("1"), nil)
+	}))
+	err = commit(func(b *Batch) error {
+		return b.SetIfAbsent([]byte("a"), []byte("2"), nil)
+	})
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	require.Equal(t, "1", get("a"))
+
+	// A batch with a failed condition applies none of its actions.
+	err = commit(func(b *Batch) error {
+		require.NoError(t, b.Set([]byte("b"), []byte("1"), nil))
+		return b.SetIfValueEquals([]byte("a"), []byte("2"), []byte("3"), nil)
+	})
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	require.Equal(t, "<not found>", get("b"))
+	require.Equal(t, "1", get("a"))
+	require.NoError(t, commit(func(b *Batch) error {
+		require.NoError(t, b.Set([]byte("b"), []byte("1"), nil))
+		return b.SetIfValueEquals([]byte("a"), []byte("1"), []byte("3"), nil)
+	}))
+	require.Equal(t, "1", get("b"))
+	require.Equal(t, "3", get("a"))
+
+	// DeleteIfExists only deletes keys which exist.
+	err = commit(func(b *Batch) error {
+		return b.DeleteIfExists([]byte("c"), nil)
+	})
+	require.True(t, errors.Is(err, ErrConditionFailed), "%v", err)
+	require.NoError(t, commit(func(b *Batch) error {
+		return b.DeleteIfExists([]byte("b"), nil)
+	}))
+	require.Equal(t, "<not found>", get("b"))
+
+	// A batch which failed its conditions can be committed once they hold.
+	b := d.NewBatch()
+	require.NoError(t, b.SetIfAbsent([]byte("c"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("c"), []byte("0"), nil))
+	require.True(t, errors.Is(b.Commit(nil), ErrConditionFailed))
+	require.NoError(t, d.Delete([]byte("c"), nil))
+	require.NoError(t, b.Commit(nil))
+	require.NoError(t, b.Close())
+	require.Equal(t, "1", get("c"))
+
+	// Conditions can't be committed out of order.
+	b = d.NewBatch()
+	require.NoError(t, b.SetIfAbsent([]byte("d"), []byte("1"), nil))
+	require.Error(t, b.Commit(&WriteOptions{Unordered: true}))
+	require.NoError(t, b.Close())
+
+	// Concurrent increments only succeed if no other increment was committed
+	// since the value was read.
+	const goroutines, increments = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < increments; {
+				v, closer, err := d.Get([]byte("counter"))
+				var cur int
+				if err == nil {
+					cur, err = strconv.Atoi(string(v))
+					closer.Close()
+				} else if err == ErrNotFound {
+					err = nil
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				b := d.NewBatch()
+				next := []byte(strconv.Itoa(cur + 1))
+				if cur == 0 {
+					err = b.SetIfAbsent([]byte("counter"), next, nil)
+				} else {
+					err = b.SetIfValueEquals([]byte("counter"), []byte(strconv.Itoa(cur)), next, nil)
+				}
+				if err == nil {
+					err = b.Commit(nil)
+				}
+				b.Close()
+				if err == nil {
+					n++
+				} else if !errors.Is(err, ErrConditionFailed) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, strconv.Itoa(goroutines*increments), get("counter"))
+
+	// The conditions are ignored when the WAL is replayed.
+	require.NoError(t, d.Close())
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, "3", get("a"))
+	require.Equal(t, "1", get("c"))
+	require.Equal(t, strconv.Itoa(goroutines*increments), get("counter"))
+	require.NoError(t, d.Close())
+}
+
+func TestBatchConditionsRecheck(t *testing.T) {
+	d, err := Open("", &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: internalFormatNewest,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// recheck reads the conditions of a batch, runs fn, which commits other
+	// batches in the meantime, and returns the outcome of the recheck.
+	recheck := func(fn func(b *Batch) error, between func()) error {
+		b := d.NewBatch()
+		defer b.Close()
+		require.NoError(t, fn(b))
+		recheck := d.checkConditions(b)
+		between()
+		d.commit.mu.Lock()
+		defer d.commit.mu.Unlock()
+		return recheck()
+	}
+	setIfAbsent := func(key string) func(b *Batch) error {
+		return func(b *Batch) error { return b.SetIfAbsent([]byte(key), []byte("v"), nil) }
+	}
+	deleteIfExists := func(key string) func(b *Batch) error {
+		return func(b *Batch) error { return b.DeleteIfExists([]byte(key), nil) }
+	}
+
+	// Without concurrent commits, the outcome of the first read holds.
+	require.NoError(t, recheck(setIfAbsent("a"), func() {}))
+	require.NoError(t, d.Set([]byte("b"), []byte("v"), nil))
+	require.ErrorIs(t, recheck(setIfAbsent("b"), func() {}), ErrConditionFailed)
+
+	// A concurrent write to a condition key is detected.
+	require.ErrorIs(t, recheck(setIfAbsent("c"), func() {
+		require.NoError(t, d.Set([]byte("c"), []byte("v"), nil))
+	}), ErrConditionFailed)
+	require.NoError(t, recheck(deleteIfExists("c"), func() {
+		require.NoError(t, d.Delete([]byte("c"), nil))
+		require.NoError(t, d.Set([]byte("c"), []byte("v"), nil))
+	}))
+	// A concurrent write to another key does not change the outcome.
+	require.NoError(t, recheck(setIfAbsent("d"), func() {
+		require.NoError(t, d.Set([]byte("e"), []byte("v"), nil))
+	}))
+
+	// So is a concurrent range deletion covering a condition key.
+	require.ErrorIs(t, recheck(deleteIfExists("c"), func() {
+		require.NoError(t, d.DeleteRange([]byte("c"), []byte("d"), nil))
+	}), ErrConditionFailed)
+
+	// A flush, which changes the readState, requires reading the conditions
+	// again.
+	require.ErrorIs(t, recheck(setIfAbsent("f"), func() {
+		require.NoError(t, d.Set([]byte("f"), []byte("v"), nil))
+		require.NoError(t, d.Flush())
+	}), ErrConditionFailed)
+
+	// The outcome of a condition on a key whose newest entry is a merge is
+	// always read again, since a merge operand applied later with a lower
+	// sequence number changes the value.
+	require.NoError(t, d.Merge([]byte("g"), []byte("1"), nil))
+	b := d.NewBatch()
+	defer b.Close()
+	require.NoError(t, b.SetIfValueEquals([]byte("g"), []byte("1"), []byte("2"), nil))
+	rs := d.loadReadState()
+	defer rs.unref()
+	_, ok := d.newestConditionEntries(b, rs)
+	require.False(t, ok)
+	d.commit.mu.Lock()
+	require.NoError(t, d.checkConditions(b)())
+	d.commit.mu.Unlock()
+}
+
+// BenchmarkCommitConditions measures the cost of the batches with conditions
+// for the concurrent commits. The conditions are read before the commit
+// pipeline is held, and only checked against the memtables while it is.
+func BenchmarkCommitConditions(b *testing.B) {
+	for _, conditions := range []bool{false, true} {
+		b.Run(fmt.Sprintf("conditions=%t", conditions), func(b *testing.B) {
+			d, err := Open("", &Options{
+				FS:                 vfs.NewMem(),
+				FormatMajorVersion: internalFormatNewest,
+			})
+			require.NoError(b, err)
+			defer func() { require.NoError(b, d.Close()) }()
+			// The keys are in sstables, so that reading them requires table
+			// reads.
+			for i := 0; i < 10000; i++ {
+				require.NoError(b, d.Set([]byte(fmt.Sprintf("key-%06d", i)), []byte("v"), nil))
+			}
+			require.NoError(b, d.Flush())
+
+			var n atomic.Int64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := n.Add(1)
+					batch := d.NewBatch()
+					key := []byte(fmt.Sprintf("key-%06d", i%10000))
+					// Every other batch has a condition.
+					if conditions && i%2 == 0 {
+						_ = batch.SetIfValueEquals(key, []byte("v"), []byte("v"), nil)
+					} else {
+						_ = batch.Set(key, []byte("v"), nil)
+					}
+					if err := batch.Commit(nil); err != nil {
+						b.Fatal(err)
+					}
+					_ = batch.Close()
+				}
+			})
+		})
+	}
+}
+
 func TestBatchMemTableSizeOverflow(t *testing.T) {
 	opts := &Options{
 		FS: vfs.NewMem(),
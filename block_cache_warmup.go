@@ -0,0 +1,266 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/internal/crc"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/tokenbucket"
+)
+
+// hotBlocksFilename is the name of the file, in the DB directory, that contains
+// the list of hot blocks. See BlockCacheWarmupOptions.
+const hotBlocksFilename = "HOT-BLOCKS"
+
+// hotBlocksVersion is the version of the encoding of the hot blocks file.
+const hotBlocksVersion = 1
+
+// blockCacheWarmup persists the list of hot blocks of a DB and warms up the
+// block cache from it.
+type blockCacheWarmup struct {
+	opts BlockCacheWarmupOptions
+	// ctx is canceled when the DB is closed.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+	// persistMu serializes the writes of the list.
+	persistMu sync.Mutex
+	// warmupDone is closed when the warm-up completes.
+	warmupDone chan struct{}
+	// prefetchedBlocks and prefetchedBytes are the blocks read by the warm-up.
+	// They can only be read after warmupDone is closed.
+	prefetchedBlocks int
+	prefetchedBytes  uint64
+}
+
+// startBlockCacheWarmup starts the warm-up of the block cache and the periodic
+// persistence of the list of hot blocks, if they are enabled.
+func (d *DB) startBlockCacheWarmup() {
+	opts := d.opts.Experimental.BlockCacheWarmup
+	if opts.PersistInterval <= 0 {
+		return
+	}
+	w := &blockCacheWarmup{
+		opts:       opts,
+		warmupDone: make(chan struct{}),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	d.blockCacheWarmup = w
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer close(w.warmupDone)
+		d.warmUpBlockCache()
+	}()
+	if !d.opts.ReadOnly {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			ticker := time.NewTicker(opts.PersistInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-w.ctx.Done():
+					return
+				case <-ticker.C:
+					if err := d.persistHotBlocks(); err != nil {
+						d.opts.Logger.Errorf("pebble: writing the hot blocks list: %s", err)
+					}
+				}
+			}
+		}()
+	}
+}
+
+// close stops the warm-up and the periodic persistence of the list, and writes
+// the list one last time. It must be called before the table cache is closed.
+func (w *blockCacheWarmup) close(d *DB) error {
+	var err error
+	w.stopOnce.Do(func() {
+		w.cancel()
+		w.wg.Wait()
+		if !d.opts.ReadOnly {
+			err = d.persistHotBlocks()
+		}
+	})
+	return err
+}
+
+// persistHotBlocks writes the list of the most frequently accessed blocks of
+// the DB. The file contains the blocks grouped by file, with the offsets of
+// the blocks of a file delta-encoded, followed by a checksum.
+func (d *DB) persistHotBlocks() error {
+	w := d.blockCacheWarmup
+	w.persistMu.Lock()
+	defer w.persistMu.Unlock()
+
+	keys := d.opts.Cache.HotBlocks(d.cacheID, w.opts.MaxBlocks)
+	slices.SortFunc(keys, func(a, b cache.BlockKey) int {
+		if c := cmp.Compare(a.FileNum, b.FileNum); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	buf := binary.AppendUvarint(nil, hotBlocksVersion)
+	for i := 0; i < len(keys); {
+		j := i + 1
+		for j < len(keys) && keys[j].FileNum == keys[i].FileNum {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(keys[i].FileNum))
+		buf = binary.AppendUvarint(buf, uint64(j-i))
+		var prev uint64
+		for _, k := range keys[i:j] {
+			buf = binary.AppendUvarint(buf, k.Offset-prev)
+			prev = k.Offset
+		}
+		i = j
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc.New(buf).Value())
+
+	path := d.opts.FS.PathJoin(d.dirname, hotBlocksFilename)
+	tmpPath := path + ".tmp"
+	f, err := d.opts.FS.Create(tmpPath, vfs.WriteCategoryUnspecified)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return d.opts.FS.Rename(tmpPath, path)
+}
+
+// readHotBlocks reads the list written by persistHotBlocks, returning the
+// offsets of the hot blocks of each file. Returns nil if there is no list.
+func readHotBlocks(fs vfs.FS, dirname string) (map[base.DiskFileNum][]uint64, error) {
+	f, err := fs.Open(fs.PathJoin(dirname, hotBlocksFilename))
+	if oserror.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err := errors.CombineErrors(err, f.Close()); err != nil {
+		return nil, err
+	}
+	errCorrupt := base.CorruptionErrorf("pebble: corrupt hot blocks list")
+	if len(data) < 4 {
+		return nil, errCorrupt
+	}
+	data, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc.New(data).Value() != checksum {
+		return nil, errCorrupt
+	}
+	next := func() (uint64, bool) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, false
+		}
+		data = data[n:]
+		return v, true
+	}
+	if v, ok := next(); !ok || v != hotBlocksVersion {
+		return nil, errors.Newf("pebble: unsupported hot blocks list version %d", v)
+	}
+	res := make(map[base.DiskFileNum][]uint64)
+	for len(data) > 0 {
+		fileNum, ok1 := next()
+		count, ok2 := next()
+		if !ok1 || !ok2 || count > uint64(len(data)) {
+			return nil, errCorrupt
+		}
+		offsets := make([]uint64, count)
+		var prev uint64
+		for i := range offsets {
+			delta, ok := next()
+			if !ok {
+				return nil, errCorrupt
+			}
+			prev += delta
+			offsets[i] = prev
+		}
+		res[base.DiskFileNum(fileNum)] = offsets
+	}
+	return res, nil
+}
+
+// warmUpBlockCache reads the blocks in the list of hot blocks into the block
+// cache, skipping the blocks of tables that are not in the current version.
+func (d *DB) warmUpBlockCache() {
+	w := d.blockCacheWarmup
+	hot, err := readHotBlocks(d.opts.FS, d.dirname)
+	if err != nil {
+		d.opts.Logger.Errorf("pebble: reading the hot blocks list: %s", err)
+		return
+	}
+	if len(hot) == 0 {
+		return
+	}
+
+	// The read state protects the tables from deletion during the warm-up.
+	rs := d.loadReadState()
+	defer rs.unref()
+	backings := make(map[base.DiskFileNum]*fileBacking)
+	for level := range rs.current.Levels {
+		iter := rs.current.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			backings[f.FileBacking.DiskFileNum] = f.FileBacking
+		}
+	}
+	fileNums := make([]base.DiskFileNum, 0, len(hot))
+	for fileNum := range hot {
+		if _, ok := backings[fileNum]; ok {
+			fileNums = append(fileNums, fileNum)
+		}
+	}
+	slices.Sort(fileNums)
+
+	start := time.Now()
+	var tb tokenbucket.TokenBucket
+	// Each token corresponds to a byte that was read.
+	tb.Init(tokenbucket.TokensPerSecond(w.opts.PrefetchBytesPerSecond), tokenbucket.Tokens(1<<20))
+	wait := func(length uint64) error {
+		return tb.WaitCtx(w.ctx, tokenbucket.Tokens(length))
+	}
+	for _, fileNum := range fileNums {
+		err := d.tableCache.withBackingReader(backings[fileNum], func(r *sstable.Reader) error {
+			blocks, size, err := r.PrefetchBlocks(w.ctx, hot[fileNum], wait)
+			w.prefetchedBlocks += blocks
+			w.prefetchedBytes += size
+			return err
+		})
+		if w.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// The other tables may still be read.
+			d.opts.Logger.Errorf("pebble: warming up the block cache with table %s: %s", fileNum, err)
+		}
+	}
+	d.opts.Logger.Infof("block cache warm-up: read %d blocks (%s) from %d tables in %s",
+		w.prefetchedBlocks, humanize.Bytes.Uint64(w.prefetchedBytes), len(fileNums),
+		time.Since(start).Round(time.Millisecond))
+}
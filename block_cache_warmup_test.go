@@ -0,0 +1,129 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockCacheWarmup(t *testing.T) {
+	fs := vfs.NewMem()
+	open := func(warmup bool) *DB {
+		c := cache.New(64 << 20)
+		defer c.Unref()
+		opts := &Options{
+			FS:                          fs,
+			Cache:                       c,
+			DisableAutomaticCompactions: true,
+			Levels:                      []LevelOptions{{BlockSize: 256}},
+		}
+		if warmup {
+			opts.Experimental.BlockCacheWarmup.PersistInterval = time.Hour
+		}
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		if d.blockCacheWarmup != nil {
+			<-d.blockCacheWarmup.warmupDone
+		}
+		return d
+	}
+	get := func(d *DB, key string) {
+		_, closer, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+	}
+	// tables returns the file numbers of the tables in the current version.
+	tables := func(d *DB) map[base.DiskFileNum]bool {
+		res := make(map[base.DiskFileNum]bool)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for _, l := range d.mu.versions.currentVersion().Levels {
+			iter := l.Iter()
+			for f := iter.First(); f != nil; f = iter.Next() {
+				res[f.FileBacking.DiskFileNum] = true
+			}
+		}
+		return res
+	}
+
+	d := open(true /* warmup */)
+	for _, prefix := range []string{"a", "b"} {
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%s%03d", prefix, i)), make([]byte, 64), nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	for i := 0; i < 100; i += 10 {
+		get(d, fmt.Sprintf("a%03d", i))
+		get(d, fmt.Sprintf("b%03d", i))
+	}
+	hot := d.opts.Cache.HotBlocks(d.cacheID, 1000)
+	require.NoError(t, d.Close())
+	list, err := readHotBlocks(fs, "")
+	require.NoError(t, err)
+	var n int
+	for _, offsets := range list {
+		n += len(offsets)
+	}
+	require.Equal(t, len(hot), n)
+	require.Len(t, list, 2)
+
+	// Rewrite the table that contains the "a" keys; its blocks are no longer
+	// in the current version, and are not prefetched.
+	d = open(false /* warmup */)
+	require.NoError(t, d.Delete([]byte("a000"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Compact([]byte("a"), []byte("a999"), false /* parallelize */))
+	live := tables(d)
+	var expectedBlocks int
+	for fileNum, offsets := range list {
+		if live[fileNum] {
+			expectedBlocks += len(offsets)
+		}
+	}
+	require.NoError(t, d.Close())
+	require.NotZero(t, expectedBlocks)
+	require.Less(t, expectedBlocks, n)
+
+	d = open(true /* warmup */)
+	require.NotZero(t, d.blockCacheWarmup.prefetchedBlocks)
+	for _, k := range d.opts.Cache.HotBlocks(d.cacheID, 1000) {
+		require.True(t, live[k.FileNum], "block of deleted table %s", k.FileNum)
+	}
+	for fileNum, offsets := range list {
+		if !live[fileNum] {
+			continue
+		}
+		for _, offset := range offsets {
+			h := d.opts.Cache.Get(d.cacheID, fileNum, offset)
+			require.NotNil(t, h.Get())
+			h.Release()
+		}
+	}
+	// The reads of the "b" keys hit the cache.
+	before := d.Metrics().BlockCache
+	for i := 0; i < 100; i += 10 {
+		get(d, fmt.Sprintf("b%03d", i))
+	}
+	require.Equal(t, before.Misses, d.Metrics().BlockCache.Misses)
+	require.NoError(t, d.Close())
+
+	// A corrupt list is ignored.
+	f, err := fs.Create(hotBlocksFilename, vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("corrupt"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	d = open(true /* warmup */)
+	require.Zero(t, d.blockCacheWarmup.prefetchedBlocks)
+	require.NoError(t, d.Close())
+}
@@ -24,7 +24,10 @@ import (
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/mergers"
+	"github.com/cockroachdb/pebble/rangefilter"
 	"github.com/cockroachdb/pebble/replay"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/spf13/cobra"
 )
@@ -309,10 +312,18 @@ func (c *replayConfig) parseHooks() *pebble.ParseHooks {
 				return nil, nil
 			case "rocksdb.BuiltinBloomFilter":
 				return bloom.FilterPolicy(10), nil
+			case "pebble.RibbonFilter":
+				return ribbon.FilterPolicy(10), nil
 			default:
 				return nil, errors.Errorf("invalid filter policy name %q", name)
 			}
 		},
+		NewRangeFilterPolicy: func(name string) (pebble.RangeFilterPolicy, error) {
+			if name != rangefilter.FilterPolicy(0).Name() {
+				return nil, errors.Errorf("invalid range filter policy name %q", name)
+			}
+			return rangefilter.FilterPolicy(16), nil
+		},
 		NewMerger: makeMerger,
 	}
 }
@@ -394,7 +405,7 @@ func makeMerger(name string) (*pebble.Merger, error) {
 		merger.Name = name
 		return merger, nil
 	default:
-		return nil, errors.Newf("unrecognized comparer %q", name)
+		return mergers.ByName(name)
 	}
 }
 
@@ -120,6 +120,26 @@ func (q *commitQueue) dequeueApplied() *Batch {
 	}
 }
 
+// commitMode is the mode in which a batch is committed.
+type commitMode int8
+
+const (
+	// commitOrdered is the default mode: the commit returns once the batch
+	// and all the earlier batches are visible.
+	commitOrdered commitMode = iota
+	// commitPipelined is the mode of WriteOptions.Pipelined: the commit
+	// returns once the batch is written to the WAL, and hands the batch to the
+	// apply stage (see commitPipeline.applyPipelined), which applies it to the
+	// memtable after the commit mutex is released. The batch is published in
+	// order by whichever goroutine publishes the earlier batches. The
+	// commitQueueSem slot of the batch is released when it is published.
+	commitPipelined
+	// commitUnordered is the mode of WriteOptions.Unordered: the batch is not
+	// added to the pending queue, and the visible sequence number is ratcheted
+	// past the batch as soon as it is applied.
+	commitUnordered
+)
+
 // commitEnv contains the environment that a commitPipeline interacts
 // with. This allows fine-grained testing of commitPipeline behavior without
 // construction of an entire DB.
@@ -139,6 +159,14 @@ type commitEnv struct {
 	// the memtable the batch should be applied to. Serial execution enforced by
 	// commitPipeline.mu.
 	write func(b *Batch, wg *sync.WaitGroup, err *error) (*memTable, error)
+	// Evaluate the conditions of the batch (see Batch.SetIfAbsent) against the
+	// current state, without commitPipeline.mu held. The returned function is
+	// called with commitPipeline.mu held, once the batches preceding b are
+	// applied and published, and returns an error wrapping ErrConditionFailed
+	// if any of the conditions doesn't hold at that point. It re-evaluates the
+	// conditions only if a batch committed in the meantime may have changed
+	// their outcome.
+	checkConditions func(b *Batch) (recheck func() error)
 }
 
 // A commitPipeline manages the stages of committing a set of mutations
@@ -176,6 +204,14 @@ type commitEnv struct {
 // similar behavior to RocksDB's manual WAL flush functionality. Application
 // code needs to protect against this if necessary.
 //
+// Two modes relax the wait for the publish (see commitMode). A pipelined
+// commit returns once the batch is written to the WAL: the batch is applied by
+// the apply stage, concurrently with the WAL writes of the next batches, and
+// published by the goroutine that publishes the earlier batches; the caller
+// waits for the publish in Batch.SyncWait. An unordered commit bypasses the pending queue entirely and
+// ratchets the visible sequence number past its batch once applied, giving up
+// invariant 2 for all the batches committed concurrently.
+//
 // The full outline of the commit pipeline operation is as follows:
 //
 //	with commitPipeline mutex locked:
@@ -244,6 +280,20 @@ type commitPipeline struct {
 	commitQueueSem chan struct{}
 	logSyncQSem    chan struct{}
 	ingestSem      chan struct{}
+	// unapplied is the number of batches which were assigned a sequence number
+	// but not yet applied to the memtable. With unordered commits, the visible
+	// sequence number can be ratcheted past such batches.
+	unapplied atomic.Int64
+	// applyStage holds the pipelined batches which are written to the WAL
+	// until they are applied to the memtable. At most one goroutine applies
+	// them, and it only runs while the queue isn't empty. See applyPipelined.
+	applyStage struct {
+		sync.Mutex
+		// cond is signaled when the goroutine stops running.
+		cond    sync.Cond
+		queue   []pipelinedBatch
+		running bool
+	}
 	// The mutex to use for synchronizing access to logSeqNum and serializing
 	// calls to commitEnv.write().
 	mu sync.Mutex
@@ -270,6 +320,7 @@ func newCommitPipeline(env commitEnv) *commitPipeline {
 		logSyncQSem:    make(chan struct{}, record.SyncConcurrency-1),
 		ingestSem:      make(chan struct{}, 1),
 	}
+	p.applyStage.cond.L = &p.applyStage.Mutex
 	return p
 }
 
@@ -294,10 +345,16 @@ func (p *commitPipeline) directWrite(b *Batch) error {
 // WAL, and applying the batch to the memtable. Upon successful return the
 // batch's mutations will be visible for reading.
 // REQUIRES: noSyncWait => syncWAL
+//
+// The batch is committed in the mode of b.commitMode. REQUIRES:
+// b.commitMode == commitPipelined => noSyncWait || !syncWAL
 func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	if b.Empty() {
 		return nil
 	}
+	if b.commitMode == commitUnordered {
+		return p.commitUnordered(b, syncWAL, noSyncWait)
+	}
 
 	commitStartTime := time.Now()
 	// Acquire semaphores.
@@ -315,6 +372,14 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	// for reuse. See Batch.release().
 	mem, err := p.prepare(b, syncWAL, noSyncWait)
 	if err != nil {
+		if b.conditionFailed {
+			// The batch was not enqueued, and may be reused.
+			<-p.commitQueueSem
+			if syncWAL {
+				<-p.logSyncQSem
+			}
+			return err
+		}
 		b.db = nil // prevent batch reuse on error
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
 		// sitting in the pending queue. We should consider fixing this by also
@@ -322,8 +387,19 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 		return err
 	}
 
+	if b.commitMode == commitPipelined {
+		// The batch is applied and published by the apply stage. The semaphore
+		// is released when the batch is published, and the caller waits for it
+		// in Batch.SyncWait.
+		b.commitStats.TotalDuration = time.Since(commitStartTime)
+		p.applyPipelined(b, mem)
+		return nil
+	}
+
 	// Apply the batch to the memtable.
-	if err := p.env.apply(b, mem); err != nil {
+	err = p.env.apply(b, mem)
+	p.unapplied.Add(-1)
+	if err != nil {
 		b.db = nil // prevent batch reuse on error
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
 		// sitting in the pending queue. We should consider fixing this by also
@@ -352,6 +428,138 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	return err
 }
 
+// commitUnordered commits a batch in the unordered mode. See commitMode.
+func (p *commitPipeline) commitUnordered(b *Batch, syncWAL bool, noSyncWait bool) error {
+	n := uint64(b.Count())
+	if n == invalidBatchCount {
+		return ErrInvalidBatch
+	}
+
+	// The batch is not added to the pending queue, so the commitQueueSem is
+	// not needed.
+	commitStartTime := time.Now()
+	var syncWG *sync.WaitGroup
+	var syncErr *error
+	if syncWAL {
+		p.logSyncQSem <- struct{}{}
+		syncErr = &b.commitErr
+		syncWG = &b.commit
+		if noSyncWait {
+			syncWG = &b.fsyncWait
+		}
+		syncWG.Add(1)
+	}
+	b.commitStats.SemaphoreWaitDuration = time.Since(commitStartTime)
+
+	if err := p.writeAndApplyUnordered(b, syncWG, syncErr); err != nil {
+		b.db = nil // prevent batch reuse on error
+		return err
+	}
+	b.applied.Store(true)
+
+	// Make the batch visible, along with any earlier batch that is still being
+	// applied.
+	for {
+		curSeqNum := p.env.visibleSeqNum.Load()
+		newSeqNum := b.SeqNum() + n
+		if newSeqNum <= curSeqNum || p.env.visibleSeqNum.CompareAndSwap(curSeqNum, newSeqNum) {
+			break
+		}
+	}
+
+	if syncWAL && !noSyncWait {
+		now := time.Now()
+		b.commit.Wait()
+		b.commitStats.CommitWaitDuration += time.Since(now)
+		if b.commitErr != nil {
+			b.db = nil // prevent batch reuse on error
+			return b.commitErr
+		}
+	}
+	b.commitStats.TotalDuration = time.Since(commitStartTime)
+	return nil
+}
+
+// writeAndApplyUnordered assigns a sequence number to an unordered batch,
+// writes it to the WAL and applies it to the memtable.
+func (p *commitPipeline) writeAndApplyUnordered(
+	b *Batch, syncWG *sync.WaitGroup, syncErr *error,
+) error {
+	n := uint64(b.Count())
+	p.mu.Lock()
+	// The batch holds back AllocateSeqNum until it is applied, or fails.
+	p.unapplied.Add(1)
+	defer p.unapplied.Add(-1)
+	b.setSeqNum(p.env.logSeqNum.Add(n) - n)
+	mem, err := p.env.write(b, syncWG, syncErr)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return p.env.apply(b, mem)
+}
+
+// pipelinedBatch is a batch in the apply stage, along with the memtable it is
+// applied to.
+type pipelinedBatch struct {
+	b   *Batch
+	mem *memTable
+}
+
+// applyPipelined hands a pipelined batch, which is written to the WAL, to the
+// apply stage. The batch is applied to the memtable and published in the
+// background, which lets the caller write its next batches to the WAL in the
+// meantime.
+func (p *commitPipeline) applyPipelined(b *Batch, mem *memTable) {
+	p.applyStage.Lock()
+	p.applyStage.queue = append(p.applyStage.queue, pipelinedBatch{b: b, mem: mem})
+	if p.applyStage.running {
+		p.applyStage.Unlock()
+		return
+	}
+	p.applyStage.running = true
+	p.applyStage.Unlock()
+	go p.runApplyStage()
+}
+
+// runApplyStage applies the batches of the apply stage, until the queue is
+// empty.
+func (p *commitPipeline) runApplyStage() {
+	for {
+		p.applyStage.Lock()
+		if len(p.applyStage.queue) == 0 {
+			p.applyStage.running = false
+			p.applyStage.cond.Broadcast()
+			p.applyStage.Unlock()
+			return
+		}
+		pb := p.applyStage.queue[0]
+		p.applyStage.queue[0] = pipelinedBatch{}
+		p.applyStage.queue = p.applyStage.queue[1:]
+		p.applyStage.Unlock()
+
+		if err := p.env.apply(pb.b, pb.mem); err != nil {
+			// The batch is published anyway, so that the later batches are not
+			// blocked behind it. The error is returned by Batch.SyncWait.
+			pb.b.applyErr = err
+		}
+		p.unapplied.Add(-1)
+		p.publish(pb.b)
+	}
+}
+
+// waitApplyStage waits until the apply stage has applied and published all
+// the pipelined batches handed to it. It must be called before the memtables
+// and the WAL are released, since the apply stage may still be applying
+// batches whose caller never called Batch.SyncWait.
+func (p *commitPipeline) waitApplyStage() {
+	p.applyStage.Lock()
+	defer p.applyStage.Unlock()
+	for p.applyStage.running {
+		p.applyStage.cond.Wait()
+	}
+}
+
 // AllocateSeqNum allocates count sequence numbers, invokes the prepare
 // callback, then the apply callback, and then publishes the sequence
 // numbers. AllocateSeqNum does not write to the WAL or add entries to the
@@ -400,10 +608,12 @@ func (p *commitPipeline) AllocateSeqNum(
 	// Wait for any outstanding writes to the memtable to complete. This is
 	// necessary for ingestion so that the check for memtable overlap can see any
 	// writes that were sequenced before the ingestion. The spin loop is
-	// unfortunate, but obviates the need for additional synchronization.
+	// unfortunate, but obviates the need for additional synchronization. Note
+	// that unordered commits can publish a sequence number before the earlier
+	// batches are applied, hence the check of unapplied.
 	for {
 		visibleSeqNum := p.env.visibleSeqNum.Load()
-		if visibleSeqNum == logSeqNum {
+		if visibleSeqNum == logSeqNum && p.unapplied.Load() == 0 {
 			break
 		}
 		runtime.Gosched()
@@ -430,6 +640,34 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	if n == invalidBatchCount {
 		return nil, ErrInvalidBatch
 	}
+
+	// The conditions are read before acquiring p.mu, so that the reads, which
+	// may require I/O, don't block the concurrent commits.
+	var recheckConditions func() error
+	if b.hasConditions {
+		recheckConditions = p.env.checkConditions(b)
+	}
+
+	p.mu.Lock()
+
+	if b.hasConditions {
+		// The conditions are evaluated against the state at the batch sequence
+		// number, so wait for the earlier batches to be applied and published,
+		// as in AllocateSeqNum. The batch fails before it is enqueued if any
+		// of them doesn't hold.
+		for {
+			if p.env.visibleSeqNum.Load() == p.env.logSeqNum.Load() && p.unapplied.Load() == 0 {
+				break
+			}
+			runtime.Gosched()
+		}
+		if err := recheckConditions(); err != nil {
+			b.conditionFailed = true
+			p.mu.Unlock()
+			return nil, err
+		}
+	}
+
 	var syncWG *sync.WaitGroup
 	var syncErr *error
 	switch {
@@ -451,12 +689,11 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 		b.commit.Add(2)
 	}
 
-	p.mu.Lock()
-
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
 	// number order.
 	p.pending.enqueue(b)
+	p.unapplied.Add(1)
 
 	// Assign the batch a sequence number. Note that we use atomic operations
 	// here to handle concurrent reads of logSeqNum. commitPipeline.mu provides
@@ -472,6 +709,10 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 }
 
 func (p *commitPipeline) publish(b *Batch) {
+	// Read the mode before the batch can be published by another goroutine: a
+	// pipelined batch can be closed as soon as it is published.
+	pipelined := b.commitMode == commitPipelined
+
 	// Mark the batch as applied.
 	b.applied.Store(true)
 
@@ -485,6 +726,10 @@ func (p *commitPipeline) publish(b *Batch) {
 	for {
 		t := p.pending.dequeueApplied()
 		if t == nil {
+			if pipelined {
+				// Another goroutine will publish us.
+				break
+			}
 			// Wait for another goroutine to publish us. We might also be waiting for
 			// the WAL sync to finish.
 			now := time.Now()
@@ -513,6 +758,9 @@ func (p *commitPipeline) publish(b *Batch) {
 			}
 		}
 
+		if t.commitMode == commitPipelined {
+			<-p.commitQueueSem
+		}
 		t.commit.Done()
 	}
 }
@@ -8,11 +8,13 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invariants"
@@ -208,6 +210,345 @@ func TestCommitPipelineAllocateSeqNum(t *testing.T) {
 	}
 }
 
+func TestCommitPipelineModes(t *testing.T) {
+	n := 10000
+	if invariants.RaceEnabled {
+		// Under race builds we have to limit the concurrency or we hit the
+		// following error:
+		//
+		//   race: limit on 8128 simultaneously alive goroutines is exceeded, dying
+		n = 1000
+	}
+
+	for _, mode := range []commitMode{commitPipelined, commitUnordered} {
+		for _, syncWAL := range []bool{false, true} {
+			t.Run(fmt.Sprintf("mode=%d/sync=%t", mode, syncWAL), func(t *testing.T) {
+				var e testCommitEnv
+				p := newCommitPipeline(e.env())
+				e.queueSemChan = p.logSyncQSem
+
+				var wg sync.WaitGroup
+				wg.Add(n)
+				for i := 0; i < n; i++ {
+					go func(i int) {
+						defer wg.Done()
+						var b Batch
+						b.commitMode = mode
+						require.NoError(t, b.Set([]byte(fmt.Sprint(i)), nil, nil))
+						require.NoError(t, p.Commit(&b, syncWAL, true /* noSyncWait */))
+						if mode == commitUnordered {
+							// An unordered batch is visible once committed.
+							require.Less(t, b.SeqNum(), e.visibleSeqNum.Load())
+						}
+						require.NoError(t, b.SyncWait())
+						require.Less(t, b.SeqNum(), e.visibleSeqNum.Load())
+					}(i)
+				}
+				wg.Wait()
+				require.Equal(t, uint64(n), e.writeCount.Load())
+				require.Len(t, e.applyBuf.buf, n)
+				require.Equal(t, uint64(n), e.logSeqNum.Load())
+				require.Equal(t, uint64(n), e.visibleSeqNum.Load())
+				require.Zero(t, p.unapplied.Load())
+				// All the commitQueueSem slots were released.
+				require.Zero(t, len(p.commitQueueSem))
+			})
+		}
+	}
+}
+
+// TestCommitPipelineModesVisibility checks the visibility of pipelined and
+// unordered batches committed while an earlier batch is being applied.
+func TestCommitPipelineModesVisibility(t *testing.T) {
+	for _, mode := range []commitMode{commitPipelined, commitUnordered} {
+		t.Run(fmt.Sprintf("mode=%d", mode), func(t *testing.T) {
+			applying, unblock := make(chan struct{}), make(chan struct{})
+			var visibleSeqNum atomic.Uint64
+			p := newCommitPipeline(commitEnv{
+				logSeqNum:     new(atomic.Uint64),
+				visibleSeqNum: &visibleSeqNum,
+				apply: func(b *Batch, mem *memTable) error {
+					if b.SeqNum() == 0 {
+						// Block the application of the first batch.
+						close(applying)
+						<-unblock
+					}
+					return nil
+				},
+				write: func(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*memTable, error) {
+					return nil, nil
+				},
+			})
+
+			first := make(chan error, 1)
+			go func() {
+				b := &Batch{}
+				require.NoError(t, b.Set([]byte("a"), nil, nil))
+				first <- p.Commit(b, false /* sync */, false)
+			}()
+			<-applying
+
+			b := &Batch{}
+			b.commitMode = mode
+			require.NoError(t, b.Set([]byte("b"), nil, nil))
+			require.NoError(t, p.Commit(b, false /* sync */, true))
+			require.Equal(t, uint64(1), b.SeqNum())
+			allocated := make(chan struct{})
+			go func() {
+				p.AllocateSeqNum(1, func(uint64) {}, func(uint64) {})
+				close(allocated)
+			}()
+			switch mode {
+			case commitPipelined:
+				// The batch is not published before the first one.
+				require.Zero(t, visibleSeqNum.Load())
+			case commitUnordered:
+				// The batch is published, along with the first one.
+				require.Equal(t, uint64(2), visibleSeqNum.Load())
+			}
+			// The sequence numbers are not allocated until the first batch is
+			// applied.
+			time.Sleep(10 * time.Millisecond)
+			select {
+			case <-allocated:
+				t.Fatal("sequence numbers allocated before the first batch was applied")
+			default:
+			}
+
+			close(unblock)
+			require.NoError(t, <-first)
+			require.NoError(t, b.SyncWait())
+			<-allocated
+			require.Equal(t, uint64(3), visibleSeqNum.Load())
+		})
+	}
+}
+
+// TestCommitPipelinePipelinedApplyError checks that the error of the
+// application of a pipelined batch is returned by Batch.SyncWait, and doesn't
+// block the later batches.
+func TestCommitPipelinePipelinedApplyError(t *testing.T) {
+	var visibleSeqNum atomic.Uint64
+	p := newCommitPipeline(commitEnv{
+		logSeqNum:     new(atomic.Uint64),
+		visibleSeqNum: &visibleSeqNum,
+		apply: func(b *Batch, mem *memTable) error {
+			if b.SeqNum() == 0 {
+				return errors.New("injected error")
+			}
+			return nil
+		},
+		write: func(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*memTable, error) {
+			return nil, nil
+		},
+	})
+	b := &Batch{}
+	b.commitMode = commitPipelined
+	require.NoError(t, b.Set([]byte("a"), nil, nil))
+	require.NoError(t, p.Commit(b, false /* sync */, true /* noSyncWait */))
+
+	b2 := &Batch{}
+	require.NoError(t, b2.Set([]byte("b"), nil, nil))
+	require.NoError(t, p.Commit(b2, false /* sync */, false /* noSyncWait */))
+	require.EqualError(t, b.SyncWait(), "injected error")
+	require.Equal(t, uint64(2), visibleSeqNum.Load())
+	require.Zero(t, p.unapplied.Load())
+}
+
+func TestCommitPipelinePipelinedClose(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+
+	// The batches are closed without waiting for them to be applied: Close
+	// must wait for the apply stage before releasing the memtables.
+	const numBatches = 100
+	batches := make([]*Batch, numBatches)
+	for i := range batches {
+		b := d.NewBatch()
+		for j := 0; j < 100; j++ {
+			require.NoError(t, b.Set([]byte(fmt.Sprintf("%03d-%03d", i, j)), []byte("value"), nil))
+		}
+		require.NoError(t, d.ApplyNoSyncWait(b, &WriteOptions{Pipelined: true}))
+		batches[i] = b
+	}
+	require.NoError(t, d.Close())
+	require.False(t, d.commit.applyStage.running)
+	require.Empty(t, d.commit.applyStage.queue)
+	for _, b := range batches {
+		require.True(t, b.applied.Load())
+		require.NoError(t, b.applyErr)
+	}
+
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var n int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		n++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, numBatches*100, n)
+	require.NoError(t, d.Close())
+}
+
+// BenchmarkCommitPipelinePipelined measures the overlap of the WAL writes and
+// the memtable applications of the batches of a single writer: in the
+// pipelined mode, the writer writes its next batches to the WAL while the
+// earlier batches are applied, instead of waiting for each of them. The WAL
+// write and the application of a batch each take delay, so the pipelined mode
+// takes about half the time per batch.
+func BenchmarkCommitPipelinePipelined(b *testing.B) {
+	if runtime.GOMAXPROCS(0) < 2 {
+		b.Skip("the WAL writes and the applications can't overlap on a single CPU")
+	}
+	const delay = 20 * time.Microsecond
+	spin := func() {
+		for start := time.Now(); time.Since(start) < delay; {
+		}
+	}
+	for _, mode := range []commitMode{commitOrdered, commitPipelined} {
+		b.Run(fmt.Sprintf("mode=%d", mode), func(b *testing.B) {
+			p := newCommitPipeline(commitEnv{
+				logSeqNum:     new(atomic.Uint64),
+				visibleSeqNum: new(atomic.Uint64),
+				apply: func(*Batch, *memTable) error {
+					spin()
+					return nil
+				},
+				write: func(*Batch, *sync.WaitGroup, *error) (*memTable, error) {
+					spin()
+					return nil, nil
+				},
+			})
+			// The writer waits for its oldest batch once the number of batches in
+			// flight reaches the capacity of the commit queue.
+			var inFlight []*Batch
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				batch := &Batch{}
+				batch.commitMode = mode
+				if err := batch.Set([]byte("a"), nil, nil); err != nil {
+					b.Fatal(err)
+				}
+				if err := p.Commit(batch, false /* sync */, true /* noSyncWait */); err != nil {
+					b.Fatal(err)
+				}
+				inFlight = append(inFlight, batch)
+				if len(inFlight) == cap(p.commitQueueSem) {
+					if err := inFlight[0].SyncWait(); err != nil {
+						b.Fatal(err)
+					}
+					inFlight = inFlight[1:]
+				}
+			}
+			for _, batch := range inFlight {
+				if err := batch.SyncWait(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyCommitModes(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// A pipelined apply doesn't require Sync, and the batch is visible once
+	// SyncWait returns.
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.ApplyNoSyncWait(b, &WriteOptions{Pipelined: true}))
+	require.NoError(t, b.SyncWait())
+	require.NoError(t, b.Close())
+	require.Error(t, d.ApplyNoSyncWait(d.NewBatch(), NoSync))
+
+	// An unordered batch is visible once applied.
+	for _, opts := range []*WriteOptions{{Unordered: true}, {Sync: true, Unordered: true}} {
+		require.NoError(t, d.Set([]byte("b"), []byte(fmt.Sprint(opts.Sync)), opts))
+		v, closer, err := d.Get([]byte("b"))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprint(opts.Sync), string(v))
+		require.NoError(t, closer.Close())
+	}
+	v, closer, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, "1", string(v))
+	require.NoError(t, closer.Close())
+}
+
+func TestApplyDurability(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+
+	// Batches of all the durability levels can be mixed in the same WAL, and
+	// are all visible once applied.
+	opts := map[string]*WriteOptions{
+		"none":        {Durability: DurabilityNone},
+		"buffered":    {Durability: DurabilityBuffered},
+		"sync":        {Durability: DurabilitySync},
+		"sync-within": {Durability: DurabilitySyncWithin, SyncWithin: 10 * time.Millisecond},
+		"default":     NoSync,
+	}
+	for _, k := range []string{"none", "buffered", "sync", "sync-within", "default"} {
+		bytesIn := d.Metrics().WAL.BytesIn
+		require.NoError(t, d.Set([]byte(k), []byte(k), opts[k]))
+		if k == "none" {
+			require.Equal(t, bytesIn, d.Metrics().WAL.BytesIn)
+		} else {
+			require.Less(t, bytesIn, d.Metrics().WAL.BytesIn)
+		}
+		v, closer, err := d.Get([]byte(k))
+		require.NoError(t, err)
+		require.Equal(t, k, string(v))
+		require.NoError(t, closer.Close())
+	}
+	require.Error(t, d.Set([]byte("a"), nil, &WriteOptions{Durability: DurabilitySyncWithin}))
+	require.Error(t, d.ApplyNoSyncWait(d.NewBatch(), &WriteOptions{Durability: DurabilityBuffered}))
+	require.NoError(t, d.Close())
+
+	// The batch that skipped the WAL is lost since the memtable was not
+	// flushed, but the WAL replay recovers the batches that follow it.
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	for _, k := range []string{"none", "buffered", "sync", "sync-within", "default"} {
+		v, closer, err := d.Get([]byte(k))
+		if k == "none" {
+			require.ErrorIs(t, err, ErrNotFound)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, k, string(v))
+		require.NoError(t, closer.Close())
+	}
+
+	// A flushed batch survives even if it skipped the WAL.
+	require.NoError(t, d.Set([]byte("none"), []byte("flushed"), opts["none"]))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	v, closer, err := d.Get([]byte("none"))
+	require.NoError(t, err)
+	require.Equal(t, "flushed", string(v))
+	require.NoError(t, closer.Close())
+	require.NoError(t, d.Close())
+
+	// With the WAL disabled, only the levels that don't need the WAL to be
+	// synced are allowed.
+	d, err = Open("", &Options{FS: vfs.NewMem(), DisableWAL: true})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), nil, opts["none"]))
+	require.NoError(t, d.Set([]byte("a"), nil, opts["buffered"]))
+	require.Error(t, d.Set([]byte("a"), nil, opts["sync"]))
+	require.Error(t, d.Set([]byte("a"), nil, opts["sync-within"]))
+	require.NoError(t, d.Close())
+}
+
 type syncDelayFile struct {
 	vfs.File
 	done chan struct{}
@@ -1233,6 +1233,10 @@ func (d *DB) clearCompactingState(c *compaction, rollback bool) {
 }
 
 func (d *DB) calculateDiskAvailableBytes() uint64 {
+	if d.diskQuota != nil {
+		// The available space changed, or is about to change.
+		d.diskQuota.signal()
+	}
 	if space, err := d.opts.FS.GetDiskUsage(d.dirname); err == nil {
 		d.diskAvailBytes.Store(space.AvailBytes)
 		return space.AvailBytes
@@ -1734,6 +1738,7 @@ func (d *DB) flush1() (bytesFlushed uint64, err error) {
 	if err == nil {
 		flushed = d.mu.mem.queue[:n]
 		d.mu.mem.queue = d.mu.mem.queue[n:]
+		d.durable.ratchet(d.getEarliestUnflushedSeqNumLocked())
 		d.updateReadStateLocked(d.opts.DebugCheck)
 		d.updateTableStatsLocked(ve.NewFiles)
 		if ingest {
@@ -1919,6 +1924,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 		earliestUnflushedSeqNum: d.getEarliestUnflushedSeqNumLocked(),
 	}
 
+	quotaExceeded := d.diskQuota != nil && d.diskQuota.exceeded.Load()
 	if d.mu.compact.compactingCount < maxCompactions {
 		// Check for delete-only compactions first, because they're expected to be
 		// cheap and reduce future compaction work.
@@ -1928,6 +1934,15 @@ func (d *DB) maybeScheduleCompactionPicker(
 			d.tryScheduleDeleteOnlyCompaction()
 		}
 
+		if quotaExceeded {
+			// Only run the compactions that reclaim space until the quota is no
+			// longer exceeded; manual compactions and downloads wait.
+			for !d.opts.DisableAutomaticCompactions && d.mu.compact.compactingCount < maxCompactions &&
+				d.tryScheduleAutoCompaction(env, pickElisionOnly) {
+			}
+			return
+		}
+
 		for len(d.mu.compact.manual) > 0 && d.mu.compact.compactingCount < maxCompactions {
 			if manual := d.mu.compact.manual[0]; !d.tryScheduleManualCompaction(env, manual) {
 				// Inability to run head blocks later manual compactions.
@@ -1942,7 +1957,7 @@ func (d *DB) maybeScheduleCompactionPicker(
 		}
 	}
 
-	for len(d.mu.compact.downloads) > 0 && d.mu.compact.downloadingCount < maxDownloads &&
+	for !quotaExceeded && len(d.mu.compact.downloads) > 0 && d.mu.compact.downloadingCount < maxDownloads &&
 		d.tryScheduleDownloadCompaction(env, maxDownloads) {
 	}
 }
@@ -6,9 +6,11 @@
 package pebble // import "github.com/cockroachdb/pebble"
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -54,6 +56,10 @@ var (
 	// ErrReadOnly is returned when a write operation is performed on a read-only
 	// database.
 	ErrReadOnly = errors.New("pebble: read-only")
+	// ErrConditionFailed is returned when a batch is not committed because one
+	// of its conditions doesn't hold (see Batch.SetIfAbsent). Use
+	// errors.Is(err, ErrConditionFailed) to check for this error.
+	ErrConditionFailed = errors.New("pebble: batch condition failed")
 	// errNoSplit indicates that the user is trying to perform a range key
 	// operation but the configured Comparer does not provide a Split
 	// implementation.
@@ -315,6 +321,23 @@ type DB struct {
 
 	cleanupManager *cleanupManager
 
+	// replica is set if the DB was opened with OpenReplica.
+	replica *replicaState
+
+	// blockCacheWarmup is set if the block cache warm-up is enabled. See
+	// BlockCacheWarmupOptions.
+	blockCacheWarmup *blockCacheWarmup
+
+	// diskQuota is set if a disk quota is configured. See DiskQuotaOptions.
+	diskQuota *diskQuota
+
+	// durable tracks the durable sequence number. See DB.DurableSeqNum.
+	durable durableTracker
+
+	// prepared tracks the batches prepared by CommitAtomic which are not yet
+	// committed or aborted.
+	prepared preparedBatches
+
 	// During an iterator close, we may asynchronously schedule read compactions.
 	// We want to wait for those goroutines to finish, before closing the DB.
 	// compactionShedulers.Wait() should not be called while the DB.mu is held.
@@ -522,6 +545,95 @@ func (d *DB) Get(key []byte) ([]byte, io.Closer, error) {
 	return d.getInternal(key, nil /* batch */, nil /* snapshot */)
 }
 
+// MultiGet looks up the given keys, like Get, and calls fn with the index and
+// the value of each key, in order, or with ErrNotFound if the DB does not
+// contain the key. The keys are looked up in the same snapshot of the DB. The
+// value is only valid until fn returns; an error returned by fn stops MultiGet
+// and is returned.
+//
+// Before the lookups, the reads of the data blocks that may contain the keys
+// are submitted at once, for all the sstables, and executed in parallel (see
+// sstable.Reader.PrefetchKeys): unlike a sequence of calls to Get, the lookups
+// don't wait for the reads of the blocks one at a time.
+func (d *DB) MultiGet(keys [][]byte, fn func(i int, value []byte, err error) error) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	s := d.NewSnapshot()
+	defer s.Close()
+	// An error is ignored: the lookups read the blocks again, and return the
+	// error.
+	_ = d.prefetchKeys(context.Background(), keys)
+	for i, key := range keys {
+		value, closer, err := d.getInternal(key, nil /* batch */, s)
+		err = fn(i, value, err)
+		if closer != nil {
+			err = firstError(err, closer.Close())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefetchKeys reads the data blocks of the sstables of the current version
+// which may contain the given keys into the block cache, in parallel.
+func (d *DB) prefetchKeys(ctx context.Context, keys [][]byte) error {
+	readState := d.loadReadState()
+	defer readState.unref()
+	current := readState.current
+
+	sorted := slices.Clone(keys)
+	slices.SortFunc(sorted, d.cmp)
+	// tableKeys are the keys that each table may contain, in order.
+	tableKeys := make(map[*fileBacking][][]byte)
+	var backings []*fileBacking
+	addFile := func(f *fileMetadata, key []byte) {
+		if f == nil || d.cmp(f.SmallestPointKey.UserKey, key) > 0 {
+			return
+		}
+		if _, ok := tableKeys[f.FileBacking]; !ok {
+			backings = append(backings, f.FileBacking)
+		}
+		tableKeys[f.FileBacking] = append(tableKeys[f.FileBacking], key)
+	}
+	for _, key := range sorted {
+		for _, ls := range current.L0SublevelFiles {
+			iter := ls.Iter()
+			iter = iter.Filter(manifest.KeyTypePoint)
+			addFile(iter.SeekGE(d.cmp, key), key)
+		}
+		for level := 1; level < numLevels; level++ {
+			iter := current.Levels[level].Iter()
+			iter = iter.Filter(manifest.KeyTypePoint)
+			addFile(iter.SeekGE(d.cmp, key), key)
+		}
+	}
+	if len(backings) == 0 {
+		return nil
+	}
+
+	// The reads of all the tables are started before waiting for any of them.
+	return d.tableCache.withReaders(backings, func(readers []*sstable.Reader) error {
+		var err error
+		waits := make([]func() (int, uint64, error), 0, len(readers))
+		for i, r := range readers {
+			wait, prefetchErr := r.PrefetchKeys(ctx, tableKeys[backings[i]])
+			if prefetchErr != nil {
+				err = firstError(err, prefetchErr)
+				continue
+			}
+			waits = append(waits, wait)
+		}
+		for _, wait := range waits {
+			_, _, waitErr := wait()
+			err = firstError(err, waitErr)
+		}
+		return err
+	})
+}
+
 type getIterAlloc struct {
 	dbi    Iterator
 	keyBuf []byte
@@ -542,7 +654,13 @@ func (d *DB) getInternal(key []byte, b *Batch, s *Snapshot) ([]byte, io.Closer,
 	// Grab and reference the current readState. This prevents the underlying
 	// files in the associated version from being deleted if there is a current
 	// compaction. The readState is unref'd by Iterator.Close().
-	readState := d.loadReadState()
+	var readState *readState
+	if s != nil && s.readState != nil {
+		readState = s.readState
+		readState.ref()
+	} else {
+		readState = d.loadReadState()
+	}
 
 	// Determine the seqnum to read at after grabbing the read state (current and
 	// memtables) above.
@@ -784,7 +902,7 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 	return d.applyInternal(batch, opts, false)
 }
 
-// ApplyNoSyncWait must only be used when opts.Sync is true and the caller
+// ApplyNoSyncWait must only be used when opts.GetSync() is true and the caller
 // does not want to wait for the WAL fsync to happen. The method will return
 // once the mutation is applied to the memtable and is visible (note that a
 // mutation is visible before the WAL sync even in the wait case, so we have
@@ -792,18 +910,22 @@ func (d *DB) Apply(batch *Batch, opts *WriteOptions) error {
 // to wait for the WAL fsync. The caller must not Close the batch without
 // first calling Batch.SyncWait.
 //
+// If opts.Pipelined is set, the method returns before the mutation is
+// visible, and Batch.SyncWait also waits for it to be visible. opts.Sync may
+// be false in this case. See WriteOptions.Pipelined.
+//
 // RECOMMENDATION: Prefer using Apply unless you really understand why you
 // need ApplyNoSyncWait.
 // EXPERIMENTAL: API/feature subject to change. Do not yet use outside
 // CockroachDB.
 func (d *DB) ApplyNoSyncWait(batch *Batch, opts *WriteOptions) error {
-	if !opts.Sync {
+	if !opts.GetSync() && !opts.Pipelined {
 		return errors.Errorf("cannot request asynchonous apply when WriteOptions.Sync is false")
 	}
 	return d.applyInternal(batch, opts, true)
 }
 
-// REQUIRES: noSyncWait => opts.Sync
+// REQUIRES: noSyncWait => opts.GetSync() || opts.Pipelined
 func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) error {
 	if err := d.closed.Load(); err != nil {
 		panic(err)
@@ -817,14 +939,27 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 	if d.opts.ReadOnly {
 		return ErrReadOnly
 	}
+	if d.diskQuota != nil && d.diskQuota.exceeded.Load() && !batch.onlyDeletions() {
+		return d.diskQuota.rejectWrite()
+	}
 	if batch.db != nil && batch.db != d {
 		panic(fmt.Sprintf("pebble: batch db mismatch: %p != %p", batch.db, d))
 	}
 
-	sync := opts.GetSync()
-	if sync && d.opts.DisableWAL {
+	durability := opts.GetDurability()
+	switch durability {
+	case DurabilityNone, DurabilityBuffered, DurabilitySync:
+	case DurabilitySyncWithin:
+		if opts.SyncWithin <= 0 {
+			return errors.Errorf("pebble: WriteOptions.SyncWithin must be positive for %s durability", durability)
+		}
+	default:
+		return errors.Errorf("pebble: unknown durability %s", durability)
+	}
+	if (durability == DurabilitySync || durability == DurabilitySyncWithin) && d.opts.DisableWAL {
 		return errors.New("pebble: WAL disabled")
 	}
+	sync := durability == DurabilitySync
 
 	if fmv := d.FormatMajorVersion(); fmv < batch.minimumFormatMajorVersion {
 		panic(fmt.Sprintf(
@@ -839,6 +974,21 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 		}
 	}
 	batch.committing = true
+	batch.durability = durability
+	batch.syncWithin = 0
+	if durability == DurabilitySyncWithin {
+		batch.syncWithin = opts.SyncWithin
+	}
+	batch.commitMode = commitOrdered
+	switch {
+	case opts != nil && opts.Unordered && batch.hasConditions:
+		batch.committing = false
+		return errors.New("pebble: batch conditions require an ordered commit")
+	case opts != nil && opts.Unordered:
+		batch.commitMode = commitUnordered
+	case opts != nil && opts.Pipelined && noSyncWait:
+		batch.commitMode = commitPipelined
+	}
 
 	if batch.db == nil {
 		if err := batch.refreshMemTableSize(); err != nil {
@@ -853,6 +1003,14 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 		}
 	}
 	if err := d.commit.Commit(batch, sync, noSyncWait); err != nil {
+		if batch.conditionFailed {
+			// The batch was rejected before it was written to the WAL, so the
+			// commit pipeline is still usable, and so is the batch.
+			batch.committing = false
+			batch.conditionFailed = false
+			batch.flushable = nil
+			return err
+		}
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
@@ -870,6 +1028,150 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 	return nil
 }
 
+// checkConditions evaluates the conditions of the batch against the current
+// state of the DB, without holding the commit pipeline, and returns the
+// function which checks, with the commit pipeline held, that the outcome still
+// holds. See commitEnv.checkConditions.
+//
+// The conditions are read from a pinned readState, including the memtable
+// entries of the batches which are applied but not yet visible: once the
+// commit pipeline is held, all of them are visible. Only the memtables can
+// change while the readState is current, so the outcome still holds if the
+// readState is still current and the newest memtable entries of the condition
+// keys are unchanged. Otherwise, the conditions are read again with the commit
+// pipeline held, which blocks all the concurrent commits.
+func (d *DB) checkConditions(b *Batch) (recheck func() error) {
+	rs := d.loadReadState()
+	// The newest entries are recorded before the conditions are read, so that
+	// an entry added in between is detected by the recheck.
+	newest, ok := d.newestConditionEntries(b, rs)
+	var err error
+	if ok {
+		err = d.evalConditions(b, &Snapshot{db: d, seqNum: InternalKeySeqNumMax, readState: rs})
+	}
+	return func() error {
+		defer rs.unref()
+		if ok {
+			d.readState.RLock()
+			current := d.readState.val == rs
+			d.readState.RUnlock()
+			if current {
+				if recheck, ok := d.newestConditionEntries(b, rs); ok && slices.Equal(newest, recheck) {
+					return err
+				}
+			}
+		}
+		return d.evalConditions(b, d)
+	}
+}
+
+// conditionEntry describes the newest memtable entries of a condition key: the
+// sequence numbers of the newest point key and of the newest range deletion
+// covering the key.
+type conditionEntry struct {
+	pointSeqNum    uint64
+	rangeDelSeqNum uint64
+}
+
+// newestConditionEntries returns the newest memtable entries of each of the
+// condition keys of the batch. It returns false if an entry added to a
+// memtable later, with a lower sequence number, could change the outcome of a
+// condition, i.e. if the newest point key of a condition key is a merge.
+func (d *DB) newestConditionEntries(b *Batch, rs *readState) ([]conditionEntry, bool) {
+	var res []conditionEntry
+	br := b.Reader()
+	for {
+		kind, ukey, _, ok, err := br.Next()
+		if err != nil {
+			return nil, false
+		}
+		if !ok {
+			return res, true
+		}
+		switch kind {
+		case InternalKeyKindAssertAbsent, InternalKeyKindAssertExists, InternalKeyKindAssertValue:
+		default:
+			continue
+		}
+		var e conditionEntry
+		for _, fe := range rs.memtables {
+			// The other flushables are never written to once they are part of
+			// a readState.
+			m, ok := fe.flushable.(*memTable)
+			if !ok {
+				continue
+			}
+			iter := m.skl.NewIter(nil, nil)
+			if kv := iter.SeekGE(ukey, base.SeekGEFlagsNone); kv != nil && d.equal(kv.K.UserKey, ukey) {
+				if kv.Kind() == InternalKeyKindMerge {
+					_ = iter.Close()
+					return nil, false
+				}
+				e.pointSeqNum = max(e.pointSeqNum, kv.SeqNum())
+			}
+			if err := iter.Close(); err != nil {
+				return nil, false
+			}
+			if rangeDelIter := m.newRangeDelIter(nil); rangeDelIter != nil {
+				span, err := rangeDelIter.SeekGE(ukey)
+				if err != nil {
+					_ = rangeDelIter.Close()
+					return nil, false
+				}
+				if span != nil && span.Contains(d.cmp, ukey) && !span.Empty() {
+					e.rangeDelSeqNum = max(e.rangeDelSeqNum, span.LargestSeqNum())
+				}
+				if err := rangeDelIter.Close(); err != nil {
+					return nil, false
+				}
+			}
+		}
+		res = append(res, e)
+	}
+}
+
+// evalConditions evaluates the conditions of the batch against the state of
+// the reader. It returns an error wrapping ErrConditionFailed if any of them
+// doesn't hold.
+func (d *DB) evalConditions(b *Batch, r Reader) error {
+	br := b.Reader()
+	for {
+		kind, ukey, value, ok, err := br.Next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		switch kind {
+		case InternalKeyKindAssertAbsent, InternalKeyKindAssertExists, InternalKeyKindAssertValue:
+		default:
+			continue
+		}
+		v, closer, err := r.Get(ukey)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		var holds bool
+		switch kind {
+		case InternalKeyKindAssertAbsent:
+			holds = err == ErrNotFound
+		case InternalKeyKindAssertExists:
+			holds = err == nil
+		case InternalKeyKindAssertValue:
+			holds = err == nil && bytes.Equal(v, value)
+		}
+		if closer != nil {
+			if err := closer.Close(); err != nil {
+				return err
+			}
+		}
+		if !holds {
+			return errors.Wrapf(ErrConditionFailed, "%s(%s)", kind, d.opts.Comparer.FormatKey(ukey))
+		}
+	}
+}
+
 func (d *DB) commitApply(b *Batch, mem *memTable) error {
 	if b.flushable != nil {
 		// This is a large batch which was already added to the immutable queue.
@@ -909,6 +1211,16 @@ func (d *DB) commitApply(b *Batch, mem *memTable) error {
 func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*memTable, error) {
 	var size int64
 	repr := b.Repr()
+	// Batches committed with DurabilityNone are not written to the WAL. Their
+	// sequence numbers are then missing from the WAL, which WAL replay
+	// tolerates.
+	writeWAL := !d.opts.DisableWAL && b.durability != DurabilityNone
+	syncOpts := wal.SyncOptions{
+		Done:       syncWG,
+		Err:        syncErr,
+		SyncWithin: b.syncWithin,
+		Marker:     b.SeqNum() + uint64(b.Count()),
+	}
 
 	if b.flushable != nil {
 		// We have a large batch. Such batches are special in that they don't get
@@ -921,12 +1233,15 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		// Set the sequence number since it was not set to the correct value earlier
 		// (see comment in newFlushableBatch()).
 		b.flushable.setSeqNum(b.SeqNum())
-		if !d.opts.DisableWAL {
+		if writeWAL {
 			var err error
-			size, err = d.mu.log.writer.WriteRecord(repr, wal.SyncOptions{Done: syncWG, Err: syncErr}, b.refData)
+			size, err = d.mu.log.writer.WriteRecord(repr, syncOpts, b.refData)
 			if err != nil {
 				panic(err)
 			}
+			if b.preparedTxnID != nil {
+				d.removePreparedBatch(b.preparedTxnID)
+			}
 		}
 	}
 
@@ -941,7 +1256,7 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		err = d.makeRoomForWrite(b)
 	}
 
-	if err == nil && !d.opts.DisableWAL {
+	if err == nil && writeWAL {
 		d.mu.log.bytesIn += uint64(len(repr))
 	}
 
@@ -956,15 +1271,18 @@ func (d *DB) commitWrite(b *Batch, syncWG *sync.WaitGroup, syncErr *error) (*mem
 		return nil, err
 	}
 
-	if d.opts.DisableWAL {
+	if !writeWAL {
 		return mem, nil
 	}
 
 	if b.flushable == nil {
-		size, err = d.mu.log.writer.WriteRecord(repr, wal.SyncOptions{Done: syncWG, Err: syncErr}, b.refData)
+		size, err = d.mu.log.writer.WriteRecord(repr, syncOpts, b.refData)
 		if err != nil {
 			panic(err)
 		}
+		if b.preparedTxnID != nil {
+			d.removePreparedBatch(b.preparedTxnID)
+		}
 	}
 
 	d.logSize.Store(uint64(size))
@@ -993,6 +1311,9 @@ var iterAllocPool = sync.Pool{
 //   - No snapshot: All fields are zero values.
 //   - Classic snapshot: Only `seqNum` is set. The latest readState will be used
 //     and the specified seqNum will be used as the snapshot seqNum.
+//   - Snapshot of a replica: `seqNum` and `readState` are set. The readState
+//     pinned by the snapshot is used, as the refreshes of the replica don't
+//     preserve the keys visible at seqNum.
 //   - EventuallyFileOnlySnapshot (EFOS) behaving as a classic snapshot. Only
 //     the `seqNum` is set. The latest readState will be used
 //     and the specified seqNum will be used as the snapshot seqNum.
@@ -1565,6 +1886,9 @@ func (d *DB) NewSnapshot() *Snapshot {
 		db:     d,
 		seqNum: d.mu.versions.visibleSeqNum.Load(),
 	}
+	if d.replica != nil {
+		s.readState = d.loadReadState()
+	}
 	d.mu.snapshots.pushBack(s)
 	d.mu.Unlock()
 	return s
@@ -1592,6 +1916,18 @@ func (d *DB) NewEventuallyFileOnlySnapshot(keyRanges []KeyRange) *EventuallyFile
 // or to call Close concurrently with any other DB method. It is not valid
 // to call any of a DB's methods after the DB has been closed.
 func (d *DB) Close() error {
+	// Stop refreshing the replica first, since refreshes acquire d.mu.
+	var replicaErr error
+	if d.replica != nil {
+		replicaErr = d.replica.close()
+	}
+	if d.blockCacheWarmup != nil {
+		replicaErr = firstError(replicaErr, d.blockCacheWarmup.close(d))
+	}
+	if d.diskQuota != nil {
+		d.diskQuota.close()
+	}
+
 	// Lock the commit pipeline for the duration of Close. This prevents a race
 	// with makeRoomForWrite. Rotating the WAL in makeRoomForWrite requires
 	// dropping d.mu several times for I/O. If Close only holds d.mu, an
@@ -1604,6 +1940,9 @@ func (d *DB) Close() error {
 	// during Close.
 	d.commit.mu.Lock()
 	defer d.commit.mu.Unlock()
+	// Wait for the pipelined batches to be applied to the memtables before
+	// they are released. Applying a batch may acquire d.mu.
+	d.commit.waitApplyStage()
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	if err := d.closed.Load(); err != nil {
@@ -1620,7 +1959,12 @@ func (d *DB) Close() error {
 	d.closed.Store(errors.WithStack(ErrClosed))
 	close(d.closedCh)
 
-	defer d.opts.Cache.Unref()
+	defer func() {
+		// Blocks of the closed DB may remain in the shared block cache until
+		// they are evicted; they must not remain protected by the DB's quota.
+		d.opts.Cache.ReleaseID(d.cacheID)
+		d.opts.Cache.Unref()
+	}()
 
 	for d.mu.compact.compactingCount > 0 || d.mu.compact.downloadingCount > 0 || d.mu.compact.flushing {
 		d.mu.compact.cond.Wait()
@@ -1632,7 +1976,7 @@ func (d *DB) Close() error {
 		d.mu.tableValidation.cond.Wait()
 	}
 
-	var err error
+	err := replicaErr
 	if n := len(d.mu.compact.inProgress); n > 0 {
 		err = errors.Errorf("pebble: %d unexpected in-progress compactions", errors.Safe(n))
 	}
@@ -2009,11 +2353,19 @@ func (d *DB) Metrics() *Metrics {
 	d.mu.Unlock()
 
 	metrics.BlockCache = d.opts.Cache.Metrics()
+	metrics.BlockCacheForDB = d.opts.Cache.MetricsForID(d.cacheID)
 	metrics.TableCache, metrics.Filter = d.tableCache.metrics()
 	metrics.TableIters = int64(d.tableCache.iterCount())
 	metrics.CategoryStats = d.tableCache.dbOpts.sstStatsCollector.GetStats()
 
 	metrics.SecondaryCacheMetrics = d.objProvider.Metrics()
+	metrics.RemoteStorage = d.objProvider.RemoteStorageMetrics()
+	if d.diskQuota != nil {
+		d.diskQuota.metrics(metrics)
+	}
+	if d.cleanupManager.walArchiver != nil {
+		d.cleanupManager.walArchiver.metrics(metrics)
+	}
 
 	metrics.Uptime = d.timeNow().Sub(d.openedAt)
 
@@ -2326,6 +2678,23 @@ func (d *DB) walPreallocateSize() int {
 	return int(size)
 }
 
+// walCompression returns the compression to apply to the records of a new
+// WAL. Compressed records can only be written once the format major version
+// is FormatWALCompression, since older versions can't read them.
+func (d *DB) walCompression() record.Compression {
+	if d.FormatMajorVersion() < FormatWALCompression {
+		return record.NoCompression
+	}
+	return d.opts.WALCompression
+}
+
+// walStriped returns whether a new WAL is striped across
+// Options.WALStripeDirs. Striped WALs can only be written once the format
+// major version is FormatWALStriping, since older versions can't read them.
+func (d *DB) walStriped() bool {
+	return d.FormatMajorVersion() >= FormatWALStriping
+}
+
 func (d *DB) newMemTable(logNum base.DiskFileNum, logSeqNum uint64) (*memTable, *flushableEntry) {
 	size := d.mu.mem.nextSize
 	if d.mu.mem.nextSize < d.opts.MemTableSize {
@@ -2544,6 +2913,11 @@ func (d *DB) makeRoomForWrite(b *Batch) error {
 		} else {
 			logSeqNum = d.mu.versions.logSeqNum.Load()
 		}
+		if !d.opts.DisableWAL {
+			// The previous WAL was synced when closed, and it contains all the
+			// batches that precede logSeqNum.
+			d.durable.ratchet(logSeqNum)
+		}
 		d.rotateMemtable(newLogNum, logSeqNum, immMem)
 		force = false
 	}
@@ -2609,6 +2983,9 @@ func (d *DB) recycleWAL() (newLogNum base.DiskFileNum, prevLogSize uint64) {
 	if err != nil {
 		panic(err)
 	}
+	// The previous WALs become obsolete once flushed, so the prepare records
+	// of the batches prepared by CommitAtomic are written again.
+	d.relogPreparedBatches(writer)
 
 	d.mu.Lock()
 	d.mu.log.writer = writer
@@ -2694,6 +3071,18 @@ func (d *DB) SetCreatorID(creatorID uint64) error {
 	return d.objProvider.SetCreatorID(objstorage.CreatorID(creatorID))
 }
 
+// SetBlockCacheQuota sets a soft quota in bytes on the space the DB's blocks
+// occupy in the block cache. While the DB's blocks occupy no more than the
+// quota, they are protected from eviction caused by other DBs sharing the
+// block cache, so that a busy DB cannot evict the working set of the others.
+// A quota of zero, the default, removes the quota. See Cache.SetQuota.
+//
+// The quota may be changed at any time, for example alongside
+// Cache.SetCapacity when memory is rebalanced between DBs.
+func (d *DB) SetBlockCacheQuota(quota int64) {
+	d.opts.Cache.SetQuota(d.cacheID, quota)
+}
+
 // KeyStatistics keeps track of the number of keys that have been pinned by a
 // snapshot as well as counts of the different key kinds in the lsm.
 //
@@ -14,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/vfs/errorfs"
@@ -485,6 +487,58 @@ func TestGetMerge(t *testing.T) {
 	require.NoError(t, d.Close())
 }
 
+func TestMultiGet(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// The keys are spread over a memtable and several sstables of different
+	// levels.
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), []byte(fmt.Sprintf("val%03d", i)), nil))
+		if i%30 == 29 {
+			require.NoError(t, d.Flush())
+		}
+		if i == 59 {
+			require.NoError(t, d.Compact([]byte("key"), []byte("key999"), false /* parallelize */))
+		}
+	}
+	require.NoError(t, d.Delete([]byte("key010"), nil))
+
+	keys := [][]byte{
+		[]byte("key095"), []byte("key000"), []byte("key010"), []byte("a"),
+		[]byte("key045"), []byte("key099"), []byte("z"),
+	}
+	var got []string
+	require.NoError(t, d.MultiGet(keys, func(i int, value []byte, err error) error {
+		if errors.Is(err, ErrNotFound) {
+			got = append(got, fmt.Sprintf("%s: not found", keys[i]))
+			return nil
+		}
+		require.NoError(t, err)
+		got = append(got, fmt.Sprintf("%s: %s", keys[i], value))
+		return nil
+	}))
+	require.Equal(t, []string{
+		"key095: val095", "key000: val000", "key010: not found", "a: not found",
+		"key045: val045", "key099: val099", "z: not found",
+	}, got)
+
+	// An error returned by fn stops MultiGet.
+	n := 0
+	err = d.MultiGet(keys, func(int, []byte, error) error {
+		n++
+		if n == 2 {
+			return errors.New("stop")
+		}
+		return nil
+	})
+	require.EqualError(t, err, "stop")
+	require.Equal(t, 2, n)
+}
+
 func TestMergeOrderSameAfterFlush(t *testing.T) {
 	// Ensure compaction iterator (used by flush) and user iterator process merge
 	// operands in the same order
@@ -920,6 +974,90 @@ func TestCacheEvict(t *testing.T) {
 	}
 }
 
+type transientRemoteError struct{}
+
+func (transientRemoteError) Error() string   { return "transient remote error" }
+func (transientRemoteError) Temporary() bool { return true }
+
+// TestRemoteStorageRetries tests that transient remote storage errors are
+// retried when the storage is wrapped with remote.WithRetries, and that the
+// retries are reflected in the metrics.
+func TestRemoteStorageRetries(t *testing.T) {
+	var reads atomic.Int64
+	storage := remote.WithFaults(remote.NewInMem(), func(op remote.FaultOp, _ string) error {
+		if op == remote.FaultOpReadAt && reads.Add(1)%2 == 0 {
+			return transientRemoteError{}
+		}
+		return nil
+	})
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+		"": remote.WithRetries(storage, remote.RetryOptions{InitialBackoff: time.Microsecond}),
+	})
+	opts.Experimental.CreateOnShared = remote.CreateOnSharedAll
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.SetCreatorID(1))
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%03d", i)), []byte("v"), nil))
+	}
+	require.NoError(t, d.Flush())
+	for i := 0; i < 100; i++ {
+		v, closer, err := d.Get([]byte(fmt.Sprintf("k%03d", i)))
+		require.NoError(t, err)
+		require.Equal(t, "v", string(v))
+		require.NoError(t, closer.Close())
+	}
+	m := d.Metrics().RemoteStorage
+	require.Greater(t, m.Retries, int64(0))
+	require.Zero(t, m.Failures)
+}
+
+func TestSharedCacheMetricsAndQuota(t *testing.T) {
+	cache := NewCache(10 << 20)
+	defer cache.Unref()
+
+	var dbs [2]*DB
+	for i := range dbs {
+		var err error
+		dbs[i], err = Open("", &Options{
+			Cache: cache,
+			FS:    vfs.NewMem(),
+		})
+		require.NoError(t, err)
+		for j := 0; j < 1000*(i+1); j++ {
+			key := []byte(fmt.Sprintf("%04d", j))
+			require.NoError(t, dbs[i].Set(key, key, nil))
+		}
+		require.NoError(t, dbs[i].Flush())
+		iter, _ := dbs[i].NewIter(nil)
+		for iter.First(); iter.Valid(); iter.Next() {
+		}
+		require.NoError(t, iter.Close())
+	}
+	dbs[0].SetBlockCacheQuota(1 << 20)
+
+	// The block cache usage is broken out by DB.
+	m0, m1 := dbs[0].Metrics(), dbs[1].Metrics()
+	require.Equal(t, m0.BlockCache.Size, m1.BlockCache.Size)
+	require.NotZero(t, m0.BlockCacheForDB.Size)
+	require.Greater(t, m1.BlockCacheForDB.Size, m0.BlockCacheForDB.Size)
+	require.Equal(t, m0.BlockCache.Size, m0.BlockCacheForDB.Size+m1.BlockCacheForDB.Size)
+	require.Equal(t, m0.BlockCache.Misses, m0.BlockCacheForDB.Misses+m1.BlockCacheForDB.Misses)
+
+	// Shrinking the cache evicts blocks.
+	cache.SetCapacity(cache.MaxSize() / 2)
+	require.Equal(t, int64(5<<20), cache.MaxSize())
+	require.LessOrEqual(t, cache.Size(), cache.MaxSize())
+
+	for _, d := range dbs {
+		require.NoError(t, d.Close())
+	}
+	require.Zero(t, cache.Size())
+}
+
 func TestFlushEmpty(t *testing.T) {
 	d, err := Open("", testingRandomized(t, &Options{
 		FS: vfs.NewMem(),
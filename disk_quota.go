@@ -0,0 +1,226 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// ErrDiskQuotaExceeded is returned when a write is rejected because the disk
+// quota is exceeded (see DiskQuotaOptions). Use errors.Is(err,
+// ErrDiskQuotaExceeded) to check for this error.
+var ErrDiskQuotaExceeded = errors.New("pebble: disk quota exceeded")
+
+// diskQuota checks the disk quota of a DB in the background. See
+// DiskQuotaOptions.
+type diskQuota struct {
+	opts DiskQuotaOptions
+	// exceeded is true while the quota is exceeded.
+	exceeded atomic.Bool
+	// rejectedWrites is the number of writes rejected with
+	// ErrDiskQuotaExceeded.
+	rejectedWrites atomic.Uint64
+	// signalCh triggers a check of the quota. It has a buffer of one element,
+	// so that a signal is not lost while a check is running.
+	signalCh chan struct{}
+	// checkMu serializes the checks.
+	checkMu sync.Mutex
+	mu      struct {
+		sync.Mutex
+		// info is the result of the last check.
+		info DiskQuotaInfo
+	}
+	// ctx is canceled when the DB is closed.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// startDiskQuota starts checking the disk quota in the background, if it is
+// enabled. The first check happens right away.
+func (d *DB) startDiskQuota() {
+	opts := d.opts.DiskQuota
+	if !opts.enabled() || d.opts.ReadOnly {
+		return
+	}
+	q := &diskQuota{
+		opts:     opts,
+		signalCh: make(chan struct{}, 1),
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	d.diskQuota = q
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		ticker := time.NewTicker(opts.CheckInterval)
+		defer ticker.Stop()
+		d.checkDiskQuota()
+		for {
+			select {
+			case <-q.ctx.Done():
+				return
+			case <-ticker.C:
+			case <-q.signalCh:
+			}
+			d.checkDiskQuota()
+		}
+	}()
+}
+
+// signal triggers a check of the quota, without waiting for it.
+func (q *diskQuota) signal() {
+	select {
+	case q.signalCh <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the background checks.
+func (q *diskQuota) close() {
+	q.stopOnce.Do(func() {
+		q.cancel()
+		q.wg.Wait()
+	})
+}
+
+// rejectWrite returns the error of a write that is rejected because the quota
+// is exceeded.
+func (q *diskQuota) rejectWrite() error {
+	q.rejectedWrites.Add(1)
+	q.mu.Lock()
+	info := q.mu.info
+	q.mu.Unlock()
+	return errors.Mark(errors.Newf("pebble: disk quota exceeded: free %s (min %s), usage %s (max %s)",
+		humanize.Bytes.Uint64(info.FreeBytes), humanize.Bytes.Uint64(info.MinFreeBytes),
+		humanize.Bytes.Uint64(info.UsageBytes), humanize.Bytes.Uint64(info.MaxUsageBytes)),
+		ErrDiskQuotaExceeded)
+}
+
+// checkDiskQuota compares the available space and the disk usage of the DB
+// with the thresholds, and enters or leaves the degraded mode when the quota
+// becomes exceeded or is no longer exceeded.
+func (d *DB) checkDiskQuota() {
+	q := d.diskQuota
+	q.checkMu.Lock()
+	defer q.checkMu.Unlock()
+	info := DiskQuotaInfo{
+		MinFreeBytes:  q.opts.MinFreeBytes,
+		MaxUsageBytes: q.opts.MaxUsageBytes,
+		UsageBytes:    d.Metrics().DiskSpaceUsage(),
+	}
+	// NB: we don't use calculateDiskAvailableBytes, which signals a check.
+	checkFree := q.opts.MinFreeBytes > 0
+	if space, err := d.opts.FS.GetDiskUsage(d.dirname); err == nil {
+		d.diskAvailBytes.Store(space.AvailBytes)
+		info.FreeBytes = space.AvailBytes
+	} else {
+		if !errors.Is(err, vfs.ErrUnsupported) {
+			d.opts.EventListener.BackgroundError(err)
+		}
+		checkFree = false
+	}
+
+	wasExceeded := q.exceeded.Load()
+	if !wasExceeded {
+		info.Exceeded = (checkFree && info.FreeBytes < q.opts.MinFreeBytes) ||
+			(q.opts.MaxUsageBytes > 0 && info.UsageBytes > q.opts.MaxUsageBytes)
+	} else {
+		info.Exceeded =
+			(checkFree && info.FreeBytes < q.opts.MinFreeBytes+q.resumeMargin(q.opts.MinFreeBytes)) ||
+				(q.opts.MaxUsageBytes > 0 &&
+					info.UsageBytes+q.resumeMargin(q.opts.MaxUsageBytes) > q.opts.MaxUsageBytes)
+	}
+	q.mu.Lock()
+	q.mu.info = info
+	q.mu.Unlock()
+	if info.Exceeded == wasExceeded {
+		return
+	}
+
+	q.exceeded.Store(info.Exceeded)
+	if info.Exceeded {
+		d.opts.EventListener.DiskQuotaExceeded(info)
+	} else {
+		d.opts.EventListener.DiskQuotaResumed(info)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if info.Exceeded {
+		// Cancel the compactions that would consume more space. They are
+		// picked again when the quota is no longer exceeded.
+		for c := range d.mu.compact.inProgress {
+			if !c.kind.reclaimsSpace() {
+				c.cancel.Store(true)
+			}
+		}
+	}
+	d.maybeScheduleCompaction()
+}
+
+// resumeMargin returns the margin that must be freed past the given threshold
+// before the quota is no longer exceeded.
+func (q *diskQuota) resumeMargin(threshold uint64) uint64 {
+	if q.opts.ResumeMarginBytes > 0 {
+		return q.opts.ResumeMarginBytes
+	}
+	return threshold / 16
+}
+
+// reclaimsSpace returns true if the compactions of this kind are run while the
+// disk quota is exceeded: they either free space, or are necessary to free
+// space (flushes free the memtables and WAL files).
+func (k compactionKind) reclaimsSpace() bool {
+	switch k {
+	case compactionKindFlush, compactionKindIngestedFlushable, compactionKindMove,
+		compactionKindDeleteOnly, compactionKindElisionOnly:
+		return true
+	default:
+		return false
+	}
+}
+
+// onlyDeletions returns true if the batch only contains deletions (and log
+// data), which are accepted when the disk quota is exceeded since they allow
+// space to be reclaimed.
+func (b *Batch) onlyDeletions() bool {
+	r := b.Reader()
+	for {
+		kind, _, _, ok, err := r.Next()
+		if err != nil {
+			return false
+		}
+		if !ok {
+			return true
+		}
+		switch kind {
+		case InternalKeyKindDelete, InternalKeyKindSingleDelete, InternalKeyKindDeleteSized,
+			InternalKeyKindRangeDelete, InternalKeyKindRangeKeyDelete, InternalKeyKindLogData,
+			InternalKeyKindAssertExists:
+		default:
+			return false
+		}
+	}
+}
+
+// metrics populates m.DiskQuota.
+func (q *diskQuota) metrics(m *Metrics) {
+	q.mu.Lock()
+	info := q.mu.info
+	q.mu.Unlock()
+	m.DiskQuota.Exceeded = q.exceeded.Load()
+	m.DiskQuota.FreeBytes = info.FreeBytes
+	m.DiskQuota.UsageBytes = info.UsageBytes
+	m.DiskQuota.MinFreeBytes = info.MinFreeBytes
+	m.DiskQuota.MaxUsageBytes = info.MaxUsageBytes
+	m.DiskQuota.RejectedWrites = q.rejectedWrites.Load()
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// diskUsageFS is a vfs.FS that reports a configurable amount of available
+// space.
+type diskUsageFS struct {
+	vfs.FS
+	availBytes atomic.Uint64
+}
+
+func (fs *diskUsageFS) GetDiskUsage(path string) (vfs.DiskUsage, error) {
+	avail := fs.availBytes.Load()
+	return vfs.DiskUsage{AvailBytes: avail, TotalBytes: 10 << 30, UsedBytes: 10<<30 - avail}, nil
+}
+
+func TestDiskQuota(t *testing.T) {
+	fs := &diskUsageFS{FS: vfs.NewMem()}
+	fs.availBytes.Store(1 << 30)
+	events := make(chan DiskQuotaInfo, 10)
+	opts := &Options{
+		FS: fs,
+		DiskQuota: DiskQuotaOptions{
+			MinFreeBytes:  100 << 20,
+			CheckInterval: time.Hour,
+		},
+		EventListener: &EventListener{
+			DiskQuotaExceeded: func(info DiskQuotaInfo) { events <- info },
+			DiskQuotaResumed:  func(info DiskQuotaInfo) { events <- info },
+		},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("b"), nil))
+
+	// The quota is checked when the available space is refreshed.
+	fs.availBytes.Store(50 << 20)
+	d.calculateDiskAvailableBytes()
+	info := <-events
+	require.True(t, info.Exceeded)
+	require.Equal(t, uint64(50<<20), info.FreeBytes)
+	require.Equal(t, uint64(100<<20), info.MinFreeBytes)
+
+	err = d.Set([]byte("c"), []byte("c"), nil)
+	require.True(t, errors.Is(err, ErrDiskQuotaExceeded), "%v", err)
+	require.Contains(t, err.Error(), "free 50MB (min 100MB)")
+	b := d.NewBatch()
+	require.NoError(t, b.Delete([]byte("b"), nil))
+	require.NoError(t, b.Set([]byte("d"), nil, nil))
+	require.True(t, errors.Is(d.Apply(b, nil), ErrDiskQuotaExceeded))
+
+	// Deletions are accepted.
+	require.NoError(t, d.Delete([]byte("a"), nil))
+	require.NoError(t, d.DeleteRange([]byte("b"), []byte("c"), nil))
+	_, _, err = d.Get([]byte("a"))
+	require.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, d.Flush())
+
+	// Ingestions of local files are rejected.
+	f, err := fs.Create("ext", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	w := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+		TableFormat: d.FormatMajorVersion().MaxTableFormat(),
+	})
+	require.NoError(t, w.Set([]byte("e"), []byte("e")))
+	require.NoError(t, w.Close())
+	require.True(t, errors.Is(d.Ingest([]string{"ext"}), ErrDiskQuotaExceeded))
+
+	m := d.Metrics()
+	require.True(t, m.DiskQuota.Exceeded)
+	require.Equal(t, uint64(3), m.DiskQuota.RejectedWrites)
+	require.Contains(t, m.String(), "Disk quota: exceeded: true  free: 50MB (min 100MB)")
+
+	// Freeing space past the threshold, but not past the margin, is not
+	// enough to resume writes.
+	fs.availBytes.Store(103 << 20)
+	d.checkDiskQuota()
+	require.True(t, d.Metrics().DiskQuota.Exceeded)
+	require.Len(t, events, 0)
+
+	fs.availBytes.Store(200 << 20)
+	d.checkDiskQuota()
+	info = <-events
+	require.False(t, info.Exceeded)
+	require.False(t, d.Metrics().DiskQuota.Exceeded)
+	require.NoError(t, d.Set([]byte("c"), []byte("c"), nil))
+	require.NoError(t, d.Ingest([]string{"ext"}))
+}
+
+func TestDiskQuotaMaxUsage(t *testing.T) {
+	var log strings.Builder
+	exceeded := make(chan struct{}, 1)
+	d, err := Open("", &Options{
+		FS:        vfs.NewMem(),
+		DiskQuota: DiskQuotaOptions{MaxUsageBytes: 1},
+		EventListener: &EventListener{
+			DiskQuotaExceeded: func(info DiskQuotaInfo) {
+				log.WriteString(info.String())
+				exceeded <- struct{}{}
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	// The quota is checked when the DB is opened. The filesystem doesn't report
+	// the available space.
+	<-exceeded
+	require.Contains(t, log.String(), "disk quota exceeded, rejecting writes: free 0B (min 0B)")
+	require.True(t, errors.Is(d.Set([]byte("a"), nil, nil), ErrDiskQuotaExceeded))
+}
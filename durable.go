@@ -0,0 +1,122 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+)
+
+// durableTracker tracks the durable sequence number of a DB, and the callbacks
+// waiting for sequence numbers to become durable. See DB.DurableSeqNum.
+//
+// The durable sequence number is ratcheted by:
+//   - the syncs of the WAL, which report the sequence number following the
+//     last batch synced (see wal.SyncOptions.Marker);
+//   - the rotation of the WAL, since the previous WAL is synced when closed;
+//   - the flushes, since all the writes with a sequence number lower than the
+//     earliest unflushed one are persisted in sstables.
+type durableTracker struct {
+	seqNum atomic.Uint64
+	mu     struct {
+		sync.Mutex
+		waiters durableWaiters
+	}
+}
+
+type durableWaiter struct {
+	seqNum uint64
+	fn     func()
+}
+
+// durableWaiters is a min-heap of waiters ordered by sequence number.
+type durableWaiters []durableWaiter
+
+var _ heap.Interface = (*durableWaiters)(nil)
+
+func (w durableWaiters) Len() int           { return len(w) }
+func (w durableWaiters) Less(i, j int) bool { return w[i].seqNum < w[j].seqNum }
+func (w durableWaiters) Swap(i, j int)      { w[i], w[j] = w[j], w[i] }
+
+func (w *durableWaiters) Push(x interface{}) {
+	*w = append(*w, x.(durableWaiter))
+}
+
+func (w *durableWaiters) Pop() interface{} {
+	old := *w
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = durableWaiter{}
+	*w = old[:n-1]
+	return x
+}
+
+// ratchet ratchets the durable sequence number up to seqNum, and invokes the
+// callbacks waiting for the sequence numbers below it.
+func (t *durableTracker) ratchet(seqNum uint64) {
+	for {
+		cur := t.seqNum.Load()
+		if seqNum <= cur {
+			return
+		}
+		if t.seqNum.CompareAndSwap(cur, seqNum) {
+			break
+		}
+	}
+	// NB: the sequence number is published before t.mu is acquired, so a
+	// concurrent notify either observes it or adds its waiter before the
+	// waiters are popped below.
+	var fns []func()
+	t.mu.Lock()
+	for len(t.mu.waiters) > 0 && t.mu.waiters[0].seqNum < seqNum {
+		fns = append(fns, heap.Pop(&t.mu.waiters).(durableWaiter).fn)
+	}
+	t.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// notify invokes fn once seqNum is below the durable sequence number.
+func (t *durableTracker) notify(seqNum uint64, fn func()) {
+	t.mu.Lock()
+	if seqNum >= t.seqNum.Load() {
+		heap.Push(&t.mu.waiters, durableWaiter{seqNum: seqNum, fn: fn})
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	fn()
+}
+
+// DurableSeqNum returns the durable sequence number of the DB: all the writes
+// with a lower sequence number are persisted, and survive a crash. This is the
+// case once the WAL is synced past the write, even if the write itself did not
+// request a sync (see WriteOptions.Sync), or once the write is flushed. The
+// exception are the writes committed with DurabilityNone, which are not
+// written to the WAL and are only persisted once they are flushed, regardless
+// of the durable sequence number.
+//
+// A batch is durable once its sequence number (see Batch.SeqNum) is below the
+// durable sequence number.
+func (d *DB) DurableSeqNum() uint64 {
+	return d.durable.seqNum.Load()
+}
+
+// NotifyDurable invokes fn once the write with sequence number seqNum is
+// durable, that is once DurableSeqNum() is greater than seqNum. This allows
+// the callers of ApplyNoSyncWait or of writes which don't request a sync to
+// learn when their writes are persisted, without waiting for each of them.
+// For a batch, pass Batch.SeqNum() once the batch is committed.
+//
+// If the write is already durable, fn is invoked before NotifyDurable
+// returns. Otherwise, it is invoked by the goroutine that makes the write
+// durable, which may be the goroutine syncing the WAL, so fn must not block or
+// call into the DB. If the DB is closed before the write becomes durable, fn
+// is not invoked.
+func (d *DB) NotifyDurable(seqNum uint64, fn func()) {
+	d.durable.notify(seqNum, fn)
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurableSeqNum(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+
+	apply := func(opts *WriteOptions) (seqNum uint64, durable chan struct{}) {
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte("a"), []byte("b"), nil))
+		require.NoError(t, d.Apply(b, opts))
+		seqNum = b.SeqNum()
+		require.NoError(t, b.Close())
+		durable = make(chan struct{})
+		d.NotifyDurable(seqNum, func() { close(durable) })
+		return seqNum, durable
+	}
+	isClosed := func(ch chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// A write which is not synced is not durable, until a later synced write
+	// syncs it along with its own data.
+	seqNum, durable := apply(NoSync)
+	require.LessOrEqual(t, d.DurableSeqNum(), seqNum)
+	require.False(t, isClosed(durable))
+	syncSeqNum, syncDurable := apply(Sync)
+	require.Greater(t, d.DurableSeqNum(), syncSeqNum)
+	require.True(t, isClosed(durable))
+	require.True(t, isClosed(syncDurable))
+
+	// A write which skipped the WAL is only durable once flushed, but a flush
+	// makes all the writes durable.
+	seqNum, durable = apply(&WriteOptions{Durability: DurabilityNone})
+	require.False(t, isClosed(durable))
+	seqNum2, durable2 := apply(NoSync)
+	require.NoError(t, d.Flush())
+	require.Greater(t, d.DurableSeqNum(), seqNum2)
+	require.True(t, isClosed(durable))
+	require.True(t, isClosed(durable2))
+
+	// A write with a sync deadline becomes durable without a waiter.
+	_, durable = apply(&WriteOptions{Durability: DurabilitySyncWithin, SyncWithin: time.Millisecond})
+	select {
+	case <-durable:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the write to become durable")
+	}
+
+	// The caller of ApplyNoSyncWait is notified of the sync before waiting.
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("a"), []byte("c"), nil))
+	require.NoError(t, d.ApplyNoSyncWait(b, Sync))
+	durable = make(chan struct{})
+	d.NotifyDurable(b.SeqNum(), func() { close(durable) })
+	<-durable
+	require.NoError(t, b.SyncWait())
+	require.NoError(t, b.Close())
+
+	// A write which is already durable is notified right away.
+	notified := false
+	d.NotifyDurable(seqNum, func() { notified = true })
+	require.True(t, notified)
+}
+
+func TestDurableSeqNumRotation(t *testing.T) {
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+
+	// Rotating the WAL syncs the previous one.
+	require.NoError(t, d.Set([]byte("a"), []byte("b"), NoSync))
+	seqNum := d.mu.versions.logSeqNum.Load()
+	require.Less(t, d.DurableSeqNum(), seqNum)
+	d.commit.mu.Lock()
+	d.mu.Lock()
+	require.NoError(t, d.makeRoomForWrite(nil))
+	d.mu.Unlock()
+	d.commit.mu.Unlock()
+	require.GreaterOrEqual(t, d.DurableSeqNum(), seqNum)
+	require.NoError(t, d.Close())
+
+	// After a restart, the recovered writes are durable.
+	d, err = Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.Equal(t, d.mu.versions.visibleSeqNum.Load(), d.DurableSeqNum())
+	require.NoError(t, d.Close())
+}
@@ -152,6 +152,39 @@ func (i levelInfos) SafeFormat(w redact.SafePrinter, _ rune) {
 // file.
 type DiskSlowInfo = vfs.DiskSlowInfo
 
+// DiskQuotaInfo contains the info for a disk quota event. See
+// DiskQuotaOptions.
+type DiskQuotaInfo struct {
+	// Exceeded is true if the quota is exceeded, in which case writes are
+	// rejected and only the compactions that reclaim space are run.
+	Exceeded bool
+	// FreeBytes is the space available on the volume of the DB, or 0 if the
+	// filesystem doesn't report it.
+	FreeBytes uint64
+	// UsageBytes is the disk space used by the DB (see
+	// Metrics.DiskSpaceUsage).
+	UsageBytes uint64
+	// MinFreeBytes and MaxUsageBytes are the thresholds of the quota.
+	MinFreeBytes  uint64
+	MaxUsageBytes uint64
+}
+
+func (i DiskQuotaInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i DiskQuotaInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	if i.Exceeded {
+		w.Printf("disk quota exceeded, rejecting writes:")
+	} else {
+		w.Printf("disk quota no longer exceeded, resuming writes:")
+	}
+	w.Printf(" free %s (min %s), usage %s (max %s)",
+		humanize.Bytes.Uint64(i.FreeBytes), humanize.Bytes.Uint64(i.MinFreeBytes),
+		humanize.Bytes.Uint64(i.UsageBytes), humanize.Bytes.Uint64(i.MaxUsageBytes))
+}
+
 // FlushInfo contains the info for a flush event.
 type FlushInfo struct {
 	// JobID is the ID of the flush job.
@@ -512,6 +545,43 @@ func (i WALDeleteInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("[JOB %d] WAL deleted %s", redact.Safe(i.JobID), i.FileNum)
 }
 
+// WALDiscardInfo contains the info for a WAL discard event: data of a WAL
+// was discarded by WAL recovery because of a corruption (see
+// Options.WALRecoveryMode).
+type WALDiscardInfo struct {
+	// Mode is the WAL recovery mode.
+	Mode WALRecoveryMode
+	// Kind describes the discarded data.
+	Kind WALDiscardKind
+	// FileNum is the file number of the WAL.
+	FileNum base.DiskFileNum
+	// Path is the path of the physical file that contains the corruption, and
+	// Offset the offset of the corruption within the file. They are unset if
+	// the entire WAL was discarded.
+	Path   string
+	Offset int64
+	// Err is the corruption.
+	Err error
+}
+
+func (i WALDiscardInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i WALDiscardInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	switch i.Kind {
+	case WALDiscardRecord:
+		w.Printf("WAL %s: discarded corrupted record at offset %d (%s): %s",
+			i.FileNum, redact.Safe(i.Offset), redact.Safe(i.Mode), i.Err)
+	case WALDiscardTail:
+		w.Printf("WAL %s: discarded tail from offset %d (%s): %s",
+			i.FileNum, redact.Safe(i.Offset), redact.Safe(i.Mode), i.Err)
+	default:
+		w.Printf("WAL %s: discarded (%s): %s", i.FileNum, redact.Safe(i.Mode), i.Err)
+	}
+}
+
 // WriteStallBeginInfo contains the info for a write stall begin event.
 type WriteStallBeginInfo struct {
 	Reason string
@@ -554,6 +624,14 @@ type EventListener struct {
 	// working.
 	DiskSlow func(DiskSlowInfo)
 
+	// DiskQuotaExceeded is invoked when the disk quota (see DiskQuotaOptions)
+	// is exceeded, and writes start being rejected.
+	DiskQuotaExceeded func(DiskQuotaInfo)
+
+	// DiskQuotaResumed is invoked when enough space was freed after the disk
+	// quota was exceeded, and writes are accepted again.
+	DiskQuotaResumed func(DiskQuotaInfo)
+
 	// FlushBegin is invoked after the inputs to a flush have been determined,
 	// but before the flush has produced any output.
 	FlushBegin func(FlushInfo)
@@ -603,6 +681,11 @@ type EventListener struct {
 	// WALDeleted is invoked after a WAL has been deleted.
 	WALDeleted func(WALDeleteInfo)
 
+	// WALDiscarded is invoked when data of a WAL is discarded by WAL recovery
+	// because of a corruption. It is not invoked for the tail of the most
+	// recent WAL discarded by WALRecoveryTolerateCorruptedTail.
+	WALDiscarded func(WALDiscardInfo)
+
 	// WriteStallBegin is invoked when writes are intentionally delayed.
 	WriteStallBegin func(WriteStallBeginInfo)
 
@@ -633,6 +716,12 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.DiskSlow == nil {
 		l.DiskSlow = func(info DiskSlowInfo) {}
 	}
+	if l.DiskQuotaExceeded == nil {
+		l.DiskQuotaExceeded = func(info DiskQuotaInfo) {}
+	}
+	if l.DiskQuotaResumed == nil {
+		l.DiskQuotaResumed = func(info DiskQuotaInfo) {}
+	}
 	if l.FlushBegin == nil {
 		l.FlushBegin = func(info FlushInfo) {}
 	}
@@ -675,6 +764,9 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.WALDeleted == nil {
 		l.WALDeleted = func(info WALDeleteInfo) {}
 	}
+	if l.WALDiscarded == nil {
+		l.WALDiscarded = func(info WALDiscardInfo) {}
+	}
 	if l.WriteStallBegin == nil {
 		l.WriteStallBegin = func(info WriteStallBeginInfo) {}
 	}
@@ -703,6 +795,12 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		DiskSlow: func(info DiskSlowInfo) {
 			logger.Infof("%s", info)
 		},
+		DiskQuotaExceeded: func(info DiskQuotaInfo) {
+			logger.Errorf("%s", info)
+		},
+		DiskQuotaResumed: func(info DiskQuotaInfo) {
+			logger.Infof("%s", info)
+		},
 		FlushBegin: func(info FlushInfo) {
 			logger.Infof("%s", info)
 		},
@@ -745,6 +843,9 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 		WALDeleted: func(info WALDeleteInfo) {
 			logger.Infof("%s", info)
 		},
+		WALDiscarded: func(info WALDiscardInfo) {
+			logger.Infof("%s", info)
+		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
 			logger.Infof("%s", info)
 		},
@@ -775,6 +876,14 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.DiskSlow(info)
 			b.DiskSlow(info)
 		},
+		DiskQuotaExceeded: func(info DiskQuotaInfo) {
+			a.DiskQuotaExceeded(info)
+			b.DiskQuotaExceeded(info)
+		},
+		DiskQuotaResumed: func(info DiskQuotaInfo) {
+			a.DiskQuotaResumed(info)
+			b.DiskQuotaResumed(info)
+		},
 		FlushBegin: func(info FlushInfo) {
 			a.FlushBegin(info)
 			b.FlushBegin(info)
@@ -831,6 +940,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.WALDeleted(info)
 			b.WALDeleted(info)
 		},
+		WALDiscarded: func(info WALDiscardInfo) {
+			a.WALDiscarded(info)
+			b.WALDiscarded(info)
+		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
 			a.WriteStallBegin(info)
 			b.WriteStallBegin(info)
@@ -195,6 +195,33 @@ const (
 	// Experimental versions, which are excluded by FormatNewest (but can be used
 	// in tests) can be defined here.
 
+	// FormatWALCompression is a format major version that adds support for
+	// compressed WAL records (see Options.WALCompression). Older versions don't
+	// understand the chunk types of compressed records.
+	FormatWALCompression
+
+	// FormatBatchConditions is a format major version that adds support for
+	// batch conditions (see Batch.SetIfAbsent). Older versions don't understand
+	// the key kinds of the conditions recorded in WAL batches.
+	FormatBatchConditions
+
+	// FormatPartitionedFilters is a format major version that adds support for
+	// sstables with partitioned filters and data block hash indexes
+	// (sstable.TableFormatPebblev6).
+	FormatPartitionedFilters
+
+	// FormatAtomicCommit is a format major version that adds support for
+	// atomic commits across DBs (see CommitAtomic). Older versions don't
+	// understand the prepare, commit and abort records written to the WAL:
+	// they would drop the prepared batches without resolving them.
+	FormatAtomicCommit
+
+	// FormatWALStriping is a format major version that adds support for WALs
+	// striped across several directories (see Options.WALStripeDirs). Older
+	// versions don't understand the records written to keep the stripes of a
+	// WAL in order, and would refuse to replay them.
+	FormatWALStriping
+
 	// -- Add experimental versions here --
 
 	// internalFormatNewest is the most recent, possibly experimental format major
@@ -222,8 +249,11 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted:
 		return sstable.TableFormatPebblev3
-	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatWALCompression, FormatBatchConditions:
 		return sstable.TableFormatPebblev4
+	case FormatPartitionedFilters, FormatAtomicCommit, FormatWALStriping:
+		return sstable.TableFormatPebblev6
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
 	}
@@ -234,7 +264,9 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 func (v FormatMajorVersion) MinTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted,
-		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatWALCompression, FormatBatchConditions, FormatPartitionedFilters,
+		FormatAtomicCommit, FormatWALStriping:
 		return sstable.TableFormatPebblev1
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -271,6 +303,21 @@ var formatMajorVersionMigrations = map[FormatMajorVersion]func(*DB) error{
 	FormatSyntheticPrefixSuffix: func(d *DB) error {
 		return d.finalizeFormatVersUpgrade(FormatSyntheticPrefixSuffix)
 	},
+	FormatWALCompression: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatWALCompression)
+	},
+	FormatBatchConditions: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatBatchConditions)
+	},
+	FormatPartitionedFilters: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatPartitionedFilters)
+	},
+	FormatAtomicCommit: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatAtomicCommit)
+	},
+	FormatWALStriping: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatWALStriping)
+	},
 }
 
 const formatVersionMarkerName = `format-version`
@@ -24,11 +24,16 @@ func TestFormatMajorVersionStableValues(t *testing.T) {
 	require.Equal(t, FormatDeleteSizedAndObsolete, FormatMajorVersion(15))
 	require.Equal(t, FormatVirtualSSTables, FormatMajorVersion(16))
 	require.Equal(t, FormatSyntheticPrefixSuffix, FormatMajorVersion(17))
+	require.Equal(t, FormatWALCompression, FormatMajorVersion(18))
+	require.Equal(t, FormatBatchConditions, FormatMajorVersion(19))
+	require.Equal(t, FormatPartitionedFilters, FormatMajorVersion(20))
+	require.Equal(t, FormatAtomicCommit, FormatMajorVersion(21))
+	require.Equal(t, FormatWALStriping, FormatMajorVersion(22))
 
 	// When we add a new version, we should add a check for the new version in
 	// addition to updating these expected values.
 	require.Equal(t, FormatNewest, FormatMajorVersion(17))
-	require.Equal(t, internalFormatNewest, FormatMajorVersion(17))
+	require.Equal(t, internalFormatNewest, FormatMajorVersion(22))
 }
 
 func TestFormatMajorVersion_MigrationDefined(t *testing.T) {
@@ -53,6 +58,16 @@ func TestRatchetFormat(t *testing.T) {
 	require.Equal(t, FormatVirtualSSTables, d.FormatMajorVersion())
 	require.NoError(t, d.RatchetFormatMajorVersion(FormatSyntheticPrefixSuffix))
 	require.Equal(t, FormatSyntheticPrefixSuffix, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatWALCompression))
+	require.Equal(t, FormatWALCompression, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatBatchConditions))
+	require.Equal(t, FormatBatchConditions, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatPartitionedFilters))
+	require.Equal(t, FormatPartitionedFilters, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatAtomicCommit))
+	require.Equal(t, FormatAtomicCommit, d.FormatMajorVersion())
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatWALStriping))
+	require.Equal(t, FormatWALStriping, d.FormatMajorVersion())
 
 	require.NoError(t, d.Close())
 
@@ -208,6 +223,11 @@ func TestFormatMajorVersions_TableFormat(t *testing.T) {
 		FormatDeleteSizedAndObsolete:     {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
 		FormatVirtualSSTables:            {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
 		FormatSyntheticPrefixSuffix:      {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
+		FormatWALCompression:             {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
+		FormatBatchConditions:            {sstable.TableFormatPebblev1, sstable.TableFormatPebblev4},
+		FormatPartitionedFilters:         {sstable.TableFormatPebblev1, sstable.TableFormatPebblev6},
+		FormatAtomicCommit:               {sstable.TableFormatPebblev1, sstable.TableFormatPebblev6},
+		FormatWALStriping:                {sstable.TableFormatPebblev1, sstable.TableFormatPebblev6},
 	}
 
 	// Valid versions.
@@ -1495,6 +1495,10 @@ func (d *DB) ingest(
 	if len(shared) > 0 && d.opts.Experimental.RemoteStorage == nil {
 		panic("cannot ingest shared sstables with nil SharedStorage")
 	}
+	if len(paths) > 0 && d.diskQuota != nil && d.diskQuota.exceeded.Load() {
+		// The local files are linked or copied into the DB directory.
+		return IngestOperationStats{}, d.diskQuota.rejectWrite()
+	}
 	if (exciseSpan.Valid() || len(shared) > 0 || len(external) > 0) && d.FormatMajorVersion() < FormatVirtualSSTables {
 		return IngestOperationStats{}, errors.New("pebble: format major version too old for excise, shared or external sstable ingestion")
 	}
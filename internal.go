@@ -26,6 +26,9 @@ const (
 	InternalKeyKindRangeKeyMax     = base.InternalKeyKindRangeKeyMax
 	InternalKeyKindIngestSST       = base.InternalKeyKindIngestSST
 	InternalKeyKindDeleteSized     = base.InternalKeyKindDeleteSized
+	InternalKeyKindAssertAbsent    = base.InternalKeyKindAssertAbsent
+	InternalKeyKindAssertExists    = base.InternalKeyKindAssertExists
+	InternalKeyKindAssertValue     = base.InternalKeyKindAssertValue
 	InternalKeyKindInvalid         = base.InternalKeyKindInvalid
 	InternalKeySeqNumBatch         = base.InternalKeySeqNumBatch
 	InternalKeySeqNumMax           = base.InternalKeySeqNumMax
@@ -107,6 +107,21 @@ const (
 	// seqNum.
 	InternalKeyKindMax InternalKeyKind = 23
 
+	// InternalKeyKindAssertAbsent, InternalKeyKindAssertExists and
+	// InternalKeyKindAssertValue are conditions on the state of a key, which
+	// are evaluated when their batch is committed, failing the batch if they
+	// don't hold. InternalKeyKindAssertValue holds the expected value of the
+	// key. Unlike InternalKeyKindLogData, they only appear in batches (and in
+	// the WAL), and never in memtables or sstables: they are greater than
+	// InternalKeyKindMax, which bounds the kinds of the persisted keys.
+	InternalKeyKindAssertAbsent InternalKeyKind = 24
+	InternalKeyKindAssertExists InternalKeyKind = 25
+	InternalKeyKindAssertValue  InternalKeyKind = 26
+
+	// InternalKeyKindBatchMax is the maximum value of the kinds of the entries
+	// of a batch, including the batch-only kinds above.
+	InternalKeyKindBatchMax InternalKeyKind = 26
+
 	// Internal to the sstable format. Not exposed by any sstable iterator.
 	// Declared here to prevent definition of valid key kinds that set this bit.
 	InternalKeyKindSSTableInternalObsoleteBit  InternalKeyKind = 64
@@ -157,6 +172,9 @@ var internalKeyKindNames = []string{
 	InternalKeyKindRangeKeyDelete: "RANGEKEYDEL",
 	InternalKeyKindIngestSST:      "INGESTSST",
 	InternalKeyKindDeleteSized:    "DELSIZED",
+	InternalKeyKindAssertAbsent:   "ASSERTABSENT",
+	InternalKeyKindAssertExists:   "ASSERTEXISTS",
+	InternalKeyKindAssertValue:    "ASSERTVALUE",
 	InternalKeyKindInvalid:        "INVALID",
 }
 
@@ -249,6 +267,9 @@ var kindsMap = map[string]InternalKeyKind{
 	"RANGEKEYDEL":   InternalKeyKindRangeKeyDelete,
 	"INGESTSST":     InternalKeyKindIngestSST,
 	"DELSIZED":      InternalKeyKindDeleteSized,
+	"ASSERTABSENT":  InternalKeyKindAssertAbsent,
+	"ASSERTEXISTS":  InternalKeyKindAssertExists,
+	"ASSERTVALUE":   InternalKeyKindAssertValue,
 }
 
 // ParseInternalKey parses the string representation of an internal key. The
@@ -16,13 +16,20 @@ type FilterType int
 
 // The available filter types.
 const (
+	// TableFilter is a single filter over all of the keys in a table.
 	TableFilter FilterType = iota
+	// PartitionedFilter splits a table's filter into partitions aligned with
+	// the table's index partitions, each of which is encoded as a TableFilter.
+	// Only the partition covering a sought key needs to be loaded.
+	PartitionedFilter
 )
 
 func (t FilterType) String() string {
 	switch t {
 	case TableFilter:
 		return "table"
+	case PartitionedFilter:
+		return "partitioned"
 	}
 	return "unknown"
 }
@@ -64,6 +71,41 @@ type FilterPolicy interface {
 	NewWriter(ftype FilterType) FilterWriter
 }
 
+// RangeFilterWriter provides an interface for creating range filter blocks.
+// See RangeFilterPolicy for more details about range filters.
+type RangeFilterWriter interface {
+	// AddKey adds a key to the filter. Keys are added in increasing order.
+	AddKey(key []byte)
+
+	// Finish appends to dst an encoded filter that holds the current set of
+	// keys. The writer state is reset after the call to Finish allowing the
+	// writer to be reused for the creation of additional filters.
+	Finish(dst []byte) []byte
+}
+
+// RangeFilterPolicy is an algorithm for probabilistically encoding a set of
+// keys such that it can be determined whether the set may contain any key
+// within a range of keys. Unlike a FilterPolicy, which can only answer point
+// queries for a key prefix, a range filter allows skipping tables during
+// short range scans.
+//
+// As with FilterPolicy, the name of a RangeFilterPolicy names the algorithm,
+// is written to files on disk and must match at the time of reading for the
+// filter to be used.
+type RangeFilterPolicy interface {
+	// Name names the range filter policy.
+	Name() string
+
+	// MayContainRange returns whether the encoded filter may contain a key k
+	// with lower <= k <= upper. A nil lower or upper bound is unbounded. False
+	// positives are possible, where it returns true for ranges that contain
+	// no keys in the original set.
+	MayContainRange(filter, lower, upper []byte) bool
+
+	// NewWriter creates a new RangeFilterWriter.
+	NewWriter() RangeFilterWriter
+}
+
 // BlockPropertyFilter is used in an Iterator to filter sstables and blocks
 // within the sstable. It should not maintain any per-sstable state, and must
 // be thread-safe.
@@ -0,0 +1,215 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package cache
+
+import (
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// The admission filter is an implementation of TinyLFU
+// (https://arxiv.org/abs/1512.00727). The accesses to the blocks are recorded
+// in a frequency sketch; when a new block would cause an eviction, it is only
+// admitted if it was accessed more frequently than the block that would be
+// evicted. This prevents blocks that are accessed once (e.g. by a large scan)
+// from evicting the working set.
+
+const (
+	// sketchDepth is the number of rows of the count-min sketch.
+	sketchDepth = 4
+	// sketchMaxCount is the maximum value of a (4-bit) counter.
+	sketchMaxCount = 15
+	// sketchBlockSize is the estimated size of a block, used to size the
+	// sketch based on the size of the shard.
+	sketchBlockSize = 4 << 10
+	// sketchWidthFactor is the minimum number of counters in each row of the
+	// sketch per block that fits in the shard.
+	sketchWidthFactor = 4
+	// sketchSampleFactor is the number of accesses, as a multiple of the
+	// number of blocks that fit in the shard, after which the counters are
+	// halved. The aging allows the sketch to track changes in the access
+	// pattern.
+	sketchSampleFactor = 10
+	// admissionVictimSearch is the maximum number of entries examined after
+	// the cold hand to find the block that would be evicted.
+	admissionVictimSearch = 8
+)
+
+var sketchSeeds = [sketchDepth]uint64{
+	0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325,
+}
+
+// frequencySketch is a count-min sketch with 4-bit counters that estimates
+// the access frequency of the blocks of a shard. It is safe for concurrent
+// use.
+type frequencySketch struct {
+	// table contains the counters of all the rows, 16 per word.
+	table []atomic.Uint64
+	// mask is the width of a row minus one; the width is a power of two.
+	mask uint64
+	// additions is the number of accesses recorded since the counters were
+	// last halved.
+	additions  atomic.Int64
+	sampleSize int64
+}
+
+// sketchBlocks returns the estimated number of blocks that fit in a shard of
+// the given size, which determines the size of its sketch.
+func sketchBlocks(shardSize int64) uint64 {
+	return uint64(max(shardSize/sketchBlockSize, 16))
+}
+
+func newFrequencySketch(shardSize int64) *frequencySketch {
+	blocks := sketchBlocks(shardSize)
+	// Each row has (at least) 4 counters per block, which keeps the error due
+	// to the collisions low.
+	width := uint64(1) << bits.Len64(sketchWidthFactor*blocks-1)
+	return &frequencySketch{
+		table:      make([]atomic.Uint64, sketchDepth*width/16),
+		mask:       width - 1,
+		sampleSize: sketchSampleFactor * int64(blocks),
+	}
+}
+
+// counter returns the index of the word and the shift of the counter for the
+// key hash in the given row.
+func (s *frequencySketch) counter(h uint64, row int) (word int, shift uint) {
+	h = (h ^ sketchSeeds[row]) * 0x9e3779b97f4a7c15
+	idx := uint64(row)*(s.mask+1) + (h>>32)&s.mask
+	return int(idx / 16), uint(idx%16) * 4
+}
+
+// increment records an access to the block with the given key hash.
+func (s *frequencySketch) increment(h uint64) {
+	for row := 0; row < sketchDepth; row++ {
+		word, shift := s.counter(h, row)
+		for {
+			v := s.table[word].Load()
+			if (v>>shift)&sketchMaxCount == sketchMaxCount {
+				break
+			}
+			if s.table[word].CompareAndSwap(v, v+(1<<shift)) {
+				break
+			}
+		}
+	}
+	if s.additions.Add(1) == s.sampleSize {
+		s.reset()
+	}
+}
+
+// estimate returns the estimated number of accesses to the block with the
+// given key hash.
+func (s *frequencySketch) estimate(h uint64) uint64 {
+	res := uint64(sketchMaxCount)
+	for row := 0; row < sketchDepth; row++ {
+		word, shift := s.counter(h, row)
+		res = min(res, (s.table[word].Load()>>shift)&sketchMaxCount)
+	}
+	return res
+}
+
+// reset halves all the counters.
+func (s *frequencySketch) reset() {
+	for i := range s.table {
+		for {
+			v := s.table[i].Load()
+			if s.table[i].CompareAndSwap(v, (v>>1)&0x7777777777777777) {
+				break
+			}
+		}
+	}
+	s.additions.Add(-s.sampleSize / 2)
+}
+
+// keyHash returns the hash of a block key, which is used both to select the
+// shard of the block and by the frequency sketch.
+func keyHash(id uint64, fileNum base.DiskFileNum, offset uint64) uint64 {
+	// Inlined version of fnv.New64 + Write.
+	const offset64 = 14695981039346656037
+	const prime64 = 1099511628211
+
+	h := uint64(offset64)
+	for i := 0; i < 8; i++ {
+		h *= prime64
+		h ^= uint64(id & 0xff)
+		id >>= 8
+	}
+	fileNumVal := uint64(fileNum)
+	for i := 0; i < 8; i++ {
+		h *= prime64
+		h ^= uint64(fileNumVal) & 0xff
+		fileNumVal >>= 8
+	}
+	for i := 0; i < 8; i++ {
+		h *= prime64
+		h ^= uint64(offset & 0xff)
+		offset >>= 8
+	}
+	return h
+}
+
+// admit returns true if a new block should be added to the shard, which
+// requires that c.mu is held. The block is always admitted if it fits in the
+// shard without evicting other blocks; otherwise, it is only admitted if it was
+// accessed at least as frequently as the block that would be evicted next,
+// which is the first unreferenced cold block after the cold hand.
+func (c *shard) admit(sketch *frequencySketch, h uint64, size int64) bool {
+	if c.sizeHot+c.sizeCold+size < c.targetSize() {
+		return true
+	}
+	e := c.handCold
+	for i := 0; i < admissionVictimSearch && e != nil; i++ {
+		if e.ptype == etCold && !e.referenced.Load() {
+			victim := keyHash(e.key.id, e.key.fileNum, e.key.offset)
+			return sketch.estimate(h) >= sketch.estimate(victim)
+		}
+		if e = e.next(); e == c.handCold {
+			break
+		}
+	}
+	return true
+}
+
+// EnableAdmissionFilter enables the admission filter of the cache, which
+// prevents the blocks that are accessed once from evicting the blocks that are
+// accessed frequently. See TinyLFU (https://arxiv.org/abs/1512.00727).
+//
+// The accesses to the blocks are recorded in a frequency sketch. When the
+// cache is full, a new block is only added if it was accessed more frequently
+// than the block that would be evicted to make room for it; otherwise, Set
+// returns a handle to the value without adding it to the cache. Blocks that
+// were recently evicted are always added back, as they are known to be reused.
+//
+// The filter cannot be disabled once it is enabled.
+func (c *Cache) EnableAdmissionFilter() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		if s.sketch.Load() == nil {
+			s.sketch.Store(newFrequencySketch(c.maxSize.Load() / int64(len(c.shards))))
+		}
+	}
+}
+
+// resizeSketch replaces the frequency sketch of the shard, if the admission
+// filter is enabled and the sketch was sized for a different shard size. The
+// recorded accesses are lost, which only makes the filter admit more blocks
+// until the new sketch warms up.
+func (c *shard) resizeSketch(shardSize int64) {
+	s := c.sketch.Load()
+	if s == nil || s.sampleSize == sketchSampleFactor*int64(sketchBlocks(shardSize)) {
+		return
+	}
+	c.sketch.CompareAndSwap(s, newFrequencySketch(shardSize))
+}
+
+// UncachedHandle returns a Handle for a value that is not added to the cache,
+// for the reads that opt out of adding the blocks they read to the cache. The
+// value must have been allocated by Alloc; releasing the Handle frees it.
+func UncachedHandle(value *Value) Handle {
+	return Handle{value: value}
+}
@@ -77,6 +77,11 @@ func (h Handle) Release() {
 type shard struct {
 	hits   atomic.Int64
 	misses atomic.Int64
+	// rejected is the number of blocks rejected by the admission filter.
+	rejected atomic.Int64
+	// sketch records the accesses to the blocks of the shard, if the admission
+	// filter is enabled. See Cache.EnableAdmissionFilter.
+	sketch atomic.Pointer[frequencySketch]
 
 	mu sync.RWMutex
 
@@ -86,6 +91,18 @@ type shard struct {
 	blocks       blockMap // fileNum+offset -> block
 	files        blockMap // fileNum -> list of blocks
 
+	// ids tracks the quota and usage of each cache ID. It is shared by all
+	// shards.
+	ids *idRegistry
+	// idHits tracks the hits and misses of each cache ID in the shard. They
+	// are summed across shards by Cache.MetricsForID.
+	idHits idMap[idHits]
+	// evictingFor is the ID whose block is being added to the shard, if any.
+	// Blocks of other IDs that are within their quota are protected from the
+	// evictions it causes while protectQuotas is set. See Cache.SetQuota.
+	evictingFor   uint64
+	protectQuotas bool
+
 	// The blocks and files maps store values in manually managed memory that is
 	// invisible to the Go GC. This is fine for Value and entry objects that are
 	// stored in manually managed memory, but when the "invariants" build tag is
@@ -111,7 +128,10 @@ type shard struct {
 	countTest int64
 }
 
-func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
+func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64, record bool) Handle {
+	if sketch := c.sketch.Load(); sketch != nil && record {
+		sketch.increment(keyHash(id, fileNum, offset))
+	}
 	c.mu.RLock()
 	var value *Value
 	if e, _ := c.blocks.Get(key{fileKey{id, fileNum}, offset}); e != nil {
@@ -123,12 +143,37 @@ func (c *shard) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
 	c.mu.RUnlock()
 	if value == nil {
 		c.misses.Add(1)
+		if h := c.idHitsFor(id); h != nil {
+			h.misses.Add(1)
+		}
 		return Handle{}
 	}
 	c.hits.Add(1)
+	if h := c.idHitsFor(id); h != nil {
+		h.hits.Add(1)
+	}
 	return Handle{value: value}
 }
 
+// idHitsFor returns the hit counts of the ID in the shard, or nil if the ID is
+// not registered with the cache, e.g. because it has been released. A lookup
+// straggling after the release of its ID must not register the ID again.
+func (c *shard) idHitsFor(id uint64) *idHits {
+	if h := c.idHits.lookup(id); h != nil {
+		return h
+	}
+	return c.idHits.getIf(id, func() bool {
+		return c.ids.lookup(id) != nil
+	})
+}
+
+func (c *shard) Contains(id uint64, fileNum base.DiskFileNum, offset uint64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, _ := c.blocks.Get(key{fileKey{id, fileNum}, offset})
+	return e != nil && e.peekValue() != nil
+}
+
 func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *Value) Handle {
 	if n := value.refs(); n != 1 {
 		panic(fmt.Sprintf("pebble: Value has already been added to the cache: refs=%d", n))
@@ -136,12 +181,19 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.evictingFor = id
+	defer func() { c.evictingFor = 0 }()
 
 	k := key{fileKey{id, fileNum}, offset}
 	e, _ := c.blocks.Get(k)
 
 	switch {
 	case e == nil:
+		if sketch := c.sketch.Load(); sketch != nil &&
+			!c.admit(sketch, keyHash(id, fileNum, offset), int64(len(value.buf))) {
+			c.rejected.Add(1)
+			return Handle{value: value}
+		}
 		// no cache entry? add it
 		e = newEntry(c, k, int64(len(value.buf)))
 		e.setValue(value)
@@ -149,6 +201,7 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 			value.ref.trace("add-cold")
 			c.sizeCold += e.size
 			c.countCold++
+			c.updateIDUsage(e, e.size, 1)
 		} else {
 			value.ref.trace("skip-cold")
 			e.free()
@@ -160,6 +213,7 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 		e.setValue(value)
 		e.referenced.Store(true)
 		delta := int64(len(value.buf)) - e.size
+		c.updateIDUsage(e, delta, 0)
 		e.size = int64(len(value.buf))
 		if e.ptype == etHot {
 			value.ref.trace("add-hot")
@@ -190,6 +244,7 @@ func (c *shard) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *V
 			value.ref.trace("add-hot")
 			c.sizeHot += e.size
 			c.countHot++
+			c.updateIDUsage(e, e.size, 1)
 		} else {
 			value.ref.trace("skip-hot")
 			e.free()
@@ -302,6 +357,36 @@ func (c *shard) evictFileRun(fkey key) (moreRemaining bool) {
 	return true
 }
 
+// hotBlocks appends the keys of the blocks of the given ID to the hot,
+// referenced and cold slices, depending on their state.
+func (c *shard) hotBlocks(
+	id uint64, hot, referenced, cold []BlockKey,
+) ([]BlockKey, []BlockKey, []BlockKey) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	start := c.handHot
+	if start == nil {
+		return hot, referenced, cold
+	}
+	for e := start; ; {
+		if e.key.id == id && e.ptype != etTest {
+			k := BlockKey{FileNum: e.key.fileNum, Offset: e.key.offset}
+			switch {
+			case e.ptype == etHot:
+				hot = append(hot, k)
+			case e.referenced.Load():
+				referenced = append(referenced, k)
+			default:
+				cold = append(cold, k)
+			}
+		}
+		if e = e.next(); e == start {
+			break
+		}
+	}
+	return hot, referenced, cold
+}
+
 func (c *shard) Free() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -336,6 +421,26 @@ func (c *shard) Reserve(n int) {
 	c.checkConsistency()
 }
 
+// setMaxSize changes the maximum size of the shard, evicting blocks if the
+// shard no longer fits within it.
+func (c *shard) setMaxSize(maxSize int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxSize = maxSize
+
+	// See the comment in Reserve.
+	targetSize := c.targetSize()
+	if c.coldTarget > targetSize {
+		c.coldTarget = targetSize
+	}
+
+	c.evict()
+	for c.targetSize() < c.sizeTest && c.handTest != nil {
+		c.runHandTest()
+	}
+	c.checkConsistency()
+}
+
 // Size returns the current space used by the cache.
 func (c *shard) Size() int64 {
 	c.mu.RLock()
@@ -499,9 +604,11 @@ func (c *shard) metaEvict(e *entry) (evictedValue *Value) {
 	case etHot:
 		c.sizeHot -= e.size
 		c.countHot--
+		c.updateIDUsage(e, -e.size, -1)
 	case etCold:
 		c.sizeCold -= e.size
 		c.countCold--
+		c.updateIDUsage(e, -e.size, -1)
 	case etTest:
 		c.sizeTest -= e.size
 		c.countTest--
@@ -512,10 +619,48 @@ func (c *shard) metaEvict(e *entry) (evictedValue *Value) {
 	return evictedValue
 }
 
+// updateIDUsage records a change in the size and count of the blocks held in
+// the cache under the ID of the entry.
+func (c *shard) updateIDUsage(e *entry, size, count int64) {
+	// Only the addition of a block registers its ID: the blocks of a released
+	// ID may be evicted or replaced after its release, which must not register
+	// the ID again.
+	s := c.ids.lookup(e.key.id)
+	if s == nil {
+		if count <= 0 {
+			return
+		}
+		s = c.ids.get(e.key.id)
+	}
+	s.size.Add(size)
+	s.count.Add(count)
+}
+
 func (c *shard) evict() {
+	// While any ID has a quota, the cold hand skips the blocks of IDs other
+	// than evictingFor that are within their quota. If a full revolution of
+	// the clock does not free enough space, quotas are disregarded so that
+	// eviction always makes progress.
+	c.protectQuotas = c.ids.numQuotas.Load() > 0
+	var steps int64
 	for c.targetSize() <= c.sizeHot+c.sizeCold && c.handCold != nil {
+		if c.protectQuotas && steps > c.countHot+c.countCold+c.countTest {
+			c.protectQuotas = false
+		}
 		c.runHandCold(c.countCold, c.sizeCold)
+		steps++
 	}
+	c.protectQuotas = false
+}
+
+// protected returns true if the entry is protected from eviction by the quota
+// of its ID.
+func (c *shard) protected(e *entry) bool {
+	if !c.protectQuotas || e.key.id == c.evictingFor {
+		return false
+	}
+	s := c.ids.lookup(e.key.id)
+	return s != nil && s.withinQuota()
 }
 
 func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
@@ -538,11 +683,12 @@ func (c *shard) runHandCold(countColdDebug, sizeColdDebug int64) {
 			c.countCold--
 			c.sizeHot += e.size
 			c.countHot++
-		} else {
+		} else if !c.protected(e) {
 			e.setValue(nil)
 			e.ptype = etTest
 			c.sizeCold -= e.size
 			c.countCold--
+			c.updateIDUsage(e, -e.size, -1)
 			c.sizeTest += e.size
 			c.countTest++
 			for c.targetSize() < c.sizeTest && c.handTest != nil {
@@ -622,6 +768,9 @@ type Metrics struct {
 	Hits int64
 	// The number of cache misses.
 	Misses int64
+	// The number of blocks that were not added to the cache by the admission
+	// filter. See Cache.EnableAdmissionFilter.
+	Rejected int64
 }
 
 // Cache implements Pebble's sharded block cache. The Clock-PRO algorithm is
@@ -662,9 +811,10 @@ type Metrics struct {
 // "tracing" produces a significant slowdown, while "invariants" does not.
 type Cache struct {
 	refs    atomic.Int64
-	maxSize int64
+	maxSize atomic.Int64
 	idAlloc atomic.Uint64
 	shards  []shard
+	ids     idRegistry
 
 	// Traces recorded by Cache.trace. Used for debugging.
 	tr struct {
@@ -715,9 +865,9 @@ func New(size int64) *Cache {
 
 func newShards(size int64, shards int) *Cache {
 	c := &Cache{
-		maxSize: size,
-		shards:  make([]shard, shards),
+		shards: make([]shard, shards),
 	}
+	c.maxSize.Store(size)
 	c.refs.Store(1)
 	c.idAlloc.Store(1)
 	c.trace("alloc", c.refs.Load())
@@ -725,6 +875,7 @@ func newShards(size int64, shards int) *Cache {
 		c.shards[i] = shard{
 			maxSize:    size / int64(len(c.shards)),
 			coldTarget: size / int64(len(c.shards)),
+			ids:        &c.ids,
 		}
 		if entriesGoAllocated {
 			c.shards[i].entries = make(map[*entry]struct{})
@@ -754,30 +905,7 @@ func (c *Cache) getShard(id uint64, fileNum base.DiskFileNum, offset uint64) *sh
 	if id == 0 {
 		panic("pebble: 0 cache ID is invalid")
 	}
-
-	// Inlined version of fnv.New64 + Write.
-	const offset64 = 14695981039346656037
-	const prime64 = 1099511628211
-
-	h := uint64(offset64)
-	for i := 0; i < 8; i++ {
-		h *= prime64
-		h ^= uint64(id & 0xff)
-		id >>= 8
-	}
-	fileNumVal := uint64(fileNum)
-	for i := 0; i < 8; i++ {
-		h *= prime64
-		h ^= uint64(fileNumVal) & 0xff
-		fileNumVal >>= 8
-	}
-	for i := 0; i < 8; i++ {
-		h *= prime64
-		h ^= uint64(offset & 0xff)
-		offset >>= 8
-	}
-
-	return &c.shards[h%uint64(len(c.shards))]
+	return &c.shards[keyHash(id, fileNum, offset)%uint64(len(c.shards))]
 }
 
 // Ref adds a reference to the cache. The cache only remains valid as long a
@@ -807,13 +935,30 @@ func (c *Cache) Unref() {
 // Get retrieves the cache value for the specified file and offset, returning
 // nil if no value is present.
 func (c *Cache) Get(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
-	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset)
+	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset, true /* record */)
+}
+
+// Peek is like Get, but the access is not recorded by the admission filter. It
+// is used by the reads that do not add the blocks they read to the cache (see
+// UncachedHandle), so that they do not affect the admission of other blocks.
+func (c *Cache) Peek(id uint64, fileNum base.DiskFileNum, offset uint64) Handle {
+	return c.getShard(id, fileNum, offset).Get(id, fileNum, offset, false /* record */)
+}
+
+// Contains returns true if the cache contains a value for the specified file
+// and offset. Unlike Get, it is not counted as a hit or a miss, and does not
+// affect the eviction of the value.
+func (c *Cache) Contains(id uint64, fileNum base.DiskFileNum, offset uint64) bool {
+	return c.getShard(id, fileNum, offset).Contains(id, fileNum, offset)
 }
 
 // Set sets the cache value for the specified file and offset, overwriting an
 // existing value if present. A Handle is returned which provides faster
 // retrieval of the cached value than Get (lock-free and avoidance of the map
 // lookup). The value must have been allocated by Cache.Alloc.
+//
+// If the admission filter is enabled, the value may not be added to the cache;
+// the returned Handle is valid regardless.
 func (c *Cache) Set(id uint64, fileNum base.DiskFileNum, offset uint64, value *Value) Handle {
 	return c.getShard(id, fileNum, offset).Set(id, fileNum, offset, value)
 }
@@ -833,9 +978,46 @@ func (c *Cache) EvictFile(id uint64, fileNum base.DiskFileNum) {
 	}
 }
 
+// BlockKey identifies a cached block within the namespace of a cache ID.
+type BlockKey struct {
+	FileNum base.DiskFileNum
+	Offset  uint64
+}
+
+// HotBlocks returns the keys of up to n blocks of the given ID, preferring the
+// blocks that are accessed most frequently: the hot blocks are returned first,
+// followed by the cold blocks that were accessed since they were last swept by
+// the clock hands, followed by the other cold blocks.
+func (c *Cache) HotBlocks(id uint64, n int) []BlockKey {
+	var hot, referenced, cold []BlockKey
+	for i := range c.shards {
+		hot, referenced, cold = c.shards[i].hotBlocks(id, hot, referenced, cold)
+	}
+	res := append(append(hot, referenced...), cold...)
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
 // MaxSize returns the max size of the cache.
 func (c *Cache) MaxSize() int64 {
-	return c.maxSize
+	return c.maxSize.Load()
+}
+
+// SetCapacity changes the max size of the cache. Shrinking the cache evicts
+// blocks until the cache fits within the new size. The number of shards is
+// fixed when the cache is created, so a cache that grows much larger than its
+// initial size may experience more contention than a cache created at that
+// size. If the admission filter is enabled, its frequency sketch is resized
+// for the new size.
+func (c *Cache) SetCapacity(size int64) {
+	c.maxSize.Store(size)
+	shardSize := size / int64(len(c.shards))
+	for i := range c.shards {
+		c.shards[i].setMaxSize(shardSize)
+		c.shards[i].resizeSketch(shardSize)
+	}
 }
 
 // Size returns the current space used by the cache.
@@ -898,12 +1080,16 @@ func (c *Cache) Metrics() Metrics {
 		s.mu.RUnlock()
 		m.Hits += s.hits.Load()
 		m.Misses += s.misses.Load()
+		m.Rejected += s.rejected.Load()
 	}
 	return m
 }
 
 // NewID returns a new ID to be used as a namespace for cached file
-// blocks.
+// blocks. The ID is registered with the cache until it is released with
+// ReleaseID.
 func (c *Cache) NewID() uint64 {
-	return c.idAlloc.Add(1)
+	id := c.idAlloc.Add(1)
+	c.ids.get(id)
+	return id
 }
@@ -277,3 +277,302 @@ func TestReserveColdTarget(t *testing.T) {
 		t.Fatalf("expected positive cache size %d, but found %d", 48, cache.Size())
 	}
 }
+
+func TestSetCapacity(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	for i := 0; i < 10; i++ {
+		cache.Set(1, base.DiskFileNum(i), 0, testValue(cache, "a", 10)).Release()
+	}
+	require.LessOrEqual(t, cache.Size(), int64(100))
+
+	// Shrinking the cache evicts blocks.
+	cache.SetCapacity(50)
+	require.Equal(t, int64(50), cache.MaxSize())
+	require.Less(t, cache.Size(), int64(50))
+
+	// Growing the cache allows more blocks to be cached.
+	cache.SetCapacity(200)
+	for i := 0; i < 20; i++ {
+		cache.Set(1, base.DiskFileNum(i), 0, testValue(cache, "a", 10)).Release()
+	}
+	require.Greater(t, cache.Size(), int64(100))
+	require.LessOrEqual(t, cache.Size(), int64(200))
+}
+
+func TestQuota(t *testing.T) {
+	// Cache blocks of ID 1, then repeatedly access a working set of ID 2 that
+	// fills the cache, and count the blocks of ID 1 that remain.
+	run := func(quota int64) int {
+		cache := newShards(100, 1)
+		defer cache.Unref()
+		cache.SetQuota(1, quota)
+
+		for i := 0; i < 4; i++ {
+			cache.Set(1, base.DiskFileNum(i), 0, testValue(cache, "a", 10)).Release()
+		}
+		for j := 0; j < 10; j++ {
+			for i := 0; i < 10; i++ {
+				h := cache.Get(2, base.DiskFileNum(i), 0)
+				if h.Get() == nil {
+					cache.Set(2, base.DiskFileNum(i), 0, testValue(cache, "b", 10)).Release()
+				}
+				h.Release()
+			}
+		}
+		require.LessOrEqual(t, cache.Size(), int64(100))
+
+		var found int
+		for i := 0; i < 4; i++ {
+			h := cache.Get(1, base.DiskFileNum(i), 0)
+			if h.Get() != nil {
+				found++
+			}
+			h.Release()
+		}
+		m := cache.MetricsForID(1)
+		require.Equal(t, int64(found), m.Count)
+		require.Equal(t, int64(found*10), m.Size)
+		require.Equal(t, int64(found), m.Hits)
+		require.Equal(t, int64(4-found), m.Misses)
+		return found
+	}
+	require.Equal(t, 0, run(0))
+	// The blocks of ID 1 are evicted until they fit within the quota.
+	require.Equal(t, 2, run(20))
+	require.Equal(t, 4, run(50))
+}
+
+func TestMetricsByID(t *testing.T) {
+	cache := newShards(100, 4)
+	defer cache.Unref()
+
+	cache.Set(1, base.DiskFileNum(0), 0, testValue(cache, "a", 5)).Release()
+	cache.Set(2, base.DiskFileNum(0), 0, testValue(cache, "b", 7)).Release()
+	cache.Set(2, base.DiskFileNum(1), 0, testValue(cache, "b", 3)).Release()
+	cache.Get(1, base.DiskFileNum(0), 0).Release()
+	cache.Get(2, base.DiskFileNum(2), 0).Release()
+	cache.EvictFile(2, base.DiskFileNum(1))
+
+	require.Equal(t, map[uint64]Metrics{
+		1: {Size: 5, Count: 1, Hits: 1},
+		2: {Size: 7, Count: 1, Misses: 1},
+	}, cache.MetricsByID())
+
+	// Releasing an ID releases its metrics and its quota, even though its
+	// blocks remain cached until they are evicted.
+	cache.SetQuota(2, 10)
+	cache.ReleaseID(2)
+	require.Equal(t, int64(0), cache.ids.numQuotas.Load())
+	require.Equal(t, map[uint64]Metrics{
+		1: {Size: 5, Count: 1, Hits: 1},
+	}, cache.MetricsByID())
+	cache.EvictFile(2, base.DiskFileNum(0))
+	require.Equal(t, map[uint64]Metrics{
+		1: {Size: 5, Count: 1, Hits: 1},
+	}, cache.MetricsByID())
+	require.Equal(t, int64(5), cache.Size())
+
+	// Lookups straggling after the release of an ID do not register it again.
+	cache.Get(2, base.DiskFileNum(0), 0).Release()
+	cache.Get(2, base.DiskFileNum(3), 0).Release()
+	require.Equal(t, map[uint64]Metrics{
+		1: {Size: 5, Count: 1, Hits: 1},
+	}, cache.MetricsByID())
+
+	// An ID returned by NewID is registered before its first use, so that its
+	// first lookups count as misses.
+	id := cache.NewID()
+	cache.Get(id, base.DiskFileNum(0), 0).Release()
+	require.Equal(t, Metrics{Misses: 1}, cache.MetricsForID(id))
+	cache.ReleaseID(id)
+	cache.Get(id, base.DiskFileNum(0), 0).Release()
+	require.Equal(t, Metrics{}, cache.MetricsForID(id))
+}
+
+func TestHotBlocks(t *testing.T) {
+	cache := newShards(100, 1)
+	defer cache.Unref()
+
+	keys := func(fileNums ...int) []BlockKey {
+		var res []BlockKey
+		for _, f := range fileNums {
+			res = append(res, BlockKey{FileNum: base.DiskFileNum(f)})
+		}
+		return res
+	}
+	for i := 0; i < 5; i++ {
+		cache.Set(1, base.DiskFileNum(i), 0, testValue(cache, "a", 10)).Release()
+	}
+	cache.Set(2, base.DiskFileNum(0), 0, testValue(cache, "a", 10)).Release()
+	cache.Get(1, base.DiskFileNum(3), 0).Release()
+	require.Equal(t, keys(3), cache.HotBlocks(1, 100)[:1])
+	require.ElementsMatch(t, keys(0, 1, 2, 3, 4), cache.HotBlocks(1, 100))
+	require.Equal(t, keys(3), cache.HotBlocks(1, 2)[:1])
+	require.Len(t, cache.HotBlocks(1, 2), 2)
+	require.Equal(t, keys(0), cache.HotBlocks(2, 100))
+	require.Empty(t, cache.HotBlocks(3, 100))
+
+	// A block that is added back shortly after it was evicted becomes hot.
+	for i := 5; i < 11; i++ {
+		cache.Set(1, base.DiskFileNum(i), 0, testValue(cache, "a", 10)).Release()
+	}
+	cache.Set(1, base.DiskFileNum(0), 0, testValue(cache, "a", 10)).Release()
+	cache.Set(1, base.DiskFileNum(10), 0, testValue(cache, "a", 10)).Release()
+	require.Equal(t, keys(10), cache.HotBlocks(1, 100)[:1])
+}
+
+func TestFrequencySketch(t *testing.T) {
+	s := newFrequencySketch(1 << 20)
+	for i := 0; i < 10; i++ {
+		s.increment(1)
+	}
+	s.increment(2)
+	require.Equal(t, uint64(10), s.estimate(1))
+	require.Equal(t, uint64(1), s.estimate(2))
+	require.Equal(t, uint64(0), s.estimate(3))
+
+	// The counters saturate.
+	for i := 0; i < 20; i++ {
+		s.increment(1)
+	}
+	require.Equal(t, uint64(sketchMaxCount), s.estimate(1))
+
+	// The counters are halved after sampleSize additions.
+	for i := int64(0); s.additions.Load() < s.sampleSize-1; i++ {
+		s.increment(uint64(1000 + i%100))
+	}
+	s.increment(4)
+	require.Equal(t, uint64(sketchMaxCount/2), s.estimate(1))
+}
+
+// scanResistance simulates a workload in which a working set that fits in the
+// cache is read repeatedly, interleaved with a scan of blocks that are each
+// read once (3 of every 4 reads). It returns the hit rate of the reads of the
+// working set once the cache is warm.
+func scanResistance(admissionFilter bool) (hitRate float64, m Metrics) {
+	const hotBlocks = 800
+	const blockSize = 4 << 10
+	cache := newShards(1000*blockSize, 1)
+	defer cache.Unref()
+	if admissionFilter {
+		cache.EnableAdmissionFilter()
+	}
+	read := func(fileNum base.DiskFileNum, offset uint64) bool {
+		h := cache.Get(1, fileNum, offset)
+		if h.Get() != nil {
+			h.Release()
+			return true
+		}
+		cache.Set(1, fileNum, offset, testValue(cache, "a", blockSize)).Release()
+		return false
+	}
+	rng := rand.New(rand.NewSource(1))
+	var hits, reads int
+	var scanOffset uint64
+	for i := 0; i < 100000; i++ {
+		if i%4 != 0 {
+			read(2, scanOffset)
+			scanOffset++
+			continue
+		}
+		if read(1, uint64(rng.Intn(hotBlocks))) && i > 10000 {
+			hits++
+		}
+		if i > 10000 {
+			reads++
+		}
+	}
+	return float64(hits) / float64(reads), cache.Metrics()
+}
+
+func TestAdmissionFilter(t *testing.T) {
+	hitRate, m := scanResistance(false /* admissionFilter */)
+	require.Zero(t, m.Rejected)
+	filteredHitRate, m := scanResistance(true /* admissionFilter */)
+	require.NotZero(t, m.Rejected)
+	require.Greater(t, filteredHitRate, 0.96)
+	require.Greater(t, filteredHitRate, hitRate)
+
+	// Blocks are admitted while the cache is not full, and the handles of
+	// rejected blocks are valid.
+	cache := newShards(10, 1)
+	defer cache.Unref()
+	cache.EnableAdmissionFilter()
+	for i := 0; i < 10; i++ {
+		h := cache.Set(1, base.DiskFileNum(0), uint64(i), testValue(cache, "a", 1))
+		require.Equal(t, "a", string(h.Get()))
+		h.Release()
+	}
+	require.Zero(t, cache.Metrics().Rejected)
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 10; i++ {
+			cache.Get(1, base.DiskFileNum(0), uint64(i)).Release()
+		}
+	}
+	for i := 0; i < 10; i++ {
+		h := cache.Set(1, base.DiskFileNum(1), uint64(i), testValue(cache, "b", 1))
+		require.Equal(t, "b", string(h.Get()))
+		h.Release()
+	}
+	rejected := cache.Metrics().Rejected
+	require.NotZero(t, rejected)
+
+	// Peek does not record the access, so the block is rejected.
+	require.Nil(t, cache.Peek(1, base.DiskFileNum(2), 0).Get())
+	cache.Set(1, base.DiskFileNum(2), 0, testValue(cache, "c", 1)).Release()
+	require.Equal(t, rejected+1, cache.Metrics().Rejected)
+	require.Nil(t, cache.Peek(1, base.DiskFileNum(2), 0).Get())
+}
+
+func TestAdmissionFilterSetCapacity(t *testing.T) {
+	const shardSize = 1 << 20
+	cache := newShards(4*shardSize, 4)
+	defer cache.Unref()
+	sketches := func() (res []*frequencySketch) {
+		for i := range cache.shards {
+			res = append(res, cache.shards[i].sketch.Load())
+		}
+		return res
+	}
+
+	// Without the admission filter, there is no sketch to resize.
+	cache.SetCapacity(8 * shardSize)
+	for _, s := range sketches() {
+		require.Nil(t, s)
+	}
+
+	cache.EnableAdmissionFilter()
+	before := sketches()
+	for _, s := range before {
+		require.Equal(t, newFrequencySketch(2*shardSize).mask, s.mask)
+	}
+	// The sketches are kept if their size does not change.
+	cache.SetCapacity(8 * shardSize)
+	require.Equal(t, before, sketches())
+
+	// The sketches are resized when the cache grows or shrinks.
+	cache.SetCapacity(64 * shardSize)
+	for i, s := range sketches() {
+		require.NotSame(t, before[i], s)
+		require.Equal(t, newFrequencySketch(16*shardSize).mask, s.mask)
+		require.Greater(t, s.mask, before[i].mask)
+	}
+	cache.SetCapacity(4 * shardSize)
+	for _, s := range sketches() {
+		require.Equal(t, newFrequencySketch(shardSize).mask, s.mask)
+	}
+}
+
+func BenchmarkCacheScanResistance(b *testing.B) {
+	for _, admissionFilter := range []bool{false, true} {
+		b.Run(fmt.Sprintf("admission-filter=%t", admissionFilter), func(b *testing.B) {
+			var hitRate float64
+			for i := 0; i < b.N; i++ {
+				hitRate, _ = scanResistance(admissionFilter)
+			}
+			b.ReportMetric(hitRate*100, "hit%")
+		})
+	}
+}
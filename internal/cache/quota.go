@@ -0,0 +1,218 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// idState holds the quota and the usage of the blocks cached under a single
+// cache ID. The usage is summed across all shards.
+type idState struct {
+	quota atomic.Int64
+	size  atomic.Int64
+	count atomic.Int64
+}
+
+// withinQuota returns true if the ID has a quota and its usage does not exceed
+// it.
+func (s *idState) withinQuota() bool {
+	quota := s.quota.Load()
+	return quota > 0 && s.size.Load() <= quota
+}
+
+// idHits holds the hit and miss counts of a single cache ID within a shard.
+type idHits struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// idMap maps cache IDs to values of type T. Lookups are lock-free: the map is
+// copied on write, which only happens the first time an ID is used and when
+// it is released.
+type idMap[T any] struct {
+	mu sync.Mutex
+	m  atomic.Pointer[map[uint64]*T]
+}
+
+// lookup returns the value of the ID, or nil if the ID has no value.
+func (r *idMap[T]) lookup(id uint64) *T {
+	if m := r.m.Load(); m != nil {
+		return (*m)[id]
+	}
+	return nil
+}
+
+// get returns the value of the ID, creating it if necessary.
+func (r *idMap[T]) get(id uint64) *T {
+	return r.getIf(id, nil)
+}
+
+// getIf returns the value of the ID. If the ID has no value, it creates one
+// only if cond is nil or returns true, and returns nil otherwise. cond is
+// called with r.mu held, which orders it with respect to remove.
+func (r *idMap[T]) getIf(id uint64, cond func() bool) *T {
+	if v := r.lookup(id); v != nil {
+		return v
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v := r.lookup(id); v != nil {
+		return v
+	}
+	if cond != nil && !cond() {
+		return nil
+	}
+	m := r.clone(1)
+	v := new(T)
+	m[id] = v
+	r.m.Store(&m)
+	return v
+}
+
+// remove removes the value of the ID, if any.
+func (r *idMap[T]) remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeLocked(id)
+}
+
+// removeLocked removes the value of the ID, returning it, or nil if the ID
+// has no value.
+//
+// REQUIRES: r.mu is held.
+func (r *idMap[T]) removeLocked(id uint64) *T {
+	v := r.lookup(id)
+	if v != nil {
+		m := r.clone(0)
+		delete(m, id)
+		r.m.Store(&m)
+	}
+	return v
+}
+
+// clone returns a copy of the map, with room for extra more entries.
+//
+// REQUIRES: r.mu is held.
+func (r *idMap[T]) clone(extra int) map[uint64]*T {
+	old := r.m.Load()
+	if old == nil {
+		return make(map[uint64]*T, extra)
+	}
+	m := make(map[uint64]*T, len(*old)+extra)
+	for k, v := range *old {
+		m[k] = v
+	}
+	return m
+}
+
+// idRegistry maps cache IDs to their idState.
+type idRegistry struct {
+	idMap[idState]
+	// numQuotas is the number of IDs with a non-zero quota. Quotas are only
+	// considered during eviction if it is non-zero.
+	numQuotas atomic.Int64
+}
+
+func (r *idRegistry) setQuota(id uint64, quota int64) {
+	if quota < 0 {
+		quota = 0
+	}
+	s := r.get(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := s.quota.Swap(quota)
+	switch {
+	case old == 0 && quota != 0:
+		r.numQuotas.Add(1)
+	case old != 0 && quota == 0:
+		r.numQuotas.Add(-1)
+	}
+}
+
+func (r *idRegistry) release(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s := r.removeLocked(id); s != nil && s.quota.Swap(0) != 0 {
+		r.numQuotas.Add(-1)
+	}
+}
+
+// SetQuota sets a soft quota in bytes on the blocks cached under the specified
+// ID. While the blocks of an ID occupy no more than its quota, they are
+// protected from eviction caused by the insertion of blocks under other IDs,
+// for as long as the cache can reclaim space from IDs that have no quota or
+// that exceed their quota. This prevents a single busy DB sharing the cache
+// from evicting the working set of the other DBs. A quota of zero removes the
+// quota.
+//
+// The quota is soft: an ID may exceed its quota when there is free space in
+// the cache, and the blocks of an ID within its quota are still evicted when
+// no other blocks can be evicted.
+func (c *Cache) SetQuota(id uint64, quota int64) {
+	if id == 0 {
+		panic("pebble: 0 cache ID is invalid")
+	}
+	c.ids.setQuota(id, quota)
+}
+
+// ReleaseID releases the quota and the metrics of the specified ID, once the
+// owner of the ID is closed. Blocks cached under the ID remain in the cache
+// until they are evicted, but are no longer accounted for, and lookups under
+// the ID no longer count as hits or misses.
+func (c *Cache) ReleaseID(id uint64) {
+	// The ID is removed from the registry before its hit counts, so that a
+	// concurrent lookup cannot recreate the hit counts after their removal;
+	// see shard.idHitsFor.
+	c.ids.release(id)
+	for i := range c.shards {
+		c.shards[i].idHits.remove(id)
+	}
+}
+
+// MetricsForID returns the metrics for the blocks cached under the specified
+// ID. The hit and miss counts are kept per shard and summed.
+func (c *Cache) MetricsForID(id uint64) Metrics {
+	var m Metrics
+	if s := c.ids.lookup(id); s != nil {
+		m.Size = s.size.Load()
+		m.Count = s.count.Load()
+	}
+	for i := range c.shards {
+		if h := c.shards[i].idHits.lookup(id); h != nil {
+			m.Hits += h.hits.Load()
+			m.Misses += h.misses.Load()
+		}
+	}
+	return m
+}
+
+// MetricsByID returns the metrics for the blocks cached under each ID that has
+// been used with the cache and not released.
+func (c *Cache) MetricsByID() map[uint64]Metrics {
+	ids := make(map[uint64]struct{})
+	if m := c.ids.m.Load(); m != nil {
+		for id := range *m {
+			ids[id] = struct{}{}
+		}
+	}
+	for i := range c.shards {
+		if m := c.shards[i].idHits.m.Load(); m != nil {
+			for id := range *m {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	res := make(map[uint64]Metrics, len(ids))
+	for id := range ids {
+		res[id] = c.MetricsForID(id)
+	}
+	return res
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/rangefilter"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
@@ -1159,6 +1160,61 @@ func TestIteratorRandomizedBlockIntervalFilter(t *testing.T) {
 	require.Equal(t, 0, len(matchingKeyValues))
 }
 
+func TestIteratorRangeFilter(t *testing.T) {
+	opts := &Options{
+		FS:                 vfs.NewMem(),
+		FormatMajorVersion: internalFormatNewest,
+		Levels:             []LevelOptions{{RangeFilterPolicy: rangefilter.FilterPolicy(16)}},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+	// Write two overlapping tables: one with keys "a" and "z", and one with key
+	// "m".
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+	require.NoError(t, d.Set([]byte("z"), []byte("z"), nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Set([]byte("m"), []byte("m"), nil))
+	require.NoError(t, d.Flush())
+
+	keys := func(iter *Iterator) string {
+		var buf strings.Builder
+		for valid := iter.First(); valid; valid = iter.Next() {
+			fmt.Fprintf(&buf, "%s ", iter.Key())
+		}
+		require.NoError(t, iter.Error())
+		return strings.TrimSpace(buf.String())
+	}
+
+	iter, err := d.NewIter(&IterOptions{LowerBound: []byte("b"), UpperBound: []byte("c")})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, iter.Close())
+	}()
+	require.Equal(t, "", keys(iter))
+	// The table containing "a" and "z" overlaps the bounds, but its range
+	// filter excludes it without reading any of its blocks.
+	require.Zero(t, iter.Stats().InternalStats.BlockBytes)
+
+	// Tables excluded by their range filter are reconsidered when the bounds
+	// change.
+	for _, tc := range []struct {
+		lower, upper string
+		want         string
+	}{
+		{"a", "b", "a"},
+		{"b", "c", ""},
+		{"l", "n", "m"},
+		{"y", "zz", "z"},
+		{"a", "zz", "a m z"},
+	} {
+		iter.SetBounds([]byte(tc.lower), []byte(tc.upper))
+		require.Equal(t, tc.want, keys(iter), "[%s, %s)", tc.lower, tc.upper)
+	}
+}
+
 func TestIteratorGuaranteedDurable(t *testing.T) {
 	mem := vfs.NewMem()
 	opts := &Options{FS: mem}
@@ -25,6 +25,11 @@ type internalIterOpts struct {
 	bufferPool         *sstable.BufferPool
 	stats              *base.InternalIteratorStats
 	boundLimitedFilter sstable.BoundLimitedBlockPropertyFilter
+	// if useRangeFilter is set, point iterators are not created for sstables
+	// whose range filter excludes the iterator bounds. The caller must then be
+	// prepared to receive an empty point iterator, and to reopen the sstable
+	// if the bounds change.
+	useRangeFilter bool
 }
 
 // levelIter provides a merged view of the sstables in a level.
@@ -204,6 +209,7 @@ func (l *levelIter) init(
 	l.files = files
 	l.exhaustedDir = 0
 	l.internalOpts = internalOpts
+	l.internalOpts.useRangeFilter = true
 }
 
 func (l *levelIter) initRangeDel(rangeDelIter *keyspan.FragmentIterator) {
@@ -1165,6 +1171,14 @@ func (l *levelIter) SetBounds(lower, upper []byte) {
 	if l.iter == nil {
 		return
 	}
+	if l.iter == emptyIter {
+		// The table was excluded without opening an iterator, possibly by its
+		// range filter given the previous bounds. Close so that the table is
+		// reconsidered under the new bounds when the levelIter is next
+		// positioned.
+		_ = l.Close()
+		return
+	}
 
 	// Update tableOpts.{Lower,Upper}Bound in case the new boundaries fall within
 	// the boundaries of the current table.
@@ -226,9 +226,10 @@ func (m *memTable) apply(batch *Batch, seqNum uint64) error {
 		case InternalKeyKindRangeKeySet, InternalKeyKindRangeKeyUnset, InternalKeyKindRangeKeyDelete:
 			err = m.rangeKeySkl.Add(ikey, value)
 			rangeKeyCount++
-		case InternalKeyKindLogData:
-			// Don't increment seqNum for LogData, since these are not applied
-			// to the memtable.
+		case InternalKeyKindLogData, InternalKeyKindAssertAbsent, InternalKeyKindAssertExists,
+			InternalKeyKindAssertValue:
+			// Don't increment seqNum for LogData or conditions, since these are
+			// not applied to the memtable.
 			seqNum--
 		case InternalKeyKindIngestSST:
 			panic("pebble: cannot apply ingested sstable key kind to memtable")
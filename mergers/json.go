@@ -0,0 +1,192 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// JSONMerge is a merger which merges JSON objects field by field, following
+// the JSON merge patch semantics (RFC 7386): each operand is a patch of the
+// result of the older operands, whose fields replace the fields of the same
+// name, except that objects are merged recursively and null values remove
+// fields. The base value of a key must also be a JSON object.
+//
+// An operand may also be a JSON array of patches, which are applied in order.
+// A patch can't always be combined with the patch preceding it (for instance
+// {"a":1} followed by {"a":{"b":2}}, which replaces field a rather than merging
+// it), so the partial merges done during compactions produce such arrays.
+var JSONMerge = &base.Merger{
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		m := &jsonMerger{}
+		return m, m.MergeNewer(value)
+	},
+	Name: "pebble.json.merge",
+}
+
+type jsonObject = map[string]interface{}
+
+type jsonMerger struct {
+	// patches holds the operands merged so far, from oldest to newest. A patch
+	// is combined with the preceding one whenever possible.
+	patches []jsonObject
+}
+
+var _ base.DeletableValueMerger = (*jsonMerger)(nil)
+
+// decodeJSONPatches decodes an operand of JSONMerge into a list of patches.
+func decodeJSONPatches(value []byte) ([]jsonObject, error) {
+	d := json.NewDecoder(bytes.NewReader(value))
+	// Preserve the representation of numbers.
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, base.CorruptionErrorf("pebble: invalid JSON operand: %v", err)
+	}
+	if d.More() {
+		return nil, base.CorruptionErrorf("pebble: invalid JSON operand: trailing data")
+	}
+	switch v := v.(type) {
+	case jsonObject:
+		return []jsonObject{v}, nil
+	case []interface{}:
+		patches := make([]jsonObject, len(v))
+		for i := range v {
+			var ok bool
+			if patches[i], ok = v[i].(jsonObject); !ok {
+				return nil, base.CorruptionErrorf("pebble: JSON operand is not an array of objects")
+			}
+		}
+		return patches, nil
+	default:
+		return nil, base.CorruptionErrorf("pebble: JSON operand is neither an object nor an array")
+	}
+}
+
+// MergeNewer implements base.ValueMerger.
+func (m *jsonMerger) MergeNewer(value []byte) error {
+	patches, err := decodeJSONPatches(value)
+	if err != nil {
+		return err
+	}
+	for _, p := range patches {
+		if n := len(m.patches); n > 0 && canCombineJSONPatches(m.patches[n-1], p) {
+			combineJSONPatches(m.patches[n-1], p)
+		} else {
+			m.patches = append(m.patches, p)
+		}
+	}
+	return nil
+}
+
+// MergeOlder implements base.ValueMerger.
+func (m *jsonMerger) MergeOlder(value []byte) error {
+	patches, err := decodeJSONPatches(value)
+	if err != nil {
+		return err
+	}
+	for i := len(patches) - 1; i >= 0; i-- {
+		p := patches[i]
+		if len(m.patches) > 0 && canCombineJSONPatches(p, m.patches[0]) {
+			combineJSONPatches(p, m.patches[0])
+			m.patches[0] = p
+		} else {
+			m.patches = append([]jsonObject{p}, m.patches...)
+		}
+	}
+	return nil
+}
+
+// Finish implements base.ValueMerger.
+func (m *jsonMerger) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	var v interface{}
+	switch {
+	case includesBase:
+		doc := make(jsonObject)
+		for _, p := range m.patches {
+			applyJSONPatch(doc, p)
+		}
+		v = doc
+	case len(m.patches) == 1:
+		v = m.patches[0]
+	default:
+		v = m.patches
+	}
+	value, err := json.Marshal(v)
+	return value, nil, err
+}
+
+// DeletableFinish implements base.DeletableValueMerger. Empty patches are
+// dropped, unless they include the base value, which must remain to shadow
+// the older values of the key.
+func (m *jsonMerger) DeletableFinish(includesBase bool) ([]byte, bool, io.Closer, error) {
+	if !includesBase && len(m.patches) == 1 && len(m.patches[0]) == 0 {
+		return nil, true, nil, nil
+	}
+	value, closer, err := m.Finish(includesBase)
+	return value, false, closer, err
+}
+
+// canCombineJSONPatches returns true if the patch newer, applied after the
+// patch older, can be expressed as a single patch. This is not the case if
+// newer merges an object into a field which older sets to a value other than
+// an object, or removes: the field must then be replaced by the object, which
+// a patch can't express.
+func canCombineJSONPatches(older, newer jsonObject) bool {
+	for k, v := range newer {
+		newerObj, ok := v.(jsonObject)
+		if !ok {
+			continue
+		}
+		olderV, ok := older[k]
+		if !ok {
+			continue
+		}
+		olderObj, ok := olderV.(jsonObject)
+		if !ok || !canCombineJSONPatches(olderObj, newerObj) {
+			return false
+		}
+	}
+	return true
+}
+
+// combineJSONPatches combines the patch newer into the patch older, which
+// becomes the combination of the two.
+//
+// REQUIRES: canCombineJSONPatches(older, newer)
+func combineJSONPatches(older, newer jsonObject) {
+	for k, v := range newer {
+		if newerObj, ok := v.(jsonObject); ok {
+			if olderObj, ok := older[k].(jsonObject); ok {
+				combineJSONPatches(olderObj, newerObj)
+				continue
+			}
+		}
+		older[k] = v
+	}
+}
+
+// applyJSONPatch applies the patch to the JSON object doc.
+func applyJSONPatch(doc, patch jsonObject) {
+	for k, v := range patch {
+		switch v := v.(type) {
+		case nil:
+			delete(doc, k)
+		case jsonObject:
+			target, ok := doc[k].(jsonObject)
+			if !ok {
+				target = make(jsonObject)
+			}
+			applyJSONPatch(target, v)
+			doc[k] = target
+		default:
+			doc[k] = v
+		}
+	}
+}
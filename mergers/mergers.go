@@ -0,0 +1,219 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package mergers provides ready-made implementations of pebble.Merger for
+// common merge operations: integer addition, maximum and minimum, append with
+// a delimiter, union of sets, and merging of JSON documents.
+//
+// The names of the mergers are stable. Pebble records the name of the merger
+// in the OPTIONS file and in the properties of sstables, and refuses to open a
+// database with a merger other than the one it was created with. ByName looks
+// up a merger by the name recorded in an OPTIONS file.
+//
+// All the mergers support partial merges: during compactions, a run of merge
+// operands which doesn't include the base value of a key is combined into a
+// single operand, which keeps merge chains short. The mergers for which some
+// combination of operands has no effect (a zero sum, an empty set, an empty
+// JSON patch) implement pebble.DeletableValueMerger, to drop such operands
+// altogether.
+package mergers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// ByName returns the merger with the given name: either one of the mergers
+// returned by All, a merger returned by NewAppend, or the default merger of
+// Pebble.
+func ByName(name string) (*base.Merger, error) {
+	if name == base.DefaultMerger.Name {
+		return base.DefaultMerger, nil
+	}
+	for _, m := range All() {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	if strings.HasPrefix(name, appendNamePrefix) && strings.HasSuffix(name, ")") {
+		delim, err := strconv.Unquote(name[len(appendNamePrefix) : len(name)-1])
+		if err == nil {
+			return NewAppend([]byte(delim)), nil
+		}
+	}
+	return nil, errors.Errorf("pebble: unknown merger %q", errors.Safe(name))
+}
+
+// All returns the mergers of this package, except the mergers returned by
+// NewAppend, which depend on their delimiter.
+func All() []*base.Merger {
+	return []*base.Merger{Int64Add, Uint64Add, Max, Min, SetUnion, JSONMerge}
+}
+
+// EncodeInt64 encodes v as an operand of Int64Add.
+func EncodeInt64(v int64) []byte {
+	return EncodeUint64(uint64(v))
+}
+
+// DecodeInt64 decodes a value of Int64Add.
+func DecodeInt64(value []byte) (int64, error) {
+	v, err := DecodeUint64(value)
+	return int64(v), err
+}
+
+// EncodeUint64 encodes v as an operand of Uint64Add. The encoding is 8 bytes
+// big-endian, so that the encoded values sort numerically under Max and Min.
+func EncodeUint64(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, v)
+}
+
+// DecodeUint64 decodes a value of Uint64Add.
+func DecodeUint64(value []byte) (uint64, error) {
+	if len(value) != 8 {
+		return 0, base.CorruptionErrorf("pebble: invalid integer operand of length %d", errors.Safe(len(value)))
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// Int64Add is a merger which adds int64 operands, encoded with EncodeInt64.
+// The addition wraps around on overflow.
+var Int64Add = &base.Merger{
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		m := &adder{}
+		return m, m.MergeNewer(value)
+	},
+	Name: "pebble.int64.add",
+}
+
+// Uint64Add is a merger which adds uint64 operands, encoded with
+// EncodeUint64. The addition wraps around on overflow.
+var Uint64Add = &base.Merger{
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		m := &adder{}
+		return m, m.MergeNewer(value)
+	},
+	Name: "pebble.uint64.add",
+}
+
+// adder implements Int64Add and Uint64Add, which only differ by the
+// interpretation of their operands: in two's complement, the sum is the same.
+type adder struct {
+	sum uint64
+}
+
+var _ base.DeletableValueMerger = (*adder)(nil)
+
+// MergeNewer implements base.ValueMerger.
+func (a *adder) MergeNewer(value []byte) error {
+	v, err := DecodeUint64(value)
+	a.sum += v
+	return err
+}
+
+// MergeOlder implements base.ValueMerger.
+func (a *adder) MergeOlder(value []byte) error {
+	return a.MergeNewer(value)
+}
+
+// Finish implements base.ValueMerger.
+func (a *adder) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return EncodeUint64(a.sum), nil, nil
+}
+
+// DeletableFinish implements base.DeletableValueMerger. Operands which add up
+// to zero are dropped, unless they include the base value, which must remain
+// to shadow the older values of the key.
+func (a *adder) DeletableFinish(includesBase bool) ([]byte, bool, io.Closer, error) {
+	if !includesBase && a.sum == 0 {
+		return nil, true, nil, nil
+	}
+	value, closer, err := a.Finish(includesBase)
+	return value, false, closer, err
+}
+
+// Max is a merger which keeps the greatest operand, comparing operands
+// bytewise. Integers encoded with EncodeUint64 compare numerically.
+var Max = &base.Merger{
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		return &extremum{sign: 1, value: append([]byte(nil), value...)}, nil
+	},
+	Name: "pebble.bytes.max",
+}
+
+// Min is a merger which keeps the smallest operand, comparing operands
+// bytewise. Integers encoded with EncodeUint64 compare numerically.
+var Min = &base.Merger{
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		return &extremum{sign: -1, value: append([]byte(nil), value...)}, nil
+	},
+	Name: "pebble.bytes.min",
+}
+
+// extremum implements Max (sign 1) and Min (sign -1).
+type extremum struct {
+	sign  int
+	value []byte
+}
+
+// MergeNewer implements base.ValueMerger.
+func (e *extremum) MergeNewer(value []byte) error {
+	if bytes.Compare(value, e.value)*e.sign > 0 {
+		e.value = append(e.value[:0], value...)
+	}
+	return nil
+}
+
+// MergeOlder implements base.ValueMerger.
+func (e *extremum) MergeOlder(value []byte) error {
+	return e.MergeNewer(value)
+}
+
+// Finish implements base.ValueMerger.
+func (e *extremum) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return e.value, nil, nil
+}
+
+const appendNamePrefix = "pebble.append("
+
+// NewAppend returns a merger which concatenates the operands from oldest to
+// newest, separated by delim. Its name embeds the delimiter, quoted as a Go
+// string literal, for instance pebble.append(",").
+func NewAppend(delim []byte) *base.Merger {
+	delim = append([]byte(nil), delim...)
+	return &base.Merger{
+		Merge: func(key, value []byte) (base.ValueMerger, error) {
+			return &appender{delim: delim, buf: append([]byte(nil), value...)}, nil
+		},
+		Name: appendNamePrefix + strconv.Quote(string(delim)) + ")",
+	}
+}
+
+type appender struct {
+	delim []byte
+	buf   []byte
+}
+
+// MergeNewer implements base.ValueMerger.
+func (a *appender) MergeNewer(value []byte) error {
+	a.buf = append(append(a.buf, a.delim...), value...)
+	return nil
+}
+
+// MergeOlder implements base.ValueMerger.
+func (a *appender) MergeOlder(value []byte) error {
+	buf := make([]byte, 0, len(value)+len(a.delim)+len(a.buf))
+	a.buf = append(append(append(buf, value...), a.delim...), a.buf...)
+	return nil
+}
+
+// Finish implements base.ValueMerger.
+func (a *appender) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return a.buf, nil, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergers
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// merge merges the operands, from oldest to newest, either by merging newer
+// operands or by merging older operands.
+func merge(
+	t *testing.T, m *base.Merger, newer, includesBase bool, operands ...[]byte,
+) (value []byte, deleted bool) {
+	var vm base.ValueMerger
+	var err error
+	if newer {
+		vm, err = m.Merge(nil, operands[0])
+		require.NoError(t, err)
+		for _, op := range operands[1:] {
+			require.NoError(t, vm.MergeNewer(op))
+		}
+	} else {
+		vm, err = m.Merge(nil, operands[len(operands)-1])
+		require.NoError(t, err)
+		for i := len(operands) - 2; i >= 0; i-- {
+			require.NoError(t, vm.MergeOlder(operands[i]))
+		}
+	}
+	if dvm, ok := vm.(base.DeletableValueMerger); ok {
+		value, deleted, _, err = dvm.DeletableFinish(includesBase)
+	} else {
+		value, _, err = vm.Finish(includesBase)
+	}
+	require.NoError(t, err)
+	return value, deleted
+}
+
+func TestMergers(t *testing.T) {
+	testCases := []struct {
+		merger   *base.Merger
+		operands [][]byte
+		want     []byte
+		// identity is a run of operands which has no effect.
+		identity [][]byte
+	}{
+		{
+			merger:   Int64Add,
+			operands: [][]byte{EncodeInt64(5), EncodeInt64(-3), EncodeInt64(10), EncodeInt64(-20)},
+			want:     EncodeInt64(-8),
+			identity: [][]byte{EncodeInt64(-3), EncodeInt64(3)},
+		},
+		{
+			merger:   Uint64Add,
+			operands: [][]byte{EncodeUint64(3), EncodeUint64(math.MaxUint64), EncodeUint64(7)},
+			want:     EncodeUint64(9),
+			identity: [][]byte{EncodeUint64(math.MaxUint64), EncodeUint64(1)},
+		},
+		{
+			merger:   Max,
+			operands: [][]byte{EncodeUint64(3), EncodeUint64(1 << 40), EncodeUint64(7)},
+			want:     EncodeUint64(1 << 40),
+		},
+		{
+			merger:   Min,
+			operands: [][]byte{[]byte("b"), []byte("a"), []byte("c")},
+			want:     []byte("a"),
+		},
+		{
+			merger:   NewAppend([]byte(", ")),
+			operands: [][]byte{[]byte("a"), []byte("b"), []byte(""), []byte("c")},
+			want:     []byte("a, b, , c"),
+		},
+		{
+			merger: SetUnion,
+			operands: [][]byte{
+				EncodeSet([]byte("b"), []byte("a"), []byte("b")),
+				EncodeSet(),
+				EncodeSet([]byte("c"), []byte("a")),
+				EncodeSet([]byte("aa")),
+			},
+			want:     EncodeSet([]byte("a"), []byte("aa"), []byte("b"), []byte("c")),
+			identity: [][]byte{EncodeSet(), EncodeSet()},
+		},
+		{
+			merger: JSONMerge,
+			operands: [][]byte{
+				[]byte(`{"a":1,"b":{"c":1,"d":null},"e":[1,2]}`),
+				[]byte(`{"b":{"d":2.50}}`),
+				[]byte(`{"a":null,"f":"x"}`),
+				[]byte(`{"b":5}`),
+				[]byte(`[{"b":{"g":3}},{"f":{"h":null}}]`),
+				[]byte(`{"a":{"i":true}}`),
+			},
+			want:     []byte(`{"a":{"i":true},"b":{"g":3},"e":[1,2],"f":{}}`),
+			identity: [][]byte{[]byte(`{}`), []byte(`[]`), []byte(`{}`)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.merger.Name, func(t *testing.T) {
+			for _, newer := range []bool{true, false} {
+				got, deleted := merge(t, tc.merger, newer, true, tc.operands...)
+				require.False(t, deleted)
+				require.Equal(t, tc.want, got)
+			}
+
+			// Merging runs of operands partially yields the same result.
+			for i := 0; i < len(tc.operands); i++ {
+				for j := i + 1; j <= len(tc.operands); j++ {
+					for _, newer := range []bool{true, false} {
+						partial, deleted := merge(t, tc.merger, newer, false, tc.operands[i:j]...)
+						operands := append([][]byte(nil), tc.operands[:i]...)
+						if !deleted {
+							operands = append(operands, partial)
+						}
+						operands = append(operands, tc.operands[j:]...)
+						got, _ := merge(t, tc.merger, !newer, true, operands...)
+						require.Equal(t, tc.want, got, "partial merge of [%d,%d): %s", i, j, partial)
+					}
+				}
+			}
+
+			// Runs of operands which have no effect are dropped, but only if they
+			// don't include the base value.
+			if tc.identity != nil {
+				_, deleted := merge(t, tc.merger, true, false, tc.identity...)
+				require.True(t, deleted)
+				_, deleted = merge(t, tc.merger, true, true, tc.identity...)
+				require.False(t, deleted)
+			}
+		})
+	}
+}
+
+func TestMergersInvalidOperands(t *testing.T) {
+	testCases := []struct {
+		merger  *base.Merger
+		operand string
+	}{
+		{Int64Add, "1234"},
+		{Uint64Add, ""},
+		{SetUnion, "\x05ab"},
+		{SetUnion, "\x01b\x01a"},
+		{JSONMerge, `"a"`},
+		{JSONMerge, `[{}, 1]`},
+		{JSONMerge, `{} {}`},
+	}
+	for _, tc := range testCases {
+		_, err := tc.merger.Merge(nil, []byte(tc.operand))
+		require.Error(t, err, "%s: %q", tc.merger.Name, tc.operand)
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, m := range append(All(), base.DefaultMerger, NewAppend(nil), NewAppend([]byte(")\n\""))) {
+		got, err := ByName(m.Name)
+		require.NoError(t, err)
+		require.Equal(t, m.Name, got.Name)
+	}
+	for _, name := range []string{"", "pebble.unknown", "pebble.append(", `pebble.append(",)`} {
+		_, err := ByName(name)
+		require.Error(t, err, "%q", name)
+	}
+}
+
+func TestMergersDB(t *testing.T) {
+	opts := &pebble.Options{FS: vfs.NewMem(), Merger: JSONMerge}
+	d, err := pebble.Open("", opts)
+	require.NoError(t, err)
+	get := func(key string) string {
+		v, closer, err := d.Get([]byte(key))
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+
+	// Merge runs of patches in successive flushes, so that the compactions
+	// merge them partially.
+	require.NoError(t, d.Set([]byte("a"), []byte(`{"n":0}`), nil))
+	for i := 1; i <= 10; i++ {
+		for _, key := range []string{"a", "b"} {
+			patch := fmt.Sprintf(`{"n":%d,"x%d":{"y":%d}}`, i, i%3, i)
+			require.NoError(t, d.Merge([]byte(key), []byte(patch), nil))
+		}
+		if i%2 == 0 {
+			require.NoError(t, d.Merge([]byte("b"), []byte(`{"x0":null}`), nil))
+		}
+		require.NoError(t, d.Flush())
+		if i%3 == 0 {
+			require.NoError(t, d.Compact([]byte("a"), []byte("c"), false))
+		}
+	}
+	require.Equal(t, `{"n":10,"x0":{"y":9},"x1":{"y":10},"x2":{"y":8}}`, get("a"))
+	require.Equal(t, `{"n":10,"x1":{"y":10},"x2":{"y":8}}`, get("b"))
+	require.NoError(t, d.Close())
+
+	// The name of the merger is recorded in the OPTIONS file.
+	ls, err := opts.FS.List("")
+	require.NoError(t, err)
+	var found bool
+	for _, name := range ls {
+		if strings.HasPrefix(name, "OPTIONS-") {
+			f, err := opts.FS.Open(name)
+			require.NoError(t, err)
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			require.Contains(t, string(data), "merger="+JSONMerge.Name)
+			found = true
+		}
+	}
+	require.True(t, found)
+}
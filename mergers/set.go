@@ -0,0 +1,117 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package mergers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// SetUnion is a merger which computes the union of sets of items, encoded
+// with EncodeSet.
+var SetUnion = &base.Merger{
+	Merge: func(key, value []byte) (base.ValueMerger, error) {
+		m := &setUnion{}
+		return m, m.MergeNewer(value)
+	},
+	Name: "pebble.set.union",
+}
+
+// EncodeSet encodes the set of the given items as an operand of SetUnion. The
+// encoding is the sequence of the distinct items in increasing bytewise order,
+// each prefixed with its length as a uvarint.
+func EncodeSet(items ...[]byte) []byte {
+	items = slices.Clone(items)
+	slices.SortFunc(items, bytes.Compare)
+	items = slices.CompactFunc(items, bytes.Equal)
+	return appendSet(nil, items)
+}
+
+// DecodeSet decodes a value of SetUnion into its items, in increasing bytewise
+// order. The items alias value.
+func DecodeSet(value []byte) ([][]byte, error) {
+	var items [][]byte
+	for len(value) > 0 {
+		n, w := binary.Uvarint(value)
+		if w <= 0 || n > uint64(len(value)-w) {
+			return nil, base.CorruptionErrorf("pebble: invalid set operand")
+		}
+		item := value[w : w+int(n)]
+		if len(items) > 0 && bytes.Compare(items[len(items)-1], item) >= 0 {
+			return nil, base.CorruptionErrorf("pebble: set operand items out of order")
+		}
+		items = append(items, item)
+		value = value[w+int(n):]
+	}
+	return items, nil
+}
+
+func appendSet(buf []byte, items [][]byte) []byte {
+	for _, item := range items {
+		buf = binary.AppendUvarint(buf, uint64(len(item)))
+		buf = append(buf, item...)
+	}
+	return buf
+}
+
+type setUnion struct {
+	// items holds the union of the operands so far, in increasing bytewise
+	// order.
+	items [][]byte
+}
+
+var _ base.DeletableValueMerger = (*setUnion)(nil)
+
+// MergeNewer implements base.ValueMerger.
+func (s *setUnion) MergeNewer(value []byte) error {
+	// The operand is owned by the caller, so the union references a copy.
+	items, err := DecodeSet(slices.Clone(value))
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	union := make([][]byte, 0, len(s.items)+len(items))
+	i, j := 0, 0
+	for i < len(s.items) && j < len(items) {
+		switch c := bytes.Compare(s.items[i], items[j]); {
+		case c < 0:
+			union = append(union, s.items[i])
+			i++
+		case c > 0:
+			union = append(union, items[j])
+			j++
+		default:
+			union = append(union, s.items[i])
+			i, j = i+1, j+1
+		}
+	}
+	union = append(union, s.items[i:]...)
+	s.items = append(union, items[j:]...)
+	return nil
+}
+
+// MergeOlder implements base.ValueMerger.
+func (s *setUnion) MergeOlder(value []byte) error {
+	return s.MergeNewer(value)
+}
+
+// Finish implements base.ValueMerger.
+func (s *setUnion) Finish(includesBase bool) ([]byte, io.Closer, error) {
+	return appendSet(nil, s.items), nil, nil
+}
+
+// DeletableFinish implements base.DeletableValueMerger. Empty operands are
+// dropped, unless they include the base value, which must remain to shadow
+// the older values of the key.
+func (s *setUnion) DeletableFinish(includesBase bool) ([]byte, bool, io.Closer, error) {
+	if !includesBase && len(s.items) == 0 {
+		return nil, true, nil, nil
+	}
+	value, closer, err := s.Finish(includesBase)
+	return value, false, closer, err
+}
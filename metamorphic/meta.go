@@ -535,6 +535,20 @@ func RunOnce(t TestingT, runDir string, seed uint64, historyPath string, rOpts .
 		}
 	}
 
+	if len(testOpts.Opts.WALStripeDirs) > 0 {
+		if runOpts.numInstances > 1 {
+			// TODO: allow opts to diverge on a per-instance basis, like for
+			// WALFailover.
+			testOpts.Opts.WALStripeDirs = nil
+		} else {
+			for i := range testOpts.Opts.WALStripeDirs {
+				testOpts.Opts.WALStripeDirs[i].FS = opts.FS
+				testOpts.Opts.WALStripeDirs[i].Dirname = opts.FS.PathJoin(
+					runDir, testOpts.Opts.WALStripeDirs[i].Dirname)
+			}
+		}
+	}
+
 	if opts.WALDir != "" {
 		if runOpts.numInstances > 1 {
 			// TODO(bilal): Allow opts to diverge on a per-instance basis, and use
@@ -107,7 +107,14 @@ func (o *applyOp) run(t *Test, h historyRecorder) {
 	b := t.getBatch(o.batchID)
 	w := t.getWriter(o.writerID)
 	var err error
-	if o.writerID.tag() == dbTag && t.testOpts.asyncApplyToDB && t.writeOpts.Sync {
+	if o.writerID.tag() == dbTag && t.testOpts.pipelinedApplyToDB {
+		writeOpts := *t.writeOpts
+		writeOpts.Pipelined = true
+		err = w.(*pebble.DB).ApplyNoSyncWait(b, &writeOpts)
+		if err == nil {
+			err = b.SyncWait()
+		}
+	} else if o.writerID.tag() == dbTag && t.testOpts.asyncApplyToDB && t.writeOpts.Sync {
 		err = w.(*pebble.DB).ApplyNoSyncWait(b, t.writeOpts)
 		if err == nil {
 			err = b.SyncWait()
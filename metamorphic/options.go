@@ -23,6 +23,9 @@ import (
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/objstorage/remote/s3"
+	"github.com/cockroachdb/pebble/rangefilter"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/wal"
@@ -50,6 +53,12 @@ func parseOptions(
 	hooks := &pebble.ParseHooks{
 		NewCache:        pebble.NewCache,
 		NewFilterPolicy: filterPolicyFromName,
+		NewRangeFilterPolicy: func(name string) (pebble.RangeFilterPolicy, error) {
+			if name != rangefilter.FilterPolicy(0).Name() {
+				return nil, errors.Errorf("Invalid range filter policy name '%s'", name)
+			}
+			return rangefilter.FilterPolicy(16), nil
+		},
 		SkipUnknown: func(name, value string) bool {
 			switch name {
 			case "TestOptions":
@@ -106,14 +115,12 @@ func parseOptions(
 				return true
 			case "TestOptions.shared_storage_enabled":
 				opts.sharedStorageEnabled = true
-				opts.sharedStorageFS = remote.NewInMem()
 				if opts.Opts.Experimental.CreateOnShared == remote.CreateOnSharedNone {
 					opts.Opts.Experimental.CreateOnShared = remote.CreateOnSharedAll
 				}
 				return true
 			case "TestOptions.external_storage_enabled":
 				opts.externalStorageEnabled = true
-				opts.externalStorageFS = remote.NewInMem()
 				return true
 			case "TestOptions.secondary_cache_enabled":
 				opts.secondaryCacheEnabled = true
@@ -162,6 +169,15 @@ func parseOptions(
 			case "TestOptions.use_excise":
 				opts.useExcise = true
 				return true
+			case "TestOptions.pipelined_apply_to_db":
+				opts.pipelinedApplyToDB = true
+				return true
+			case "TestOptions.unordered_writes":
+				opts.unorderedWrites = true
+				return true
+			case "TestOptions.s3_storage":
+				opts.s3Storage = true
+				return true
 			default:
 				if customOptionParsers == nil {
 					return false
@@ -183,6 +199,9 @@ func parseOptions(
 	if opts.Opts.WALFailover != nil {
 		opts.Opts.WALFailover.Secondary.FS = opts.Opts.FS
 	}
+	for i := range opts.Opts.WALStripeDirs {
+		opts.Opts.WALStripeDirs[i].FS = opts.Opts.FS
+	}
 	opts.InitRemoteStorageFactory()
 	opts.Opts.EnsureDefaults()
 	return err
@@ -255,6 +274,15 @@ func optionsToString(opts *TestOptions) string {
 	if opts.useExcise {
 		fmt.Fprintf(&buf, "  use_excise=%v\n", opts.useExcise)
 	}
+	if opts.pipelinedApplyToDB {
+		fmt.Fprint(&buf, "  pipelined_apply_to_db=true\n")
+	}
+	if opts.unorderedWrites {
+		fmt.Fprint(&buf, "  unordered_writes=true\n")
+	}
+	if opts.s3Storage {
+		fmt.Fprint(&buf, "  s3_storage=true\n")
+	}
 	for _, customOpt := range opts.CustomOpts {
 		fmt.Fprintf(&buf, "  %s=%s\n", customOpt.Name(), customOpt.Value())
 	}
@@ -390,22 +418,60 @@ type TestOptions struct {
 	// excises. However !useExcise && !useSharedReplicate can be used to guarantee
 	// lack of excises.
 	useExcise bool
+	// Use DB.ApplyNoSyncWait with WriteOptions.Pipelined for applies to the
+	// DB, followed by Batch.SyncWait.
+	pipelinedApplyToDB bool
+	// Set WriteOptions.Unordered on all writes. The operations of the test
+	// wait for their writes, so the relaxed visibility is not observable.
+	unorderedWrites bool
+	// Store shared and external objects in S3 buckets served by an in-process
+	// fake S3 server, rather than in memory.
+	s3Storage bool
 }
 
-// InitRemoteStorageFactory initializes Opts.Experimental.RemoteStorage.
+// InitRemoteStorageFactory initializes Opts.Experimental.RemoteStorage,
+// creating the shared and external storage if necessary.
 func (testOpts *TestOptions) InitRemoteStorageFactory() {
 	if testOpts.sharedStorageEnabled || testOpts.externalStorageEnabled {
 		m := make(map[remote.Locator]remote.Storage)
 		if testOpts.sharedStorageEnabled {
+			if testOpts.sharedStorageFS == nil {
+				testOpts.sharedStorageFS = testOpts.newRemoteStorage()
+			}
 			m[""] = testOpts.sharedStorageFS
 		}
 		if testOpts.externalStorageEnabled {
+			if testOpts.externalStorageFS == nil {
+				testOpts.externalStorageFS = testOpts.newRemoteStorage()
+			}
 			m["external"] = testOpts.externalStorageFS
 		}
 		testOpts.Opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(m)
 	}
 }
 
+// newRemoteStorage returns a new, empty remote.Storage: an in-memory store, or
+// if s3Storage is set, an S3 store backed by its own fake S3 server.
+func (testOpts *TestOptions) newRemoteStorage() remote.Storage {
+	if !testOpts.s3Storage {
+		return remote.NewInMem()
+	}
+	creds := s3.Credentials{AccessKeyID: "metamorphic", SecretAccessKey: "metamorphic"}
+	server := s3.NewFakeServer(creds, "metamorphic")
+	storage, err := s3.New(s3.Config{
+		Endpoint:    "http://s3.metamorphic",
+		Bucket:      "metamorphic",
+		Credentials: creds,
+		// Use small parts so that multipart uploads are exercised.
+		PartSize:   64 << 10,
+		HTTPClient: server.Client(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return storage
+}
+
 // CustomOption defines a custom option that configures the behavior of an
 // individual test run. Like all test options, custom options are serialized to
 // the OPTIONS file even if they're not options ordinarily understood by Pebble.
@@ -566,6 +632,14 @@ func standardOptions() []*TestOptions {
   shared_storage_enabled=true
   external_storage_enabled=true
   secondary_cache_enabled=false
+`, pebble.FormatSyntheticPrefixSuffix),
+		30: fmt.Sprintf(`
+[Options]
+  format_major_version=%s
+[TestOptions]
+  shared_storage_enabled=true
+  external_storage_enabled=true
+  s3_storage=true
 `, pebble.FormatSyntheticPrefixSuffix),
 	}
 
@@ -673,6 +747,13 @@ func RandomOptions(
 			},
 		}
 	}
+	// A quarter of the time without failover, stripe the WALs.
+	if opts.WALFailover == nil && rng.Intn(4) == 0 {
+		opts.WALStripeDirs = []wal.Dir{
+			{FS: vfs.Default, Dirname: "data/wal_stripe1"},
+			{FS: vfs.Default, Dirname: "data/wal_stripe2"},
+		}
+	}
 	if rng.Intn(4) == 0 {
 		// Enable Writer parallelism for 25% of the random options. Setting
 		// MaxWriterConcurrency to any value greater than or equal to 1 has the
@@ -707,18 +788,26 @@ func RandomOptions(
 	lopts.IndexBlockSize = 1 << uint(rng.Intn(24)) // 1 - 16MB
 	lopts.TargetFileSize = 1 << uint(rng.Intn(28)) // 1 - 256MB
 
-	// We either use no bloom filter, the default filter, or a filter with
-	// randomized bits-per-key setting. We zero out the Filters map. It'll get
-	// repopulated on EnsureDefaults accordingly.
+	// We either use no bloom filter, the default filter, a ribbon filter, or a
+	// bloom filter with randomized bits-per-key setting. We zero out the
+	// Filters map. It'll get repopulated on EnsureDefaults accordingly.
 	opts.Filters = nil
-	switch rng.Intn(3) {
+	switch rng.Intn(4) {
 	case 0:
 		lopts.FilterPolicy = nil
 	case 1:
 		lopts.FilterPolicy = bloom.FilterPolicy(10)
+	case 2:
+		lopts.FilterPolicy = ribbon.FilterPolicy(10)
 	default:
 		lopts.FilterPolicy = newTestingFilterPolicy(1 << rng.Intn(5))
 	}
+	// Randomly use a range filter. The testkeys comparer orders key prefixes
+	// bytewise, as the range filter requires.
+	opts.RangeFilters = nil
+	if rng.Intn(2) == 0 {
+		lopts.RangeFilterPolicy = rangefilter.FilterPolicy(16)
+	}
 
 	// We use either no compression, snappy compression or zstd compression.
 	switch rng.Intn(3) {
@@ -758,6 +847,9 @@ func RandomOptions(
 	if opts.WALFailover != nil {
 		opts.WALFailover.Secondary.FS = opts.FS
 	}
+	for i := range opts.WALStripeDirs {
+		opts.WALStripeDirs[i].FS = opts.FS
+	}
 	testOpts.ingestUsingApply = rng.Intn(2) != 0
 	testOpts.deleteSized = rng.Intn(2) != 0
 	testOpts.replaceSingleDelete = rng.Intn(2) != 0
@@ -777,7 +869,6 @@ func RandomOptions(
 		if testOpts.Opts.FormatMajorVersion < pebble.FormatMinForSharedObjects {
 			testOpts.Opts.FormatMajorVersion = pebble.FormatMinForSharedObjects
 		}
-		testOpts.sharedStorageFS = remote.NewInMem()
 		// If shared storage is enabled, pick between writing all files on shared
 		// vs. lower levels only, 50% of the time.
 		testOpts.Opts.Experimental.CreateOnShared = remote.CreateOnSharedAll
@@ -800,7 +891,6 @@ func RandomOptions(
 		if testOpts.Opts.FormatMajorVersion < pebble.FormatSyntheticPrefixSuffix {
 			testOpts.Opts.FormatMajorVersion = pebble.FormatSyntheticPrefixSuffix
 		}
-		testOpts.externalStorageFS = remote.NewInMem()
 	}
 
 	testOpts.seedEFOS = rng.Uint64()
@@ -812,6 +902,17 @@ func RandomOptions(
 			testOpts.Opts.FormatMajorVersion = pebble.FormatVirtualSSTables
 		}
 	}
+
+	// The options below are drawn from a separate source, derived from a value
+	// drawn above, so that they don't change the draws of the options above:
+	// the same seed generates the same options as before they were added. New
+	// options are appended here.
+	extraRng := rand.New(rand.NewSource(testOpts.seedEFOS ^ 0x9e3779b97f4a7c15))
+	testOpts.pipelinedApplyToDB = extraRng.Intn(2) == 0
+	testOpts.unorderedWrites = extraRng.Intn(4) == 0
+	// A quarter of the time, store shared and external objects in S3 (if
+	// enabled).
+	testOpts.s3Storage = extraRng.Intn(4) == 0
 	testOpts.InitRemoteStorageFactory()
 	testOpts.Opts.EnsureDefaults()
 	return testOpts
@@ -870,6 +971,17 @@ func setupInitialState(dataDir string, testOpts *TestOptions) error {
 			Dirname: failoverDir,
 		})
 	}
+
+	// Likewise for the WAL stripe dirs.
+	for _, stripe := range []string{"wal_stripe1", "wal_stripe2"} {
+		stripeDir := testOpts.Opts.FS.PathJoin(dataDir, stripe)
+		if _, err := testOpts.Opts.FS.Stat(stripeDir); err == nil && len(testOpts.Opts.WALStripeDirs) == 0 {
+			testOpts.Opts.WALRecoveryDirs = append(testOpts.Opts.WALRecoveryDirs, wal.Dir{
+				FS:      testOpts.Opts.FS,
+				Dirname: stripeDir,
+			})
+		}
+	}
 	return nil
 }
 
@@ -909,6 +1021,8 @@ func filterPolicyFromName(name string) (pebble.FilterPolicy, error) {
 		return nil, nil
 	case "rocksdb.BuiltinBloomFilter":
 		return bloom.FilterPolicy(10), nil
+	case "pebble.RibbonFilter":
+		return ribbon.FilterPolicy(10), nil
 	}
 	var bitsPerKey int
 	if _, err := fmt.Sscanf(name, testingFilterPolicyFmt, &bitsPerKey); err != nil {
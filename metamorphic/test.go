@@ -92,6 +92,9 @@ func (t *Test) init(
 	} else {
 		t.writeOpts = pebble.NoSync
 	}
+	if testOpts.unorderedWrites {
+		t.writeOpts = &pebble.WriteOptions{Sync: t.writeOpts.Sync, Unordered: true}
+	}
 	testOpts.Opts.WithFSDefaults()
 	t.opts = testOpts.Opts.EnsureDefaults()
 	t.opts.Logger = h
@@ -8,11 +8,13 @@ import (
 	"fmt"
 	"math"
 	"time"
+	"unsafe"
 
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/cache"
 	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/sharedcache"
+	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/wal"
@@ -35,6 +37,10 @@ type ThroughputMetric = base.ThroughputMetric
 // file system.
 type SecondaryCacheMetrics = sharedcache.Metrics
 
+// RemoteStorageMetrics holds the retry, rate limiting and circuit breaker
+// counters of the remote storage (see remote.WithRetries).
+type RemoteStorageMetrics = remote.RetryMetrics
+
 // LevelMetrics holds per-level metrics such as the number of files and total
 // size of the files, and compaction related metrics.
 type LevelMetrics struct {
@@ -150,6 +156,9 @@ func (m *LevelMetrics) WriteAmp() float64 {
 // metrics reflect those operations.
 type Metrics struct {
 	BlockCache CacheMetrics
+	// BlockCacheForDB holds the metrics for the DB's blocks within BlockCache,
+	// which may be shared with other DBs.
+	BlockCacheForDB CacheMetrics
 
 	Compact struct {
 		// The total number of compactions, and per-compaction type counts.
@@ -185,6 +194,24 @@ type Metrics struct {
 		Count uint64
 	}
 
+	// DiskQuota holds the status of the disk quota (see DiskQuotaOptions), as
+	// of the last check. It is empty if no quota is configured.
+	DiskQuota struct {
+		// Exceeded is true if the quota is exceeded.
+		Exceeded bool
+		// FreeBytes is the space available on the volume of the DB, or 0 if the
+		// filesystem doesn't report it.
+		FreeBytes uint64
+		// UsageBytes is the disk space used by the DB.
+		UsageBytes uint64
+		// MinFreeBytes and MaxUsageBytes are the thresholds of the quota.
+		MinFreeBytes  uint64
+		MaxUsageBytes uint64
+		// RejectedWrites is the number of writes rejected with
+		// ErrDiskQuotaExceeded since the DB was opened.
+		RejectedWrites uint64
+	}
+
 	Flush struct {
 		// The total number of flushes.
 		Count           int64
@@ -307,6 +334,30 @@ type Metrics struct {
 		Failover wal.FailoverStats
 	}
 
+	// WALArchive holds the progress of the archival of the obsolete WALs (see
+	// WALArchiveOptions). It is empty if archival is not enabled.
+	WALArchive struct {
+		// QueuedFiles and QueuedBytes are the number and size of the obsolete
+		// WALs waiting to be archived. They are kept on disk until then.
+		QueuedFiles int64
+		QueuedBytes uint64
+		// ArchivedFiles and ArchivedBytes are the number and size of the WALs
+		// archived since the DB was opened.
+		ArchivedFiles int64
+		ArchivedBytes uint64
+		// LargestSeqNum is the largest sequence number in the archived WALs.
+		LargestSeqNum uint64
+		// Lag is the time since the oldest queued WAL was queued, or zero if no
+		// WAL is queued.
+		Lag time.Duration
+		// Failures is the number of failed uploads since the DB was opened.
+		Failures int64
+		// SkippedFiles is the number of WALs that were not archived because of a
+		// permanent failure (e.g. the WAL can't be read) since the DB was opened.
+		// They are left on disk. The other failures are retried.
+		SkippedFiles int64
+	}
+
 	LogWriter struct {
 		FsyncLatency prometheus.Histogram
 		record.LogWriterMetrics
@@ -316,6 +367,10 @@ type Metrics struct {
 
 	SecondaryCacheMetrics SecondaryCacheMetrics
 
+	// RemoteStorage holds the counters of the remote storage objects that were
+	// wrapped with remote.WithRetries.
+	RemoteStorage RemoteStorageMetrics
+
 	private struct {
 		optionsFileSize  uint64
 		manifestFileSize uint64
@@ -345,6 +400,7 @@ func (m *Metrics) DiskSpaceUsage() uint64 {
 	var usageBytes uint64
 	usageBytes += m.WAL.PhysicalSize
 	usageBytes += m.WAL.ObsoletePhysicalSize
+	usageBytes += m.WALArchive.QueuedBytes
 	usageBytes += m.Table.Local.LiveSize
 	usageBytes += m.Table.Local.ObsoleteSize
 	usageBytes += m.Table.Local.ZombieSize
@@ -560,6 +616,18 @@ func (m *Metrics) SafeFormat(w redact.SafePrinter, _ rune) {
 		w.Printf(" failover: (switches: %d, primary: %s, secondary: %s)\n", m.WAL.Failover.DirSwitchCount,
 			m.WAL.Failover.PrimaryWriteDuration.String(), m.WAL.Failover.SecondaryWriteDuration.String())
 	}
+	if m.WALArchive.QueuedFiles > 0 || m.WALArchive.ArchivedFiles > 0 || m.WALArchive.Failures > 0 {
+		// Only shown when WAL archival is active.
+		w.Printf("WAL archive: queued: %d (%s)  archived: %d (%s)  seqnum: %d  lag: %s  failures: %d  skipped: %d\n",
+			redact.Safe(m.WALArchive.QueuedFiles),
+			humanize.Bytes.Uint64(m.WALArchive.QueuedBytes),
+			redact.Safe(m.WALArchive.ArchivedFiles),
+			humanize.Bytes.Uint64(m.WALArchive.ArchivedBytes),
+			redact.Safe(m.WALArchive.LargestSeqNum),
+			redact.Safe(m.WALArchive.Lag.Round(time.Millisecond)),
+			redact.Safe(m.WALArchive.Failures),
+			redact.Safe(m.WALArchive.SkippedFiles))
+	}
 
 	w.Printf("Flushes: %d\n", redact.Safe(m.Flush.Count))
 
@@ -596,13 +664,28 @@ func (m *Metrics) SafeFormat(w redact.SafePrinter, _ rune) {
 		redact.Safe(m.NumVirtual()),
 		humanize.Bytes.Uint64(m.VirtualSize()))
 	w.Printf("Local tables size: %s\n", humanize.Bytes.Uint64(m.Table.Local.LiveSize))
+	if m.DiskQuota.MinFreeBytes > 0 || m.DiskQuota.MaxUsageBytes > 0 {
+		// Only shown when a disk quota is configured.
+		w.Printf("Disk quota: exceeded: %t  free: %s (min %s)  usage: %s (max %s)  rejected writes: %d\n",
+			redact.Safe(m.DiskQuota.Exceeded),
+			humanize.Bytes.Uint64(m.DiskQuota.FreeBytes),
+			humanize.Bytes.Uint64(m.DiskQuota.MinFreeBytes),
+			humanize.Bytes.Uint64(m.DiskQuota.UsageBytes),
+			humanize.Bytes.Uint64(m.DiskQuota.MaxUsageBytes),
+			redact.Safe(m.DiskQuota.RejectedWrites))
+	}
 
 	formatCacheMetrics := func(m *CacheMetrics, name redact.SafeString) {
-		w.Printf("%s: %s entries (%s)  hit rate: %.1f%%\n",
+		w.Printf("%s: %s entries (%s)  hit rate: %.1f%%",
 			name,
 			humanize.Count.Int64(m.Count),
 			humanize.Bytes.Int64(m.Size),
 			redact.Safe(hitRate(m.Hits, m.Misses)))
+		if m.Rejected > 0 {
+			// Only shown when the admission filter is enabled.
+			w.Printf("  rejected: %s", humanize.Count.Int64(m.Rejected))
+		}
+		w.Printf("\n")
 	}
 	formatCacheMetrics(&m.BlockCache, "Block cache")
 	formatCacheMetrics(&m.TableCache, "Table cache")
@@ -613,6 +696,12 @@ func (m *Metrics) SafeFormat(w redact.SafePrinter, _ rune) {
 			humanize.Count.Int64(m.Count),
 			humanize.Bytes.Int64(m.Size),
 			redact.Safe(hitRate(m.ReadsWithFullHit, m.ReadsWithPartialHit+m.ReadsWithNoHit)))
+		if m.WarmStartBlocks > 0 {
+			w.Printf("  warm start: %s blocks (%s discarded)  hit rate: %.1f%%\n",
+				humanize.Count.Int64(m.WarmStartBlocks),
+				humanize.Count.Int64(m.WarmStartDiscarded),
+				redact.Safe(hitRate(m.WarmStartHits, m.TotalReads-m.WarmStartHits)))
+		}
 	}
 	formatSharedCacheMetrics(w, &m.SecondaryCacheMetrics, "Secondary cache")
 
@@ -640,14 +729,18 @@ func percent(numerator, denominator int64) float64 {
 	return 100 * float64(numerator) / float64(denominator)
 }
 
+// tableCacheEntrySize64 is Sizeof(sstable.Reader{}) on 64-bit platforms, which
+// is the size of the entries of the table cache (see TestMetrics).
+const tableCacheEntrySize64 = 840
+
 // StringForTests is identical to m.String() on 64-bit platforms. It is used to
 // provide a platform-independent result for tests.
 func (m *Metrics) StringForTests() string {
 	mCopy := *m
 	if math.MaxInt == math.MaxInt32 {
-		// This is the difference in Sizeof(sstable.Reader{})) between 64 and 32 bit
-		// platforms.
-		const tableCacheSizeAdjustment = 212
+		// The size of the table cache is a multiple of Sizeof(sstable.Reader{}),
+		// which is smaller on 32 bit platforms.
+		tableCacheSizeAdjustment := tableCacheEntrySize64 - int64(unsafe.Sizeof(sstable.Reader{}))
 		mCopy.TableCache.Size += mCopy.TableCache.Count * tableCacheSizeAdjustment
 	}
 	return redact.StringWithoutMarkers(&mCopy)
@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"unsafe"
 
 	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/pebble/internal/cache"
@@ -101,6 +102,9 @@ func TestMetrics(t *testing.T) {
 	if runtime.GOARCH == "386" {
 		t.Skip("skipped on 32-bit due to slightly varied output")
 	}
+	// The expected output depends on the size of the entries of the table
+	// cache, which StringForTests uses on 32-bit platforms.
+	require.Equal(t, uintptr(tableCacheEntrySize64), unsafe.Sizeof(sstable.Reader{}))
 	defer sstable.DeterministicReadBlockDurationForTesting()()
 
 	var d *DB
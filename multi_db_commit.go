@@ -0,0 +1,444 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// CommitAtomic applies batches to several DBs atomically: after a crash,
+// either all the batches are applied or none of them are. Each batch must be
+// bound to a different DB (see DB.NewBatch), and the DBs must have a WAL.
+//
+// CommitAtomic implements a two-phase commit in which coordinator is a
+// separate DB which records the outcome of the transaction txnID:
+//
+//  1. Each batch is prepared: it is written to the WAL of its DB within a
+//     prepare record, and synced, but is not applied.
+//  2. The transaction is committed by setting the key txnID in coordinator,
+//     and syncing it. If a batch fails to prepare, the transaction is aborted
+//     instead, and the prepared batches are discarded.
+//  3. Each batch is applied to its DB, and synced.
+//  4. The key txnID is deleted from coordinator.
+//
+// If a DB is closed or crashes between steps 1 and 3, its batch is in doubt
+// when the DB is reopened, and Open resolves it using
+// Options.ResolvePreparedBatch, which should look up the commit record in
+// coordinator (see CoordinatorResolver). If CommitAtomic fails after step 2,
+// the transaction is committed but some of the batches may only be applied
+// once their DB is reopened, and the commit record is left in coordinator.
+//
+// The batches must not have conditions (see Batch.SetIfAbsent), and their DBs
+// must be at FormatAtomicCommit or later. txnID must be a valid key for the
+// Comparer of coordinator, and must not be used by a concurrent transaction.
+// The batches are not closed by CommitAtomic, and must not be committed
+// otherwise.
+func CommitAtomic(coordinator *DB, txnID []byte, batches ...*Batch) error {
+	if len(txnID) == 0 {
+		return errors.New("pebble: empty transaction ID")
+	}
+	dbs := make(map[*DB]struct{}, len(batches))
+	for _, b := range batches {
+		switch {
+		case b.db == nil:
+			return errors.New("pebble: batch of an atomic commit is not bound to a DB")
+		case b.db == coordinator:
+			return errors.New("pebble: batch of an atomic commit is bound to the coordinator")
+		case b.db.opts.DisableWAL:
+			return errors.New("pebble: atomic commit to a DB without a WAL")
+		case b.db.opts.ReadOnly:
+			return ErrReadOnly
+		case b.db.FormatMajorVersion() < FormatAtomicCommit:
+			return errors.Newf("pebble: atomic commits require at least format major version %d (current: %d)",
+				FormatAtomicCommit, b.db.FormatMajorVersion())
+		case b.ingestedSSTBatch || b.committing:
+			return ErrInvalidBatch
+		case b.hasConditions:
+			// The conditions could only be evaluated when the batch is applied,
+			// after the transaction is committed.
+			return errors.New("pebble: batch of an atomic commit has conditions")
+		}
+		if _, ok := dbs[b.db]; ok {
+			return errors.New("pebble: several batches of an atomic commit are bound to the same DB")
+		}
+		dbs[b.db] = struct{}{}
+	}
+
+	var err error
+	prepared := batches[:0:0]
+	for _, b := range batches {
+		if err = b.db.prepareBatch(txnID, b); err != nil {
+			break
+		}
+		prepared = append(prepared, b)
+	}
+	if err == nil {
+		err = coordinator.Set(txnID, nil, Sync)
+	}
+	if err != nil {
+		// In the absence of a commit record, the transaction is presumed
+		// aborted, so failing to abort a prepared batch only delays discarding
+		// it until its DB is reopened.
+		for _, b := range prepared {
+			err = firstError(err, b.db.resolvePreparedBatch(txnID, nil))
+		}
+		return err
+	}
+
+	for _, b := range batches {
+		if err := b.db.resolvePreparedBatch(txnID, b); err != nil {
+			return errors.Wrapf(err, "pebble: transaction %q is committed but not applied", txnID)
+		}
+	}
+	// The batches are synced, so the commit record is no longer needed.
+	return coordinator.Delete(txnID, NoSync)
+}
+
+// CoordinatorResolver returns an implementation of Options.ResolvePreparedBatch
+// for the DBs whose atomic commits are coordinated by coordinator. A
+// transaction is committed if its commit record exists in coordinator.
+func CoordinatorResolver(coordinator *DB) func(txnID []byte) (committed bool, err error) {
+	return func(txnID []byte) (bool, error) {
+		_, closer, err := coordinator.Get(txnID)
+		if err == ErrNotFound {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return true, closer.Close()
+	}
+}
+
+// The records of an atomic commit are written to the WAL as LogData entries,
+// whose data starts with twoPhasePrefix, followed by the kind of the record,
+// the uvarint length of the transaction ID and the transaction ID. A prepare
+// record is the only entry of its batch, and is followed by the repr of the
+// prepared batch. A commit record is the first entry of the batch which
+// applies the prepared batch, while an abort record is the only entry of its
+// batch.
+const twoPhasePrefix = "\x00pebble.2pc\x00"
+
+const (
+	twoPhasePrepare byte = 'p'
+	twoPhaseCommit  byte = 'c'
+	twoPhaseAbort   byte = 'a'
+)
+
+func encodeTwoPhaseRecord(kind byte, txnID, repr []byte) []byte {
+	buf := make([]byte, 0, len(twoPhasePrefix)+1+binary.MaxVarintLen64+len(txnID)+len(repr))
+	buf = append(buf, twoPhasePrefix...)
+	buf = append(buf, kind)
+	buf = binary.AppendUvarint(buf, uint64(len(txnID)))
+	buf = append(buf, txnID...)
+	return append(buf, repr...)
+}
+
+func decodeTwoPhaseRecord(data []byte) (kind byte, txnID, repr []byte, ok bool) {
+	if !bytes.HasPrefix(data, []byte(twoPhasePrefix)) || len(data) == len(twoPhasePrefix) {
+		return 0, nil, nil, false
+	}
+	data = data[len(twoPhasePrefix):]
+	kind = data[0]
+	n, l := binary.Uvarint(data[1:])
+	if l <= 0 || n > uint64(len(data)-1-l) {
+		return 0, nil, nil, false
+	}
+	data = data[1+l:]
+	return kind, data[:n], data[n:], true
+}
+
+// isTwoPhaseRecord returns true if the first entry of the batch repr is a
+// record of an atomic commit.
+func isTwoPhaseRecord(repr []byte) bool {
+	r := batchrepr.Read(repr)
+	kind, data, _, ok, err := r.Next()
+	if err != nil || !ok || kind != InternalKeyKindLogData {
+		return false
+	}
+	_, _, _, ok = decodeTwoPhaseRecord(data)
+	return ok
+}
+
+// preparedBatches tracks the batches of a DB which are prepared but neither
+// committed nor aborted. Their prepare records must survive the WAL which
+// contains them, so they are written again to each new WAL (see
+// DB.relogPreparedBatches), and the in-doubt batches are resolved by Open.
+type preparedBatches struct {
+	mu struct {
+		sync.Mutex
+		// batches maps the transaction IDs to the prepared batches.
+		batches map[string]preparedBatch
+		// seq orders the prepared batches, by order of preparation.
+		seq uint64
+		// reserved is the number of units of commitPipeline.logSyncQSem
+		// reserved to sync the prepare records written to a new WAL, which
+		// must not block while holding commitPipeline.mu. One unit is reserved
+		// when a batch is prepared, and is released when the batch is resolved
+		// or spent by a WAL rotation. reserved <= len(batches).
+		reserved int
+	}
+}
+
+type preparedBatch struct {
+	seq uint64
+	// record is the WAL record containing the prepare record.
+	record []byte
+	// repr is the repr of the prepared batch, within record.
+	repr []byte
+}
+
+// addPreparedBatch registers the prepared batch of transaction txnID, given
+// the WAL record containing its prepare record. The caller must not hold any
+// lock.
+func (d *DB) addPreparedBatch(txnID []byte, record []byte, repr []byte) error {
+	d.commit.logSyncQSem <- struct{}{}
+	p := &d.prepared
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.mu.batches[string(txnID)]; ok {
+		<-d.commit.logSyncQSem
+		return errors.Errorf("pebble: transaction %q is already prepared", txnID)
+	}
+	if p.mu.batches == nil {
+		p.mu.batches = make(map[string]preparedBatch)
+	}
+	p.mu.seq++
+	p.mu.batches[string(txnID)] = preparedBatch{seq: p.mu.seq, record: record, repr: repr}
+	p.mu.reserved++
+	return nil
+}
+
+// removePreparedBatch forgets the prepared batch of transaction txnID. It is
+// called by DB.commitWrite once the record resolving the batch is written to
+// the WAL, so that it is not written again to a newer WAL.
+func (d *DB) removePreparedBatch(txnID []byte) {
+	p := &d.prepared
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.mu.batches, string(txnID))
+	if p.mu.reserved > len(p.mu.batches) {
+		p.mu.reserved--
+		<-d.commit.logSyncQSem
+	}
+}
+
+// sortedPreparedBatchesLocked returns the prepared batches, by order of
+// preparation. d.prepared.mu must be held by the caller.
+func (d *DB) sortedPreparedBatchesLocked() (txnIDs []string, batches []preparedBatch) {
+	p := &d.prepared
+	for txnID := range p.mu.batches {
+		txnIDs = append(txnIDs, txnID)
+	}
+	sort.Slice(txnIDs, func(i, j int) bool {
+		return p.mu.batches[txnIDs[i]].seq < p.mu.batches[txnIDs[j]].seq
+	})
+	batches = make([]preparedBatch, len(txnIDs))
+	for i, txnID := range txnIDs {
+		batches[i] = p.mu.batches[txnID]
+	}
+	return txnIDs, batches
+}
+
+// prepareBatch writes the prepare record of batch b of transaction txnID to
+// the WAL, and syncs it.
+func (d *DB) prepareBatch(txnID []byte, b *Batch) error {
+	rb := newBatch(d)
+	_ = rb.LogData(encodeTwoPhaseRecord(twoPhasePrepare, txnID, b.Repr()), nil)
+	record := slices.Clone(rb.Repr())
+	// The repr of b ends the prepare record, which is the last entry.
+	repr := record[len(record)-len(b.Repr()):]
+	if err := d.addPreparedBatch(txnID, record, repr); err != nil {
+		return err
+	}
+	if err := d.Apply(rb, Sync); err != nil {
+		d.removePreparedBatch(txnID)
+		return err
+	}
+	return rb.Close()
+}
+
+// resolvePreparedBatch commits the prepared batch b of transaction txnID, by
+// applying it along with a commit record, or aborts it if b is nil.
+func (d *DB) resolvePreparedBatch(txnID []byte, b *Batch) error {
+	rb := newBatch(d)
+	opts := NoSync
+	if b == nil {
+		_ = rb.LogData(encodeTwoPhaseRecord(twoPhaseAbort, txnID, nil), nil)
+	} else {
+		if b.hasConditions {
+			return errors.New("pebble: batch of an atomic commit has conditions")
+		}
+		_ = rb.LogData(encodeTwoPhaseRecord(twoPhaseCommit, txnID, nil), nil)
+		if err := rb.Apply(b, nil); err != nil {
+			return err
+		}
+		opts = Sync
+	}
+	rb.preparedTxnID = txnID
+	if err := d.Apply(rb, opts); err != nil {
+		return err
+	}
+	return rb.Close()
+}
+
+// relogPreparedBatches writes the prepare records of the prepared batches to
+// the new WAL w, and syncs them, so that they survive the previous WALs. Since
+// the batches resolved from now on are written to w after their prepare
+// records, the order of the records of each transaction is preserved.
+//
+// commitPipeline.mu must be held by the caller, but not DB.mu.
+func (d *DB) relogPreparedBatches(w wal.Writer) {
+	p := &d.prepared
+	p.mu.Lock()
+	_, batches := d.sortedPreparedBatchesLocked()
+	reserved := p.mu.reserved > 0
+	if len(batches) > 0 && reserved {
+		p.mu.reserved--
+	}
+	p.mu.Unlock()
+	if len(batches) == 0 {
+		return
+	}
+	if !reserved {
+		// The reservations were spent by the previous rotations. This only
+		// blocks if all the units of logSyncQSem are held by batches waiting
+		// on commitPipeline.mu.
+		d.commit.logSyncQSem <- struct{}{}
+	}
+	var syncWG sync.WaitGroup
+	var syncErr error
+	for i := range batches {
+		var opts wal.SyncOptions
+		if i == len(batches)-1 {
+			syncWG.Add(1)
+			opts = wal.SyncOptions{Done: &syncWG, Err: &syncErr}
+		}
+		if _, err := w.WriteRecord(batches[i].record, opts, nil); err != nil {
+			panic(err)
+		}
+	}
+	syncWG.Wait()
+	if syncErr != nil {
+		panic(syncErr)
+	}
+}
+
+// replayTwoPhaseRecord tracks the prepared batches while replaying the WAL
+// record b. It returns true if b is a prepare or abort record, which must not
+// be applied.
+func (d *DB) replayTwoPhaseRecord(b *Batch) (skip bool, err error) {
+	br := b.Reader()
+	kind, data, _, ok, err := br.Next()
+	if err != nil || !ok || kind != InternalKeyKindLogData {
+		return false, err
+	}
+	kind2pc, txnID, repr, ok := decodeTwoPhaseRecord(data)
+	if !ok {
+		return false, nil
+	}
+	p := &d.prepared
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch kind2pc {
+	case twoPhasePrepare:
+		if b.Count() != 0 {
+			return false, base.CorruptionErrorf("pebble: prepare record of transaction %q with %d entries",
+				txnID, b.Count())
+		}
+		if p.mu.batches == nil {
+			p.mu.batches = make(map[string]preparedBatch)
+		}
+		// A prepare record is written again to each new WAL until its
+		// transaction is resolved, so it may be replayed several times.
+		if _, ok := p.mu.batches[string(txnID)]; !ok {
+			record := slices.Clone(b.Repr())
+			p.mu.seq++
+			p.mu.batches[string(txnID)] = preparedBatch{
+				seq:    p.mu.seq,
+				record: record,
+				repr:   record[len(record)-len(repr):],
+			}
+		}
+		return true, nil
+	case twoPhaseAbort:
+		delete(p.mu.batches, string(txnID))
+		return true, nil
+	case twoPhaseCommit:
+		delete(p.mu.batches, string(txnID))
+		return false, nil
+	default:
+		return false, base.CorruptionErrorf("pebble: unknown record kind %q of transaction %q", kind2pc, txnID)
+	}
+}
+
+// resolveInDoubtBatches resolves the prepared batches which remain after the
+// WAL replay using Options.ResolvePreparedBatch. The committed batches are
+// flushed to L0, and their files added to ve. It returns the flushed
+// flushables, which the caller must unref once ve is applied. DB.mu must be
+// held by the caller.
+func (d *DB) resolveInDoubtBatches(jobID JobID, ve *versionEdit) (flushableList, error) {
+	p := &d.prepared
+	p.mu.Lock()
+	txnIDs, batches := d.sortedPreparedBatchesLocked()
+	p.mu.batches = nil
+	p.mu.Unlock()
+	if len(batches) == 0 {
+		return nil, nil
+	}
+	if d.opts.ResolvePreparedBatch == nil {
+		return nil, errors.Errorf("pebble: %d in-doubt prepared batches, and Options.ResolvePreparedBatch is unset",
+			errors.Safe(len(batches)))
+	}
+
+	var toFlush flushableList
+	for i := range batches {
+		committed, err := d.opts.ResolvePreparedBatch([]byte(txnIDs[i]))
+		if err != nil {
+			return nil, errors.Wrapf(err, "pebble: resolving transaction %q", txnIDs[i])
+		}
+		d.opts.Logger.Infof("[JOB %d] in-doubt transaction %q resolved as committed=%t", jobID, txnIDs[i], committed)
+		b := &Batch{}
+		b.db = d
+		b.SetRepr(batches[i].repr)
+		if !committed || b.Count() == 0 {
+			continue
+		}
+		seqNum := d.mu.versions.logSeqNum.Load()
+		b.setSeqNum(seqNum)
+		d.mu.versions.logSeqNum.Store(seqNum + uint64(b.Count()))
+		b.flushable, err = newFlushableBatch(b, d.opts.Comparer)
+		if err != nil {
+			return nil, err
+		}
+		entry := d.newFlushableEntry(b.flushable, d.mu.versions.minUnflushedLogNum, seqNum)
+		// Disable memory accounting by adding a reader ref that will never be
+		// removed.
+		entry.readerRefs.Add(1)
+		toFlush = append(toFlush, entry)
+	}
+	if len(toFlush) == 0 {
+		return nil, nil
+	}
+	c, err := newFlush(d.opts, d.mu.versions.currentVersion(),
+		1 /* base level */, toFlush, d.timeNow())
+	if err != nil {
+		return nil, err
+	}
+	newVE, _, _, err := d.runCompaction(jobID, c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "running compaction of the in-doubt batches")
+	}
+	ve.NewFiles = append(ve.NewFiles, newVE.NewFiles...)
+	return toFlush, nil
+}
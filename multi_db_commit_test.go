@@ -0,0 +1,147 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitAtomic(t *testing.T) {
+	coordinator, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, coordinator.Close()) }()
+	var dbs [2]*DB
+	for i := range dbs {
+		dbs[i], err = Open("", &Options{FS: vfs.NewMem(), FormatMajorVersion: FormatAtomicCommit})
+		require.NoError(t, err)
+		defer func(d *DB) { require.NoError(t, d.Close()) }(dbs[i])
+	}
+	newBatch := func(d *DB, key, value string) *Batch {
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte(key), []byte(value), nil))
+		return b
+	}
+	get := func(d *DB, key string) string {
+		v, closer, err := d.Get([]byte(key))
+		if err == ErrNotFound {
+			return ""
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	numPrepared := func(d *DB) int {
+		d.prepared.mu.Lock()
+		defer d.prepared.mu.Unlock()
+		return len(d.prepared.mu.batches)
+	}
+
+	// A committed transaction is applied to all the DBs, and its commit record
+	// is deleted.
+	b0, b1 := newBatch(dbs[0], "a", "1"), newBatch(dbs[1], "b", "1")
+	require.NoError(t, CommitAtomic(coordinator, []byte("txn1"), b0, b1))
+	require.NoError(t, b0.Close())
+	require.NoError(t, b1.Close())
+	require.Equal(t, "1", get(dbs[0], "a"))
+	require.Equal(t, "1", get(dbs[1], "b"))
+	require.Equal(t, "", get(coordinator, "txn1"))
+	require.Equal(t, 0, numPrepared(dbs[0]))
+	require.Equal(t, 0, numPrepared(dbs[1]))
+
+	// A transaction which fails to prepare is aborted.
+	pending := newBatch(dbs[1], "b", "pending")
+	require.NoError(t, dbs[1].prepareBatch([]byte("txn2"), pending))
+	b0, b1 = newBatch(dbs[0], "a", "2"), newBatch(dbs[1], "b", "2")
+	require.Error(t, CommitAtomic(coordinator, []byte("txn2"), b0, b1))
+	require.Equal(t, "1", get(dbs[0], "a"))
+	require.Equal(t, "1", get(dbs[1], "b"))
+	require.Equal(t, 0, numPrepared(dbs[0]))
+	require.NoError(t, dbs[1].resolvePreparedBatch([]byte("txn2"), nil))
+	require.Equal(t, 0, numPrepared(dbs[1]))
+
+	// Invalid transactions.
+	require.Error(t, CommitAtomic(coordinator, nil, b0))
+	require.Error(t, CommitAtomic(coordinator, []byte("txn3"), b0, newBatch(dbs[0], "c", "3")))
+	require.Error(t, CommitAtomic(coordinator, []byte("txn3"), newBatch(coordinator, "c", "3")))
+	conditional := dbs[1].NewBatch()
+	require.NoError(t, conditional.SetIfAbsent([]byte("c"), []byte("3"), nil))
+	require.ErrorContains(t, CommitAtomic(coordinator, []byte("txn3"), b0, conditional), "conditions")
+	require.ErrorContains(t, dbs[1].resolvePreparedBatch([]byte("txn3"), conditional), "conditions")
+	require.Equal(t, 0, numPrepared(dbs[1]))
+
+	// The DBs of the batches must support atomic commits.
+	old, err := Open("", &Options{FS: vfs.NewMem(), FormatMajorVersion: FormatPartitionedFilters})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, old.Close()) }()
+	require.ErrorContains(t, CommitAtomic(coordinator, []byte("txn3"), b0, newBatch(old, "c", "3")),
+		"atomic commits require at least format major version")
+	require.Equal(t, "1", get(dbs[0], "a"))
+}
+
+func TestCommitAtomicRecovery(t *testing.T) {
+	coordinator, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, coordinator.Close()) }()
+
+	var resolved []string
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                 mem,
+		FormatMajorVersion: FormatAtomicCommit,
+		ResolvePreparedBatch: func(txnID []byte) (bool, error) {
+			resolved = append(resolved, string(txnID))
+			return CoordinatorResolver(coordinator)(txnID)
+		},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	prepare := func(txnID string, key string) *Batch {
+		b := d.NewBatch()
+		require.NoError(t, b.Set([]byte(key), []byte(txnID), nil))
+		require.NoError(t, d.prepareBatch([]byte(txnID), b))
+		return b
+	}
+
+	// txn1 is resolved before the crash, txn2 and txn3 are in doubt, but only
+	// txn2 is committed by the coordinator. Flushing writes the prepare
+	// records to a new WAL, and makes the previous one obsolete.
+	b1 := prepare("txn1", "a")
+	prepare("txn2", "b")
+	prepare("txn3", "c")
+	require.NoError(t, d.Flush())
+	require.NoError(t, coordinator.Set([]byte("txn1"), nil, Sync))
+	require.NoError(t, coordinator.Set([]byte("txn2"), nil, Sync))
+	require.NoError(t, d.resolvePreparedBatch([]byte("txn1"), b1))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+
+	// The in-doubt batches must be resolved.
+	_, err = Open("", &Options{FS: mem})
+	require.Error(t, err)
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Equal(t, []string{"txn2", "txn3"}, resolved)
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var kvs []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		kvs = append(kvs, fmt.Sprintf("%s=%s", iter.Key(), iter.Value()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"a=txn1", "b=txn2"}, kvs)
+	require.NoError(t, d.Close())
+
+	// The resolved batches are no longer in doubt.
+	resolved = nil
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.Empty(t, resolved)
+	require.NoError(t, d.Close())
+}
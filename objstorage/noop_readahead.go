@@ -4,7 +4,11 @@
 
 package objstorage
 
-import "context"
+import (
+	"context"
+
+	"github.com/cockroachdb/pebble/vfs"
+)
 
 // NoopReadHandle can be used by Readable implementations that don't
 // support read-ahead.
@@ -24,6 +28,11 @@ func (h *NoopReadHandle) ReadAt(ctx context.Context, p []byte, off int64) error
 	return h.readable.ReadAt(ctx, p, off)
 }
 
+// ReadAsync is part of the ReadHandle interface.
+func (h *NoopReadHandle) ReadAsync(ctx context.Context, reqs []vfs.ReadRequest) *PendingReads {
+	return h.readable.ReadAsync(ctx, reqs)
+}
+
 // Close is part of the ReadHandle interface.
 func (*NoopReadHandle) Close() error { return nil }
 
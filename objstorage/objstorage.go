@@ -27,6 +27,16 @@ type Readable interface {
 	// same Readable.
 	ReadAt(ctx context.Context, p []byte, off int64) error
 
+	// ReadAsync starts a batch of reads, each of which reads len(Buf) bytes at
+	// Offset, and returns without waiting for their completion. The reads are
+	// executed in parallel, if possible; on Linux, the reads of local files are
+	// submitted with io_uring (see vfs.File.ReadBatch).
+	//
+	// Like ReadAt, the reads do not return partial results. The buffers can only
+	// be used after PendingReads.Wait returns, and the reads must complete
+	// before the Readable is closed.
+	ReadAsync(ctx context.Context, reqs []vfs.ReadRequest) *PendingReads
+
 	Close() error
 
 	// Size returns the size of the object.
@@ -52,6 +62,15 @@ type ReadHandle interface {
 	// Parallel ReadAt calls on the same ReadHandle are not allowed.
 	ReadAt(ctx context.Context, p []byte, off int64) error
 
+	// ReadAsync starts a batch of reads; see Readable.ReadAsync. The reads are
+	// taken into account by the read-ahead of the handle: e.g. the reads that
+	// prefetch the next blocks of a scan are not read ahead again.
+	//
+	// ReadAsync must not be called in parallel with ReadAt, but ReadAt can be
+	// called while the reads are pending. The reads must complete before the
+	// ReadHandle is closed.
+	ReadAsync(ctx context.Context, reqs []vfs.ReadRequest) *PendingReads
+
 	Close() error
 
 	// SetupForCompaction informs the implementation that the read handle will
@@ -314,6 +333,10 @@ type Provider interface {
 	// Metrics returns metrics about objstorage. Currently, it only returns metrics
 	// about the shared cache.
 	Metrics() sharedcache.Metrics
+
+	// RemoteStorageMetrics returns the sum of the metrics of the remote
+	// storage objects that were created by remote.WithRetries.
+	RemoteStorageMetrics() remote.RetryMetrics
 }
 
 // RemoteObjectBacking encodes the metadata necessary to incorporate a shared
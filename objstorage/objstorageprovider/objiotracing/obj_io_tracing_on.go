@@ -159,6 +159,21 @@ func (r *readable) ReadAt(ctx context.Context, v []byte, off int64) error {
 	return r.r.ReadAt(ctx, v, off)
 }
 
+// ReadAsync is part of the objstorage.Readable interface.
+func (r *readable) ReadAsync(ctx context.Context, reqs []vfs.ReadRequest) *objstorage.PendingReads {
+	r.mu.Lock()
+	for _, req := range reqs {
+		r.mu.g.add(ctx, Event{
+			Op:      ReadOp,
+			FileNum: r.fileNum,
+			Offset:  req.Offset,
+			Size:    int64(len(req.Buf)),
+		})
+	}
+	r.mu.Unlock()
+	return r.r.ReadAsync(ctx, reqs)
+}
+
 // Close is part of the objstorage.Readable interface.
 func (r *readable) Close() error {
 	r.mu.g.flush()
@@ -203,6 +218,22 @@ func (rh *readHandle) ReadAt(ctx context.Context, p []byte, off int64) error {
 	return rh.rh.ReadAt(ctx, p, off)
 }
 
+// ReadAsync is part of the objstorage.ReadHandle interface.
+func (rh *readHandle) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	for _, req := range reqs {
+		rh.g.add(ctx, Event{
+			Op:       ReadOp,
+			FileNum:  rh.fileNum,
+			HandleID: rh.handleID,
+			Offset:   req.Offset,
+			Size:     int64(len(req.Buf)),
+		})
+	}
+	return rh.rh.ReadAsync(ctx, reqs)
+}
+
 // Close is part of the objstorage.ReadHandle interface.
 func (rh *readHandle) Close() error {
 	rh.g.flush()
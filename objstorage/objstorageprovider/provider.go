@@ -34,6 +34,10 @@ type provider struct {
 
 	remote remoteSubsystem
 
+	// directIOUnsupported is used to log once that direct I/O is not supported
+	// by the filesystem; see Settings.DirectIO.
+	directIOUnsupported sync.Once
+
 	mu struct {
 		sync.RWMutex
 
@@ -87,6 +91,20 @@ type Settings struct {
 	// out a large chunk of dirty filesystem buffers.
 	BytesPerSync int
 
+	// DirectIO enables direct I/O (O_DIRECT on Linux) for the local objects:
+	// sstable reads and writes bypass the OS page cache, which avoids caching
+	// the data both in the page cache and in the block cache. Reads and writes
+	// are aligned to vfs.DirectIOAlignment, and readahead uses buffers of the
+	// read handles instead of OS-level readahead. If the filesystem does not
+	// support direct I/O, buffered I/O is used.
+	DirectIO bool
+
+	// ReadOnly is set if the provider is used by a read-only store, which
+	// never writes to its directory: the changes to the remote objects (for
+	// instance, those attached by a replica) are only known in memory, and are
+	// not persisted in the remote object catalog.
+	ReadOnly bool
+
 	// Fields here are set only if the provider is to support remote objects
 	// (experimental).
 	Remote struct {
@@ -455,6 +473,19 @@ func (p *provider) Metrics() sharedcache.Metrics {
 	return sharedcache.Metrics{}
 }
 
+// RemoteStorageMetrics is part of the objstorage.Provider interface.
+func (p *provider) RemoteStorageMetrics() remote.RetryMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var res remote.RetryMetrics
+	for _, s := range p.mu.remote.storageObjects {
+		if m, ok := s.(remote.RetryMetricsProvider); ok {
+			res.Add(m.RetryMetrics())
+		}
+	}
+	return res
+}
+
 // CheckpointState is part of the objstorage.Provider interface.
 func (p *provider) CheckpointState(
 	fs vfs.FS, dir string, fileType base.FileType, fileNums []base.DiskFileNum,
@@ -491,15 +522,17 @@ func (p *provider) addMetadataLocked(meta objstorage.ObjectMetadata) {
 	}
 	p.mu.knownObjects[meta.DiskFileNum] = meta
 	if meta.IsRemote() {
-		p.mu.remote.catalogBatch.AddObject(remoteobjcat.RemoteObjectMetadata{
-			FileNum:          meta.DiskFileNum,
-			FileType:         meta.FileType,
-			CreatorID:        meta.Remote.CreatorID,
-			CreatorFileNum:   meta.Remote.CreatorFileNum,
-			Locator:          meta.Remote.Locator,
-			CleanupMethod:    meta.Remote.CleanupMethod,
-			CustomObjectName: meta.Remote.CustomObjectName,
-		})
+		if !p.st.ReadOnly {
+			p.mu.remote.catalogBatch.AddObject(remoteobjcat.RemoteObjectMetadata{
+				FileNum:          meta.DiskFileNum,
+				FileType:         meta.FileType,
+				CreatorID:        meta.Remote.CreatorID,
+				CreatorFileNum:   meta.Remote.CreatorFileNum,
+				Locator:          meta.Remote.Locator,
+				CleanupMethod:    meta.Remote.CleanupMethod,
+				CustomObjectName: meta.Remote.CustomObjectName,
+			})
+		}
 		if meta.IsExternal() {
 			p.mu.remote.addExternalObject(meta)
 		}
@@ -521,7 +554,9 @@ func (p *provider) removeMetadata(fileNum base.DiskFileNum) {
 		p.mu.remote.removeExternalObject(meta)
 	}
 	if meta.IsRemote() {
-		p.mu.remote.catalogBatch.DeleteObject(fileNum)
+		if !p.st.ReadOnly {
+			p.mu.remote.catalogBatch.DeleteObject(fileNum)
+		}
 	} else {
 		p.mu.localObjectsChanged = true
 	}
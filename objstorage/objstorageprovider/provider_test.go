@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strings"
 	"sync"
 	"testing"
@@ -16,6 +17,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/objstorage/remote/s3"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/stretchr/testify/require"
 )
@@ -466,9 +468,47 @@ func TestAttachExternalObject(t *testing.T) {
 }
 
 func TestNotExistError(t *testing.T) {
+	for _, storageName := range []string{"mem", "s3"} {
+		t.Run(storageName, func(t *testing.T) {
+			sharedStorage := newTestRemoteStorage(t, storageName)
+			defer sharedStorage.Close()
+			testNotExistError(t, sharedStorage)
+		})
+	}
+}
+
+// newTestRemoteStorage returns a remote.Storage of the given type: an
+// in-memory store ("mem") or an S3 store backed by a fake server ("s3").
+func newTestRemoteStorage(t *testing.T, name string) remote.Storage {
+	switch name {
+	case "mem":
+		return remote.NewInMem()
+	case "s3":
+		storage, _ := newFakeS3Storage(t)
+		return storage
+	default:
+		t.Fatalf("unknown storage %q", name)
+		return nil
+	}
+}
+
+func newFakeS3Storage(t *testing.T) (remote.Storage, *s3.FakeServer) {
+	creds := s3.Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}
+	f := s3.NewFakeServer(creds, "bucket")
+	storage, err := s3.New(s3.Config{
+		Endpoint:    "http://s3.test",
+		Bucket:      "bucket",
+		Credentials: creds,
+		PartSize:    1024,
+		HTTPClient:  f.Client(),
+	})
+	require.NoError(t, err)
+	return storage, f
+}
+
+func testNotExistError(t *testing.T, sharedStorage remote.Storage) {
 	fs := vfs.NewMem()
 	st := DefaultSettings(fs, "")
-	sharedStorage := remote.NewInMem()
 	st.Remote.StorageFactory = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
 		"": sharedStorage,
 	})
@@ -519,6 +559,62 @@ func TestNotExistError(t *testing.T) {
 	}
 }
 
+// TestRemoteStorageErrors checks that errors returned by the remote storage
+// are surfaced by the provider.
+func TestRemoteStorageErrors(t *testing.T) {
+	ctx := context.Background()
+	sharedStorage, f := newFakeS3Storage(t)
+	st := DefaultSettings(vfs.NewMem(), "")
+	st.Remote.StorageFactory = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+		"": sharedStorage,
+	})
+	st.Remote.CreateOnShared = remote.CreateOnSharedAll
+	st.Remote.CreateOnSharedLocator = ""
+	provider, err := Open(st)
+	require.NoError(t, err)
+	defer provider.Close()
+	require.NoError(t, provider.SetCreatorID(1))
+
+	var failing bool
+	f.InjectErrors(func(r *http.Request) *s3.Error {
+		if !failing {
+			return nil
+		}
+		return &s3.Error{StatusCode: http.StatusServiceUnavailable, Code: "SlowDown", Message: "Please reduce your request rate."}
+	})
+
+	// A failed upload fails the creation of the object.
+	failing = true
+	w, _, err := provider.Create(ctx, base.FileTypeTable, 1, objstorage.CreateOptions{PreferSharedStorage: true})
+	require.NoError(t, err)
+	data := make([]byte, 5000)
+	genData(1, 0, data)
+	if err := w.Write(data); err == nil {
+		require.Error(t, w.Finish())
+	} else {
+		w.Abort()
+	}
+	require.Zero(t, f.NumPendingUploads())
+
+	failing = false
+	w, _, err = provider.Create(ctx, base.FileTypeTable, 2, objstorage.CreateOptions{PreferSharedStorage: true})
+	require.NoError(t, err)
+	require.NoError(t, w.Write(data))
+	require.NoError(t, w.Finish())
+
+	r, err := provider.OpenForReading(ctx, base.FileTypeTable, 2, objstorage.OpenOptions{})
+	require.NoError(t, err)
+	defer r.Close()
+	buf := make([]byte, 100)
+	failing = true
+	err = r.ReadAt(ctx, buf, 10)
+	require.Error(t, err)
+	require.False(t, provider.IsNotExistError(err))
+	failing = false
+	require.NoError(t, r.ReadAt(ctx, buf, 10))
+	require.Equal(t, byte(1), checkData(t, 10, buf))
+}
+
 // genData generates object data that can be checked later with checkData.
 func genData(salt byte, offset int, p []byte) {
 	for i := range p {
@@ -605,3 +701,180 @@ func TestParallelSync(t *testing.T) {
 		})
 	}
 }
+
+func TestDirectIO(t *testing.T) {
+	dir := t.TempDir()
+	st := DefaultSettings(vfs.Default, dir)
+	st.DirectIO = true
+	p, err := Open(st)
+	require.NoError(t, err)
+	defer p.Close()
+
+	rng := rand.New(rand.NewSource(1))
+	ctx := context.Background()
+	for i, size := range []int{0, 100, vfs.DirectIOAlignment, directWriteBufferSize + 1, 3*directWriteBufferSize + 12345} {
+		fileNum := base.DiskFileNum(i + 1)
+		data := make([]byte, size)
+		rng.Read(data)
+
+		w, _, err := p.Create(ctx, base.FileTypeTable, fileNum, objstorage.CreateOptions{})
+		require.NoError(t, err)
+		if _, ok := w.(*fileDirectWritable); !ok {
+			require.NoError(t, w.Finish())
+			t.Skip("direct I/O is not supported by the filesystem")
+		}
+		// Write the data in pieces of random sizes.
+		for rest := data; len(rest) > 0; {
+			n := min(len(rest), 1+rng.Intn(3*vfs.DirectIOAlignment))
+			require.NoError(t, w.Write(rest[:n]))
+			rest = rest[n:]
+		}
+		require.NoError(t, w.Finish())
+
+		r, err := p.OpenForReading(ctx, base.FileTypeTable, fileNum, objstorage.OpenOptions{})
+		require.NoError(t, err)
+		require.True(t, r.(*fileReadable).directIO)
+		require.Equal(t, int64(size), r.Size())
+		if size == 0 {
+			require.NoError(t, r.Close())
+			continue
+		}
+		randomRead := func(read func(p []byte, off int64) error) {
+			off := rng.Intn(size)
+			buf := make([]byte, 1+rng.Intn(size-off))
+			require.NoError(t, read(buf, int64(off)))
+			require.Equal(t, data[off:off+len(buf)], buf)
+		}
+		sequentialReads := func(rh objstorage.ReadHandle) {
+			for off := 0; off < size; {
+				buf := make([]byte, min(size-off, 1+rng.Intn(2*vfs.DirectIOAlignment)))
+				require.NoError(t, rh.ReadAt(ctx, buf, int64(off)))
+				require.Equal(t, data[off:off+len(buf)], buf)
+				off += len(buf)
+			}
+		}
+		for j := 0; j < 20; j++ {
+			randomRead(func(p []byte, off int64) error { return r.ReadAt(ctx, p, off) })
+		}
+		// Aligned reads into aligned buffers are not copied.
+		if size >= vfs.DirectIOAlignment {
+			buf := vfs.AlignedBuf(vfs.DirectIOAlignment)
+			require.NoError(t, r.ReadAt(ctx, buf, 0))
+			require.Equal(t, data[:len(buf)], buf)
+		}
+		rh := r.NewReadHandle(ctx)
+		sequentialReads(rh)
+		for j := 0; j < 20; j++ {
+			randomRead(func(p []byte, off int64) error { return rh.ReadAt(ctx, p, off) })
+		}
+		require.NoError(t, rh.Close())
+		rh = r.NewReadHandle(ctx)
+		rh.SetupForCompaction()
+		sequentialReads(rh)
+		require.NoError(t, rh.Close())
+
+		// Read handles (and their readahead buffers) are reused; interleave the
+		// reads of handles that are closed and reopened.
+		handles := []objstorage.ReadHandle{r.NewReadHandle(ctx), r.NewReadHandle(ctx)}
+		for j := 0; j < 50; j++ {
+			k := rng.Intn(len(handles))
+			if rng.Intn(5) == 0 {
+				require.NoError(t, handles[k].Close())
+				handles[k] = r.NewReadHandle(ctx)
+				if rng.Intn(2) == 0 {
+					handles[k].SetupForCompaction()
+				}
+			}
+			randomRead(func(p []byte, off int64) error { return handles[k].ReadAt(ctx, p, off) })
+		}
+		for _, h := range handles {
+			require.NoError(t, h.Close())
+		}
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestReadAsync(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name     string
+		settings func() Settings
+	}{
+		{"local", func() Settings { return DefaultSettings(vfs.Default, t.TempDir()) }},
+		{"direct-io", func() Settings {
+			st := DefaultSettings(vfs.Default, t.TempDir())
+			st.DirectIO = true
+			return st
+		}},
+		{"mem", func() Settings { return DefaultSettings(vfs.NewMem(), "") }},
+		{"shared", func() Settings {
+			st := DefaultSettings(vfs.NewMem(), "")
+			st.Remote.StorageFactory = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+				"": remote.NewInMem(),
+			})
+			st.Remote.CreateOnShared = remote.CreateOnSharedAll
+			return st
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := Open(tc.settings())
+			require.NoError(t, err)
+			defer p.Close()
+			if tc.name == "shared" {
+				require.NoError(t, p.SetCreatorID(1))
+			}
+
+			const size = 1 << 20
+			data := make([]byte, size)
+			rng := rand.New(rand.NewSource(1))
+			rng.Read(data)
+			w, _, err := p.Create(ctx, base.FileTypeTable, 1, objstorage.CreateOptions{PreferSharedStorage: true})
+			require.NoError(t, err)
+			require.NoError(t, w.Write(append([]byte(nil), data...)))
+			require.NoError(t, w.Finish())
+
+			r, err := p.OpenForReading(ctx, base.FileTypeTable, 1, objstorage.OpenOptions{})
+			require.NoError(t, err)
+			makeReqs := func(n int) []vfs.ReadRequest {
+				reqs := make([]vfs.ReadRequest, n)
+				for i := range reqs {
+					length := 1 + rng.Intn(32<<10)
+					reqs[i] = vfs.ReadRequest{
+						Buf:    make([]byte, length),
+						Offset: rng.Int63n(size - int64(length)),
+					}
+				}
+				return reqs
+			}
+			check := func(reqs []vfs.ReadRequest) {
+				for _, req := range reqs {
+					require.Equal(t, data[req.Offset:req.Offset+int64(len(req.Buf))], req.Buf)
+				}
+			}
+			for _, n := range []int{1, 10, 100} {
+				reqs := makeReqs(n)
+				require.NoError(t, r.ReadAsync(ctx, reqs).Wait())
+				check(reqs)
+			}
+
+			// Batches submitted with a read handle, interleaved with reads.
+			rh := r.NewReadHandle(ctx)
+			reqs := makeReqs(20)
+			pending := rh.ReadAsync(ctx, reqs)
+			buf := make([]byte, 1000)
+			for off := int64(0); off < 100000; off += int64(len(buf)) {
+				require.NoError(t, rh.ReadAt(ctx, buf, off))
+				require.Equal(t, data[off:off+int64(len(buf))], buf)
+			}
+			require.NoError(t, pending.Wait())
+			require.True(t, pending.Done())
+			check(reqs)
+
+			// A read past the end of the object fails.
+			reqs = []vfs.ReadRequest{{Buf: make([]byte, 100), Offset: size - 10}}
+			require.Error(t, rh.ReadAsync(ctx, reqs).Wait())
+			require.NoError(t, rh.Close())
+			require.NoError(t, r.Close())
+		})
+	}
+}
@@ -4,6 +4,13 @@
 
 package objstorageprovider
 
+import (
+	"io"
+	"sync"
+
+	"github.com/cockroachdb/pebble/vfs"
+)
+
 const (
 	// Constants for dynamic readahead of data blocks. Note that the size values
 	// make sense as some multiple of the default block size; and they should
@@ -76,6 +83,26 @@ func (rs *readaheadState) recordCacheHit(offset, blockLength int64) {
 	rs.prevSize = 0
 }
 
+// recordReadBatch updates state for a batch of reads that was submitted at
+// once (see objstorage.ReadHandle.ReadAsync), typically to prefetch the next
+// blocks of a scan. The range of the batch is treated like a past readahead:
+// the reads in the range don't issue a readahead or reset the state.
+func (rs *readaheadState) recordReadBatch(reqs []vfs.ReadRequest) {
+	if len(reqs) == 0 {
+		return
+	}
+	start, end := reqs[0].Offset, int64(0)
+	for _, req := range reqs {
+		start = min(start, req.Offset)
+		end = max(end, req.Offset+int64(len(req.Buf)))
+	}
+	if end <= rs.limit {
+		return
+	}
+	rs.prevSize = end - start
+	rs.limit = end
+}
+
 // maybeReadahead updates state and determines whether to issue a readahead /
 // prefetch call for a block read at offset for blockLength bytes.
 // Returns a size value (greater than 0) that should be prefetched if readahead
@@ -199,3 +226,98 @@ func (rs *readaheadState) maybeReadahead(offset, blockLength int64) int64 {
 	rs.prevSize = 0
 	return 0
 }
+
+// alignedReadahead implements readahead for files that use direct I/O (see
+// vfs.SetDirectIO), which bypass the OS page cache and thus cannot rely on
+// Prefetch or OS-level readahead. The readahead is read into a buffer owned by
+// the read handle, with the offset and the length aligned to
+// vfs.DirectIOAlignment, and the subsequent reads are served from it.
+type alignedReadahead struct {
+	// buf is aligned to vfs.DirectIOAlignment; its capacity is the maximum
+	// readahead size (plus the alignment).
+	buf []byte
+	// offset is the offset in the file of buf[0].
+	offset int64
+}
+
+// alignedBufPool contains the buffers of alignedReadahead.
+var alignedBufPool sync.Pool
+
+// init reuses a buffer released by another alignedReadahead, if possible.
+func (ra *alignedReadahead) init() {
+	if b, ok := alignedBufPool.Get().(*[]byte); ok {
+		ra.buf = (*b)[:0]
+	}
+}
+
+// readAt copies the data at the given offset into p if it is entirely
+// contained in the buffer, and returns true if it was.
+func (ra *alignedReadahead) readAt(p []byte, offset int64) bool {
+	if offset < ra.offset || offset+int64(len(p)) > ra.offset+int64(len(ra.buf)) {
+		return false
+	}
+	copy(p, ra.buf[offset-ra.offset:])
+	return true
+}
+
+// fill reads size bytes starting at offset (extended to aligned boundaries and
+// limited to the end of the file) into the buffer.
+func (ra *alignedReadahead) fill(file vfs.File, fileSize, offset, size int64) error {
+	start := alignDown(offset)
+	end := min(alignUp(offset+size), alignUp(fileSize))
+	if ra.buf == nil || int64(cap(ra.buf)) < end-start {
+		ra.buf = vfs.AlignedBuf(int(alignUp(max(end-start, fileMaxReadaheadSize+vfs.DirectIOAlignment))))
+	}
+	ra.buf = ra.buf[:end-start]
+	ra.offset = start
+	n, err := readFullAt(file, ra.buf, start)
+	ra.buf = ra.buf[:n]
+	return err
+}
+
+// release discards the contents of the buffer and makes it available for reuse.
+func (ra *alignedReadahead) release() {
+	if ra.buf != nil {
+		buf := ra.buf[:0]
+		alignedBufPool.Put(&buf)
+	}
+	*ra = alignedReadahead{}
+}
+
+// directReadAt reads len(p) bytes at the given offset of a file that uses
+// direct I/O, using an aligned buffer if the read is not aligned.
+func directReadAt(file vfs.File, fileSize int64, p []byte, offset int64) error {
+	if offset%vfs.DirectIOAlignment == 0 && vfs.IsAligned(p) {
+		_, err := readFullAt(file, p, offset)
+		return err
+	}
+	var ra alignedReadahead
+	ra.init()
+	defer ra.release()
+	if err := ra.fill(file, fileSize, offset, int64(len(p))); err != nil {
+		return err
+	}
+	if !ra.readAt(p, offset) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// readFullAt reads len(p) bytes at the given offset, tolerating a short read at
+// the end of the file (which can happen when reading an aligned range that
+// extends past the end of the file).
+func readFullAt(file vfs.File, p []byte, offset int64) (int, error) {
+	n, err := file.ReadAt(p, offset)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func alignDown(n int64) int64 {
+	return n &^ (vfs.DirectIOAlignment - 1)
+}
+
+func alignUp(n int64) int64 {
+	return alignDown(n + vfs.DirectIOAlignment - 1)
+}
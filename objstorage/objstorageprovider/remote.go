@@ -152,6 +152,14 @@ func (p *provider) remoteInit() error {
 			p.mu.remote.addExternalObject(o)
 		}
 	}
+	if p.remote.cache != nil {
+		// Discard the cached blocks of the objects that were removed while the
+		// cache was closed.
+		p.remote.cache.RetainObjects(func(fileNum base.DiskFileNum) bool {
+			_, ok := p.mu.knownObjects[fileNum]
+			return ok
+		})
+	}
 	return nil
 }
 
@@ -0,0 +1,343 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package objstorageprovider
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/remoteobjcat"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+)
+
+// RemoteGCStore describes a store that uses a shared remote storage, for the
+// purpose of garbage collection (see RemoteGC).
+type RemoteGCStore struct {
+	// Catalog is the content of the store's remote object catalog.
+	Catalog remoteobjcat.CatalogContents
+	// LiveBackings, if set, contains the file numbers of the backing tables
+	// referenced by the latest version in the store's MANIFEST. It is used to
+	// report the objects that are in the catalog but are no longer used by
+	// the store; the store removes these itself, so they are not orphaned.
+	LiveBackings map[base.DiskFileNum]struct{}
+}
+
+// RemoteGCOptions configures RemoteGC.
+type RemoteGCOptions struct {
+	// Storage is the remote storage to collect.
+	Storage remote.Storage
+	// Locator is the locator of Storage; only the catalog objects with this
+	// locator are considered.
+	Locator remote.Locator
+	// Stores must describe every live store that shares Storage. The ref
+	// markers of any other creator are considered orphaned (these are
+	// typically left behind by decommissioned or lost nodes).
+	Stores []RemoteGCStore
+	// GracePeriod is the minimum time that an object must have been observed
+	// as orphaned, across runs, before it is deleted. It protects the objects
+	// that are being created, whose ref markers exist before they are added to
+	// the catalog.
+	GracePeriod time.Duration
+	// FirstSeen maps the names of the orphaned objects to the time they were
+	// first observed as orphaned. It is updated in place, and should be
+	// persisted between runs. It must be non-nil.
+	FirstSeen map[string]time.Time
+	// IncludeUnreferenced, if set, also considers orphaned the objects that
+	// have no ref markers at all and are not in any catalog. Such objects are
+	// left behind when a store crashes between creating an object and its ref
+	// marker, or between removing the last ref marker and the object. It must
+	// not be set if any store creates objects with SharedNoCleanup on the
+	// storage, since these objects never have ref markers.
+	IncludeUnreferenced bool
+	// DryRun, if set, reports the orphaned objects without deleting anything.
+	DryRun bool
+	// Now returns the current time; defaults to time.Now.
+	Now func() time.Time
+}
+
+// RemoteGCObject describes an orphaned object found by RemoteGC.
+type RemoteGCObject struct {
+	Name string
+	// Size is the size of the object; ref markers are empty.
+	Size int64
+	// IsRef is set if the object is a ref marker.
+	IsRef bool
+	// Reason describes why the object is considered orphaned.
+	Reason string
+	// FirstSeen is the time the object was first observed as orphaned.
+	FirstSeen time.Time
+	// Eligible is set if the grace period has passed for the object.
+	Eligible bool
+	// Deleted is set if the object was deleted.
+	Deleted bool
+}
+
+// RemoteGCReport is the result of RemoteGC.
+type RemoteGCReport struct {
+	// Orphans are the orphaned objects, sorted by name.
+	Orphans []RemoteGCObject
+	// ObsoleteInStores is the number of objects (and their total size) that are
+	// in the catalog of a store but not used by its LSM. These are not
+	// orphaned: the stores remove them when they delete obsolete files (or when
+	// they are next opened).
+	ObsoleteInStores      int
+	ObsoleteInStoresBytes int64
+}
+
+// Pending returns the number of orphaned objects (and their total size) that
+// were not deleted.
+func (r *RemoteGCReport) Pending() (count int, bytes int64) {
+	for i := range r.Orphans {
+		if !r.Orphans[i].Deleted {
+			count++
+			bytes += r.Orphans[i].Size
+		}
+	}
+	return count, bytes
+}
+
+// Deleted returns the number of objects (and their total size) that were
+// deleted.
+func (r *RemoteGCReport) Deleted() (count int, bytes int64) {
+	for i := range r.Orphans {
+		if r.Orphans[i].Deleted {
+			count++
+			bytes += r.Orphans[i].Size
+		}
+	}
+	return count, bytes
+}
+
+// RemoteGC finds the objects in a remote storage that are no longer referenced
+// by any store, and deletes those that have been orphaned for longer than the
+// grace period.
+//
+// The objects created by stores are tracked through ref markers (see
+// sharedObjectRefName): a ref marker is live if the referencing store is known
+// and has the object in its catalog. An object is orphaned if it is not in the
+// catalog of any store and all its ref markers are orphaned. The orphaned ref
+// markers are deleted first; an object is deleted only if no ref markers
+// remain, which is checked right before the deletion, the same way a store
+// removes an object it no longer references.
+//
+// Objects with names that were not generated by a store (e.g. external
+// objects) are ignored, but their orphaned ref markers are deleted.
+func RemoteGC(opts RemoteGCOptions) (RemoteGCReport, error) {
+	if opts.FirstSeen == nil {
+		return RemoteGCReport{}, errors.AssertionFailedf("FirstSeen must be set")
+	}
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	// Collect the live objects and ref markers.
+	var report RemoteGCReport
+	creators := make(map[objstorage.CreatorID]struct{})
+	liveObjects := make(map[string]struct{})
+	liveRefs := make(map[string]struct{})
+	for _, store := range opts.Stores {
+		if !store.Catalog.CreatorID.IsSet() {
+			continue
+		}
+		creators[store.Catalog.CreatorID] = struct{}{}
+		for _, m := range store.Catalog.Objects {
+			if m.Locator != opts.Locator {
+				continue
+			}
+			meta := remoteGCMetadata(m)
+			liveObjects[remoteObjectName(meta)] = struct{}{}
+			if m.CleanupMethod == objstorage.SharedRefTracking {
+				liveRefs[sharedObjectRefName(meta, store.Catalog.CreatorID, m.FileNum)] = struct{}{}
+			}
+			if store.LiveBackings != nil {
+				if _, ok := store.LiveBackings[m.FileNum]; !ok {
+					size, err := opts.Storage.Size(remoteObjectName(meta))
+					if err != nil && !opts.Storage.IsNotExistError(err) {
+						return RemoteGCReport{}, err
+					}
+					report.ObsoleteInStores++
+					report.ObsoleteInStoresBytes += size
+				}
+			}
+		}
+	}
+
+	names, err := opts.Storage.List("" /* prefix */, "" /* delimiter */)
+	if err != nil {
+		return RemoteGCReport{}, err
+	}
+	slices.Sort(names)
+
+	// liveRefCount and refCount map object names to the number of their live
+	// ref markers and of all their ref markers.
+	liveRefCount := make(map[string]int)
+	refCount := make(map[string]int)
+	var objects []string
+	var orphanRefs []RemoteGCObject
+	for _, name := range names {
+		obj, creatorID, _, ok := parseRemoteObjectRefName(name)
+		if !ok {
+			if isRemoteObjectName(name) {
+				objects = append(objects, name)
+			}
+			continue
+		}
+		refCount[obj]++
+		if _, ok := liveRefs[name]; ok {
+			liveRefCount[obj]++
+			continue
+		}
+		reason := fmt.Sprintf("not in the catalog of creator %d", creatorID)
+		if _, ok := creators[creatorID]; !ok {
+			reason = fmt.Sprintf("creator %d is not a known store", creatorID)
+		}
+		orphanRefs = append(orphanRefs, RemoteGCObject{Name: name, IsRef: true, Reason: reason})
+	}
+	report.Orphans = orphanRefs
+	for _, name := range objects {
+		if _, ok := liveObjects[name]; ok || liveRefCount[name] > 0 {
+			continue
+		}
+		reason := "all ref markers are orphaned"
+		if refCount[name] == 0 {
+			if !opts.IncludeUnreferenced {
+				continue
+			}
+			reason = "no ref markers"
+		}
+		size, err := opts.Storage.Size(name)
+		if err != nil {
+			if opts.Storage.IsNotExistError(err) {
+				continue
+			}
+			return RemoteGCReport{}, err
+		}
+		report.Orphans = append(report.Orphans, RemoteGCObject{
+			Name:   name,
+			Size:   size,
+			Reason: reason,
+		})
+	}
+	slices.SortFunc(report.Orphans, func(a, b RemoteGCObject) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	// Update the first-seen times. Objects that are no longer orphaned (or no
+	// longer exist) are forgotten.
+	t := now()
+	orphans := make(map[string]struct{}, len(report.Orphans))
+	for i := range report.Orphans {
+		o := &report.Orphans[i]
+		orphans[o.Name] = struct{}{}
+		firstSeen, ok := opts.FirstSeen[o.Name]
+		if !ok {
+			firstSeen = t
+			opts.FirstSeen[o.Name] = t
+		}
+		o.FirstSeen = firstSeen
+		o.Eligible = t.Sub(firstSeen) >= opts.GracePeriod
+	}
+	for name := range opts.FirstSeen {
+		if _, ok := orphans[name]; !ok {
+			delete(opts.FirstSeen, name)
+		}
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	del := func(o *RemoteGCObject) error {
+		if err := opts.Storage.Delete(o.Name); err != nil && !opts.Storage.IsNotExistError(err) {
+			return errors.Wrapf(err, "deleting %q", errors.Safe(o.Name))
+		}
+		o.Deleted = true
+		delete(opts.FirstSeen, o.Name)
+		return nil
+	}
+	// Delete the ref markers first.
+	for i := range report.Orphans {
+		if o := &report.Orphans[i]; o.IsRef && o.Eligible {
+			if err := del(o); err != nil {
+				return report, err
+			}
+		}
+	}
+	for i := range report.Orphans {
+		o := &report.Orphans[i]
+		if o.IsRef || !o.Eligible {
+			continue
+		}
+		refs, err := opts.Storage.List(o.Name+".ref.", "" /* delimiter */)
+		if err != nil {
+			return report, err
+		}
+		if len(refs) > 0 {
+			// Some ref markers remain: either they are not eligible yet, or they
+			// were created since we listed the objects.
+			continue
+		}
+		if err := del(o); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func remoteGCMetadata(m remoteobjcat.RemoteObjectMetadata) objstorage.ObjectMetadata {
+	meta := objstorage.ObjectMetadata{
+		DiskFileNum: m.FileNum,
+		FileType:    m.FileType,
+	}
+	meta.Remote.CreatorID = m.CreatorID
+	meta.Remote.CreatorFileNum = m.CreatorFileNum
+	meta.Remote.CleanupMethod = m.CleanupMethod
+	meta.Remote.Locator = m.Locator
+	meta.Remote.CustomObjectName = m.CustomObjectName
+	return meta
+}
+
+// parseRemoteObjectRefName parses a ref marker name (see sharedObjectRefName),
+// returning the name of the object and the creator ID and file number of the
+// referencing store.
+func parseRemoteObjectRefName(
+	name string,
+) (objName string, refCreatorID objstorage.CreatorID, refFileNum base.DiskFileNum, ok bool) {
+	i := strings.LastIndex(name, ".ref.")
+	if i <= 0 {
+		return "", 0, 0, false
+	}
+	creator, fileNum, ok := strings.Cut(name[i+len(".ref."):], ".")
+	if !ok {
+		return "", 0, 0, false
+	}
+	c, err1 := strconv.ParseUint(creator, 10, 64)
+	f, err2 := strconv.ParseUint(fileNum, 10, 64)
+	if err1 != nil || err2 != nil {
+		return "", 0, 0, false
+	}
+	return name[:i], objstorage.CreatorID(c), base.DiskFileNum(f), true
+}
+
+// isRemoteObjectName returns true if the name is the name of a table created
+// by a store (see remoteObjectName).
+func isRemoteObjectName(name string) bool {
+	var meta objstorage.ObjectMetadata
+	var hash uint16
+	var creatorID, fileNum uint64
+	if n, err := fmt.Sscanf(name, "%04x-%d-%d.sst", &hash, &creatorID, &fileNum); err != nil || n != 3 {
+		return false
+	}
+	meta.FileType = base.FileTypeTable
+	meta.Remote.CreatorID = objstorage.CreatorID(creatorID)
+	meta.Remote.CreatorFileNum = base.DiskFileNum(fileNum)
+	return remoteObjectName(meta) == name
+}
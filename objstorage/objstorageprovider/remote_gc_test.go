@@ -0,0 +1,202 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package objstorageprovider
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/remoteobjcat"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemoteObjectNames(t *testing.T) {
+	for it := 0; it < 100; it++ {
+		var meta objstorage.ObjectMetadata
+		meta.DiskFileNum = base.DiskFileNum(rand.Intn(100000))
+		meta.FileType = base.FileTypeTable
+		meta.Remote.CreatorID = objstorage.CreatorID(rand.Int63())
+		meta.Remote.CreatorFileNum = base.DiskFileNum(rand.Intn(100000))
+		meta.Remote.CleanupMethod = objstorage.SharedRefTracking
+		custom := rand.Intn(4) == 0
+		if custom {
+			meta.Remote.CustomObjectName = fmt.Sprintf("foo-%d.sst", rand.Intn(10000))
+		}
+		obj := remoteObjectName(meta)
+		require.Equal(t, !custom, isRemoteObjectName(obj))
+
+		refCreatorID := objstorage.CreatorID(rand.Int63())
+		ref := sharedObjectRefName(meta, refCreatorID, meta.DiskFileNum)
+		require.False(t, isRemoteObjectName(ref))
+		objName, c, f, ok := parseRemoteObjectRefName(ref)
+		require.True(t, ok)
+		require.Equal(t, obj, objName)
+		require.Equal(t, refCreatorID, c)
+		require.Equal(t, meta.DiskFileNum, f)
+	}
+	for _, name := range []string{"foo", "0000-1-000001.sst", "foo.ref.", "foo.ref.1", "foo.ref.x.1", "0001-1-000001.sst"} {
+		_, _, _, ok := parseRemoteObjectRefName(name)
+		require.False(t, ok, name)
+	}
+	require.False(t, isRemoteObjectName("0000-1-000001.sst"))
+}
+
+func TestRemoteGC(t *testing.T) {
+	storage := remote.NewInMem()
+	create := func(name string, size int) {
+		w, err := storage.CreateObject(name)
+		require.NoError(t, err)
+		_, err = w.Write(make([]byte, size))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+	}
+	obj := func(creatorID objstorage.CreatorID, fileNum base.DiskFileNum) remoteobjcat.RemoteObjectMetadata {
+		return remoteobjcat.RemoteObjectMetadata{
+			FileNum:        fileNum,
+			FileType:       base.FileTypeTable,
+			CreatorID:      creatorID,
+			CreatorFileNum: fileNum,
+			CleanupMethod:  objstorage.SharedRefTracking,
+		}
+	}
+	name := func(m remoteobjcat.RemoteObjectMetadata) string {
+		return remoteObjectName(remoteGCMetadata(m))
+	}
+	ref := func(m remoteobjcat.RemoteObjectMetadata, creatorID objstorage.CreatorID, fileNum base.DiskFileNum) string {
+		return sharedObjectRefName(remoteGCMetadata(m), creatorID, fileNum)
+	}
+
+	// Store 1 is live; store 2 was decommissioned.
+	obj1 := obj(1, 1)  // Created and used by store 1.
+	obj2 := obj(2, 5)  // Created by store 2, shared with store 1 (as file 7).
+	obj3 := obj(2, 6)  // Created and used by store 2.
+	obj4 := obj(1, 9)  // Store 1 crashed before adding it to its catalog.
+	obj5 := obj(1, 10) // Store 1 crashed before creating the ref marker.
+	external := remoteobjcat.RemoteObjectMetadata{
+		FileNum:          3,
+		FileType:         base.FileTypeTable,
+		CleanupMethod:    objstorage.SharedRefTracking,
+		CustomObjectName: "external.sst",
+	}
+	create(name(obj1), 100)
+	create(ref(obj1, 1, 1), 0)
+	create(name(obj2), 200)
+	create(ref(obj2, 2, 5), 0)
+	create(ref(obj2, 1, 7), 0)
+	create(name(obj3), 300)
+	create(ref(obj3, 2, 6), 0)
+	create(name(obj4), 400)
+	create(ref(obj4, 1, 9), 0)
+	create(name(obj5), 500)
+	create("external.sst", 600)
+	create(ref(external, 2, 3), 0)
+	create("unrelated", 700)
+
+	shared := obj2
+	shared.FileNum = 7
+	stores := []RemoteGCStore{{
+		Catalog: remoteobjcat.CatalogContents{
+			CreatorID: 1,
+			Objects:   []remoteobjcat.RemoteObjectMetadata{obj1, shared},
+		},
+		// File 7 was compacted away but is not yet removed.
+		LiveBackings: map[base.DiskFileNum]struct{}{1: {}},
+	}}
+
+	t0 := time.Unix(1000, 0)
+	firstSeen := make(map[string]time.Time)
+	run := func(now time.Time, dryRun, includeUnreferenced bool) RemoteGCReport {
+		report, err := RemoteGC(RemoteGCOptions{
+			Storage:             storage,
+			Stores:              stores,
+			GracePeriod:         time.Hour,
+			FirstSeen:           firstSeen,
+			IncludeUnreferenced: includeUnreferenced,
+			DryRun:              dryRun,
+			Now:                 func() time.Time { return now },
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, report.ObsoleteInStores)
+		require.Equal(t, int64(200), report.ObsoleteInStoresBytes)
+		return report
+	}
+	orphanNames := func(r RemoteGCReport) []string {
+		var res []string
+		for _, o := range r.Orphans {
+			res = append(res, o.Name)
+		}
+		return res
+	}
+	expOrphans := []string{
+		name(obj3), ref(obj3, 2, 6),
+		name(obj4), ref(obj4, 1, 9),
+		ref(obj2, 2, 5),
+		ref(external, 2, 3),
+	}
+	slices.Sort(expOrphans)
+
+	// The first run only records the orphans.
+	r := run(t0, false /* dryRun */, false /* includeUnreferenced */)
+	require.Equal(t, expOrphans, orphanNames(r))
+	for _, o := range r.Orphans {
+		require.False(t, o.Eligible)
+		require.False(t, o.Deleted)
+	}
+	count, bytes := r.Pending()
+	require.Equal(t, 6, count)
+	require.Equal(t, int64(700), bytes)
+	require.Len(t, firstSeen, 6)
+
+	// After the grace period, a dry run reports the orphans as eligible but does
+	// not delete them.
+	r = run(t0.Add(time.Hour), true /* dryRun */, false /* includeUnreferenced */)
+	require.Equal(t, expOrphans, orphanNames(r))
+	for _, o := range r.Orphans {
+		require.True(t, o.Eligible)
+		require.Equal(t, t0, o.FirstSeen)
+		require.False(t, o.Deleted)
+	}
+
+	// Store 1 adds obj4 to its catalog in the meantime; it is no longer
+	// orphaned.
+	stores[0].Catalog.Objects = append(stores[0].Catalog.Objects, obj4)
+	stores[0].LiveBackings[9] = struct{}{}
+	r = run(t0.Add(time.Hour), false /* dryRun */, false /* includeUnreferenced */)
+	count, bytes = r.Deleted()
+	require.Equal(t, 4, count)
+	require.Equal(t, int64(300), bytes)
+	require.Empty(t, firstSeen)
+
+	names, err := storage.List("", "")
+	require.NoError(t, err)
+	slices.Sort(names)
+	expNames := []string{
+		name(obj1), ref(obj1, 1, 1),
+		name(obj2), ref(obj2, 1, 7),
+		name(obj4), ref(obj4, 1, 9),
+		name(obj5),
+		"external.sst",
+		"unrelated",
+	}
+	slices.Sort(expNames)
+	require.Equal(t, expNames, names)
+
+	// Objects without any ref markers are only collected if requested.
+	r = run(t0.Add(2*time.Hour), false /* dryRun */, true /* includeUnreferenced */)
+	require.Equal(t, []string{name(obj5)}, orphanNames(r))
+	require.Equal(t, "no ref markers", r.Orphans[0].Reason)
+	r = run(t0.Add(3*time.Hour), false /* dryRun */, true /* includeUnreferenced */)
+	count, bytes = r.Deleted()
+	require.Equal(t, 1, count)
+	require.Equal(t, int64(500), bytes)
+	_, err = storage.Size(name(obj5))
+	require.True(t, storage.IsNotExistError(err))
+}
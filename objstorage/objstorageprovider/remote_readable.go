@@ -12,6 +12,7 @@ import (
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/sharedcache"
 	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/vfs"
 )
 
 // NewRemoteReadable creates an objstorage.Readable out of a remote.ObjectReader.
@@ -66,6 +67,15 @@ func (r *remoteReadable) readInternal(
 	return r.objReader.ReadAt(ctx, p, offset)
 }
 
+// ReadAsync is part of the objstorage.Readable interface.
+func (r *remoteReadable) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	return objstorage.StartReads(func() error {
+		return objstorage.ReadBatchWithReadAt(ctx, r, reqs)
+	})
+}
+
 func (r *remoteReadable) Close() error {
 	defer func() { r.objReader = nil }()
 	return r.objReader.Close()
@@ -150,6 +160,16 @@ func (r *remoteReadHandle) maybeReadahead(offset int64, len int) int {
 	return int(r.readahead.state.maybeReadahead(offset, int64(len)))
 }
 
+// ReadAsync is part of the objstorage.ReadHandle interface.
+func (r *remoteReadHandle) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	if !r.forCompaction {
+		r.readahead.state.recordReadBatch(reqs)
+	}
+	return r.readable.ReadAsync(ctx, reqs)
+}
+
 // Close is part of the objstorage.ReadHandle interface.
 func (r *remoteReadHandle) Close() error {
 	r.readable = nil
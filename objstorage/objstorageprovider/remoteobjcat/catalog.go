@@ -108,6 +108,34 @@ func Open(fs vfs.FS, dirname string) (*Catalog, CatalogContents, error) {
 		}
 		// TODO(radu): remove obsolete catalog files.
 	}
+	return c, c.contentsLocked(), nil
+}
+
+// ReadContents returns the contents of the catalog in the given directory
+// without modifying any files. It can be used on the directory of a running
+// DB.
+func ReadContents(fs vfs.FS, dirname string) (CatalogContents, error) {
+	c := &Catalog{
+		fs:      fs,
+		dirname: dirname,
+	}
+	c.mu.objects = make(map[base.DiskFileNum]RemoteObjectMetadata)
+	marker, filename, err := atomicfs.LocateMarker(fs, dirname, catalogMarkerName)
+	if err != nil {
+		return CatalogContents{}, err
+	}
+	if err := marker.Close(); err != nil {
+		return CatalogContents{}, err
+	}
+	if filename != "" {
+		if err := c.loadFromCatalogFile(filename); err != nil {
+			return CatalogContents{}, err
+		}
+	}
+	return c.contentsLocked(), nil
+}
+
+func (c *Catalog) contentsLocked() CatalogContents {
 	res := CatalogContents{
 		CreatorID: c.mu.creatorID,
 		Objects:   make([]RemoteObjectMetadata, 0, len(c.mu.objects)),
@@ -119,7 +147,7 @@ func Open(fs vfs.FS, dirname string) (*Catalog, CatalogContents, error) {
 	slices.SortFunc(res.Objects, func(a, b RemoteObjectMetadata) int {
 		return cmp.Compare(a.FileNum, b.FileNum)
 	})
-	return c, res, nil
+	return res
 }
 
 // SetCreatorID sets the creator ID. If it is already set, it must match.
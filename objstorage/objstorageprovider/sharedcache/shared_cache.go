@@ -5,7 +5,9 @@
 package sharedcache
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"math/bits"
@@ -14,7 +16,9 @@ import (
 	"time"
 
 	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
 	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/vfs"
@@ -31,6 +35,13 @@ var (
 // Cache is a persistent cache backed by a local filesystem. It is intended
 // to cache data that is in slower shared storage (e.g. S3), hence the
 // package name 'sharedcache'.
+//
+// The mapping of the cached blocks to the cache file is persisted when the
+// cache is closed, and reloaded when it is opened, so that the cache starts
+// warm after a restart. Each block is stored along with the length and a
+// checksum of its contents; a reloaded block is verified when it is first read, and discarded
+// if its contents changed (e.g. because it was overwritten after the mapping
+// was persisted, before a crash).
 type Cache struct {
 	shards       []shard
 	writeWorkers writeWorkers
@@ -71,6 +82,17 @@ type Metrics struct {
 	// The number of times writing a cache block to the cache failed.
 	WriteBackFailures int64
 
+	// The number of cache blocks that were reloaded from the persisted
+	// metadata when the cache was opened.
+	WarmStartBlocks int64
+	// The number of reloaded cache blocks that were discarded, because their
+	// object was removed or their contents did not match the checksum.
+	WarmStartDiscarded int64
+	// The number of calls to ReadAt where some data returned was read from
+	// reloaded cache blocks. The warm-start hit rate is WarmStartHits /
+	// TotalReads.
+	WarmStartHits int64
+
 	// The latency of calls to get some data from the cache.
 	GetLatency prometheus.Histogram
 	// The latency of reads of a single cache block from disk.
@@ -98,6 +120,10 @@ type internalMetrics struct {
 	evictions         atomic.Int64
 	writeBackFailures atomic.Int64
 
+	warmStartBlocks    atomic.Int64
+	warmStartDiscarded atomic.Int64
+	warmStartHits      atomic.Int64
+
 	getLatency       prometheus.Histogram
 	diskReadLatency  prometheus.Histogram
 	queuePutLatency  prometheus.Histogram
@@ -144,7 +170,7 @@ func Open(
 	c.shards = make([]shard, numShards)
 	blocksPerShard := sizeBytes / int64(numShards) / int64(blockSize)
 	for i := range c.shards {
-		if err := c.shards[i].init(c, fs, fsDir, i, blocksPerShard, blockSize, shardingBlockSize); err != nil {
+		if err := c.shards[i].init(c, fs, fsDir, i, numShards, blocksPerShard, blockSize, shardingBlockSize); err != nil {
 			return nil, err
 		}
 	}
@@ -162,8 +188,8 @@ func Open(
 	return c, nil
 }
 
-// Close closes the cache. Methods such as ReadAt should not be called after Close is
-// called.
+// Close closes the cache, persisting the mapping of the cached blocks. Methods
+// such as ReadAt should not be called after Close is called.
 func (c *Cache) Close() error {
 	c.writeWorkers.Stop()
 
@@ -191,6 +217,9 @@ func (c *Cache) Metrics() Metrics {
 		ReadsWithNoHit:      c.metrics.readsWithNoHit.Load(),
 		Evictions:           c.metrics.evictions.Load(),
 		WriteBackFailures:   c.metrics.writeBackFailures.Load(),
+		WarmStartBlocks:     c.metrics.warmStartBlocks.Load(),
+		WarmStartDiscarded:  c.metrics.warmStartDiscarded.Load(),
+		WarmStartHits:       c.metrics.warmStartHits.Load(),
 		GetLatency:          c.metrics.getLatency,
 		DiskReadLatency:     c.metrics.diskReadLatency,
 		QueuePutLatency:     c.metrics.queuePutLatency,
@@ -199,6 +228,15 @@ func (c *Cache) Metrics() Metrics {
 	}
 }
 
+// RetainObjects discards the cached blocks of the objects for which isLive
+// returns false. It is used after the cache is opened, to discard the reloaded
+// blocks of the objects that were removed while the cache was closed.
+func (c *Cache) RetainObjects(isLive func(fileNum base.DiskFileNum) bool) {
+	for i := range c.shards {
+		c.shards[i].retainObjects(isLive)
+	}
+}
+
 // ReadFlags contains options for Cache.ReadAt.
 type ReadFlags struct {
 	// ReadOnly instructs ReadAt to not write any new data into the cache; it is
@@ -228,11 +266,14 @@ func (c *Cache) ReadAt(
 	// all.
 	{
 		start := time.Now()
-		n, err := c.get(fileNum, p, ofs)
+		n, warm, err := c.get(fileNum, p, ofs)
 		c.metrics.getLatency.Observe(float64(time.Since(start)))
 		if err != nil {
 			return err
 		}
+		if warm {
+			c.metrics.warmStartHits.Add(1)
+		}
 		if n == len(p) {
 			// Everything was in cache!
 			c.metrics.readsWithFullHit.Add(1)
@@ -283,7 +324,7 @@ func (c *Cache) ReadAt(
 	copy(p, adjustedP[sizeOfOffAdjustment:])
 
 	start := time.Now()
-	c.writeWorkers.QueueWrite(fileNum, adjustedP, adjustedOfs)
+	c.writeWorkers.QueueWrite(fileNum, adjustedP[:eofCap], adjustedOfs)
 	c.metrics.queuePutLatency.Observe(float64(time.Since(start)))
 
 	return nil
@@ -296,7 +337,10 @@ func (c *Cache) ReadAt(
 //
 // If data is partially available, a prefix of the data is read; returns n < len(p)
 // and no error. If no prefix is available, returns n = 0 and no error.
-func (c *Cache) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ error) {
+//
+// warm is set if some data was read from blocks reloaded when the cache was
+// opened.
+func (c *Cache) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, warm bool, _ error) {
 	// The data extent might cross shard boundaries, hence the loop. In the hot
 	// path, max two iterations of this loop will be executed, since reads are sized
 	// in units of sstable block size.
@@ -307,18 +351,19 @@ func (c *Cache) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 		if toBoundary := int(c.shardingBlockSize - ((ofs + int64(n)) % c.shardingBlockSize)); cappedLen > toBoundary {
 			cappedLen = toBoundary
 		}
-		numRead, err := shard.get(fileNum, p[n:n+cappedLen], ofs+int64(n))
+		numRead, shardWarm, err := shard.get(fileNum, p[n:n+cappedLen], ofs+int64(n))
+		warm = warm || shardWarm
 		if err != nil {
-			return n, err
+			return n, warm, err
 		}
 		n += numRead
 		if numRead < cappedLen {
 			// We only read a prefix from this shard.
-			return n, nil
+			return n, warm, nil
 		}
 		if n == len(p) {
 			// We are done.
-			return n, nil
+			return n, warm, nil
 		}
 		// Data extent crosses shard boundary, continue with next shard.
 		if !multiShard {
@@ -328,14 +373,15 @@ func (c *Cache) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 	}
 }
 
-// set attempts to write the requested data to the cache. Both ofs & len(p) must
-// be multiples of the block size.
+// set attempts to write the requested data to the cache. ofs must be a multiple
+// of the block size. Only the last block of the data may be partial, at the end
+// of the object.
 //
 // If all of p is not written to the shard, set returns a non-nil error.
 func (c *Cache) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 	if invariants.Enabled {
-		if c.bm.Remainder(ofs) != 0 || c.bm.Remainder(int64(len(p))) != 0 {
-			panic(fmt.Sprintf("set with ofs & len not multiples of block size: %v %v", ofs, len(p)))
+		if c.bm.Remainder(ofs) != 0 {
+			panic(fmt.Sprintf("set with ofs not a multiple of block size: %v", ofs))
 		}
 	}
 
@@ -375,7 +421,10 @@ func (c *Cache) getShard(fileNum base.DiskFileNum, ofs int64) *shard {
 
 type shard struct {
 	cache             *Cache
+	fs                vfs.FS
 	file              vfs.File
+	metaPath          string
+	numShards         int
 	sizeInBlocks      int64
 	bm                blockMath
 	shardingBlockSize int64
@@ -403,6 +452,19 @@ type cacheBlockState struct {
 	// prev is the previous block in the LRU list. It is not used when the block
 	// is in the free list.
 	prev cacheBlockIndex
+
+	// length is the number of bytes of the object in the block, which is less
+	// than the block size for the last block of the object.
+	length int32
+	// checksum is the checksum of the first length bytes of the block.
+	checksum uint32
+	// warm is set if the block was reloaded when the cache was opened (and was
+	// not reused since).
+	warm bool
+	// unverified is set if the block was reloaded and its contents were not
+	// yet verified against the checksum. Such blocks are verified under the
+	// write lock before they are read.
+	unverified bool
 }
 
 // Maps a logical block in an SST to an index of the cache block with the
@@ -433,12 +495,15 @@ func (s *shard) init(
 	fs vfs.FS,
 	fsDir string,
 	shardIdx int,
+	numShards int,
 	sizeInBlocks int64,
 	blockSize int,
 	shardingBlockSize int64,
 ) error {
 	*s = shard{
 		cache:        cache,
+		fs:           fs,
+		numShards:    numShards,
 		sizeInBlocks: sizeInBlocks,
 	}
 	if blockSize < 1024 || shardingBlockSize%int64(blockSize) != 0 {
@@ -446,7 +511,9 @@ func (s *shard) init(
 	}
 	s.bm = makeBlockMath(blockSize)
 	s.shardingBlockSize = shardingBlockSize
-	file, err := fs.OpenReadWrite(fs.PathJoin(fsDir, fmt.Sprintf("SHARED-CACHE-%03d", shardIdx)), vfs.WriteCategoryUnspecified)
+	path := fs.PathJoin(fsDir, fmt.Sprintf("SHARED-CACHE-%03d", shardIdx))
+	s.metaPath = path + ".meta"
+	file, err := fs.OpenReadWrite(path, vfs.WriteCategoryUnspecified)
 	if err != nil {
 		return err
 	}
@@ -457,17 +524,35 @@ func (s *shard) init(
 	}
 	s.file = file
 
-	// TODO(josh): Right now, the secondary cache is not persistent. All existing
-	// cache contents will be over-written, since all metadata is only stored in
-	// memory.
 	s.mu.where = make(whereMap)
 	s.mu.blocks = make([]cacheBlockState, sizeInBlocks)
 	s.mu.lruHead = invalidBlockIndex
 	s.mu.freeHead = invalidBlockIndex
+	entries, err := s.readMetadata()
+	if err != nil {
+		// The cache starts cold.
+		cache.logger.Infof("discarding secondary cache metadata %q: %v", s.metaPath, err)
+		entries = nil
+	}
+	// The entries are in LRU order, starting with the most recently used.
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		s.mu.where[e.logical] = e.index
+		b := &s.mu.blocks[e.index]
+		b.logical = e.logical
+		b.length = e.length
+		b.checksum = e.checksum
+		b.warm = true
+		b.unverified = true
+		s.lruInsertFront(e.index)
+	}
 	for i := range s.mu.blocks {
-		s.freePush(cacheBlockIndex(i))
+		if !s.mu.blocks[i].warm {
+			s.freePush(cacheBlockIndex(i))
+		}
 	}
-
+	cache.metrics.count.Add(int64(len(entries)))
+	cache.metrics.warmStartBlocks.Add(int64(len(entries)))
 	return nil
 }
 
@@ -475,7 +560,186 @@ func (s *shard) close() error {
 	defer func() {
 		s.file = nil
 	}()
-	return s.file.Close()
+	// The blocks must be durable before the metadata that refers to them.
+	err := s.file.Sync()
+	if err == nil {
+		err = s.writeMetadata()
+	}
+	return errors.CombineErrors(err, s.file.Close())
+}
+
+// metadataVersion is the version of the encoding of the shard metadata files.
+const metadataVersion = 1
+
+// metadataEntry describes a cache block in the shard metadata file.
+type metadataEntry struct {
+	logical  logicalBlockID
+	index    cacheBlockIndex
+	length   int32
+	checksum uint32
+}
+
+// writeMetadata persists the mapping of the cached blocks, in LRU order. The
+// metadata file contains a header with the version and the geometry of the
+// cache, the entries, and a checksum of the contents.
+func (s *shard) writeMetadata() error {
+	s.mu.Lock()
+	buf := binary.AppendUvarint(nil, metadataVersion)
+	buf = binary.AppendUvarint(buf, uint64(s.bm.BlockSize()))
+	buf = binary.AppendUvarint(buf, uint64(s.shardingBlockSize))
+	buf = binary.AppendUvarint(buf, uint64(s.sizeInBlocks))
+	buf = binary.AppendUvarint(buf, uint64(s.numShards))
+	buf = binary.AppendUvarint(buf, uint64(len(s.mu.where)))
+	if s.mu.lruHead != invalidBlockIndex {
+		for idx := s.mu.lruHead; ; {
+			b := &s.mu.blocks[idx]
+			buf = binary.AppendUvarint(buf, uint64(b.logical.filenum))
+			buf = binary.AppendUvarint(buf, uint64(b.logical.cacheBlockIdx))
+			buf = binary.AppendUvarint(buf, uint64(idx))
+			buf = binary.AppendUvarint(buf, uint64(b.length))
+			buf = binary.LittleEndian.AppendUint32(buf, b.checksum)
+			if idx = s.lruNext(idx); idx == s.mu.lruHead {
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	buf = binary.LittleEndian.AppendUint32(buf, crc.New(buf).Value())
+
+	tmpPath := s.metaPath + ".tmp"
+	f, err := s.fs.Create(tmpPath, vfs.WriteCategoryUnspecified)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Sync(); err != nil {
+		return errors.CombineErrors(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return s.fs.Rename(tmpPath, s.metaPath)
+}
+
+// readMetadata reads the metadata file written by writeMetadata, if it exists.
+// An error is returned if the metadata is corrupt or was written with a
+// different geometry.
+func (s *shard) readMetadata() ([]metadataEntry, error) {
+	f, err := s.fs.Open(s.metaPath)
+	if oserror.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err := errors.CombineErrors(err, f.Close()); err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, errors.New("truncated metadata")
+	}
+	data, checksum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc.New(data).Value() != checksum {
+		return nil, errors.New("checksum mismatch")
+	}
+
+	r := bytes.NewReader(data)
+	var header [6]uint64
+	for i := range header {
+		if header[i], err = binary.ReadUvarint(r); err != nil {
+			return nil, errors.Wrap(err, "corrupt metadata")
+		}
+	}
+	if header[0] != metadataVersion {
+		return nil, errors.Newf("unsupported version %d", header[0])
+	}
+	geometry := [4]uint64{uint64(s.bm.BlockSize()), uint64(s.shardingBlockSize), uint64(s.sizeInBlocks), uint64(s.numShards)}
+	if [4]uint64(header[1:5]) != geometry {
+		return nil, errors.Newf("the cache geometry changed (block size, sharding block size, blocks, shards): %v -> %v",
+			header[1:5], geometry)
+	}
+	count := header[5]
+	if count > uint64(s.sizeInBlocks) {
+		return nil, errors.New("corrupt metadata")
+	}
+	entries := make([]metadataEntry, count)
+	used := make([]bool, s.sizeInBlocks)
+	seen := make(map[logicalBlockID]struct{}, count)
+	for i := range entries {
+		var v [4]uint64
+		for j := range v {
+			if v[j], err = binary.ReadUvarint(r); err != nil {
+				return nil, errors.Wrap(err, "corrupt metadata")
+			}
+		}
+		var checksum [4]byte
+		if _, err := io.ReadFull(r, checksum[:]); err != nil {
+			return nil, errors.Wrap(err, "corrupt metadata")
+		}
+		e := metadataEntry{
+			logical: logicalBlockID{
+				filenum:       base.DiskFileNum(v[0]),
+				cacheBlockIdx: cacheBlockIndex(v[1]),
+			},
+			index:    cacheBlockIndex(v[2]),
+			length:   int32(v[3]),
+			checksum: binary.LittleEndian.Uint32(checksum[:]),
+		}
+		if v[2] >= uint64(s.sizeInBlocks) || used[e.index] {
+			return nil, errors.New("corrupt metadata")
+		}
+		if v[3] == 0 || v[3] > uint64(s.bm.BlockSize()) {
+			return nil, errors.New("corrupt metadata")
+		}
+		if _, ok := seen[e.logical]; ok {
+			return nil, errors.New("corrupt metadata")
+		}
+		used[e.index] = true
+		seen[e.logical] = struct{}{}
+		entries[i] = e
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("corrupt metadata")
+	}
+	return entries, nil
+}
+
+// retainObjects discards the blocks of the objects for which isLive returns
+// false. See Cache.RetainObjects.
+func (s *shard) retainObjects(isLive func(fileNum base.DiskFileNum) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, idx := range s.mu.where {
+		if isLive(k.filenum) || s.mu.blocks[idx].lock != unlocked {
+			continue
+		}
+		s.discardLocked(k, idx)
+	}
+}
+
+// discardLocked removes a block from the cache and frees it. The block must
+// not be locked by readers. s.mu must be held.
+func (s *shard) discardLocked(k logicalBlockID, idx cacheBlockIndex) {
+	if s.mu.blocks[idx].warm {
+		s.cache.metrics.warmStartDiscarded.Add(1)
+	}
+	delete(s.mu.where, k)
+	s.lruUnlink(idx)
+	s.mu.blocks[idx] = cacheBlockState{}
+	s.freePush(idx)
+	s.cache.metrics.count.Add(-1)
+}
+
+// verify checks the first length bytes of a reloaded block against its
+// checksum. The block must be write-locked by the caller.
+func (s *shard) verify(idx cacheBlockIndex, length int32, checksum uint32) bool {
+	buf := make([]byte, length)
+	if _, err := s.file.ReadAt(buf, s.bm.BlockOffset(idx)); err != nil {
+		return false
+	}
+	return crc.New(buf).Value() == checksum
 }
 
 // freePush pushes a block to the front of the free list.
@@ -545,7 +809,10 @@ func (s *shard) lruUnlink(index cacheBlockIndex) {
 // a reverse scan, since those iterate over sstable blocks in reverse order and due to
 // cache block aligned reads will have read the suffix of the sstable block that will
 // be needed next.
-func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ error) {
+//
+// warm is set if some data was read from blocks reloaded when the cache was
+// opened.
+func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, warm bool, _ error) {
 	if invariants.Enabled {
 		if ofs/s.shardingBlockSize != (ofs+int64(len(p))-1)/s.shardingBlockSize {
 			panic(fmt.Sprintf("get crosses shard boundary: %v %v", ofs, len(p)))
@@ -571,21 +838,33 @@ func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 		// https://github.com/cockroachdb/pebble/pull/2586 for additional discussion.
 		if !ok {
 			s.mu.Unlock()
-			return n, nil
+			return n, warm, nil
 		}
 		if s.mu.blocks[cacheBlockIdx].lock == writeLockTaken {
 			// In practice, if we have two reads of the same SST block in close succession, we
 			// would expect the second to hit in the in-memory block cache. So it's not worth
 			// optimizing this case here.
 			s.mu.Unlock()
-			return n, nil
+			return n, warm, nil
+		}
+		if b := &s.mu.blocks[cacheBlockIdx]; b.unverified {
+			// Verify the reloaded block under the write lock (there can be no
+			// readers), then look it up again.
+			b.lock = writeLockTaken
+			length, checksum := b.length, b.checksum
+			s.mu.Unlock()
+			ok := s.verify(cacheBlockIdx, length, checksum)
+			s.mu.Lock()
+			if ok {
+				b.lock = unlocked
+				b.unverified = false
+			} else {
+				b.lock = unlocked
+				s.discardLocked(k, cacheBlockIdx)
+			}
+			s.mu.Unlock()
+			continue
 		}
-		s.mu.blocks[cacheBlockIdx].lock += readLockTakenInc
-		// Move to front of the LRU list.
-		s.lruUnlink(cacheBlockIdx)
-		s.lruInsertFront(cacheBlockIdx)
-		s.mu.Unlock()
-
 		readAt := s.bm.BlockOffset(cacheBlockIdx)
 		readSize := s.bm.BlockSize()
 		if n == 0 { // if first read
@@ -593,20 +872,34 @@ func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 			readAt += rem
 			readSize -= int(rem)
 		}
+		// The block may hold fewer bytes than the read needs, if it was written
+		// from a shorter object with the same file number (for instance, before a
+		// restart); it is then ignored.
+		if end := s.bm.BlockSize() - readSize + min(readSize, len(p[n:])); end > int(s.mu.blocks[cacheBlockIdx].length) {
+			s.mu.Unlock()
+			return n, warm, nil
+		}
+
+		warm = warm || s.mu.blocks[cacheBlockIdx].warm
+		s.mu.blocks[cacheBlockIdx].lock += readLockTakenInc
+		// Move to front of the LRU list.
+		s.lruUnlink(cacheBlockIdx)
+		s.lruInsertFront(cacheBlockIdx)
+		s.mu.Unlock()
 
 		if len(p[n:]) <= readSize {
 			start := time.Now()
 			numRead, err := s.file.ReadAt(p[n:], readAt)
 			s.cache.metrics.diskReadLatency.Observe(float64(time.Since(start)))
 			s.dropReadLock(cacheBlockIdx)
-			return n + numRead, err
+			return n + numRead, warm, err
 		}
 		start := time.Now()
 		numRead, err := s.file.ReadAt(p[n:n+readSize], readAt)
 		s.cache.metrics.diskReadLatency.Observe(float64(time.Since(start)))
 		s.dropReadLock(cacheBlockIdx)
 		if err != nil {
-			return 0, err
+			return 0, warm, err
 		}
 
 		// Note that numRead == readSize, since we checked for an error above.
@@ -620,8 +913,8 @@ func (s *shard) get(fileNum base.DiskFileNum, p []byte, ofs int64) (n int, _ err
 }
 
 // set attempts to write the requested data to the shard. The data must not
-// cross a shard boundary, and both ofs & len(p) must be multiples of the
-// block size.
+// cross a shard boundary, and ofs must be a multiple of the block size. Only
+// the last block of the data may be partial, at the end of the object.
 //
 // If all of p is not written to the shard, set returns a non-nil error.
 func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
@@ -629,8 +922,8 @@ func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 		if ofs/s.shardingBlockSize != (ofs+int64(len(p))-1)/s.shardingBlockSize {
 			panic(fmt.Sprintf("set crosses shard boundary: %v %v", ofs, len(p)))
 		}
-		if s.bm.Remainder(ofs) != 0 || s.bm.Remainder(int64(len(p))) != 0 {
-			panic(fmt.Sprintf("set with ofs & len not multiples of block size: %v %v", ofs, len(p)))
+		if s.bm.Remainder(ofs) != 0 {
+			panic(fmt.Sprintf("set with ofs not a multiple of block size: %v", ofs))
 		}
 		s.assertShardStateIsConsistent()
 	}
@@ -654,11 +947,20 @@ func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 			filenum:       fileNum,
 			cacheBlockIdx: s.bm.Block(ofs + int64(n)),
 		}
+		writeSize := s.bm.BlockSize()
+		if len(p[n:]) <= writeSize {
+			writeSize = len(p[n:])
+		}
+		checksum := crc.New(p[n : n+writeSize]).Value()
 		s.mu.Lock()
-		if _, ok := s.mu.where[k]; ok {
-			s.mu.Unlock()
-			n += s.bm.BlockSize()
-			continue
+		if idx, ok := s.mu.where[k]; ok {
+			if b := &s.mu.blocks[idx]; int(b.length) >= writeSize || b.lock != unlocked {
+				s.mu.Unlock()
+				n += writeSize
+				continue
+			}
+			// The block holds fewer bytes than the data (see get); replace it.
+			s.discardLocked(k, idx)
 		}
 
 		var cacheBlockIdx cacheBlockIndex
@@ -693,17 +995,18 @@ func (s *shard) set(fileNum base.DiskFileNum, p []byte, ofs int64) error {
 
 		s.lruInsertFront(cacheBlockIdx)
 		s.mu.where[k] = cacheBlockIdx
-		s.mu.blocks[cacheBlockIdx].logical = k
-		s.mu.blocks[cacheBlockIdx].lock = writeLockTaken
+		s.mu.blocks[cacheBlockIdx] = cacheBlockState{
+			logical:  k,
+			lock:     writeLockTaken,
+			next:     s.mu.blocks[cacheBlockIdx].next,
+			prev:     s.mu.blocks[cacheBlockIdx].prev,
+			length:   int32(writeSize),
+			checksum: checksum,
+		}
 		s.mu.Unlock()
 
 		writeAt := s.bm.BlockOffset(cacheBlockIdx)
 
-		writeSize := s.bm.BlockSize()
-		if len(p[n:]) <= writeSize {
-			writeSize = len(p[n:])
-		}
-
 		start := time.Now()
 		_, err := s.file.WriteAt(p[n:n+writeSize], writeAt)
 		s.cache.metrics.diskWriteLatency.Observe(float64(time.Since(start)))
@@ -214,6 +214,103 @@ func TestSharedCacheRandomized(t *testing.T) {
 	}
 }
 
+func TestSharedCacheWarmStart(t *testing.T) {
+	ctx := context.Background()
+	fs := vfs.NewMem()
+	provider, err := objstorageprovider.Open(objstorageprovider.DefaultSettings(fs, ""))
+	require.NoError(t, err)
+	defer provider.Close()
+
+	const blockSize = 1024
+	const shardingBlockSize = 4 * blockSize
+	const numShards = 2
+	const cacheSize = 4 * numShards * shardingBlockSize
+	openCache := func() *sharedcache.Cache {
+		cache, err := sharedcache.Open(fs, base.DefaultLogger, "", blockSize, shardingBlockSize, cacheSize, numShards)
+		require.NoError(t, err)
+		return cache
+	}
+
+	// The last block of the objects is partial.
+	const size = 2*shardingBlockSize + 100
+	const numBlocks = (size + blockSize - 1) / blockSize
+	objData := make([]byte, size)
+	for i := range objData {
+		objData[i] = byte(i)
+	}
+	for _, fileNum := range []base.DiskFileNum{1, 2} {
+		writable, _, err := provider.Create(ctx, base.FileTypeTable, fileNum, objstorage.CreateOptions{})
+		require.NoError(t, err)
+		require.NoError(t, writable.Write(append([]byte(nil), objData...)))
+		require.NoError(t, writable.Finish())
+	}
+	// readAll reads an object through the cache and returns the number of reads
+	// that missed the cache.
+	readAll := func(cache *sharedcache.Cache, fileNum base.DiskFileNum) int64 {
+		readable, err := provider.OpenForReading(ctx, base.FileTypeTable, fileNum, objstorage.OpenOptions{})
+		require.NoError(t, err)
+		defer readable.Close()
+		before := cache.Metrics()
+		for ofs := 0; ofs < size; ofs += blockSize {
+			got := make([]byte, min(blockSize, size-ofs))
+			require.NoError(t, cache.ReadAt(ctx, fileNum, got, int64(ofs), readable, readable.Size(), sharedcache.ReadFlags{}))
+			require.Equal(t, objData[ofs:ofs+len(got)], got)
+		}
+		cache.WaitForWritesToComplete()
+		after := cache.Metrics()
+		return after.ReadsWithNoHit + after.ReadsWithPartialHit - before.ReadsWithNoHit - before.ReadsWithPartialHit
+	}
+
+	cache := openCache()
+	require.Equal(t, int64(numBlocks), readAll(cache, 1))
+	require.Equal(t, int64(numBlocks), readAll(cache, 2))
+	require.Zero(t, cache.Metrics().WarmStartBlocks)
+	require.NoError(t, cache.Close())
+
+	// The cache is reloaded; the blocks of object 2 are discarded when it is no
+	// longer live.
+	cache = openCache()
+	m := cache.Metrics()
+	require.Equal(t, int64(2*numBlocks), m.WarmStartBlocks)
+	require.Equal(t, int64(2*numBlocks), m.Count)
+	cache.RetainObjects(func(fileNum base.DiskFileNum) bool { return fileNum == 1 })
+	m = cache.Metrics()
+	require.Equal(t, int64(numBlocks), m.WarmStartDiscarded)
+	require.Equal(t, int64(numBlocks), m.Count)
+
+	require.Zero(t, readAll(cache, 1))
+	m = cache.Metrics()
+	require.Equal(t, int64(numBlocks), m.WarmStartHits)
+	require.Equal(t, m.TotalReads, m.WarmStartHits)
+	require.Equal(t, int64(numBlocks), readAll(cache, 2))
+	require.Equal(t, int64(numBlocks), cache.Metrics().WarmStartHits)
+	require.NoError(t, cache.Close())
+
+	// Corrupt the cache files; the corrupted blocks are discarded when they are
+	// read.
+	for i := 0; i < numShards; i++ {
+		f, err := fs.OpenReadWrite(fmt.Sprintf("SHARED-CACHE-%03d", i), vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		_, err = f.WriteAt(bytes.Repeat([]byte{0xff}, cacheSize/numShards), 0)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	cache = openCache()
+	require.Equal(t, int64(2*numBlocks), cache.Metrics().WarmStartBlocks)
+	require.Equal(t, int64(numBlocks), readAll(cache, 1))
+	m = cache.Metrics()
+	require.Equal(t, int64(numBlocks), m.WarmStartDiscarded)
+	require.Zero(t, m.WarmStartHits)
+	require.NoError(t, cache.Close())
+
+	// The metadata is ignored if the geometry of the cache changes.
+	cache, err = sharedcache.Open(fs, base.DefaultLogger, "", blockSize, shardingBlockSize, 2*cacheSize, numShards)
+	require.NoError(t, err)
+	require.Zero(t, cache.Metrics().WarmStartBlocks)
+	require.Equal(t, int64(numBlocks), readAll(cache, 1))
+	require.NoError(t, cache.Close())
+}
+
 // parseBytesArg parses an optional argument that specifies a byte size; if the
 // argument is not specified the default value is used. K/M/G suffixes are
 // supported.
@@ -31,7 +31,16 @@ func (p *provider) vfsOpenForReading(
 		}
 		return nil, err
 	}
-	return newFileReadable(file, p.st.FS, filename)
+	directIO, err := p.maybeSetDirectIO(file)
+	if err != nil {
+		return nil, errors.CombineErrors(err, file.Close())
+	}
+	r, err := newFileReadable(file, p.st.FS, filename)
+	if err != nil {
+		return nil, errors.CombineErrors(err, file.Close())
+	}
+	r.directIO = directIO
+	return r, nil
 }
 
 func (p *provider) vfsCreate(
@@ -45,6 +54,10 @@ func (p *provider) vfsCreate(
 	if err != nil {
 		return nil, objstorage.ObjectMetadata{}, err
 	}
+	directIO, err := p.maybeSetDirectIO(file)
+	if err != nil {
+		return nil, objstorage.ObjectMetadata{}, errors.CombineErrors(err, file.Close())
+	}
 	file = vfs.NewSyncingFile(file, vfs.SyncingFileOptions{
 		NoSyncOnClose: p.st.NoSyncOnClose,
 		BytesPerSync:  p.st.BytesPerSync,
@@ -53,9 +66,31 @@ func (p *provider) vfsCreate(
 		DiskFileNum: fileNum,
 		FileType:    fileType,
 	}
+	if directIO {
+		return newFileDirectWritable(file), meta, nil
+	}
 	return newFileBufferedWritable(file), meta, nil
 }
 
+// maybeSetDirectIO enables direct I/O for the file if Settings.DirectIO is set,
+// returning true if it was enabled. If the file does not support direct I/O,
+// it is used without it.
+func (p *provider) maybeSetDirectIO(file vfs.File) (bool, error) {
+	if !p.st.DirectIO {
+		return false, nil
+	}
+	if err := vfs.SetDirectIO(file, true); err != nil {
+		if errors.Is(err, vfs.ErrDirectIOUnsupported) {
+			p.directIOUnsupported.Do(func() {
+				p.st.Logger.Infof("direct I/O is not supported by %q; using buffered I/O", p.st.FSDirName)
+			})
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 func (p *provider) vfsRemove(fileType base.FileType, fileNum base.DiskFileNum) error {
 	return p.st.FSCleaner.Clean(p.st.FS, fileType, p.vfsPath(fileType, fileNum))
 }
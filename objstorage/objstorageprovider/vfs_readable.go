@@ -7,6 +7,7 @@ package objstorageprovider
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"sync"
 
@@ -29,6 +30,10 @@ type fileReadable struct {
 	// sequential reads option (see vfsReadHandle).
 	filename string
 	fs       vfs.FS
+
+	// directIO is true if the file uses direct I/O (see vfs.SetDirectIO), in
+	// which case the reads must be aligned.
+	directIO bool
 }
 
 var _ objstorage.Readable = (*fileReadable)(nil)
@@ -55,6 +60,9 @@ func newFileReadable(file vfs.File, fs vfs.FS, filename string) (*fileReadable,
 
 // ReadAt is part of the objstorage.Readable interface.
 func (r *fileReadable) ReadAt(_ context.Context, p []byte, off int64) error {
+	if r.directIO {
+		return directReadAt(r.file, r.size, p, off)
+	}
 	n, err := r.file.ReadAt(p, off)
 	if invariants.Enabled && err == nil && n != len(p) {
 		panic("short read")
@@ -62,6 +70,25 @@ func (r *fileReadable) ReadAt(_ context.Context, p []byte, off int64) error {
 	return err
 }
 
+// ReadAsync is part of the objstorage.Readable interface.
+func (r *fileReadable) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	return objstorage.StartReads(func() error {
+		return r.readBatch(ctx, r.file, reqs)
+	})
+}
+
+// readBatch reads a batch of requests from file, which is r.file or a file
+// that was opened again on the same path.
+func (r *fileReadable) readBatch(ctx context.Context, file vfs.File, reqs []vfs.ReadRequest) error {
+	if r.directIO {
+		// The reads are not necessarily aligned.
+		return objstorage.ReadBatchWithReadAt(ctx, r, reqs)
+	}
+	return file.ReadBatch(reqs)
+}
+
 // Close is part of the objstorage.Readable interface.
 func (r *fileReadable) Close() error {
 	defer func() { r.file = nil }()
@@ -90,6 +117,15 @@ type vfsReadHandle struct {
 	// OS-level readahead. Once this is non-nil, the other variables in
 	// readaheadState don't matter much as we defer to OS-level readahead.
 	sequentialFile vfs.File
+
+	// The following fields are only used if the file uses direct I/O, which
+	// bypasses the OS page cache and thus OS-level readahead.
+	//
+	// ra contains the data read ahead.
+	ra alignedReadahead
+	// sequential is set by SetupForCompaction; all reads then read ahead the
+	// maximum readahead size.
+	sequential bool
 }
 
 var _ objstorage.ReadHandle = (*vfsReadHandle)(nil)
@@ -114,6 +150,7 @@ func (rh *vfsReadHandle) Close() error {
 	if rh.sequentialFile != nil {
 		err = rh.sequentialFile.Close()
 	}
+	rh.ra.release()
 	*rh = vfsReadHandle{}
 	readHandlePool.Put(rh)
 	return err
@@ -121,6 +158,9 @@ func (rh *vfsReadHandle) Close() error {
 
 // ReadAt is part of the objstorage.ReadHandle interface.
 func (rh *vfsReadHandle) ReadAt(_ context.Context, p []byte, offset int64) error {
+	if rh.r.directIO {
+		return rh.directReadAt(p, offset)
+	}
 	var n int
 	var err error
 	if rh.sequentialFile != nil {
@@ -144,8 +184,53 @@ func (rh *vfsReadHandle) ReadAt(_ context.Context, p []byte, offset int64) error
 	return err
 }
 
+// ReadAsync is part of the objstorage.ReadHandle interface.
+func (rh *vfsReadHandle) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	rh.rs.recordReadBatch(reqs)
+	file := rh.r.file
+	if rh.sequentialFile != nil {
+		file = rh.sequentialFile
+	}
+	r := rh.r
+	return objstorage.StartReads(func() error {
+		return r.readBatch(ctx, file, reqs)
+	})
+}
+
+// directReadAt implements ReadAt for files that use direct I/O, reading ahead
+// into an aligned buffer (see alignedReadahead) when the reads are sequential.
+func (rh *vfsReadHandle) directReadAt(p []byte, offset int64) error {
+	if rh.ra.readAt(p, offset) {
+		return nil
+	}
+	size := int64(len(p))
+	if rh.sequential {
+		size = max(size, fileMaxReadaheadSize)
+	} else if readaheadSize := rh.rs.maybeReadahead(offset, size); readaheadSize > 0 {
+		size = max(size, readaheadSize)
+	} else {
+		return directReadAt(rh.r.file, rh.r.size, p, offset)
+	}
+	if rh.ra.buf == nil {
+		rh.ra.init()
+	}
+	if err := rh.ra.fill(rh.r.file, rh.r.size, offset, size); err != nil {
+		return err
+	}
+	if !rh.ra.readAt(p, offset) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
 // SetupForCompaction is part of the objstorage.ReadHandle interface.
 func (rh *vfsReadHandle) SetupForCompaction() {
+	if rh.r.directIO {
+		rh.sequential = true
+		return
+	}
 	rh.switchToOSReadahead()
 }
 
@@ -164,8 +249,8 @@ func (rh *vfsReadHandle) switchToOSReadahead() {
 
 // RecordCacheHit is part of the objstorage.ReadHandle interface.
 func (rh *vfsReadHandle) RecordCacheHit(_ context.Context, offset, size int64) {
-	if rh.sequentialFile != nil {
-		// Using OS-level readahead, so do nothing.
+	if rh.sequentialFile != nil || rh.sequential {
+		// Using OS-level readahead (or always reading ahead), so do nothing.
 		return
 	}
 	rh.rs.recordCacheHit(offset, size)
@@ -196,6 +281,7 @@ func (rh *PreallocatedReadHandle) Close() error {
 	if rh.sequentialFile != nil {
 		err = rh.sequentialFile.Close()
 	}
+	rh.ra.release()
 	rh.vfsReadHandle = vfsReadHandle{}
 	return err
 }
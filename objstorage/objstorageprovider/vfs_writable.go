@@ -57,6 +57,83 @@ func (w *fileBufferedWritable) Abort() {
 	w.file = nil
 }
 
+// directWriteBufferSize is the size of the buffer of fileDirectWritable; it is
+// a multiple of vfs.DirectIOAlignment.
+const directWriteBufferSize = 256 << 10 /* 256KB */
+
+// fileDirectWritable is a Writable for a file that uses direct I/O (see
+// vfs.SetDirectIO). Direct writes must be aligned, so the data is accumulated
+// in an aligned buffer that is written when it is full. The unaligned tail of
+// the file is written by Finish after disabling direct I/O.
+type fileDirectWritable struct {
+	file vfs.File
+	buf  []byte
+	n    int
+}
+
+var _ objstorage.Writable = (*fileDirectWritable)(nil)
+
+func newFileDirectWritable(file vfs.File) *fileDirectWritable {
+	return &fileDirectWritable{
+		file: file,
+		buf:  vfs.AlignedBuf(directWriteBufferSize),
+	}
+}
+
+// Write is part of the objstorage.Writable interface.
+func (w *fileDirectWritable) Write(p []byte) error {
+	for len(p) > 0 {
+		n := copy(w.buf[w.n:], p)
+		w.n += n
+		p = p[n:]
+		if w.n == len(w.buf) {
+			if _, err := w.file.Write(w.buf); err != nil {
+				return err
+			}
+			w.n = 0
+		}
+	}
+	return nil
+}
+
+// Finish is part of the objstorage.Writable interface.
+func (w *fileDirectWritable) Finish() error {
+	err := w.flushTail()
+	if err == nil {
+		err = w.file.Sync()
+	}
+	err = firstError(err, w.file.Close())
+	w.buf = nil
+	w.file = nil
+	return err
+}
+
+// flushTail writes the buffered data: the aligned prefix with direct I/O, and
+// the rest without.
+func (w *fileDirectWritable) flushTail() error {
+	aligned := w.n &^ (vfs.DirectIOAlignment - 1)
+	if aligned > 0 {
+		if _, err := w.file.Write(w.buf[:aligned]); err != nil {
+			return err
+		}
+	}
+	if aligned == w.n {
+		return nil
+	}
+	if err := vfs.SetDirectIO(w.file, false); err != nil {
+		return err
+	}
+	_, err := w.file.Write(w.buf[aligned:w.n])
+	return err
+}
+
+// Abort is part of the objstorage.Writable interface.
+func (w *fileDirectWritable) Abort() {
+	_ = w.file.Close()
+	w.buf = nil
+	w.file = nil
+}
+
 func firstError(err0, err1 error) error {
 	if err0 != nil {
 		return err0
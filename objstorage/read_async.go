@@ -0,0 +1,117 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package objstorage
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// PendingReads is a batch of reads started by Readable.ReadAsync or
+// ReadHandle.ReadAsync, which completes asynchronously.
+type PendingReads struct {
+	read func() error
+	done chan struct{}
+	err  error
+}
+
+// StartReads executes read asynchronously, and returns a PendingReads that
+// completes when read returns. It can be used to implement ReadAsync.
+//
+// The reads are executed by a bounded pool of goroutines shared by all the
+// objects (each read is typically a batch submitted at once; see
+// vfs.File.ReadBatch). If the queue of the pool is full, read is executed by
+// the calling goroutine, which bounds the number of pending reads.
+func StartReads(read func() error) *PendingReads {
+	p := &PendingReads{read: read, done: make(chan struct{})}
+	asyncReadPool.once.Do(asyncReadPool.start)
+	select {
+	case asyncReadPool.tasks <- p:
+	default:
+		p.run()
+	}
+	return p
+}
+
+func (p *PendingReads) run() {
+	p.err = p.read()
+	p.read = nil
+	close(p.done)
+}
+
+// asyncReadPool is the pool of goroutines used by StartReads.
+var asyncReadPool pendingReadsPool
+
+type pendingReadsPool struct {
+	once  sync.Once
+	tasks chan *PendingReads
+}
+
+func (p *pendingReadsPool) start() {
+	p.tasks = make(chan *PendingReads, asyncReadQueueSize)
+	for i := 0; i < asyncReadPoolSize; i++ {
+		go func() {
+			for t := range p.tasks {
+				t.run()
+			}
+		}()
+	}
+}
+
+// asyncReadPoolSize is the number of goroutines of asyncReadPool, which is the
+// maximum number of batches of reads executed in parallel by the pool.
+var asyncReadPoolSize = max(16, 2*runtime.GOMAXPROCS(0))
+
+// asyncReadQueueSize is the number of batches of reads that can be queued in
+// asyncReadPool, waiting for a goroutine.
+var asyncReadQueueSize = 4 * asyncReadPoolSize
+
+// Wait waits for the completion of the reads, and returns the first error.
+// The buffers of the requests can only be used after Wait returns.
+func (p *PendingReads) Wait() error {
+	<-p.done
+	return p.err
+}
+
+// Done returns true if the reads have completed, i.e. if Wait does not block.
+func (p *PendingReads) Done() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadBatchWithReadAt reads a batch of requests in parallel with ReadAt calls.
+// It can be used to implement ReadAsync for objects that don't support batched
+// reads.
+func ReadBatchWithReadAt(
+	ctx context.Context,
+	r interface {
+		ReadAt(ctx context.Context, p []byte, off int64) error
+	},
+	reqs []vfs.ReadRequest,
+) error {
+	return vfs.ReadBatchConcurrently(readerAt{ctx: ctx, r: r}, reqs)
+}
+
+// readerAt adapts the ReadAt method of a Readable to io.ReaderAt.
+type readerAt struct {
+	ctx context.Context
+	r   interface {
+		ReadAt(ctx context.Context, p []byte, off int64) error
+	}
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if err := r.r.ReadAt(r.ctx, p, off); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
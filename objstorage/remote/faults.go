@@ -0,0 +1,132 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package remote
+
+import (
+	"context"
+	"io"
+)
+
+// FaultOp identifies the operation passed to the injector of a storage
+// created by WithFaults.
+type FaultOp int8
+
+// The operations that can fail in a storage created by WithFaults.
+const (
+	FaultOpReadObject FaultOp = iota
+	FaultOpReadAt
+	FaultOpCreateObject
+	FaultOpWrite
+	FaultOpList
+	FaultOpDelete
+	FaultOpSize
+)
+
+// WithFaults wraps the given Storage implementation so that the injector is
+// called before every operation; if it returns an error, the operation fails
+// with that error without reaching the wrapped storage. For List, objName is
+// the prefix. It is intended for testing.
+func WithFaults(wrapped Storage, inject func(op FaultOp, objName string) error) Storage {
+	return &faultyStore{
+		inject:  inject,
+		wrapped: wrapped,
+	}
+}
+
+type faultyStore struct {
+	inject  func(op FaultOp, objName string) error
+	wrapped Storage
+}
+
+var _ Storage = (*faultyStore)(nil)
+
+func (f *faultyStore) Close() error {
+	return f.wrapped.Close()
+}
+
+func (f *faultyStore) ReadObject(
+	ctx context.Context, objName string,
+) (_ ObjectReader, objSize int64, _ error) {
+	if err := f.inject(FaultOpReadObject, objName); err != nil {
+		return nil, 0, err
+	}
+	r, size, err := f.wrapped.ReadObject(ctx, objName)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &faultyReader{f: f, name: objName, wrapped: r}, size, nil
+}
+
+type faultyReader struct {
+	f       *faultyStore
+	name    string
+	wrapped ObjectReader
+}
+
+var _ ObjectReader = (*faultyReader)(nil)
+
+func (r *faultyReader) ReadAt(ctx context.Context, p []byte, offset int64) error {
+	if err := r.f.inject(FaultOpReadAt, r.name); err != nil {
+		return err
+	}
+	return r.wrapped.ReadAt(ctx, p, offset)
+}
+
+func (r *faultyReader) Close() error {
+	return r.wrapped.Close()
+}
+
+func (f *faultyStore) CreateObject(objName string) (io.WriteCloser, error) {
+	if err := f.inject(FaultOpCreateObject, objName); err != nil {
+		return nil, err
+	}
+	w, err := f.wrapped.CreateObject(objName)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyWriter{f: f, name: objName, wrapped: w}, nil
+}
+
+type faultyWriter struct {
+	f       *faultyStore
+	name    string
+	wrapped io.WriteCloser
+}
+
+func (w *faultyWriter) Write(p []byte) (int, error) {
+	if err := w.f.inject(FaultOpWrite, w.name); err != nil {
+		return 0, err
+	}
+	return w.wrapped.Write(p)
+}
+
+func (w *faultyWriter) Close() error {
+	return w.wrapped.Close()
+}
+
+func (f *faultyStore) List(prefix, delimiter string) ([]string, error) {
+	if err := f.inject(FaultOpList, prefix); err != nil {
+		return nil, err
+	}
+	return f.wrapped.List(prefix, delimiter)
+}
+
+func (f *faultyStore) Delete(objName string) error {
+	if err := f.inject(FaultOpDelete, objName); err != nil {
+		return err
+	}
+	return f.wrapped.Delete(objName)
+}
+
+func (f *faultyStore) Size(objName string) (int64, error) {
+	if err := f.inject(FaultOpSize, objName); err != nil {
+		return 0, err
+	}
+	return f.wrapped.Size(objName)
+}
+
+func (f *faultyStore) IsNotExistError(err error) bool {
+	return f.wrapped.IsNotExistError(err)
+}
@@ -0,0 +1,471 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package remote
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/tokenbucket"
+)
+
+// ErrCircuitOpen is returned by a storage created by WithRetries when the
+// circuit breaker is open and operations are failed without being attempted.
+var ErrCircuitOpen = errors.New("pebble: remote storage circuit breaker is open")
+
+// RetryOptions configures the storage returned by WithRetries. The zero value
+// retries transient errors a few times with exponential backoff and does not
+// apply timeouts, rate limits or a circuit breaker.
+type RetryOptions struct {
+	// MaxRetries is the number of times an operation that failed with a
+	// transient error is retried. Defaults to 3; a negative value disables
+	// retries.
+	MaxRetries int
+	// InitialBackoff is the delay before the first retry; the delay doubles with
+	// each subsequent retry, up to MaxBackoff. A random jitter of up to half the
+	// delay is subtracted. Default to 50ms and 5s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// OpTimeout, if non-zero, bounds the duration of each attempt of the
+	// operations that take a context (ReadObject and ObjectReader.ReadAt). An
+	// attempt that times out is treated as a transient error.
+	OpTimeout time.Duration
+
+	// RequestsPerSecond, if non-zero, limits the rate at which requests
+	// (including retries) are issued to the wrapped storage. Burst is the
+	// number of requests that can be issued at once after a period of
+	// inactivity; it defaults to RequestsPerSecond (and at least 1).
+	RequestsPerSecond float64
+	Burst             int
+
+	// CircuitBreakerThreshold, if non-zero, is the number of consecutive
+	// operations that must fail (after exhausting their retries) with transient
+	// errors for the circuit breaker to open. While open, all operations fail
+	// immediately with ErrCircuitOpen. After CircuitBreakerCooldown (default
+	// 10s), a single operation is let through as a probe: if it succeeds, the
+	// circuit closes; otherwise, it stays open for another cooldown period.
+	CircuitBreakerThreshold int
+	CircuitBreakerCooldown  time.Duration
+
+	// IsTransient classifies errors returned by the wrapped storage; only
+	// transient errors are retried and count toward the circuit breaker.
+	// Defaults to DefaultIsTransient. Errors for which the wrapped storage's
+	// IsNotExistError returns true are never considered transient.
+	IsTransient func(err error) bool
+
+	// now is used in tests to control time.
+	now func() time.Time
+}
+
+func (o *RetryOptions) ensureDefaults() {
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	} else if o.MaxRetries < 0 {
+		o.MaxRetries = 0
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = 50 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Second
+	}
+	if o.MaxBackoff < o.InitialBackoff {
+		o.MaxBackoff = o.InitialBackoff
+	}
+	if o.Burst <= 0 {
+		o.Burst = max(1, int(o.RequestsPerSecond))
+	}
+	if o.CircuitBreakerCooldown <= 0 {
+		o.CircuitBreakerCooldown = 10 * time.Second
+	}
+	if o.IsTransient == nil {
+		o.IsTransient = DefaultIsTransient
+	}
+	if o.now == nil {
+		o.now = time.Now
+	}
+}
+
+// DefaultIsTransient is the default error classifier used by WithRetries. It
+// considers an error transient if it is a timeout (including a deadline
+// exceeded error), or if any error in its chain has a Temporary() method that
+// returns true. Cancellation is never transient.
+func DefaultIsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var temp interface{ Temporary() bool }
+	return errors.As(err, &temp) && temp.Temporary()
+}
+
+// RetryMetrics holds the counters of a storage created by WithRetries.
+type RetryMetrics struct {
+	// Retries is the number of attempts made after a transient error.
+	Retries int64
+	// Timeouts is the number of attempts that exceeded OpTimeout.
+	Timeouts int64
+	// Failures is the number of operations that failed with a transient error
+	// after exhausting their retries.
+	Failures int64
+	// RateLimited is the number of requests that were delayed by the rate
+	// limit, and RateLimitWait is the total time they were delayed.
+	RateLimited   int64
+	RateLimitWait time.Duration
+	// CircuitBreakerTrips is the number of times the circuit breaker opened,
+	// and CircuitBreakerRejections is the number of operations failed with
+	// ErrCircuitOpen.
+	CircuitBreakerTrips      int64
+	CircuitBreakerRejections int64
+}
+
+// Add adds the counters of other to m.
+func (m *RetryMetrics) Add(other RetryMetrics) {
+	m.Retries += other.Retries
+	m.Timeouts += other.Timeouts
+	m.Failures += other.Failures
+	m.RateLimited += other.RateLimited
+	m.RateLimitWait += other.RateLimitWait
+	m.CircuitBreakerTrips += other.CircuitBreakerTrips
+	m.CircuitBreakerRejections += other.CircuitBreakerRejections
+}
+
+// RetryMetricsProvider is implemented by storage that retries failed
+// operations, such as the storage returned by WithRetries. A Storage which
+// wraps another Storage can implement it to report the metrics of the wrapped
+// storage.
+type RetryMetricsProvider interface {
+	// RetryMetrics returns the counters of the storage.
+	RetryMetrics() RetryMetrics
+}
+
+// WithRetries wraps the given Storage implementation so that transient errors
+// are retried with exponential backoff, and optionally applies per-attempt
+// timeouts, a request rate limit and a circuit breaker. The counters of the
+// returned storage are surfaced in pebble.Metrics when it is used by a DB (see
+// RetryMetricsProvider).
+//
+// The data written to an object is streamed to the wrapped storage, so only
+// the creation of an object writer is retried; errors during Write or Close
+// are returned as is.
+func WithRetries(wrapped Storage, opts RetryOptions) Storage {
+	opts.ensureDefaults()
+	r := &retryingStore{
+		wrapped: wrapped,
+		opts:    opts,
+	}
+	if opts.RequestsPerSecond > 0 {
+		r.limiter.tb.InitWithNowFn(
+			tokenbucket.TokensPerSecond(opts.RequestsPerSecond), tokenbucket.Tokens(opts.Burst), opts.now,
+		)
+	}
+	return r
+}
+
+// retryingStore wraps a remote.Storage implementation and retries failed
+// operations.
+type retryingStore struct {
+	wrapped Storage
+	opts    RetryOptions
+
+	limiter struct {
+		sync.Mutex
+		tb tokenbucket.TokenBucket
+	}
+
+	breaker struct {
+		sync.Mutex
+		consecutiveFailures int
+		open                bool
+		// openUntil is the time after which a probe is let through.
+		openUntil time.Time
+		// probing is set while a probe is in progress.
+		probing bool
+	}
+
+	metrics struct {
+		retries                  atomic.Int64
+		timeouts                 atomic.Int64
+		failures                 atomic.Int64
+		rateLimited              atomic.Int64
+		rateLimitWait            atomic.Int64
+		circuitBreakerTrips      atomic.Int64
+		circuitBreakerRejections atomic.Int64
+	}
+}
+
+var _ Storage = (*retryingStore)(nil)
+var _ RetryMetricsProvider = (*retryingStore)(nil)
+
+// RetryMetrics implements RetryMetricsProvider.
+func (r *retryingStore) RetryMetrics() RetryMetrics {
+	return RetryMetrics{
+		Retries:                  r.metrics.retries.Load(),
+		Timeouts:                 r.metrics.timeouts.Load(),
+		Failures:                 r.metrics.failures.Load(),
+		RateLimited:              r.metrics.rateLimited.Load(),
+		RateLimitWait:            time.Duration(r.metrics.rateLimitWait.Load()),
+		CircuitBreakerTrips:      r.metrics.circuitBreakerTrips.Load(),
+		CircuitBreakerRejections: r.metrics.circuitBreakerRejections.Load(),
+	}
+}
+
+// run runs the given operation, retrying it on transient errors. The context
+// passed to op is bounded by OpTimeout if timeout is set.
+func (r *retryingStore) run(
+	ctx context.Context, timeout bool, op func(ctx context.Context) error,
+) error {
+	probe, err := r.admit()
+	if err != nil {
+		return err
+	}
+	backoff := r.opts.InitialBackoff
+	var transient bool
+	for attempt := 0; ; attempt++ {
+		if err = r.wait(ctx); err != nil {
+			break
+		}
+		var timedOut bool
+		timedOut, err = r.attempt(ctx, timeout, op)
+		transient = err != nil && (timedOut || r.isTransient(err))
+		if !transient || attempt == r.opts.MaxRetries {
+			break
+		}
+		r.metrics.retries.Add(1)
+		if err2 := sleep(ctx, jitter(backoff)); err2 != nil {
+			err = err2
+			break
+		}
+		backoff = min(2*backoff, r.opts.MaxBackoff)
+	}
+	switch {
+	case ctx.Err() != nil:
+		// The caller gave up; this says nothing about the health of the
+		// storage.
+		r.record(probe, outcomeUnknown)
+	case transient:
+		r.metrics.failures.Add(1)
+		r.record(probe, outcomeTransientFailure)
+	default:
+		r.record(probe, outcomeDone)
+	}
+	return err
+}
+
+// attempt runs the operation once. It returns true if the attempt failed
+// because it exceeded OpTimeout.
+func (r *retryingStore) attempt(
+	ctx context.Context, timeout bool, op func(ctx context.Context) error,
+) (timedOut bool, _ error) {
+	if !timeout || r.opts.OpTimeout == 0 {
+		return false, op(ctx)
+	}
+	opCtx, cancel := context.WithTimeout(ctx, r.opts.OpTimeout)
+	defer cancel()
+	err := op(opCtx)
+	if err != nil && ctx.Err() == nil && opCtx.Err() != nil {
+		r.metrics.timeouts.Add(1)
+		return true, err
+	}
+	return false, err
+}
+
+func (r *retryingStore) isTransient(err error) bool {
+	return !r.wrapped.IsNotExistError(err) && r.opts.IsTransient(err)
+}
+
+// wait blocks until the rate limit allows a request to be issued.
+func (r *retryingStore) wait(ctx context.Context) error {
+	if r.opts.RequestsPerSecond <= 0 {
+		return nil
+	}
+	var waited time.Duration
+	for {
+		r.limiter.Lock()
+		ok, tryAgainAfter := r.limiter.tb.TryToFulfill(1)
+		r.limiter.Unlock()
+		if ok {
+			if waited > 0 {
+				r.metrics.rateLimited.Add(1)
+				r.metrics.rateLimitWait.Add(int64(waited))
+			}
+			return nil
+		}
+		if err := sleep(ctx, tryAgainAfter); err != nil {
+			return err
+		}
+		waited += tryAgainAfter
+	}
+}
+
+// admit checks the circuit breaker. It returns an error if the operation must
+// be rejected, and whether the operation is a probe.
+func (r *retryingStore) admit() (probe bool, _ error) {
+	if r.opts.CircuitBreakerThreshold <= 0 {
+		return false, nil
+	}
+	b := &r.breaker
+	b.Lock()
+	defer b.Unlock()
+	if !b.open {
+		return false, nil
+	}
+	if b.probing || r.opts.now().Before(b.openUntil) {
+		r.metrics.circuitBreakerRejections.Add(1)
+		return false, ErrCircuitOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+type outcome int8
+
+const (
+	// outcomeDone indicates that the storage responded, successfully or not.
+	outcomeDone outcome = iota
+	outcomeTransientFailure
+	// outcomeUnknown indicates that the operation was canceled by the caller.
+	outcomeUnknown
+)
+
+// record updates the circuit breaker with the outcome of an operation.
+func (r *retryingStore) record(probe bool, o outcome) {
+	if r.opts.CircuitBreakerThreshold <= 0 {
+		return
+	}
+	b := &r.breaker
+	b.Lock()
+	defer b.Unlock()
+	if probe {
+		b.probing = false
+	}
+	switch o {
+	case outcomeDone:
+		b.consecutiveFailures = 0
+		b.open = false
+	case outcomeTransientFailure:
+		b.consecutiveFailures++
+		if probe {
+			// The probe failed; stay open for another cooldown period.
+			b.openUntil = r.opts.now().Add(r.opts.CircuitBreakerCooldown)
+		} else if !b.open && b.consecutiveFailures >= r.opts.CircuitBreakerThreshold {
+			r.metrics.circuitBreakerTrips.Add(1)
+			b.open = true
+			b.openUntil = r.opts.now().Add(r.opts.CircuitBreakerCooldown)
+		}
+	}
+}
+
+// jitter returns a random duration in [d/2, d].
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d - time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep waits for d or until the context is canceled. A canceled context
+// always results in an error, even if the timer fired concurrently.
+func sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil || d <= 0 {
+		return err
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+	return ctx.Err()
+}
+
+func (r *retryingStore) Close() error {
+	return r.wrapped.Close()
+}
+
+func (r *retryingStore) ReadObject(
+	ctx context.Context, objName string,
+) (_ ObjectReader, objSize int64, _ error) {
+	var reader ObjectReader
+	err := r.run(ctx, true /* timeout */, func(ctx context.Context) error {
+		var err error
+		reader, objSize, err = r.wrapped.ReadObject(ctx, objName)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return &retryingReader{r: r, wrapped: reader}, objSize, nil
+}
+
+type retryingReader struct {
+	r       *retryingStore
+	wrapped ObjectReader
+}
+
+var _ ObjectReader = (*retryingReader)(nil)
+
+func (rr *retryingReader) ReadAt(ctx context.Context, p []byte, offset int64) error {
+	return rr.r.run(ctx, true /* timeout */, func(ctx context.Context) error {
+		return rr.wrapped.ReadAt(ctx, p, offset)
+	})
+}
+
+func (rr *retryingReader) Close() error {
+	return rr.wrapped.Close()
+}
+
+func (r *retryingStore) CreateObject(objName string) (io.WriteCloser, error) {
+	var w io.WriteCloser
+	err := r.run(context.Background(), false /* timeout */, func(context.Context) error {
+		var err error
+		w, err = r.wrapped.CreateObject(objName)
+		return err
+	})
+	return w, err
+}
+
+func (r *retryingStore) List(prefix, delimiter string) ([]string, error) {
+	var res []string
+	err := r.run(context.Background(), false /* timeout */, func(context.Context) error {
+		var err error
+		res, err = r.wrapped.List(prefix, delimiter)
+		return err
+	})
+	return res, err
+}
+
+func (r *retryingStore) Delete(objName string) error {
+	return r.run(context.Background(), false /* timeout */, func(context.Context) error {
+		return r.wrapped.Delete(objName)
+	})
+}
+
+func (r *retryingStore) Size(objName string) (int64, error) {
+	var size int64
+	err := r.run(context.Background(), false /* timeout */, func(context.Context) error {
+		var err error
+		size, err = r.wrapped.Size(objName)
+		return err
+	})
+	return size, err
+}
+
+func (r *retryingStore) IsNotExistError(err error) bool {
+	return r.wrapped.IsNotExistError(err)
+}
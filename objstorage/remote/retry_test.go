@@ -0,0 +1,246 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package remote
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type transientError struct{}
+
+func (transientError) Error() string   { return "transient" }
+func (transientError) Temporary() bool { return true }
+
+// faultCounter injects errors into a storage and counts the operations that
+// reach the injector.
+type faultCounter struct {
+	mu    sync.Mutex
+	calls map[FaultOp]int
+	// errs are returned (in order) by the next operations of type op.
+	op   FaultOp
+	errs []error
+}
+
+func (f *faultCounter) inject(op FaultOp, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = make(map[FaultOp]int)
+	}
+	f.calls[op]++
+	if op == f.op && len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (f *faultCounter) set(op FaultOp, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.op = op
+	f.errs = errs
+	f.calls = nil
+}
+
+func (f *faultCounter) numCalls(op FaultOp) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+func newRetryTestStorage(t *testing.T, opts RetryOptions) (Storage, *faultCounter) {
+	f := &faultCounter{}
+	mem := NewInMem()
+	w, err := mem.CreateObject("obj")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	if opts.InitialBackoff == 0 {
+		opts.InitialBackoff = time.Microsecond
+	}
+	return WithRetries(WithFaults(mem, f.inject), opts), f
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	s, f := newRetryTestStorage(t, RetryOptions{})
+	defer s.Close()
+
+	r, size, err := s.ReadObject(ctx, "obj")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), size)
+	buf := make([]byte, 5)
+
+	// Transient errors are retried.
+	f.set(FaultOpReadAt, transientError{}, errors.Wrap(transientError{}, "wrapped"))
+	require.NoError(t, r.ReadAt(ctx, buf, 6))
+	require.Equal(t, "world", string(buf))
+	require.Equal(t, 3, f.numCalls(FaultOpReadAt))
+
+	// Other errors are not.
+	f.set(FaultOpReadAt, errors.New("corruption"))
+	require.EqualError(t, r.ReadAt(ctx, buf, 0), "corruption")
+	require.Equal(t, 1, f.numCalls(FaultOpReadAt))
+
+	// Neither are not-exist errors, even if the classifier says otherwise.
+	_, err = s.Size("missing")
+	require.True(t, s.IsNotExistError(err))
+
+	// Retries are bounded.
+	f.set(FaultOpList, transientError{}, transientError{}, transientError{}, transientError{}, transientError{})
+	_, err = s.List("", "")
+	require.ErrorIs(t, err, transientError{})
+	require.Equal(t, 4, f.numCalls(FaultOpList))
+
+	require.Equal(t, RetryMetrics{Retries: 5, Failures: 1}, s.(RetryMetricsProvider).RetryMetrics())
+	_, ok := NewInMem().(RetryMetricsProvider)
+	require.False(t, ok)
+
+	// A canceled context stops the retries.
+	f.set(FaultOpReadAt, transientError{}, transientError{})
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Error(t, r.ReadAt(cctx, buf, 0))
+	require.Equal(t, 1, f.numCalls(FaultOpReadAt))
+}
+
+func TestRetriesClassifier(t *testing.T) {
+	errRetry := errors.New("retry me")
+	s, f := newRetryTestStorage(t, RetryOptions{
+		MaxRetries: 1,
+		IsTransient: func(err error) bool {
+			return errors.Is(err, errRetry)
+		},
+	})
+	f.set(FaultOpDelete, errRetry)
+	require.NoError(t, s.Delete("obj"))
+	require.Equal(t, 2, f.numCalls(FaultOpDelete))
+
+	f.set(FaultOpCreateObject, transientError{})
+	_, err := s.CreateObject("obj")
+	require.ErrorIs(t, err, transientError{})
+	require.Equal(t, 1, f.numCalls(FaultOpCreateObject))
+}
+
+func TestRetriesTimeout(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newRetryTestStorage(t, RetryOptions{OpTimeout: time.Millisecond})
+	r, _, err := s.ReadObject(ctx, "obj")
+	require.NoError(t, err)
+
+	// The first attempt hangs past the timeout, which the wrapped storage
+	// reports with an arbitrary error.
+	var once sync.Once
+	blocking := &blockingReader{ObjectReader: r, block: func() error {
+		var err error
+		once.Do(func() {
+			time.Sleep(20 * time.Millisecond)
+			err = errors.New("hung up")
+		})
+		return err
+	}}
+	rr := &retryingReader{r: s.(*retryingStore), wrapped: blocking}
+	require.NoError(t, rr.ReadAt(ctx, make([]byte, 5), 0))
+	m := s.(RetryMetricsProvider).RetryMetrics()
+	require.Equal(t, RetryMetrics{Retries: 1, Timeouts: 1}, m)
+}
+
+type blockingReader struct {
+	ObjectReader
+	block func() error
+}
+
+func (r *blockingReader) ReadAt(ctx context.Context, p []byte, offset int64) error {
+	if err := r.block(); err != nil {
+		return err
+	}
+	return r.ObjectReader.ReadAt(ctx, p, offset)
+}
+
+func TestRetriesRateLimit(t *testing.T) {
+	s, _ := newRetryTestStorage(t, RetryOptions{RequestsPerSecond: 200, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := s.Size("obj")
+		require.NoError(t, err)
+	}
+	// The first request uses the burst; each of the others waits ~5ms.
+	require.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	m := s.(RetryMetricsProvider).RetryMetrics()
+	require.Equal(t, int64(4), m.RateLimited)
+	require.Greater(t, m.RateLimitWait, time.Duration(0))
+}
+
+func TestRetriesCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	s, f := newRetryTestStorage(t, RetryOptions{
+		MaxRetries:              -1,
+		CircuitBreakerThreshold: 2,
+		CircuitBreakerCooldown:  time.Second,
+		now:                     func() time.Time { return now },
+	})
+	size := func() error {
+		_, err := s.Size("obj")
+		return err
+	}
+	errs := make([]error, 10)
+	for i := range errs {
+		errs[i] = transientError{}
+	}
+
+	f.set(FaultOpSize, errs...)
+	require.ErrorIs(t, size(), transientError{})
+	require.ErrorIs(t, size(), transientError{})
+	// The circuit is open: operations fail without reaching the storage.
+	require.ErrorIs(t, size(), ErrCircuitOpen)
+	require.ErrorIs(t, s.Delete("obj"), ErrCircuitOpen)
+	require.Equal(t, 2, f.numCalls(FaultOpSize))
+
+	// After the cooldown, a probe is let through; it fails, so the circuit
+	// stays open.
+	now = now.Add(time.Second)
+	require.ErrorIs(t, size(), transientError{})
+	require.ErrorIs(t, size(), ErrCircuitOpen)
+	require.Equal(t, 3, f.numCalls(FaultOpSize))
+
+	// A successful probe closes the circuit.
+	now = now.Add(time.Second)
+	f.set(FaultOpSize)
+	require.NoError(t, size())
+	require.NoError(t, size())
+	require.NoError(t, size())
+
+	m := s.(RetryMetricsProvider).RetryMetrics()
+	require.Equal(t, RetryMetrics{
+		Failures:                 3,
+		CircuitBreakerTrips:      1,
+		CircuitBreakerRejections: 3,
+	}, m)
+}
+
+func TestWithFaults(t *testing.T) {
+	errInjected := errors.New("injected")
+	s := WithFaults(NewInMem(), func(op FaultOp, _ string) error {
+		if op == FaultOpWrite {
+			return errInjected
+		}
+		return nil
+	})
+	w, err := s.CreateObject("foo")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "bar")
+	require.ErrorIs(t, err, errInjected)
+	require.NoError(t, w.Close())
+}
@@ -0,0 +1,378 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeServer is an in-process implementation of the subset of the S3 REST
+// API used by this package, for testing. It verifies request signatures, and
+// supports ranged reads, multipart uploads and paginated listings. Errors can
+// be injected into its responses to exercise error handling.
+//
+// FakeServer implements http.Handler, so it can be served over the network
+// using httptest.NewServer. Client returns an http.Client that dispatches
+// requests to the server directly, without using the network.
+type FakeServer struct {
+	creds Credentials
+
+	mu struct {
+		sync.Mutex
+		// buckets maps bucket names to objects.
+		buckets      map[string]map[string][]byte
+		uploads      map[string]*fakeUpload
+		nextUploadID int
+		maxKeys      int
+		injectError  func(r *http.Request) *Error
+		numRequests  int
+	}
+}
+
+type fakeUpload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+}
+
+// NewFakeServer creates a FakeServer holding the given empty buckets. Requests
+// must be signed using the given credentials.
+func NewFakeServer(creds Credentials, buckets ...string) *FakeServer {
+	f := &FakeServer{creds: creds}
+	f.mu.buckets = make(map[string]map[string][]byte)
+	for _, b := range buckets {
+		f.mu.buckets[b] = make(map[string][]byte)
+	}
+	f.mu.uploads = make(map[string]*fakeUpload)
+	f.mu.maxKeys = 1000
+	return f
+}
+
+// SetMaxKeys sets the maximum number of results in each page of a listing.
+// It defaults to 1000, as in S3.
+func (f *FakeServer) SetMaxKeys(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mu.maxKeys = n
+}
+
+// InjectErrors sets a function that is called for each request. If it returns
+// a non-nil error, the server responds with that error instead of serving the
+// request. Passing nil stops the injection of errors.
+func (f *FakeServer) InjectErrors(fn func(r *http.Request) *Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mu.injectError = fn
+}
+
+// NumRequests returns the number of requests received by the server.
+func (f *FakeServer) NumRequests() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mu.numRequests
+}
+
+// NumPendingUploads returns the number of multipart uploads that have been
+// neither completed nor aborted.
+func (f *FakeServer) NumPendingUploads() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.mu.uploads)
+}
+
+// Client returns an http.Client that sends requests directly to the server.
+func (f *FakeServer) Client() *http.Client {
+	return &http.Client{Transport: fakeTransport{f}}
+}
+
+type fakeTransport struct {
+	f *FakeServer
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	if req.Body == nil {
+		req.Body = http.NoBody
+	}
+	rec := httptest.NewRecorder()
+	t.f.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func writeError(w http.ResponseWriter, e *Error) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.StatusCode)
+	fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message></Error>",
+		xml.Header, e.Code, e.Message)
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		writeError(w, &Error{StatusCode: http.StatusInternalServerError, Code: "InternalError", Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func etag(data []byte) string {
+	h := md5.Sum(data)
+	return `"` + hex.EncodeToString(h[:]) + `"`
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (f *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, &Error{StatusCode: http.StatusBadRequest, Code: "IncompleteBody", Message: err.Error()})
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mu.numRequests++
+	if !verifyRequest(r, f.creds, body) {
+		writeError(w, &Error{StatusCode: http.StatusForbidden, Code: "SignatureDoesNotMatch",
+			Message: "The request signature we calculated does not match the signature you provided."})
+		return
+	}
+	if f.mu.injectError != nil {
+		if e := f.mu.injectError(r); e != nil {
+			writeError(w, e)
+			return
+		}
+	}
+
+	// Determine the bucket and key for both virtual-hosted-style and
+	// path-style requests.
+	var bucket, key string
+	host := r.Host
+	if i := strings.LastIndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	if b, _, ok := strings.Cut(host, "."); ok && f.mu.buckets[b] != nil {
+		bucket, key = b, strings.TrimPrefix(r.URL.Path, "/")
+	} else {
+		bucket, key, _ = strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	}
+	objects := f.mu.buckets[bucket]
+	if objects == nil {
+		writeError(w, &Error{StatusCode: http.StatusNotFound, Code: "NoSuchBucket", Message: "The specified bucket does not exist."})
+		return
+	}
+	query := r.URL.Query()
+
+	if key == "" {
+		if r.Method == http.MethodGet && query.Get("list-type") == "2" {
+			f.list(w, bucket, objects, query)
+			return
+		}
+		writeError(w, &Error{StatusCode: http.StatusNotImplemented, Code: "NotImplemented", Message: r.Method})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead:
+		data, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", etag(data))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet:
+		data, ok := objects[key]
+		if !ok {
+			writeError(w, &Error{StatusCode: http.StatusNotFound, Code: "NoSuchKey", Message: "The specified key does not exist."})
+			return
+		}
+		rng := r.Header.Get("Range")
+		if rng == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(data)
+			return
+		}
+		var start, end int
+		if n, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); n != 2 || err != nil ||
+			start > end || start >= len(data) {
+			writeError(w, &Error{StatusCode: http.StatusRequestedRangeNotSatisfiable, Code: "InvalidRange",
+				Message: "The requested range is not satisfiable"})
+			return
+		}
+		end = min(end, len(data)-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(data[start : end+1])
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		u := f.mu.uploads[query.Get("uploadId")]
+		if u == nil || u.bucket != bucket || u.key != key {
+			writeError(w, &Error{StatusCode: http.StatusNotFound, Code: "NoSuchUpload", Message: "The specified upload does not exist."})
+			return
+		}
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || partNumber < 1 || partNumber > 10000 {
+			writeError(w, &Error{StatusCode: http.StatusBadRequest, Code: "InvalidArgument", Message: "Invalid part number"})
+			return
+		}
+		u.parts[partNumber] = body
+		w.Header().Set("ETag", etag(body))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPut:
+		objects[key] = body
+		w.Header().Set("ETag", etag(body))
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.mu.nextUploadID++
+		uploadID := fmt.Sprintf("upload-%d", f.mu.nextUploadID)
+		f.mu.uploads[uploadID] = &fakeUpload{bucket: bucket, key: key, parts: make(map[int][]byte)}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: uploadID})
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		uploadID := query.Get("uploadId")
+		u := f.mu.uploads[uploadID]
+		if u == nil || u.bucket != bucket || u.key != key {
+			writeError(w, &Error{StatusCode: http.StatusNotFound, Code: "NoSuchUpload", Message: "The specified upload does not exist."})
+			return
+		}
+		var req struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+			writeError(w, &Error{StatusCode: http.StatusBadRequest, Code: "MalformedXML", Message: "Invalid CompleteMultipartUpload request"})
+			return
+		}
+		var data bytes.Buffer
+		for i, p := range req.Parts {
+			part, ok := u.parts[p.PartNumber]
+			if !ok || etag(part) != p.ETag {
+				writeError(w, &Error{StatusCode: http.StatusBadRequest, Code: "InvalidPart", Message: "One or more of the specified parts could not be found."})
+				return
+			}
+			if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+				writeError(w, &Error{StatusCode: http.StatusBadRequest, Code: "InvalidPartOrder", Message: "The list of parts was not in ascending order."})
+				return
+			}
+			data.Write(part)
+		}
+		objects[key] = data.Bytes()
+		delete(f.mu.uploads, uploadID)
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: etag(data.Bytes())})
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.mu.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodDelete:
+		delete(objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, &Error{StatusCode: http.StatusNotImplemented, Code: "NotImplemented", Message: r.Method})
+	}
+}
+
+// list implements ListObjectsV2. The continuation token encodes the last key
+// or common prefix returned.
+func (f *FakeServer) list(
+	w http.ResponseWriter, bucket string, objects map[string][]byte, query map[string][]string,
+) {
+	get := func(name string) string {
+		if v := query[name]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	prefix, delimiter := get("prefix"), get("delimiter")
+	var after string
+	if token := get("continuation-token"); token != "" {
+		b, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			writeError(w, &Error{StatusCode: http.StatusBadRequest, Code: "InvalidArgument", Message: "The continuation token provided is incorrect"})
+			return
+		}
+		after = string(b)
+	}
+
+	keys := make([]string, 0, len(objects))
+	for k := range objects {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var result listBucketResult
+	result.Name = bucket
+	result.Prefix = prefix
+	result.MaxKeys = f.mu.maxKeys
+	result.ContinuationToken = get("continuation-token")
+	var last string
+	for _, k := range keys {
+		name := k
+		isPrefix := false
+		if delimiter != "" {
+			if i := strings.Index(k[len(prefix):], delimiter); i >= 0 {
+				name = k[:len(prefix)+i+len(delimiter)]
+				isPrefix = true
+			}
+		}
+		if (after != "" && name <= after) || name == last {
+			continue
+		}
+		if result.KeyCount == f.mu.maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+			break
+		}
+		if isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, struct{ Prefix string }{name})
+		} else {
+			result.Contents = append(result.Contents, struct {
+				Key  string
+				Size int64
+			}{k, int64(len(objects[k]))})
+		}
+		result.KeyCount++
+		last = name
+	}
+	writeXML(w, result)
+}
@@ -0,0 +1,535 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package s3 implements remote.Storage on top of the Amazon S3 REST API. It
+// can be used with S3 and with S3-compatible object stores. The package also
+// provides FakeServer, an in-process S3-compatible server for testing.
+package s3 // import "github.com/cockroachdb/pebble/objstorage/remote/s3"
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+)
+
+// DefaultPartSize is the default size of the parts of multipart uploads.
+const DefaultPartSize = 8 << 20
+
+// Config configures an S3 remote.Storage.
+type Config struct {
+	// Endpoint is the URL of the S3 service, for example
+	// "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+	// Region is the region used to sign requests, for example "us-east-1".
+	Region string
+	// Bucket is the name of the bucket holding the objects.
+	Bucket string
+	// Prefix is prepended to the names of all objects, which allows multiple
+	// stores to share a bucket. It is usually a path ending in a slash.
+	Prefix string
+	// VirtualHostedStyle selects virtual-hosted-style requests, where the
+	// bucket is part of the host name, instead of path-style requests, where
+	// the bucket is the first element of the path.
+	VirtualHostedStyle bool
+	// Credentials are used to sign requests.
+	Credentials Credentials
+	// PartSize is the size of the parts of multipart uploads. Objects smaller
+	// than PartSize are uploaded with a single request. S3 requires parts of
+	// at least 5MB. Defaults to DefaultPartSize.
+	PartSize int
+	// HTTPClient is used to send requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Now returns the current time, used to sign requests. Defaults to
+	// time.Now.
+	Now func() time.Time
+}
+
+// Error is returned when the S3 service responds to a request with an error.
+type Error struct {
+	StatusCode int
+	// Code is the S3 error code, for example "NoSuchKey" or "SlowDown".
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Temporary returns true if the request may succeed if retried, which is the
+// case for throttling and server errors.
+func (e *Error) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// New returns a remote.Storage that stores objects in an S3 bucket.
+func New(cfg Config) (remote.Storage, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "s3: invalid endpoint %q", cfg.Endpoint)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, errors.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3: bucket not specified")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = DefaultPartSize
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &storage{cfg: cfg, endpoint: endpoint}, nil
+}
+
+type storage struct {
+	cfg      Config
+	endpoint *url.URL
+}
+
+var _ remote.Storage = (*storage)(nil)
+
+// request describes a request to the S3 service.
+type request struct {
+	method string
+	// key is the object key, without the configured prefix. It is empty for
+	// bucket-level requests.
+	key   string
+	query url.Values
+	// header holds additional headers.
+	header http.Header
+	body   []byte
+}
+
+// do sends a request and returns the response if its status code is one of
+// the expected codes. Otherwise it returns an error, which is marked as
+// os.ErrNotExist if the object does not exist.
+func (s *storage) do(ctx context.Context, r request, expected ...int) (*http.Response, error) {
+	u := *s.endpoint
+	path := "/" + s.cfg.Bucket
+	if s.cfg.VirtualHostedStyle {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		path = ""
+	}
+	if r.key != "" {
+		path += "/" + s.cfg.Prefix + r.key
+	} else if path == "" {
+		path = "/"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(r.query)
+
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, r.method, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "s3")
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	signRequest(req, s.cfg.Credentials, s.cfg.Region, r.body, s.cfg.Now())
+
+	resp, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "s3: %s %s", r.method, r.key)
+	}
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	return nil, s.responseError(resp, r.key)
+}
+
+func (s *storage) responseError(resp *http.Response, key string) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	var xmlErr struct {
+		Code    string
+		Message string
+	}
+	if data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil && len(data) > 0 {
+		if xml.Unmarshal(data, &xmlErr) == nil {
+			e.Code, e.Message = xmlErr.Code, xmlErr.Message
+		}
+	}
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+	if resp.StatusCode == http.StatusNotFound && e.Code != "NoSuchBucket" {
+		return errors.Mark(errors.Wrapf(e, "object %q", key), os.ErrNotExist)
+	}
+	return errors.Wrapf(e, "object %q", key)
+}
+
+// Close is part of the remote.Storage interface.
+func (s *storage) Close() error {
+	return nil
+}
+
+// ReadObject is part of the remote.Storage interface.
+func (s *storage) ReadObject(
+	ctx context.Context, objName string,
+) (_ remote.ObjectReader, objSize int64, _ error) {
+	size, err := s.size(ctx, objName)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &objectReader{s: s, key: objName, size: size}, size, nil
+}
+
+type objectReader struct {
+	s    *storage
+	key  string
+	size int64
+}
+
+var _ remote.ObjectReader = (*objectReader)(nil)
+
+// ReadAt is part of the remote.ObjectReader interface. Each call issues a
+// ranged GET request.
+func (r *objectReader) ReadAt(ctx context.Context, p []byte, offset int64) error {
+	if offset < 0 || offset+int64(len(p)) > r.size {
+		return errors.Wrapf(io.EOF, "s3: read of [%d, %d) past the end of %q (size %d)",
+			offset, offset+int64(len(p)), r.key, r.size)
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	resp, err := r.s.do(ctx, request{
+		method: http.MethodGet,
+		key:    r.key,
+		header: http.Header{
+			"Range": []string{fmt.Sprintf("bytes=%d-%d", offset, offset+int64(len(p))-1)},
+		},
+	}, http.StatusPartialContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		// The server ignored the range and returned the entire object.
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return errors.Wrapf(err, "s3: reading %q", r.key)
+		}
+	}
+	if _, err := io.ReadFull(resp.Body, p); err != nil {
+		return errors.Wrapf(err, "s3: reading %q", r.key)
+	}
+	return nil
+}
+
+// Close is part of the remote.ObjectReader interface.
+func (r *objectReader) Close() error {
+	return nil
+}
+
+// CreateObject is part of the remote.Storage interface.
+//
+// Data is buffered in memory and uploaded when the object is closed, or, for
+// objects larger than Config.PartSize, uploaded one part at a time using a
+// multipart upload.
+func (s *storage) CreateObject(objName string) (io.WriteCloser, error) {
+	return &objectWriter{s: s, key: objName}, nil
+}
+
+type objectWriter struct {
+	s   *storage
+	key string
+	buf []byte
+	// uploadID is set once a multipart upload has been started.
+	uploadID string
+	parts    []completedPart
+	err      error
+	closed   bool
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+// Write is part of the io.WriteCloser interface.
+func (w *objectWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("s3: write after close")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		c := min(len(p), w.s.cfg.PartSize-len(w.buf))
+		w.buf = append(w.buf, p[:c]...)
+		p = p[c:]
+		if len(w.buf) == w.s.cfg.PartSize {
+			if w.err = w.uploadPart(); w.err != nil {
+				w.abort()
+				return 0, w.err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *objectWriter) uploadPart() error {
+	ctx := context.Background()
+	if w.uploadID == "" {
+		resp, err := w.s.do(ctx, request{
+			method: http.MethodPost,
+			key:    w.key,
+			query:  url.Values{"uploads": {""}},
+		}, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		var result struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+			return errors.Errorf("s3: invalid CreateMultipartUpload response for %q", w.key)
+		}
+		w.uploadID = result.UploadID
+	}
+
+	partNumber := len(w.parts) + 1
+	resp, err := w.s.do(ctx, request{
+		method: http.MethodPut,
+		key:    w.key,
+		query: url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {w.uploadID},
+		},
+		body: w.buf,
+	}, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// abort aborts the multipart upload, if any, so that the storage used by the
+// uploaded parts is released. Errors are ignored: the upload has already
+// failed, and a lifecycle rule can clean up uploads that fail to be aborted.
+func (w *objectWriter) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	resp, err := w.s.do(context.Background(), request{
+		method: http.MethodDelete,
+		key:    w.key,
+		query:  url.Values{"uploadId": {w.uploadID}},
+	}, http.StatusNoContent, http.StatusOK)
+	if err == nil {
+		resp.Body.Close()
+	}
+	w.uploadID = ""
+}
+
+// Close is part of the io.WriteCloser interface. The object only becomes
+// visible once Close returns successfully.
+func (w *objectWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.finish()
+	if w.err != nil {
+		w.abort()
+	}
+	w.buf = nil
+	return w.err
+}
+
+func (w *objectWriter) finish() error {
+	ctx := context.Background()
+	if w.uploadID == "" {
+		resp, err := w.s.do(ctx, request{
+			method: http.MethodPut,
+			key:    w.key,
+			body:   w.buf,
+		}, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(); err != nil {
+			return err
+		}
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		return errors.Wrap(err, "s3")
+	}
+	resp, err := w.s.do(ctx, request{
+		method: http.MethodPost,
+		key:    w.key,
+		query:  url.Values{"uploadId": {w.uploadID}},
+		body:   body,
+	}, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// CompleteMultipartUpload may fail after the response status has been
+	// sent, in which case the body holds an error.
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "s3: completing upload of %q", w.key)
+	}
+	var xmlErr struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(data, &xmlErr) == nil {
+		return errors.Wrapf(&Error{StatusCode: resp.StatusCode, Code: xmlErr.Code, Message: xmlErr.Message},
+			"object %q", w.key)
+	}
+	w.uploadID = ""
+	return nil
+}
+
+// List is part of the remote.Storage interface.
+//
+// List returns the names of the objects whose names start with prefix, with
+// prefix trimmed. If delimiter is non-empty, the names that contain delimiter
+// after the prefix are grouped into a single result ending before the
+// delimiter, as in ListObjectsV2.
+func (s *storage) List(prefix, delimiter string) ([]string, error) {
+	var res []string
+	var continuationToken string
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {s.cfg.Prefix + prefix},
+		}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		resp, err := s.do(context.Background(), request{
+			method: http.MethodGet,
+			query:  query,
+		}, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "s3: invalid ListObjectsV2 response")
+		}
+		for _, c := range result.Contents {
+			res = append(res, strings.TrimPrefix(c.Key, s.cfg.Prefix+prefix))
+		}
+		for _, p := range result.CommonPrefixes {
+			name := strings.TrimPrefix(p.Prefix, s.cfg.Prefix+prefix)
+			res = append(res, strings.TrimSuffix(name, delimiter))
+		}
+		if !result.IsTruncated {
+			return res, nil
+		}
+		if result.NextContinuationToken == "" {
+			return nil, errors.New("s3: truncated ListObjectsV2 response without a continuation token")
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+// listBucketResult is the response to a ListObjectsV2 request.
+type listBucketResult struct {
+	XMLName  xml.Name `xml:"ListBucketResult"`
+	Name     string
+	Prefix   string
+	KeyCount int
+	MaxKeys  int
+	Contents []struct {
+		Key  string
+		Size int64
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+// Delete is part of the remote.Storage interface.
+func (s *storage) Delete(objName string) error {
+	resp, err := s.do(context.Background(), request{
+		method: http.MethodDelete,
+		key:    objName,
+	}, http.StatusNoContent, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Size is part of the remote.Storage interface.
+func (s *storage) Size(objName string) (int64, error) {
+	return s.size(context.Background(), objName)
+}
+
+func (s *storage) size(ctx context.Context, objName string) (int64, error) {
+	resp, err := s.do(ctx, request{
+		method: http.MethodHead,
+		key:    objName,
+	}, http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, errors.Errorf("s3: missing size of %q", objName)
+	}
+	return resp.ContentLength, nil
+}
+
+// IsNotExistError is part of the remote.Storage interface.
+func (s *storage) IsNotExistError(err error) bool {
+	return errors.Is(err, os.ErrNotExist)
+}
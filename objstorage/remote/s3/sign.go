@@ -0,0 +1,210 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This file implements AWS Signature Version 4 for S3 requests. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html.
+
+const (
+	signAlgorithm  = "AWS4-HMAC-SHA256"
+	signService    = "s3"
+	amzDateFormat  = "20060102T150405Z"
+	amzDayFormat   = "20060102"
+	emptyBodyHash  = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	headerDate     = "X-Amz-Date"
+	headerSHA256   = "X-Amz-Content-Sha256"
+	headerSecurity = "X-Amz-Security-Token"
+)
+
+// Credentials hold the keys used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set when using temporary credentials.
+	SessionToken string
+}
+
+func hashHex(b []byte) string {
+	if len(b) == 0 {
+		return emptyBodyHash
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath URI-encodes an object path as S3 expects: every byte except the
+// unreserved characters and '/' is percent-encoded.
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if isUnreserved(c) || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func escapeQuery(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+// canonicalQuery returns the query parameters sorted by name and value, and
+// encoded as required for signing.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, escapeQuery(k)+"="+escapeQuery(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// signedHeaderNames returns the lowercase names of the headers that are
+// signed: the Host header and all X-Amz-* headers.
+func signedHeaderNames(header http.Header) []string {
+	names := []string{"host"}
+	for k := range header {
+		if lk := strings.ToLower(k); strings.HasPrefix(lk, "x-amz-") {
+			names = append(names, lk)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// signature computes the signature of a request. The escaped path must be the
+// path as it appears on the wire.
+func signature(
+	creds Credentials,
+	region, method, host, escapedPath string,
+	query url.Values,
+	header http.Header,
+	signedHeaders []string,
+	t time.Time,
+) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		v := header.Get(name)
+		if name == "host" {
+			v = host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(v))
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		escapedPath,
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		header.Get(headerSHA256),
+	}, "\n")
+
+	day := t.Format(amzDayFormat)
+	scope := strings.Join([]string{day, region, signService, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		signAlgorithm,
+		t.Format(amzDateFormat),
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, signService)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// signRequest adds the headers that authenticate the request. The request URL
+// must have been constructed with a RawPath produced by escapePath.
+func signRequest(req *http.Request, creds Credentials, region string, body []byte, t time.Time) {
+	t = t.UTC()
+	req.Header.Set(headerDate, t.Format(amzDateFormat))
+	req.Header.Set(headerSHA256, hashHex(body))
+	if creds.SessionToken != "" {
+		req.Header.Set(headerSecurity, creds.SessionToken)
+	}
+	signedHeaders := signedHeaderNames(req.Header)
+	sig := signature(creds, region, req.Method, req.URL.Host, req.URL.EscapedPath(),
+		req.URL.Query(), req.Header, signedHeaders, t)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s/%s/%s/aws4_request, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, creds.AccessKeyID, t.Format(amzDayFormat), region, signService,
+		strings.Join(signedHeaders, ";"), sig))
+}
+
+// verifyRequest checks the signature of a request received by a server. It
+// returns false if the request is not signed with the given credentials.
+func verifyRequest(req *http.Request, creds Credentials, body []byte) bool {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, signAlgorithm+" ") {
+		return false
+	}
+	fields := make(map[string]string)
+	for _, f := range strings.Split(strings.TrimPrefix(auth, signAlgorithm+" "), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(f), "="); ok {
+			fields[k] = v
+		}
+	}
+	credParts := strings.Split(fields["Credential"], "/")
+	if len(credParts) != 5 || credParts[0] != creds.AccessKeyID {
+		return false
+	}
+	if req.Header.Get(headerSHA256) != hashHex(body) {
+		return false
+	}
+	t, err := time.Parse(amzDateFormat, req.Header.Get(headerDate))
+	if err != nil || t.Format(amzDayFormat) != credParts[1] {
+		return false
+	}
+	if creds.SessionToken != "" && req.Header.Get(headerSecurity) != creds.SessionToken {
+		return false
+	}
+	sig := signature(creds, credParts[2], req.Method, req.Host, req.URL.EscapedPath(),
+		req.URL.Query(), req.Header, strings.Split(fields["SignedHeaders"], ";"), t)
+	return hmac.Equal([]byte(sig), []byte(fields["Signature"]))
+}
@@ -39,6 +39,9 @@ type cleanupManager struct {
 	jobsCh chan *cleanupJob
 	// waitGroup is used to wait for the background goroutine to exit.
 	waitGroup sync.WaitGroup
+	// walArchiver archives the obsolete WALs before they are deleted. It is
+	// nil unless Options.WALArchive.Storage is set.
+	walArchiver *walArchiver
 
 	mu struct {
 		sync.Mutex
@@ -91,6 +94,12 @@ func openCleanupManager(
 		jobsCh:          make(chan *cleanupJob, jobsQueueDepth),
 	}
 	cm.mu.completedJobsCond.L = &cm.mu.Mutex
+	if opts.WALArchive.Storage != nil {
+		cm.walArchiver = openWALArchiver(opts, func(jobID JobID, log wal.DeletableLog) {
+			cm.deleteObsoleteFile(log.FS, fileTypeLog, jobID, log.Path,
+				base.DiskFileNum(log.NumWAL), log.ApproxFileSize)
+		})
+	}
 	cm.waitGroup.Add(1)
 
 	go func() {
@@ -103,8 +112,12 @@ func openCleanupManager(
 }
 
 // Close stops the background goroutine, waiting until all queued jobs are completed.
-// Delete pacing is disabled for the remaining jobs.
+// Delete pacing is disabled for the remaining jobs. The WALs that are not
+// archived yet are left in place.
 func (cm *cleanupManager) Close() {
+	if cm.walArchiver != nil {
+		cm.walArchiver.close()
+	}
 	close(cm.jobsCh)
 	cm.waitGroup.Wait()
 }
@@ -168,6 +181,10 @@ func (cm *cleanupManager) mainLoop() {
 				cm.onTableDeleteFn(of.nonLogFile.fileSize, of.nonLogFile.isLocal)
 				cm.deleteObsoleteObject(fileTypeTable, job.jobID, of.nonLogFile.fileNum)
 			case fileTypeLog:
+				if cm.walArchiver != nil {
+					cm.walArchiver.enqueue(job.jobID, of.logFile)
+					continue
+				}
 				cm.deleteObsoleteFile(of.logFile.FS, fileTypeLog, job.jobID, of.logFile.Path,
 					base.DiskFileNum(of.logFile.NumWAL), of.logFile.ApproxFileSize)
 			default:
@@ -476,6 +493,13 @@ func (d *DB) deleteObsoleteFiles(jobID JobID) {
 		return
 	}
 	_, noRecycle := d.opts.Cleaner.(base.NeedsFileContents)
+	// Archived WALs must not be reused before they are uploaded.
+	noRecycle = noRecycle || d.opts.WALArchive.Storage != nil
+
+	if d.opts.ReadOnly {
+		d.releaseReadOnlyObsoleteTablesLocked()
+		return
+	}
 
 	// NB: d.mu.versions.minUnflushedLogNum is the log number of the earliest
 	// log that has not had its contents flushed to an sstable.
@@ -570,6 +594,37 @@ func (d *DB) deleteObsoleteFiles(jobID JobID) {
 	}
 }
 
+// releaseReadOnlyObsoleteTablesLocked is the counterpart of
+// deleteObsoleteFiles in a read-only DB, which never deletes files from its
+// directory. Obsolete tables only exist in replicas (see RefreshReplica), and
+// are all on remote storage: the references of the replica on them are
+// released, so that the writer can delete them, and the local ones are left
+// alone.
+//
+// d.mu must be held when calling this. The function will release and re-aquire
+// the mutex.
+func (d *DB) releaseReadOnlyObsoleteTablesLocked() {
+	obsoleteTables := d.mu.versions.obsoleteTables
+	d.mu.versions.obsoleteTables = nil
+	for _, tbl := range obsoleteTables {
+		delete(d.mu.versions.zombieTables, tbl.FileNum)
+	}
+	d.mu.versions.updateObsoleteTableMetricsLocked()
+
+	d.mu.Unlock()
+	defer d.mu.Lock()
+	for _, tbl := range obsoleteTables {
+		if tbl.isLocal {
+			continue
+		}
+		d.tableCache.evict(tbl.FileNum)
+		err := d.objProvider.Remove(fileTypeTable, tbl.FileNum)
+		if err != nil && !d.objProvider.IsNotExistError(err) {
+			d.opts.Logger.Errorf("pebble: releasing remote table %s: %s", tbl.FileNum, err)
+		}
+	}
+}
+
 func (d *DB) maybeScheduleObsoleteTableDeletion() {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -29,7 +29,6 @@ import (
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/objstorage/remote"
-	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/wal"
@@ -258,10 +257,11 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	}()
 
 	d.commit = newCommitPipeline(commitEnv{
-		logSeqNum:     &d.mu.versions.logSeqNum,
-		visibleSeqNum: &d.mu.versions.visibleSeqNum,
-		apply:         d.commitApply,
-		write:         d.commitWrite,
+		logSeqNum:       &d.mu.versions.logSeqNum,
+		visibleSeqNum:   &d.mu.versions.visibleSeqNum,
+		apply:           d.commitApply,
+		write:           d.commitWrite,
+		checkConditions: d.checkConditions,
 	})
 	d.mu.nextJobID = 1
 	d.mu.mem.nextSize = opts.MemTableSize
@@ -296,6 +296,8 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		FSCleaner:           opts.Cleaner,
 		NoSyncOnClose:       opts.NoSyncOnClose,
 		BytesPerSync:        opts.BytesPerSync,
+		DirectIO:            opts.Experimental.DirectIO,
+		ReadOnly:            opts.ReadOnly,
 	}
 	providerSettings.Remote.StorageFactory = opts.Experimental.RemoteStorage
 	providerSettings.Remote.CreateOnShared = opts.Experimental.CreateOnShared
@@ -351,14 +353,18 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 	walOpts := wal.Options{
 		Primary:              wal.Dir{FS: opts.FS, Dirname: walDirname},
 		Secondary:            wal.Dir{},
+		Stripes:              opts.WALStripeDirs,
+		StripeWALs:           d.walStriped,
 		MinUnflushedWALNum:   wal.NumWAL(d.mu.versions.minUnflushedLogNum),
 		MaxNumRecyclableLogs: opts.MemTableStopWritesThreshold + 1,
 		NoSyncOnClose:        opts.NoSyncOnClose,
 		BytesPerSync:         opts.WALBytesPerSync,
 		PreallocateSize:      d.walPreallocateSize,
 		MinSyncInterval:      opts.WALMinSyncInterval,
+		Compression:          d.walCompression,
 		FsyncLatency:         d.mu.log.metrics.fsyncLatency,
 		QueueSemChan:         d.commit.logSyncQSem,
+		SyncedMarkerCallback: d.durable.ratchet,
 		Logger:               opts.Logger,
 		EventListener:        walEventListenerAdaptor{l: opts.EventListener},
 	}
@@ -478,7 +484,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		// 20.1 do not guarantee that closed WALs end cleanly. But the earliest
 		// compatible Pebble format is newer and guarantees a clean EOF.
 		strictWALTail := i < len(replayWALs)-1
-		flush, maxSeqNum, err := d.replayWAL(jobID, &ve, lf, strictWALTail)
+		flush, maxSeqNum, truncated, err := d.replayWAL(jobID, &ve, lf, strictWALTail)
 		if err != nil {
 			return nil, err
 		}
@@ -486,8 +492,36 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		if d.mu.versions.logSeqNum.Load() < maxSeqNum {
 			d.mu.versions.logSeqNum.Store(maxSeqNum)
 		}
+		if truncated {
+			// The tail of the WAL was discarded because of a corruption. The
+			// later WALs are discarded too, so that the DB is recovered to a
+			// consistent point in time: they become obsolete once the new WAL
+			// is created.
+			for _, discarded := range replayWALs[i+1:] {
+				d.opts.EventListener.WALDiscarded(WALDiscardInfo{
+					Mode:    opts.WALRecoveryMode,
+					Kind:    WALDiscardLog,
+					FileNum: base.DiskFileNum(discarded.Num),
+					Err: base.CorruptionErrorf("pebble: corruption in previous WAL %s",
+						base.DiskFileNum(lf.Num)),
+				})
+			}
+			break
+		}
+	}
+	if !d.opts.ReadOnly {
+		// Resolve the batches prepared by CommitAtomic whose transactions were
+		// not resolved before the crash. A read-only DB ignores them.
+		flush, err := d.resolveInDoubtBatches(jobID, &ve)
+		if err != nil {
+			return nil, err
+		}
+		toFlush = append(toFlush, flush...)
 	}
 	d.mu.versions.visibleSeqNum.Store(d.mu.versions.logSeqNum.Load())
+	// The writes replayed from the WAL were either flushed, or read from disk
+	// in read-only mode.
+	d.durable.ratchet(d.mu.versions.logSeqNum.Load())
 
 	if !d.opts.ReadOnly {
 		// Create an empty .log file.
@@ -590,9 +624,11 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		d.maybeCollectTableStatsLocked()
 	}
 	d.calculateDiskAvailableBytes()
+	d.startDiskQuota()
 
 	d.maybeScheduleFlush()
 	d.maybeScheduleCompaction()
+	d.startBlockCacheWarmup()
 
 	// Note: this is a no-op if invariants are disabled or race is enabled.
 	//
@@ -656,6 +692,13 @@ func prepareAndOpenDirs(
 			}
 			f.Close()
 		}
+		for _, stripe := range opts.WALStripeDirs {
+			f, err := mkdirAllAndSyncParents(stripe.FS, stripe.Dirname)
+			if err != nil {
+				return "", nil, err
+			}
+			f.Close()
+		}
 	}
 
 	dataDir, err = opts.FS.OpenDir(dirname)
@@ -753,12 +796,17 @@ func GetVersion(dir string, fs vfs.FS) (string, error) {
 // to the manifest, it is up to the caller of replayWAL to unreference the
 // toFlush flushables returned by replayWAL.
 //
+// The truncated return value is true if the tail of the WAL was discarded
+// because of a corruption (see Options.WALRecoveryMode).
+//
 // d.mu must be held when calling this, but the mutex may be dropped and
 // re-acquired during the course of this method.
 func (d *DB) replayWAL(
 	jobID JobID, ve *versionEdit, ll wal.LogicalLog, strictWALTail bool,
-) (toFlush flushableList, maxSeqNum uint64, err error) {
-	rr := ll.OpenForRead()
+) (toFlush flushableList, maxSeqNum uint64, truncated bool, err error) {
+	// The prepare and abort records of atomic commits are LogData-only batches,
+	// which the reader skips otherwise.
+	rr := ll.OpenForReadWithLogData(isTwoPhaseRecord)
 	defer rr.Close()
 	var (
 		b               Batch
@@ -838,6 +886,36 @@ func (d *DB) replayWAL(
 			err = errors.WithDetailf(err, "replaying wal %d, offset %d", ll.Num, offset)
 		}
 	}()
+	// discardCorruption discards the corrupted data at the given offset if
+	// Options.WALRecoveryMode allows it, setting truncated if the rest of the
+	// WAL is discarded. It returns false if the corruption must fail the
+	// replay.
+	discardCorruption := func(err error, offset wal.Offset) bool {
+		kind, ok := d.walDiscardKind(err, !strictWALTail)
+		if !ok {
+			return false
+		}
+		// The tail tolerated by WALRecoveryTolerateCorruptedTail is most often
+		// the zeroed or stale data left by WAL preallocation and recycling,
+		// which is expected on every reopen and is not reported.
+		if d.opts.WALRecoveryMode != WALRecoveryTolerateCorruptedTail {
+			d.opts.EventListener.WALDiscarded(WALDiscardInfo{
+				Mode:    d.opts.WALRecoveryMode,
+				Kind:    kind,
+				FileNum: base.DiskFileNum(ll.Num),
+				Path:    offset.PhysicalFile,
+				Offset:  offset.Physical,
+				Err:     err,
+			})
+		}
+		buf.Reset()
+		if kind == WALDiscardTail {
+			truncated = true
+		} else {
+			rr.Recover()
+		}
+		return true
+	}
 
 	for {
 		r, offset, err := rr.NextRecord()
@@ -845,26 +923,28 @@ func (d *DB) replayWAL(
 			_, err = io.Copy(&buf, r)
 		}
 		if err != nil {
-			// It is common to encounter a zeroed or invalid chunk due to WAL
-			// preallocation and WAL recycling. We need to distinguish these
-			// errors from EOF in order to recognize that the record was
-			// truncated and to avoid replaying subsequent WALs, but want
-			// to otherwise treat them like EOF.
 			if err == io.EOF {
 				break
-			} else if record.IsInvalidRecord(err) && !strictWALTail {
-				break
 			}
-			return nil, 0, errors.Wrap(err, "pebble: error when replaying WAL")
+			if discardCorruption(err, offset) {
+				if truncated {
+					break
+				}
+				continue
+			}
+			return nil, 0, false, errors.Wrap(err, "pebble: error when replaying WAL")
 		}
 
 		if buf.Len() < batchrepr.HeaderLen {
-			return nil, 0, base.CorruptionErrorf("pebble: corrupt wal %s (offset %s)",
+			err := base.CorruptionErrorf("pebble: corrupt wal %s (offset %s)",
 				errors.Safe(base.DiskFileNum(ll.Num)), offset)
-		}
-
-		if d.opts.ErrorIfNotPristine {
-			return nil, 0, errors.WithDetailf(ErrDBNotPristine, "location: %q", d.dirname)
+			if discardCorruption(err, offset) {
+				if truncated {
+					break
+				}
+				continue
+			}
+			return nil, 0, false, err
 		}
 
 		// Specify Batch.db so that Batch.SetRepr will compute Batch.memTableSize
@@ -872,6 +952,22 @@ func (d *DB) replayWAL(
 		b = Batch{}
 		b.db = d
 		b.SetRepr(buf.Bytes())
+		// Any record, including the prepare and abort records of atomic
+		// commits, makes the DB non-pristine: the prepared batches may be
+		// committed once the WALs are replayed.
+		if d.opts.ErrorIfNotPristine {
+			return nil, 0, false, errors.WithDetailf(ErrDBNotPristine, "location: %q", d.dirname)
+		}
+		if skip, err := d.replayTwoPhaseRecord(&b); err != nil {
+			return nil, 0, false, err
+		} else if skip {
+			// The prepare and abort records of atomic commits are not applied:
+			// the prepared batches are resolved once all the WALs are
+			// replayed. See CommitAtomic.
+			buf.Reset()
+			continue
+		}
+
 		seqNum := b.SeqNum()
 		maxSeqNum = seqNum + uint64(b.Count())
 		keysReplayed += int64(b.Count())
@@ -879,7 +975,7 @@ func (d *DB) replayWAL(
 		{
 			br := b.Reader()
 			if kind, encodedFileNum, _, ok, err := br.Next(); err != nil {
-				return nil, 0, err
+				return nil, 0, false, err
 			} else if ok && kind == InternalKeyKindIngestSST {
 				fileNums := make([]base.DiskFileNum, 0, b.Count())
 				addFileNum := func(encodedFileNum []byte) {
@@ -894,7 +990,7 @@ func (d *DB) replayWAL(
 				for i := 1; i < int(b.Count()); i++ {
 					kind, encodedFileNum, _, ok, err := br.Next()
 					if err != nil {
-						return nil, 0, err
+						return nil, 0, false, err
 					}
 					if kind != InternalKeyKindIngestSST {
 						panic("pebble: invalid batch key kind.")
@@ -906,7 +1002,7 @@ func (d *DB) replayWAL(
 				}
 
 				if _, _, _, ok, err := br.Next(); err != nil {
-					return nil, 0, err
+					return nil, 0, false, err
 				} else if ok {
 					panic("pebble: invalid number of entries in batch.")
 				}
@@ -916,29 +1012,29 @@ func (d *DB) replayWAL(
 					var readable objstorage.Readable
 					objMeta, err := d.objProvider.Lookup(fileTypeTable, n)
 					if err != nil {
-						return nil, 0, errors.Wrap(err, "pebble: error when looking up ingested SSTs")
+						return nil, 0, false, errors.Wrap(err, "pebble: error when looking up ingested SSTs")
 					}
 					if objMeta.IsRemote() {
 						readable, err = d.objProvider.OpenForReading(context.TODO(), fileTypeTable, n, objstorage.OpenOptions{MustExist: true})
 						if err != nil {
-							return nil, 0, errors.Wrap(err, "pebble: error when opening flushable ingest files")
+							return nil, 0, false, errors.Wrap(err, "pebble: error when opening flushable ingest files")
 						}
 					} else {
 						path := base.MakeFilepath(d.opts.FS, d.dirname, fileTypeTable, n)
 						f, err := d.opts.FS.Open(path)
 						if err != nil {
-							return nil, 0, err
+							return nil, 0, false, err
 						}
 
 						readable, err = sstable.NewSimpleReadable(f)
 						if err != nil {
-							return nil, 0, err
+							return nil, 0, false, err
 						}
 					}
 					// NB: ingestLoad1 will close readable.
 					meta[i], err = ingestLoad1(d.opts, d.FormatMajorVersion(), readable, d.cacheID, base.PhysicalTableFileNum(n))
 					if err != nil {
-						return nil, 0, errors.Wrap(err, "pebble: error when loading flushable ingest files")
+						return nil, 0, false, errors.Wrap(err, "pebble: error when loading flushable ingest files")
 					}
 				}
 
@@ -948,7 +1044,7 @@ func (d *DB) replayWAL(
 
 				entry, err = d.newIngestedFlushableEntry(meta, seqNum, base.DiskFileNum(ll.Num), KeyRange{})
 				if err != nil {
-					return nil, 0, err
+					return nil, 0, false, err
 				}
 
 				if d.opts.ReadOnly {
@@ -986,13 +1082,13 @@ func (d *DB) replayWAL(
 						d.timeNow(),
 					)
 					if err != nil {
-						return nil, 0, err
+						return nil, 0, false, err
 					}
 					for _, file := range c.flushing[0].flushable.(*ingestedFlushable).files {
 						ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: 0, Meta: file.FileMetadata})
 					}
 				}
-				return toFlush, maxSeqNum, nil
+				return toFlush, maxSeqNum, false, nil
 			}
 		}
 
@@ -1003,7 +1099,7 @@ func (d *DB) replayWAL(
 			b.data = slices.Clone(b.data)
 			b.flushable, err = newFlushableBatch(&b, d.opts.Comparer)
 			if err != nil {
-				return nil, 0, err
+				return nil, 0, false, err
 			}
 			entry := d.newFlushableEntry(b.flushable, base.DiskFileNum(ll.Num), b.SeqNum())
 			// Disable memory accounting by adding a reader ref that will never be
@@ -1026,7 +1122,7 @@ func (d *DB) replayWAL(
 		} else {
 			ensureMem(seqNum)
 			if err = mem.prepare(&b); err != nil && err != arenaskl.ErrArenaFull {
-				return nil, 0, err
+				return nil, 0, false, err
 			}
 			// We loop since DB.newMemTable() slowly grows the size of allocated memtables, so the
 			// batch may not initially fit, but will eventually fit (since it is smaller than
@@ -1036,11 +1132,11 @@ func (d *DB) replayWAL(
 				ensureMem(seqNum)
 				err = mem.prepare(&b)
 				if err != nil && err != arenaskl.ErrArenaFull {
-					return nil, 0, err
+					return nil, 0, false, err
 				}
 			}
 			if err = mem.apply(&b, seqNum); err != nil {
-				return nil, 0, err
+				return nil, 0, false, err
 			}
 			mem.writerUnref()
 		}
@@ -1055,10 +1151,10 @@ func (d *DB) replayWAL(
 	if !d.opts.ReadOnly && batchesReplayed > 0 {
 		err = updateVE()
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, false, err
 		}
 	}
-	return toFlush, maxSeqNum, err
+	return toFlush, maxSeqNum, truncated, err
 }
 
 func readOptionsFile(opts *Options, path string) (string, error) {
@@ -30,6 +30,7 @@ import (
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/vfs/atomicfs"
@@ -154,6 +155,34 @@ func TestErrorIfNotPristine(t *testing.T) {
 	}
 }
 
+func TestErrorIfNotPristinePreparedBatch(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS:                 mem,
+		FormatMajorVersion: FormatAtomicCommit,
+		ResolvePreparedBatch: func(txnID []byte) (bool, error) {
+			return true, nil
+		},
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+
+	// A WAL that only holds a prepare record makes the DB non-pristine, since
+	// the prepared batch is committed when the DB is opened.
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("foo"), []byte("bar"), nil))
+	require.NoError(t, d.prepareBatch([]byte("txn1"), b))
+	require.NoError(t, d.Close())
+
+	opts.ErrorIfNotPristine = true
+	if _, err := Open("", opts); !errors.Is(err, ErrDBNotPristine) {
+		t.Fatalf("expected db-not-pristine error, got %v", err)
+	}
+}
+
 func TestOpen_WALFailover(t *testing.T) {
 	filesystems := map[string]vfs.FS{}
 
@@ -325,7 +354,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000004.017",
+			"marker.format-version.000009.022",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -1122,6 +1151,181 @@ func TestOpenWALReplayMemtableGrowth(t *testing.T) {
 	db.Close()
 }
 
+func TestOpenWALCompression(t *testing.T) {
+	walSize := func(t *testing.T, fmv FormatMajorVersion, compression record.Compression) int64 {
+		mem := vfs.NewMem()
+		opts := &Options{
+			FS:                 mem,
+			FormatMajorVersion: fmv,
+			WALCompression:     compression,
+		}
+		// The WAL created along with the DB precedes the ratchet to the format
+		// major version, so it is uncompressed: write to the next one.
+		d, err := Open("", opts)
+		require.NoError(t, err)
+		require.NoError(t, d.Close())
+		d, err = Open("", opts)
+		require.NoError(t, err)
+		val := bytes.Repeat([]byte("compressible"), 100)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("key%03d", i)), val, nil))
+		}
+		require.NoError(t, d.Close())
+
+		var size int64
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		for _, filename := range ls {
+			if _, _, ok := wal.ParseLogFilename(filename); ok {
+				info, err := mem.Stat(filename)
+				require.NoError(t, err)
+				size += info.Size()
+			}
+		}
+
+		// The records are replayed when the DB is opened again.
+		d, err = Open("", opts)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			v, closer, err := d.Get([]byte(fmt.Sprintf("key%03d", i)))
+			require.NoError(t, err)
+			require.Equal(t, val, v)
+			require.NoError(t, closer.Close())
+		}
+		require.NoError(t, d.Close())
+		return size
+	}
+
+	uncompressed := walSize(t, FormatWALCompression, record.NoCompression)
+	for _, c := range []record.Compression{record.SnappyCompression, record.ZstdCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			require.Less(t, walSize(t, FormatWALCompression, c), uncompressed/4)
+			// The records are not compressed with an older format major version.
+			require.Equal(t, uncompressed, walSize(t, FormatNewest, c))
+		})
+	}
+}
+
+func TestOpenWALStripes(t *testing.T) {
+	mem := vfs.NewStrictMem()
+	stripes := []wal.Dir{{FS: mem, Dirname: "wal1"}, {FS: mem, Dirname: "wal2"}}
+	opts := &Options{
+		FS: mem, WALDir: "wal0", WALStripeDirs: stripes, FormatMajorVersion: FormatWALStriping,
+	}
+	walFiles := func() []string {
+		var files []string
+		for _, dirname := range []string{"wal0", "wal1", "wal2"} {
+			ls, err := mem.List(dirname)
+			require.NoError(t, err)
+			for _, filename := range ls {
+				if _, _, ok := wal.ParseLogFilename(filename); ok {
+					files = append(files, mem.PathJoin(dirname, filename))
+				}
+			}
+		}
+		slices.Sort(files)
+		return files
+	}
+
+	// Each WAL has a log file in each dir. Disable the flushes, so that all
+	// the WALs are live and replayed on Open.
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	d.mu.Lock()
+	d.mu.compact.flushing = true
+	d.mu.Unlock()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%d", i)), nil, Sync))
+		_, err := d.AsyncFlush()
+		require.NoError(t, err)
+	}
+	// The batches written to the last WAL are spread across its log files.
+	for i := 4; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%d", i)), nil, NoSync))
+	}
+	require.NoError(t, d.Set([]byte("key100"), nil, Sync))
+	logs, err := d.mu.log.manager.List()
+	require.NoError(t, err)
+	last := logs[len(logs)-1]
+	require.Equal(t, 3, last.NumSegments())
+	for i := 0; i < last.NumSegments(); i++ {
+		fs, path := last.SegmentLocation(i)
+		stat, err := fs.Stat(path)
+		require.NoError(t, err)
+		require.Greater(t, stat.Size(), int64(1000), "%s", path)
+	}
+	// The batches written after the last sync are lost in a crash, but the
+	// synced ones are all recovered.
+	mem.SetIgnoreSyncs(true)
+	for i := 101; i < 110; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%d", i)), nil, NoSync))
+	}
+	d.mu.Lock()
+	d.mu.compact.flushing = false
+	d.mu.Unlock()
+	require.NoError(t, d.Close())
+	mem.ResetToSyncedState()
+	mem.SetIgnoreSyncs(false)
+	// The first WAL is created before the format major version is ratcheted,
+	// so it is not striped.
+	require.Equal(t, []string{
+		"wal0/000002.log", "wal0/000004.log", "wal0/000005.log", "wal0/000006.log", "wal0/000007.log",
+		"wal1/000004-001.log", "wal1/000005-001.log", "wal1/000006-001.log", "wal1/000007-001.log",
+		"wal2/000004-002.log", "wal2/000005-002.log", "wal2/000006-002.log", "wal2/000007-002.log",
+	}, walFiles())
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	for i := 0; i <= 100; i++ {
+		_, closer, err := d.Get([]byte(fmt.Sprintf("key%d", i)))
+		require.NoError(t, err)
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d.Close())
+
+	// A stripe dir can't be dropped without listing it in WALRecoveryDirs.
+	opts2 := &Options{FS: mem, WALDir: "wal0", WALStripeDirs: stripes[:1]}
+	_, err = Open("", opts2)
+	require.Equal(t, ErrMissingWALRecoveryDir{Dir: "wal2"}, errors.Cause(err))
+	opts2.WALRecoveryDirs = stripes[1:]
+	d, err = Open("", opts2)
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+
+	// Striping is incompatible with failover.
+	opts3 := &Options{
+		FS: mem, WALDir: "wal0", WALStripeDirs: stripes,
+		WALFailover: &WALFailoverOptions{Secondary: wal.Dir{FS: mem, Dirname: "secondary"}},
+	}
+	_, err = Open("", opts3)
+	require.ErrorContains(t, err, "WALStripeDirs is incompatible with WALFailover")
+}
+
+func TestOpenWALStripesFormatMajorVersion(t *testing.T) {
+	// The WALs are only striped once the format major version is
+	// FormatWALStriping, since older versions can't read striped WALs.
+	mem := vfs.NewMem()
+	opts := &Options{
+		FS: mem, WALDir: "wal0", WALStripeDirs: []wal.Dir{{FS: mem, Dirname: "wal1"}},
+		FormatMajorVersion: FormatAtomicCommit,
+	}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), nil, Sync))
+	ls, err := mem.List("wal1")
+	require.NoError(t, err)
+	require.Empty(t, ls)
+
+	require.NoError(t, d.RatchetFormatMajorVersion(FormatWALStriping))
+	_, err = d.AsyncFlush()
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("b"), nil, Sync))
+	ls, err = mem.List("wal1")
+	require.NoError(t, err)
+	require.Len(t, ls, 1)
+	require.NoError(t, d.Close())
+}
+
 func TestPeek(t *testing.T) {
 	// The file paths are UNIX-oriented. To avoid duplicating the test fixtures
 	// just for Windows, just skip the tests on Windows.
@@ -1476,3 +1680,38 @@ func TestOpenRatchetsNextFileNum(t *testing.T) {
 	require.NoError(t, d.Compact([]byte("a"), []byte("z"), false))
 
 }
+
+func TestOpenDirectIO(t *testing.T) {
+	dir := t.TempDir()
+	opts := &Options{
+		FS:     vfs.Default,
+		Levels: []LevelOptions{{BlockSize: 512, TargetFileSize: 16 << 10}},
+	}
+	opts.Experimental.DirectIO = true
+	d, err := Open(dir, opts)
+	require.NoError(t, err)
+	value := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key%05d", i)), value, nil))
+		if i%500 == 499 {
+			require.NoError(t, d.Flush())
+		}
+	}
+	require.NoError(t, d.Compact([]byte("key"), []byte("key99999"), false /* parallelize */))
+	require.NoError(t, d.Close())
+
+	// Reopen with a new cache so that the blocks are read from the files.
+	d, err = Open(dir, opts)
+	require.NoError(t, err)
+	iter, err := d.NewIter(nil)
+	require.NoError(t, err)
+	var n int
+	for valid := iter.First(); valid; valid = iter.Next() {
+		require.Equal(t, fmt.Sprintf("key%05d", n), string(iter.Key()))
+		require.Equal(t, value, iter.Value())
+		n++
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, 2000, n)
+	require.NoError(t, d.Close())
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/manifest"
 	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/rangekey"
+	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/wal"
@@ -48,7 +49,8 @@ type FilterType = base.FilterType
 
 // Exported TableFilter constants.
 const (
-	TableFilter = base.TableFilter
+	TableFilter       = base.TableFilter
+	PartitionedFilter = base.PartitionedFilter
 )
 
 // FilterWriter exports the base.FilterWriter type.
@@ -57,6 +59,12 @@ type FilterWriter = base.FilterWriter
 // FilterPolicy exports the base.FilterPolicy type.
 type FilterPolicy = base.FilterPolicy
 
+// RangeFilterWriter exports the base.RangeFilterWriter type.
+type RangeFilterWriter = base.RangeFilterWriter
+
+// RangeFilterPolicy exports the base.RangeFilterPolicy type.
+type RangeFilterPolicy = base.RangeFilterPolicy
+
 // BlockPropertyCollector exports the sstable.BlockPropertyCollector type.
 type BlockPropertyCollector = sstable.BlockPropertyCollector
 
@@ -185,8 +193,10 @@ type IterOptions struct {
 	// existing is not low or if we just expect a one-time Seek (where loading the
 	// data block directly is better).
 	UseL6Filters bool
-	// CategoryAndQoS is used for categorized iterator stats. This should not be
-	// changed by calling SetOptions.
+	// CategoryAndQoS is used for categorized iterator stats, and to opt out of
+	// adding the blocks read by the iterator to the block cache (see
+	// sstable.CategoryAndQoS.NoCacheAdmission). This should not be changed by
+	// calling SetOptions.
 	sstable.CategoryAndQoS
 
 	DebugRangeKeyStack bool
@@ -363,7 +373,106 @@ type WriteOptions struct {
 	// survive a process crash.
 	//
 	// The default value is true.
+	//
+	// Sync is ignored if Durability is set.
 	Sync bool
+
+	// Durability is the durability level of the batch. It allows batches of
+	// different durability to be mixed in the same DB: for example, batches of
+	// cache-like data which need not survive a crash can skip the WAL, while
+	// critical batches wait for the WAL to be synced. See the Durability
+	// constants.
+	//
+	// The default value, DurabilityDefault, derives the level from Sync.
+	Durability Durability
+
+	// SyncWithin is the maximum delay before the WAL is synced for
+	// DurabilitySyncWithin. It is ignored for the other levels.
+	SyncWithin time.Duration
+
+	// Pipelined is whether DB.ApplyNoSyncWait returns before the batch is
+	// visible to reads. By default, a commit returns once the batch and all the
+	// batches committed before it are applied to the memtable and visible. In
+	// the pipelined mode, ApplyNoSyncWait returns as soon as the batch is
+	// written to the WAL; the batch is applied to the memtable in the
+	// background, so that the caller can write its next batch to the WAL while
+	// the earlier batches are still being applied. The batches still become
+	// visible in sequence number order.
+	//
+	// The caller must call Batch.SyncWait, which waits for the batch to be
+	// visible (and for the WAL sync if Sync is set), before relying on the
+	// batch being visible, or modifying or closing it. Sync may be false in
+	// this mode. DB.Close waits for the pending batches to be applied.
+	//
+	// Pipelined is ignored by the other write methods, which always wait for
+	// the batch to be visible, and when Unordered is set.
+	Pipelined bool
+
+	// Unordered is whether the batch is made visible as soon as it is applied
+	// to the memtable, without waiting for the batches committed concurrently
+	// before it. This removes the serialization of the publication of sequence
+	// numbers, at the cost of the ordering of visibility: the visible sequence
+	// number is ratcheted past the batch even if an earlier batch is still
+	// being applied. Until that batch is applied, a read (including a read at a
+	// snapshot) may observe the later batch but not the earlier one, or only
+	// part of the earlier one. The batch is still visible when the commit
+	// returns, and the batches are still written to the WAL in sequence number
+	// order, so recovery is unaffected.
+	//
+	// The relaxation applies to all the batches committed concurrently with an
+	// unordered batch, including the batches that are not unordered. Only use
+	// it if the readers don't rely on the consistency of concurrent writes, for
+	// example if concurrent batches never write the same keys and reads don't
+	// span batches.
+	Unordered bool
+}
+
+// Durability is the durability level of a batch. See WriteOptions.Durability.
+type Durability int8
+
+const (
+	// DurabilityDefault derives the durability level from WriteOptions.Sync:
+	// DurabilitySync if Sync is true, else DurabilityBuffered.
+	DurabilityDefault Durability = iota
+	// DurabilityNone applies the batch to the memtable only, without writing it
+	// to the WAL. The batch is lost if the process crashes or the DB is closed
+	// before the memtable is flushed; DB.Flush may be used to persist it. The
+	// batches that are written to the WAL are still recovered after a crash,
+	// so only use this level for data that the application can tolerate losing
+	// independently of the other writes, such as cached data.
+	DurabilityNone
+	// DurabilityBuffered writes the batch to the WAL, without syncing it. The
+	// batch is lost if the process crashes before the WAL is synced (by a
+	// later batch or the WAL rotation). This is the level of Sync=false.
+	DurabilityBuffered
+	// DurabilitySync writes the batch to the WAL and waits for the WAL to be
+	// synced (fdatasync) before the commit returns. This is the level of
+	// Sync=true.
+	DurabilitySync
+	// DurabilitySyncWithin writes the batch to the WAL and guarantees that the
+	// WAL is synced within WriteOptions.SyncWithin of the commit, without
+	// waiting for the sync. The syncs of the batches committed within the
+	// deadline are grouped together, which bounds the window of data loss on a
+	// crash at a much lower cost than DurabilitySync.
+	DurabilitySyncWithin
+)
+
+// String implements fmt.Stringer.
+func (d Durability) String() string {
+	switch d {
+	case DurabilityDefault:
+		return "default"
+	case DurabilityNone:
+		return "none"
+	case DurabilityBuffered:
+		return "buffered"
+	case DurabilitySync:
+		return "sync"
+	case DurabilitySyncWithin:
+		return "sync-within"
+	default:
+		return fmt.Sprintf("Durability(%d)", int8(d))
+	}
 }
 
 // Sync specifies the default write options for writes which synchronize to
@@ -374,9 +483,25 @@ var Sync = &WriteOptions{Sync: true}
 // synchronize to disk.
 var NoSync = &WriteOptions{Sync: false}
 
-// GetSync returns the Sync value or true if the receiver is nil.
+// GetSync returns whether the commit waits for the WAL to be synced, which is
+// the Sync value if Durability is not set, or true if the receiver is nil.
 func (o *WriteOptions) GetSync() bool {
-	return o == nil || o.Sync
+	return o.GetDurability() == DurabilitySync
+}
+
+// GetDurability returns the durability level of the receiver, derived from
+// Sync if Durability is not set, or DurabilitySync if the receiver is nil.
+func (o *WriteOptions) GetDurability() Durability {
+	switch {
+	case o == nil:
+		return DurabilitySync
+	case o.Durability != DurabilityDefault:
+		return o.Durability
+	case o.Sync:
+		return DurabilitySync
+	default:
+		return DurabilityBuffered
+	}
 }
 
 // LevelOptions holds the optional per-level parameters.
@@ -408,7 +533,9 @@ type LevelOptions struct {
 	// reduce disk reads for Get calls.
 	//
 	// One such implementation is bloom.FilterPolicy(10) from the pebble/bloom
-	// package.
+	// package. ribbon.FilterPolicy(10) from the pebble/ribbon package yields a
+	// similar false positive rate using ~25% less space, at the cost of more
+	// CPU when writing sstables.
 	//
 	// The default value means to use no filter.
 	FilterPolicy FilterPolicy
@@ -420,8 +547,27 @@ type LevelOptions struct {
 	// memory proportional to the number of keys in an sstable to create, but
 	// avoids the index lookup when determining if a key is present. Table-level
 	// filters should be preferred except under constrained memory situations.
+	//
+	// PartitionedFilter splits the table-level filter into partitions aligned
+	// with the index partitions, so that only the partition relevant to a
+	// lookup is loaded into the block cache. It requires a table format of at
+	// least sstable.TableFormatPebblev6, which is used from the format major
+	// version FormatPartitionedFilters onwards; tables written in older formats
+	// use a table-level filter instead.
 	FilterType FilterType
 
+	// RangeFilterPolicy defines a range filter algorithm that allows iterators
+	// with bounds set to skip tables that contain no keys within the bounds,
+	// without reading the tables' index blocks. The range filter is built
+	// over the key prefixes returned by Comparer.Split.
+	//
+	// One such implementation is rangefilter.FilterPolicy(16) from the
+	// pebble/rangefilter package. It requires key prefixes to sort bytewise,
+	// as is the case for DefaultComparer.
+	//
+	// The default value means to use no range filter.
+	RangeFilterPolicy RangeFilterPolicy
+
 	// IndexBlockSize is the target uncompressed size in bytes of each index
 	// block. When the index block size is larger than this target, two-level
 	// indexes are automatically enabled. Setting this option to a large value
@@ -507,6 +653,11 @@ type Options struct {
 	// TODO(peter): untested
 	DisableWAL bool
 
+	// DiskQuota configures the thresholds of free space and disk usage past
+	// which writes are rejected with ErrDiskQuotaExceeded. See
+	// DiskQuotaOptions. The quota is disabled by default.
+	DiskQuota DiskQuotaOptions
+
 	// ErrorIfExists causes an error on Open if the database already exists.
 	// The error can be checked with errors.Is(err, ErrDBAlreadyExists).
 	//
@@ -706,6 +857,27 @@ type Options struct {
 		// on shared storage in bytes. If it is 0, no cache is used.
 		SecondaryCacheSizeBytes int64
 
+		// DirectIO enables direct I/O (O_DIRECT on Linux) for the reads and writes
+		// of local sstables, so that flushes, compactions and large scans bypass
+		// the OS page cache. This avoids caching the data twice (in the page
+		// cache and in the block cache), so most of the memory can be given to
+		// the block cache. Falls back to buffered I/O if the filesystem does not
+		// support direct I/O.
+		DirectIO bool
+
+		// ScanPrefetchBlocks is the number of data blocks of an sstable that an
+		// iterator prefetches when it scans forward; the reads of the blocks are
+		// submitted at once (with io_uring on Linux), so that they are executed
+		// in parallel while the iterator processes the current blocks. If zero,
+		// the blocks are not prefetched. See
+		// sstable.ReaderOptions.ScanPrefetchBlocks.
+		ScanPrefetchBlocks int
+
+		// BlockCacheWarmup configures the periodic persistence of the list of the
+		// most frequently accessed blocks, which is used to warm up the block
+		// cache when the DB is opened.
+		BlockCacheWarmup BlockCacheWarmupOptions
+
 		// NB: DO NOT crash on SingleDeleteInvariantViolationCallback or
 		// IneffectualSingleDeleteCallback, since these can be false positives
 		// even if SingleDel has been used correctly.
@@ -795,6 +967,12 @@ type Options struct {
 	// map during normal usage of a DB.
 	Filters map[string]FilterPolicy
 
+	// RangeFilters is a map from range filter policy name to range filter
+	// policy. It is populated from the range filter policies of Levels when
+	// the DB is opened, and must include the policies of any tables written
+	// using other options for their range filters to be used.
+	RangeFilters map[string]RangeFilterPolicy
+
 	// FlushDelayDeleteRange configures how long the database should wait before
 	// forcing a flush of a memtable that contains a range deletion. Disk space
 	// cannot be reclaimed until the range deletion is flushed. No automatic
@@ -1007,6 +1185,35 @@ type Options struct {
 	// default behaviour in RocksDB.
 	WALBytesPerSync int
 
+	// WALCompression is the compression applied to the batches written to the
+	// WAL. Small batches, and batches that don't compress well, are written
+	// uncompressed. Compression requires FormatWALCompression; with an older
+	// format major version, the batches are written uncompressed until the
+	// format is ratcheted and a new WAL is created.
+	//
+	// The default value is record.NoCompression.
+	WALCompression record.Compression
+
+	// WALRecoveryMode configures how Open handles corrupted WALs. The default
+	// value is WALRecoveryTolerateCorruptedTail.
+	WALRecoveryMode WALRecoveryMode
+
+	// ResolvePreparedBatch is invoked by Open for each batch prepared by
+	// CommitAtomic whose transaction was neither committed nor aborted when
+	// the DB was closed. It returns whether the transaction txnID committed,
+	// in which case the batch is applied, or else the batch is discarded. See
+	// CoordinatorResolver.
+	//
+	// Open fails if ResolvePreparedBatch returns an error, or if it is nil and
+	// there are in-doubt batches. The in-doubt batches are ignored by a
+	// read-only DB.
+	ResolvePreparedBatch func(txnID []byte) (committed bool, err error)
+
+	// WALArchive configures the upload of the obsolete WALs to remote storage,
+	// instead of deleting them. See WALArchiveOptions. The WALs are not
+	// archived by default.
+	WALArchive WALArchiveOptions
+
 	// WALDir specifies the directory to store write-ahead logs (WALs) in. If
 	// empty (the default), WALs will be stored in the same directory as sstables
 	// (i.e. the directory passed to pebble.Open).
@@ -1019,6 +1226,23 @@ type Options struct {
 	// unavailability.
 	WALFailover *WALFailoverOptions
 
+	// WALStripeDirs is a list of additional directories across which the WALs
+	// are striped with WALDir: the batches written to a WAL are spread
+	// round-robin across a log file in WALDir and one in each of the
+	// WALStripeDirs, which are written and synced in parallel. A sync of the
+	// WAL syncs all of its log files. Recovery reads the batches back in the
+	// order in which they were written, and stops at the first one that is
+	// missing, so that the batches recovered after a crash are still a prefix
+	// of the ones written. This increases the write throughput of the WAL when
+	// the directories are on separate disks.
+	//
+	// The WALs are only striped once the format major version is
+	// FormatWALStriping; until then, they are written to WALDir. WALStripeDirs
+	// is incompatible with WALFailover, and WAL recycling is disabled when it
+	// is set. When removing a directory from WALStripeDirs, it must be added
+	// to WALRecoveryDirs until the DB is reopened and its WALs are obsolete.
+	WALStripeDirs []wal.Dir
+
 	// WALRecoveryDirs is a list of additional directories that should be
 	// scanned for the existence of additional write-ahead logs. WALRecoveryDirs
 	// is expected to be used when starting Pebble with a new WALDir or a new
@@ -1108,6 +1332,89 @@ type WALFailoverOptions struct {
 	wal.FailoverOptions
 }
 
+// DiskQuotaOptions configures a disk quota, which degrades the DB gracefully
+// before the volume runs out of space.
+//
+// The DB periodically checks the space available on its volume and its own
+// disk usage (see Metrics.DiskSpaceUsage). When one of the thresholds is
+// crossed, the quota is exceeded: the batches that contain anything other than
+// deletions, and the ingestions of local files, are rejected with
+// ErrDiskQuotaExceeded; the in-progress compactions that don't reclaim space
+// are canceled and only delete-only and elision-only compactions are
+// scheduled (manual compactions and downloads wait until the quota is no
+// longer exceeded). Flushes still run. The DB automatically resumes normal
+// operation when enough space is freed.
+type DiskQuotaOptions struct {
+	// MinFreeBytes is the minimum amount of space available on the volume of
+	// the DB. It is ignored if the filesystem doesn't report the available
+	// space. If it is 0, the available space is not checked.
+	MinFreeBytes uint64
+	// MaxUsageBytes is the maximum disk space used by the DB. If it is 0, the
+	// usage is not checked.
+	MaxUsageBytes uint64
+	// ResumeMarginBytes is the amount of space that must be freed past a
+	// threshold before the DB resumes normal operation, to avoid flapping
+	// between the two modes. If it is 0, it is 1/16th of the threshold.
+	ResumeMarginBytes uint64
+	// CheckInterval is the interval between the periodic checks. The quota is
+	// also checked whenever a flush or compaction completes or a file is
+	// deleted. The default is 10s.
+	CheckInterval time.Duration
+}
+
+// enabled returns true if a threshold is set.
+func (o *DiskQuotaOptions) enabled() bool {
+	return o.MinFreeBytes > 0 || o.MaxUsageBytes > 0
+}
+
+// WALArchiveOptions configures the archival of the obsolete WALs to remote
+// storage.
+//
+// An obsolete WAL is queued to be uploaded in the background instead of being
+// cleaned right away; the local file is cleaned (see Options.Cleaner) once it
+// is uploaded. The sequence number ranges of the archived WALs are recorded in
+// index entries (see ReadWALArchiveIndex). A WAL whose upload fails is retried
+// after RetryInterval, unless the failure is permanent (e.g. the WAL can't be
+// read): it is then skipped, and left on disk. The WALs that are still queued
+// when the DB is closed are uploaded when it is reopened.
+type WALArchiveOptions struct {
+	// Storage is the remote storage to which the WALs are uploaded. If nil, the
+	// WALs are not archived.
+	Storage remote.Storage
+	// Prefix is prepended to the names of the objects: a WAL is archived as
+	// <Prefix><WAL file name>, and its index entry as
+	// <Prefix>wal-archive-index/<WAL file name>.
+	Prefix string
+	// MaxQueuedBytes is the maximum total size of the WALs queued to be
+	// uploaded. Past it, the cleanup of obsolete files blocks until uploads
+	// complete, which eventually stalls flushes and writes. The default is
+	// 256MB.
+	MaxQueuedBytes uint64
+	// RetryInterval is the delay before a failed upload is retried. The
+	// default is 5s.
+	RetryInterval time.Duration
+}
+
+// BlockCacheWarmupOptions configures the warm-up of the block cache from a
+// persisted list of hot blocks.
+//
+// When enabled, the DB periodically writes the keys (file number and offset)
+// of the blocks it accesses most frequently to a file in its directory. When
+// the DB is opened, the blocks in the list are read into the block cache in the
+// background, skipping the blocks of tables that are no longer in the LSM.
+type BlockCacheWarmupOptions struct {
+	// PersistInterval is the interval at which the list of hot blocks is
+	// written. The list is also written when the DB is closed. If it is 0, the
+	// warm-up is disabled. The list is never written by a read-only DB.
+	PersistInterval time.Duration
+	// MaxBlocks is the maximum number of blocks in the list. The default is
+	// 16384.
+	MaxBlocks int
+	// PrefetchBytesPerSecond limits the rate at which the blocks are read when
+	// the DB is opened. The default is 32 MB/s.
+	PrefetchBytesPerSecond int64
+}
+
 // DebugCheckLevels calls CheckLevels on the provided database.
 // It may be set in the DebugCheck field of Options to check
 // level invariants whenever a new version is installed.
@@ -1250,6 +1557,21 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.Experimental.ReadSamplingMultiplier == 0 {
 		o.Experimental.ReadSamplingMultiplier = 1 << 4
 	}
+	if o.DiskQuota.CheckInterval <= 0 {
+		o.DiskQuota.CheckInterval = 10 * time.Second
+	}
+	if o.WALArchive.MaxQueuedBytes == 0 {
+		o.WALArchive.MaxQueuedBytes = 256 << 20 // 256 MB
+	}
+	if o.WALArchive.RetryInterval <= 0 {
+		o.WALArchive.RetryInterval = 5 * time.Second
+	}
+	if o.Experimental.BlockCacheWarmup.MaxBlocks <= 0 {
+		o.Experimental.BlockCacheWarmup.MaxBlocks = 16384
+	}
+	if o.Experimental.BlockCacheWarmup.PrefetchBytesPerSecond <= 0 {
+		o.Experimental.BlockCacheWarmup.PrefetchBytesPerSecond = 32 << 20 // 32 MB/s
+	}
 	if o.Experimental.TableCacheShards <= 0 {
 		o.Experimental.TableCacheShards = runtime.GOMAXPROCS(0)
 	}
@@ -1286,7 +1608,7 @@ func (o *Options) AddEventListener(l EventListener) {
 	o.EventListener = &l
 }
 
-// initMaps initializes the Comparers, Filters, and Mergers maps.
+// initMaps initializes the Comparers, Filters, RangeFilters, and Mergers maps.
 func (o *Options) initMaps() {
 	for i := range o.Levels {
 		l := &o.Levels[i]
@@ -1299,6 +1621,15 @@ func (o *Options) initMaps() {
 				o.Filters[name] = l.FilterPolicy
 			}
 		}
+		if l.RangeFilterPolicy != nil {
+			if o.RangeFilters == nil {
+				o.RangeFilters = make(map[string]RangeFilterPolicy)
+			}
+			name := l.RangeFilterPolicy.Name()
+			if _, ok := o.RangeFilters[name]; !ok {
+				o.RangeFilters[name] = l.RangeFilterPolicy
+			}
+		}
 	}
 }
 
@@ -1384,6 +1715,19 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  validate_on_ingest=%t\n", o.Experimental.ValidateOnIngest)
 	fmt.Fprintf(&buf, "  wal_dir=%s\n", o.WALDir)
 	fmt.Fprintf(&buf, "  wal_bytes_per_sync=%d\n", o.WALBytesPerSync)
+	if o.WALCompression != record.NoCompression {
+		fmt.Fprintf(&buf, "  wal_compression=%s\n", o.WALCompression)
+	}
+	if o.WALRecoveryMode != WALRecoveryTolerateCorruptedTail {
+		fmt.Fprintf(&buf, "  wal_recovery_mode=%s\n", o.WALRecoveryMode)
+	}
+	if len(o.WALStripeDirs) > 0 {
+		dirnames := make([]string, len(o.WALStripeDirs))
+		for i := range o.WALStripeDirs {
+			dirnames[i] = o.WALStripeDirs[i].Dirname
+		}
+		fmt.Fprintf(&buf, "  wal_stripe_dirs=%s\n", strings.Join(dirnames, ","))
+	}
 	fmt.Fprintf(&buf, "  max_writer_concurrency=%d\n", o.Experimental.MaxWriterConcurrency)
 	fmt.Fprintf(&buf, "  force_writer_parallelism=%t\n", o.Experimental.ForceWriterParallelism)
 	fmt.Fprintf(&buf, "  secondary_cache_size_bytes=%d\n", o.Experimental.SecondaryCacheSizeBytes)
@@ -1428,6 +1772,9 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  compression=%s\n", resolveDefaultCompression(l.Compression()))
 		fmt.Fprintf(&buf, "  filter_policy=%s\n", filterPolicyName(l.FilterPolicy))
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
+		if l.RangeFilterPolicy != nil {
+			fmt.Fprintf(&buf, "  range_filter_policy=%s\n", l.RangeFilterPolicy.Name())
+		}
 		fmt.Fprintf(&buf, "  index_block_size=%d\n", l.IndexBlockSize)
 		fmt.Fprintf(&buf, "  target_file_size=%d\n", l.TargetFileSize)
 	}
@@ -1492,12 +1839,13 @@ func parseOptions(s string, fn func(section, key, value string) error) error {
 // ParseHooks contains callbacks to create options fields which can have
 // user-defined implementations.
 type ParseHooks struct {
-	NewCache        func(size int64) *Cache
-	NewCleaner      func(name string) (Cleaner, error)
-	NewComparer     func(name string) (*Comparer, error)
-	NewFilterPolicy func(name string) (FilterPolicy, error)
-	NewMerger       func(name string) (*Merger, error)
-	SkipUnknown     func(name, value string) bool
+	NewCache             func(size int64) *Cache
+	NewCleaner           func(name string) (Cleaner, error)
+	NewComparer          func(name string) (*Comparer, error)
+	NewFilterPolicy      func(name string) (FilterPolicy, error)
+	NewRangeFilterPolicy func(name string) (RangeFilterPolicy, error)
+	NewMerger            func(name string) (*Merger, error)
+	SkipUnknown          func(name, value string) bool
 }
 
 // Parse parses the options from the specified string. Note that certain
@@ -1710,6 +2058,35 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.WALDir = value
 			case "wal_bytes_per_sync":
 				o.WALBytesPerSync, err = strconv.Atoi(value)
+			case "wal_compression":
+				switch value {
+				case "NoCompression":
+					o.WALCompression = record.NoCompression
+				case "Snappy":
+					o.WALCompression = record.SnappyCompression
+				case "ZSTD":
+					o.WALCompression = record.ZstdCompression
+				default:
+					return errors.Errorf("pebble: unknown WAL compression: %q", errors.Safe(value))
+				}
+			case "wal_recovery_mode":
+				switch value {
+				case "tolerate-corrupted-tail":
+					o.WALRecoveryMode = WALRecoveryTolerateCorruptedTail
+				case "absolute-consistency":
+					o.WALRecoveryMode = WALRecoveryAbsoluteConsistency
+				case "point-in-time":
+					o.WALRecoveryMode = WALRecoveryPointInTime
+				case "skip-corrupted-records":
+					o.WALRecoveryMode = WALRecoverySkipCorruptedRecords
+				default:
+					return errors.Errorf("pebble: unknown WAL recovery mode: %q", errors.Safe(value))
+				}
+			case "wal_stripe_dirs":
+				o.WALStripeDirs = nil
+				for _, dirname := range strings.Split(value, ",") {
+					o.WALStripeDirs = append(o.WALStripeDirs, wal.Dir{Dirname: dirname, FS: vfs.Default})
+				}
 			case "max_writer_concurrency":
 				o.Experimental.MaxWriterConcurrency, err = strconv.Atoi(value)
 			case "force_writer_parallelism":
@@ -1809,9 +2186,15 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				switch value {
 				case "table":
 					l.FilterType = TableFilter
+				case "partitioned":
+					l.FilterType = PartitionedFilter
 				default:
 					return errors.Errorf("pebble: unknown filter type: %q", errors.Safe(value))
 				}
+			case "range_filter_policy":
+				if hooks != nil && hooks.NewRangeFilterPolicy != nil {
+					l.RangeFilterPolicy, err = hooks.NewRangeFilterPolicy(value)
+				}
 			case "index_block_size":
 				l.IndexBlockSize, err = strconv.Atoi(value)
 			case "target_file_size":
@@ -1865,24 +2248,38 @@ func (o *Options) CheckCompatibility(previousOptions string) error {
 					errors.Safe(value), errors.Safe(o.Merger.Name))
 			}
 		case "Options.wal_dir", "WAL Failover.secondary_dir":
-			switch {
-			case o.WALDir == value:
-				return nil
-			case o.WALFailover != nil && o.WALFailover.Secondary.Dirname == value:
-				return nil
-			default:
-				for _, d := range o.WALRecoveryDirs {
-					if d.Dirname == value {
-						return nil
-					}
+			return o.checkWALDir(value)
+		case "Options.wal_stripe_dirs":
+			for _, dirname := range strings.Split(value, ",") {
+				if err := o.checkWALDir(dirname); err != nil {
+					return err
 				}
-				return ErrMissingWALRecoveryDir{Dir: value}
 			}
 		}
 		return nil
 	})
 }
 
+// checkWALDir returns ErrMissingWALRecoveryDir if the given directory, which
+// may contain WALs, is not part of the WAL configuration.
+func (o *Options) checkWALDir(dirname string) error {
+	switch {
+	case o.WALDir == dirname:
+		return nil
+	case o.WALFailover != nil && o.WALFailover.Secondary.Dirname == dirname:
+		return nil
+	default:
+		for _, dirs := range [][]wal.Dir{o.WALStripeDirs, o.WALRecoveryDirs} {
+			for _, d := range dirs {
+				if d.Dirname == dirname {
+					return nil
+				}
+			}
+		}
+		return ErrMissingWALRecoveryDir{Dir: dirname}
+	}
+}
+
 // Validate verifies that the options are mutually consistent. For example,
 // L0StopWritesThreshold must be >= L0CompactionThreshold, otherwise a write
 // stall would persist indefinitely.
@@ -1919,6 +2316,9 @@ func (o *Options) Validate() error {
 	if o.TableCache != nil && o.Cache != o.TableCache.cache {
 		fmt.Fprintf(&buf, "underlying cache in the TableCache and the Cache dont match\n")
 	}
+	if o.WALFailover != nil && len(o.WALStripeDirs) > 0 {
+		fmt.Fprintf(&buf, "WALStripeDirs is incompatible with WALFailover\n")
+	}
 	if buf.Len() == 0 {
 		return nil
 	}
@@ -1933,11 +2333,13 @@ func (o *Options) MakeReaderOptions() sstable.ReaderOptions {
 		readerOpts.Cache = o.Cache
 		readerOpts.Comparer = o.Comparer
 		readerOpts.Filters = o.Filters
+		readerOpts.RangeFilters = o.RangeFilters
 		if o.Merger != nil {
 			readerOpts.Merge = o.Merger.Merge
 			readerOpts.MergerName = o.Merger.Name
 		}
 		readerOpts.LoggerAndTracer = o.LoggerAndTracer
+		readerOpts.ScanPrefetchBlocks = o.Experimental.ScanPrefetchBlocks
 	}
 	return readerOpts
 }
@@ -1969,6 +2371,7 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 	writerOpts.Compression = resolveDefaultCompression(levelOpts.Compression())
 	writerOpts.FilterPolicy = levelOpts.FilterPolicy
 	writerOpts.FilterType = levelOpts.FilterType
+	writerOpts.RangeFilterPolicy = levelOpts.RangeFilterPolicy
 	writerOpts.IndexBlockSize = levelOpts.IndexBlockSize
 	return writerOpts
 }
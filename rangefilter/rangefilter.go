@@ -0,0 +1,248 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package rangefilter implements range filters, which can determine whether a
+// table may contain any key within a range of keys.
+//
+// The range filter implemented here stores the distinct keys added to it,
+// truncated to a fixed number of bytes. Truncation preserves the bytewise
+// order of keys: if a <= b then trunc(a) <= trunc(b). So if a key k with
+// lower <= k <= upper was added to the filter, the filter contains a
+// truncated key t with trunc(lower) <= t <= trunc(upper). If no such truncated
+// key exists, no key within the range was added to the filter. The truncation
+// length is chosen when the filter is finished as the longest length for
+// which the filter fits within a budget of bits per key.
+//
+// The filter relies on keys (key prefixes, as returned by Comparer.Split, when
+// used within an sstable) being ordered bytewise. It must only be used with
+// comparers for which this is the case, such as base.DefaultComparer. As a
+// safety net, a filter to which keys are added in an order other than the
+// bytewise order is written as a filter that matches every range.
+//
+// The filter is encoded as follows:
+//
+//	+---------------------------------------------+------------------+
+//	| records ((keyLen+1)*numRecords bytes)       | keyLen (uint8)   |
+//	+---------------------------------------------+------------------+
+//
+// Each record consists of the length of the truncated key (a byte) followed by
+// the truncated key, padded with zeroes to keyLen bytes. Records are sorted,
+// so the filter is queried using a binary search. A keyLen of zero denotes a
+// filter that matches every range.
+package rangefilter // import "github.com/cockroachdb/pebble/rangefilter"
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+const (
+	// maxKeyLen is the maximum length to which keys are truncated.
+	maxKeyLen = 32
+	// minBudget is the minimum size in bytes of a filter's records. It avoids
+	// truncating the keys of small filters excessively.
+	minBudget = 64
+	// streamingSlack is the additional size in bytes that the records may
+	// occupy while keys are being added. The records are truncated further as
+	// necessary when the filter is finished.
+	streamingSlack = 4 << 10
+)
+
+type tableFilter []byte
+
+// MayContainRange returns whether the filter may contain a key k with lower <=
+// k <= upper.
+func (f tableFilter) MayContainRange(lower, upper []byte) bool {
+	if len(f) == 0 {
+		return true
+	}
+	keyLen := int(f[len(f)-1])
+	if keyLen == 0 {
+		return true
+	}
+	records := f[:len(f)-1]
+	recordLen := keyLen + 1
+	if len(records)%recordLen != 0 {
+		return true
+	}
+	n := len(records) / recordLen
+	record := func(i int) []byte {
+		r := records[i*recordLen:]
+		return r[1 : 1+int(r[0])]
+	}
+	i := 0
+	if lower != nil {
+		lower = truncate(lower, keyLen)
+		i = sort.Search(n, func(i int) bool {
+			return bytes.Compare(record(i), lower) >= 0
+		})
+	}
+	if i == n {
+		return false
+	}
+	return upper == nil || bytes.Compare(record(i), truncate(upper, keyLen)) <= 0
+}
+
+func truncate(key []byte, keyLen int) []byte {
+	if len(key) > keyLen {
+		return key[:keyLen]
+	}
+	return key
+}
+
+type tableFilterWriter struct {
+	bitsPerKey int
+
+	// numKeys is the number of distinct keys added to the filter.
+	numKeys int
+	lastKey []byte
+	// unordered is set if keys were not added in bytewise order.
+	unordered bool
+
+	// keyLen is the current truncation length. It only ever decreases.
+	keyLen int
+	// records holds the encoded records for the distinct keys added so far,
+	// truncated to keyLen.
+	records []byte
+}
+
+func newTableFilterWriter(bitsPerKey int) *tableFilterWriter {
+	return &tableFilterWriter{
+		bitsPerKey: bitsPerKey,
+		keyLen:     maxKeyLen,
+	}
+}
+
+// budget returns the maximum size of the records of the filter.
+func (w *tableFilterWriter) budget() int {
+	return max(w.bitsPerKey*w.numKeys/8, minBudget)
+}
+
+// AddKey implements the base.RangeFilterWriter interface.
+func (w *tableFilterWriter) AddKey(key []byte) {
+	if w.numKeys > 0 {
+		c := bytes.Compare(w.lastKey, key)
+		if c == 0 {
+			return
+		}
+		if c > 0 {
+			w.unordered = true
+		}
+	}
+	w.lastKey = append(w.lastKey[:0], key...)
+	w.numKeys++
+	if w.unordered || w.keyLen == 0 {
+		return
+	}
+	w.addRecord(truncate(key, w.keyLen))
+	if len(w.records) > 2*w.budget()+streamingSlack {
+		w.shrink(w.budget())
+	}
+}
+
+// addRecord appends a record for the truncated key t, unless the last record
+// is equal to t.
+func (w *tableFilterWriter) addRecord(t []byte) {
+	recordLen := w.keyLen + 1
+	if n := len(w.records); n > 0 {
+		last := w.records[n-recordLen:]
+		if bytes.Equal(last[1:1+int(last[0])], t) {
+			return
+		}
+	}
+	w.records = append(w.records, byte(len(t)))
+	w.records = append(w.records, t...)
+	for i := len(t); i < w.keyLen; i++ {
+		w.records = append(w.records, 0)
+	}
+}
+
+// shrink reduces the truncation length to the longest length for which the
+// records fit within budget bytes. If no such length exists, the truncation
+// length becomes zero and the filter matches every range.
+func (w *tableFilterWriter) shrink(budget int) {
+	keyLen := w.keyLen
+	for ; keyLen > 0; keyLen-- {
+		if w.countRecords(keyLen)*(keyLen+1) <= budget {
+			break
+		}
+	}
+	if keyLen == w.keyLen {
+		return
+	}
+	records := w.records
+	recordLen := w.keyLen + 1
+	w.keyLen = keyLen
+	w.records = nil
+	if keyLen == 0 {
+		return
+	}
+	w.records = make([]byte, 0, min(len(records), budget))
+	for i := 0; i < len(records); i += recordLen {
+		w.addRecord(truncate(records[i+1:i+1+int(records[i])], keyLen))
+	}
+}
+
+// countRecords returns the number of distinct records if the keys were
+// truncated to keyLen.
+func (w *tableFilterWriter) countRecords(keyLen int) int {
+	recordLen := w.keyLen + 1
+	var count int
+	var last []byte
+	for i := 0; i < len(w.records); i += recordLen {
+		t := truncate(w.records[i+1:i+1+int(w.records[i])], keyLen)
+		if count == 0 || !bytes.Equal(last, t) {
+			count++
+			last = t
+		}
+	}
+	return count
+}
+
+// Finish implements the base.RangeFilterWriter interface.
+func (w *tableFilterWriter) Finish(buf []byte) []byte {
+	if w.unordered {
+		w.keyLen = 0
+	} else if len(w.records) > w.budget() {
+		w.shrink(w.budget())
+	}
+	buf = append(buf, w.records...)
+	buf = append(buf, byte(w.keyLen))
+
+	w.numKeys = 0
+	w.lastKey = w.lastKey[:0]
+	w.unordered = false
+	w.keyLen = maxKeyLen
+	w.records = w.records[:0]
+	return buf
+}
+
+// FilterPolicy implements the RangeFilterPolicy interface from the pebble
+// package.
+//
+// The integer value is the maximum number of bits used per key. A good value
+// is 16, which retains enough of each key to tell apart keys that differ in
+// their first bytes while using twice the space of a 1% Bloom filter at most.
+type FilterPolicy int
+
+var _ base.RangeFilterPolicy = FilterPolicy(0)
+
+// Name implements the pebble.RangeFilterPolicy interface.
+func (p FilterPolicy) Name() string {
+	// The truncation length is encoded in each filter, so the name does not
+	// depend on the number of bits per key.
+	return "pebble.TruncatedKeyRangeFilter"
+}
+
+// MayContainRange implements the pebble.RangeFilterPolicy interface.
+func (p FilterPolicy) MayContainRange(f, lower, upper []byte) bool {
+	return tableFilter(f).MayContainRange(lower, upper)
+}
+
+// NewWriter implements the pebble.RangeFilterPolicy interface.
+func (p FilterPolicy) NewWriter() base.RangeFilterWriter {
+	return newTableFilterWriter(int(p))
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package rangefilter
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/rand"
+)
+
+func newTableFilter(bitsPerKey int, keys ...[]byte) tableFilter {
+	w := FilterPolicy(bitsPerKey).NewWriter()
+	for _, key := range keys {
+		w.AddKey(key)
+	}
+	return tableFilter(w.Finish(nil))
+}
+
+func TestEmptyRangeFilter(t *testing.T) {
+	f := newTableFilter(16)
+	require.False(t, f.MayContainRange(nil, nil))
+	require.False(t, f.MayContainRange([]byte("a"), []byte("z")))
+}
+
+func TestSmallRangeFilter(t *testing.T) {
+	f := newTableFilter(16, []byte("apple"), []byte("banana"), []byte("cherry"))
+	for _, tc := range []struct {
+		lower, upper string
+		want         bool
+	}{
+		{"a", "b", true},
+		{"apple", "apple", true},
+		{"apples", "b", false},
+		{"b", "banana", true},
+		{"bananas", "cherries", false},
+		{"c", "d", true},
+		{"d", "z", false},
+		{"", "a", false},
+	} {
+		require.Equal(t, tc.want, f.MayContainRange([]byte(tc.lower), []byte(tc.upper)),
+			"[%s, %s]", tc.lower, tc.upper)
+	}
+	require.True(t, f.MayContainRange(nil, []byte("apple")))
+	require.False(t, f.MayContainRange(nil, []byte("a")))
+	require.True(t, f.MayContainRange([]byte("cherry"), nil))
+	require.False(t, f.MayContainRange([]byte("d"), nil))
+}
+
+func TestUnorderedRangeFilter(t *testing.T) {
+	f := newTableFilter(16, []byte("b"), []byte("a"))
+	require.True(t, f.MayContainRange([]byte("x"), []byte("y")))
+}
+
+func TestRangeFilterRandomized(t *testing.T) {
+	seed := uint64(rand.Int63())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+	randKey := func() []byte {
+		// Use a small alphabet so that ranges are sometimes non-empty.
+		key := make([]byte, 1+rng.Intn(12))
+		for i := range key {
+			key[i] = byte('a' + rng.Intn(4))
+		}
+		return key
+	}
+
+	for _, bitsPerKey := range []int{1, 4, 16, 64} {
+		for _, numKeys := range []int{1, 10, 100, 1000, 10000} {
+			t.Run(fmt.Sprintf("bitsPerKey=%d/numKeys=%d", bitsPerKey, numKeys), func(t *testing.T) {
+				keys := make([][]byte, numKeys)
+				for i := range keys {
+					keys[i] = randKey()
+				}
+				slices.SortFunc(keys, bytes.Compare)
+				w := FilterPolicy(bitsPerKey).NewWriter()
+				for _, key := range keys {
+					w.AddKey(key)
+				}
+				f := tableFilter(w.Finish(nil))
+				require.LessOrEqual(t, len(f), max(bitsPerKey*numKeys/8, minBudget)+1)
+
+				var negatives int
+				for i := 0; i < 1000; i++ {
+					lower, upper := randKey(), randKey()
+					if bytes.Compare(lower, upper) > 0 {
+						lower, upper = upper, lower
+					}
+					j, _ := slices.BinarySearchFunc(keys, lower, bytes.Compare)
+					contains := j < len(keys) && bytes.Compare(keys[j], upper) <= 0
+					got := f.MayContainRange(lower, upper)
+					if contains && !got {
+						t.Fatalf("false negative for [%s, %s]", lower, upper)
+					}
+					if !got {
+						negatives++
+					}
+				}
+				t.Logf("negatives: %d", negatives)
+			})
+		}
+	}
+}
+
+func TestRangeFilterWriterReuse(t *testing.T) {
+	w := FilterPolicy(16).NewWriter()
+	w.AddKey([]byte("b"))
+	w.AddKey([]byte("a"))
+	require.True(t, tableFilter(w.Finish(nil)).MayContainRange([]byte("x"), []byte("y")))
+
+	w.AddKey([]byte("a"))
+	w.AddKey([]byte("a"))
+	w.AddKey([]byte("b"))
+	f := tableFilter(w.Finish(nil))
+	require.False(t, f.MayContainRange([]byte("x"), []byte("y")))
+	require.True(t, f.MayContainRange([]byte("a"), []byte("a")))
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package record
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression algorithm applied to the records written by
+// a LogWriter.
+//
+// A compressed record is written with the compressed chunk types, and its
+// payload is:
+//
+//	+-----------------+----------------------------+--- ... ---+
+//	| Algorithm (1B)  | Decompressed size (varint) | Data      |
+//	+-----------------+----------------------------+--- ... ---+
+//
+// Readers that don't know the compressed chunk types don't return the
+// compressed records, so a log that contains compressed records must only be
+// read by a version that supports them (for the WAL, this is gated by a format
+// major version).
+type Compression uint8
+
+// The available compression algorithms. The values are part of the wire
+// format and should not be changed.
+const (
+	// NoCompression writes the records uncompressed.
+	NoCompression Compression = iota
+	// SnappyCompression compresses the records with Snappy.
+	SnappyCompression
+	// ZstdCompression compresses the records with Zstandard.
+	ZstdCompression
+)
+
+// String implements fmt.Stringer.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "NoCompression"
+	case SnappyCompression:
+		return "Snappy"
+	case ZstdCompression:
+		return "ZSTD"
+	default:
+		return "Unknown"
+	}
+}
+
+// minCompressedRecordSize is the size below which records are not compressed.
+const minCompressedRecordSize = 64
+
+// zstdEncoder and zstdDecoder are shared by all the writers and readers; their
+// EncodeAll and DecodeAll methods can be used concurrently.
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		e, err := zstd.NewWriter(nil)
+		if err != nil {
+			panic(err)
+		}
+		return e
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		d, err := zstd.NewReader(nil)
+		if err != nil {
+			panic(err)
+		}
+		return d
+	})
+)
+
+// compressRecord appends the compressed payload of p to dst[:0]. It returns
+// false if the compressed payload is not smaller than p, in which case the
+// record should be written uncompressed.
+func compressRecord(c Compression, dst, p []byte) ([]byte, bool) {
+	if c == NoCompression || len(p) < minCompressedRecordSize {
+		return dst, false
+	}
+	dst = append(dst[:0], byte(c))
+	dst = binary.AppendUvarint(dst, uint64(len(p)))
+	switch c {
+	case SnappyCompression:
+		n := len(dst)
+		dst = append(dst, make([]byte, snappy.MaxEncodedLen(len(p)))...)
+		dst = dst[:n+len(snappy.Encode(dst[n:], p))]
+	case ZstdCompression:
+		dst = zstdEncoder().EncodeAll(p, dst)
+	default:
+		return dst, false
+	}
+	return dst, len(dst) < len(p)
+}
+
+// decompressRecord decompresses the payload of a compressed record into
+// dst[:0].
+func decompressRecord(dst, payload []byte) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, ErrInvalidChunk
+	}
+	c := Compression(payload[0])
+	size, n := binary.Uvarint(payload[1:])
+	if n <= 0 || size > 1<<32 {
+		return nil, ErrInvalidChunk
+	}
+	data := payload[1+n:]
+	if cap(dst) < int(size) {
+		dst = make([]byte, size)
+	}
+	dst = dst[:size]
+	var result []byte
+	var err error
+	switch c {
+	case SnappyCompression:
+		result, err = snappy.Decode(dst, data)
+	case ZstdCompression:
+		result, err = zstdDecoder().DecodeAll(data, dst[:0])
+	default:
+		return nil, base.CorruptionErrorf("pebble/record: unknown record compression: %d", errors.Safe(c))
+	}
+	if err != nil {
+		return nil, base.MarkCorruptionError(err)
+	}
+	if len(result) != int(size) {
+		return nil, base.CorruptionErrorf("pebble/record: decompressed record has size %d, expected %d",
+			errors.Safe(len(result)), errors.Safe(size))
+	}
+	return result, nil
+}
@@ -422,6 +422,10 @@ type LogWriter struct {
 	s syncer
 	// logNum is the low 32-bits of the log's file number.
 	logNum uint32
+	// compression is the compression applied to the records.
+	compression Compression
+	// compressBuf holds the compressed payload of the record being written.
+	compressBuf []byte
 	// blockNum is the zero based block number for the current block.
 	blockNum int64
 	// err is any accumulated error. It originates in flusher.err, and is
@@ -453,8 +457,16 @@ type LogWriter struct {
 		err error
 		// minSyncInterval is the minimum duration between syncs.
 		minSyncInterval durationFunc
-		fsyncLatency    prometheus.Histogram
-		pending         []*block
+		// syncDeadline is the time by which the records written with
+		// SyncWithin must be synced, or zero if there are no such records
+		// awaiting a sync.
+		syncDeadline time.Time
+		// syncDeadlineExpired is set by syncDeadlineTimer when syncDeadline
+		// is reached, and forces the flush loop to sync.
+		syncDeadlineExpired bool
+		syncDeadlineTimer   syncTimer
+		fsyncLatency        prometheus.Histogram
+		pending             []*block
 		// Pushing and popping from pendingSyncs does not require flusher mutex to
 		// be held.
 		pendingSyncs pendingSyncs
@@ -466,6 +478,16 @@ type LogWriter struct {
 	// time.AfterFunc.
 	afterFunc func(d time.Duration, f func()) syncTimer
 
+	// nextMarker is the marker of the records written from now on, set by
+	// SetMarker. marker is the marker of the last record fully written, which
+	// is loaded by the flush loop before it picks up the data to sync.
+	// syncedMarker is the last marker reported. See
+	// LogWriterConfig.SyncedMarkerCallback.
+	nextMarker           uint64
+	marker               atomic.Uint64
+	syncedMarker         uint64
+	syncedMarkerCallback func(marker uint64)
+
 	// Backing for both pendingSyncs implementations.
 	pendingSyncsBackingQ     pendingSyncsWithSyncQueue
 	pendingSyncsBackingIndex pendingSyncsWithHighestSyncIndex
@@ -495,6 +517,16 @@ type LogWriterConfig struct {
 	// package) precede the lower layer locks (in the record package). These
 	// callbacks are serialized since they are invoked from the flushLoop.
 	ExternalSyncQueueCallback ExternalSyncQueueCallback
+
+	// Compression is the compression applied to the records. Records that are
+	// small or don't compress well are written uncompressed.
+	Compression Compression
+
+	// SyncedMarkerCallback, if non-nil, is invoked after a successful sync
+	// with the marker of the last record covered by the sync (see
+	// LogWriter.SetMarker), if that marker is non-zero. It is invoked from the
+	// flush loop, so it must not block.
+	SyncedMarkerCallback func(marker uint64)
 }
 
 // ExternalSyncQueueCallback is to be run when a PendingSync has been
@@ -530,7 +562,9 @@ func NewLogWriter(
 		// we are very unlikely to reach a file number of 4 billion and b) the log
 		// number is used as a validation check and using only the low 32-bits is
 		// sufficient for that purpose.
-		logNum: uint32(logNum),
+		logNum:               uint32(logNum),
+		compression:          logWriterConfig.Compression,
+		syncedMarkerCallback: logWriterConfig.SyncedMarkerCallback,
 		afterFunc: func(d time.Duration, f func()) syncTimer {
 			return time.AfterFunc(d, f)
 		},
@@ -578,6 +612,9 @@ func (w *LogWriter) flushLoop(context.Context) {
 		if syncTimer != nil {
 			syncTimer.Stop()
 		}
+		if f.syncDeadlineTimer != nil {
+			f.syncDeadlineTimer.Stop()
+		}
 		close(f.closed)
 		f.Unlock()
 	}()
@@ -628,7 +665,8 @@ func (w *LogWriter) flushLoop(context.Context) {
 			// the current block can be added to the pending blocks list after we release
 			// the flusher lock, but it won't be part of pending.
 			written := w.block.written.Load()
-			if len(f.pending) > 0 || written > w.block.flushed || !f.pendingSyncs.empty() {
+			if len(f.pending) > 0 || written > w.block.flushed || !f.pendingSyncs.empty() ||
+				f.syncDeadlineExpired {
 				break
 			}
 			if f.close {
@@ -666,6 +704,23 @@ func (w *LogWriter) flushLoop(context.Context) {
 		// 0,0 while we're waiting for the min-sync-interval to expire. This
 		// allows flushing to proceed even if we're not ready to sync.
 		snap := f.pendingSyncs.snapshotForPop()
+		// A sync is also forced when the deadline of the records written with
+		// SyncWithin is reached. The min-sync-interval does not apply to such
+		// syncs. Any sync performed here covers the records written with
+		// SyncWithin so far, since their data is picked up below, so the
+		// deadline is cleared.
+		forceSync := f.syncDeadlineExpired
+		if forceSync || !snap.empty() {
+			f.syncDeadline = time.Time{}
+			f.syncDeadlineExpired = false
+			if f.syncDeadlineTimer != nil {
+				f.syncDeadlineTimer.Stop()
+			}
+		}
+
+		// The marker is loaded before the data for the same reason as the sync
+		// waiters below: the record it belongs to must be picked up.
+		marker := w.marker.Load()
 
 		// Grab the portion of the current block that requires flushing. Note that
 		// the current block can be added to the pending blocks list after we
@@ -692,7 +747,7 @@ func (w *LogWriter) flushLoop(context.Context) {
 			f.Lock()
 			continue
 		}
-		synced, syncLatency, bytesWritten, err := w.flushPending(data, pending, snap)
+		synced, syncLatency, bytesWritten, err := w.flushPending(data, pending, snap, forceSync, marker)
 		f.Lock()
 		if synced && f.fsyncLatency != nil {
 			f.fsyncLatency.Observe(float64(syncLatency))
@@ -732,7 +787,7 @@ func (w *LogWriter) flushLoop(context.Context) {
 }
 
 func (w *LogWriter) flushPending(
-	data []byte, pending []*block, snap pendingSyncsSnapshot,
+	data []byte, pending []*block, snap pendingSyncsSnapshot, forceSync bool, marker uint64,
 ) (synced bool, syncLatency time.Duration, bytesWritten int64, err error) {
 	defer func() {
 		// Translate panics into errors. The errors will cause flushLoop to shut
@@ -755,13 +810,18 @@ func (w *LogWriter) flushPending(
 		_, err = w.w.Write(data)
 	}
 
-	synced = !snap.empty()
+	synced = !snap.empty() || forceSync
 	if synced {
 		if err == nil && w.s != nil {
 			syncLatency, err = w.syncWithLatency()
 		} else {
 			synced = false
 		}
+		if synced && err == nil {
+			// Report the marker before the waiters are released, so that they
+			// observe it.
+			w.reportSyncedMarker(marker)
+		}
 		f := &w.flusher
 		if popErr := f.pendingSyncs.pop(snap, err); popErr != nil {
 			return synced, syncLatency, bytesWritten, firstError(err, popErr)
@@ -771,6 +831,16 @@ func (w *LogWriter) flushPending(
 	return synced, syncLatency, bytesWritten, err
 }
 
+// reportSyncedMarker invokes the SyncedMarkerCallback with the marker of the
+// last record synced, if it was not already reported. It is only called from
+// the flush loop, or by Close after the flush loop terminated.
+func (w *LogWriter) reportSyncedMarker(marker uint64) {
+	if marker > w.syncedMarker && w.syncedMarkerCallback != nil {
+		w.syncedMarker = marker
+		w.syncedMarkerCallback(marker)
+	}
+}
+
 func (w *LogWriter) syncWithLatency() (time.Duration, error) {
 	start := time.Now()
 	err := w.s.Sync()
@@ -859,6 +929,10 @@ func (w *LogWriter) closeInternal(lastQueuedRecord PendingSyncIndex) error {
 	free := w.free.blocks
 	f.Unlock()
 
+	if err == nil && w.s != nil {
+		w.reportSyncedMarker(w.marker.Load())
+	}
+
 	// NB: the caller of closeInternal may not care about a non-nil cerr below
 	// if all queued writes have been successfully written and synced.
 	if lastQueuedRecord.Index != NoSyncIndex {
@@ -923,8 +997,20 @@ func (w *LogWriter) SyncRecordGeneralized(p []byte, ps PendingSync) (logSize int
 	// possibly be generated for VersionEdits stored in the MANIFEST. While the
 	// MANIFEST is currently written using Writer, it is good to support the same
 	// semantics with LogWriter.
+	var compressed bool
+	if w.compression != NoCompression {
+		w.compressBuf, compressed = compressRecord(w.compression, w.compressBuf, p)
+		if compressed {
+			p = w.compressBuf
+		}
+	}
 	for i := 0; i == 0 || len(p) > 0; i++ {
-		p = w.emitFragment(i, p)
+		p = w.emitFragment(i, p, compressed)
+	}
+	if w.nextMarker != 0 {
+		// The record is fully written, so the flush loop picks it up if it
+		// observes the marker.
+		w.marker.Store(w.nextMarker)
 	}
 
 	if ps.syncRequested() {
@@ -946,6 +1032,51 @@ func (w *LogWriter) SyncRecordGeneralized(p []byte, ps PendingSync) (logSize int
 	return offset, nil
 }
 
+// SyncWithin requests that the records written so far be synced within d,
+// without waiting for the sync. The sync is shared with any sync that happens
+// before the deadline, so that the records of concurrent writers which accept
+// a bounded delay are synced together.
+// External synchronisation provided by commitPipeline.mu.
+func (w *LogWriter) SyncWithin(d time.Duration) {
+	f := &w.flusher
+	f.Lock()
+	defer f.Unlock()
+	deadline := time.Now().Add(d)
+	if !f.syncDeadline.IsZero() && !deadline.Before(f.syncDeadline) {
+		// A sync is already due no later than the requested deadline.
+		return
+	}
+	f.syncDeadline = deadline
+	if d <= 0 {
+		f.syncDeadlineExpired = true
+		f.ready.Signal()
+		return
+	}
+	if f.syncDeadlineTimer == nil {
+		f.syncDeadlineTimer = w.afterFunc(d, func() {
+			f.Lock()
+			// The deadline may have been cleared by a sync that raced with
+			// the timer firing.
+			if !f.syncDeadline.IsZero() {
+				f.syncDeadlineExpired = true
+				f.ready.Signal()
+			}
+			f.Unlock()
+		})
+	} else {
+		f.syncDeadlineTimer.Reset(d)
+	}
+}
+
+// SetMarker sets the marker of the records written from now on. A marker is a
+// caller-defined value that must not decrease across records, such as the
+// sequence number following the batch a record contains. When a sync covers
+// a record, its marker is reported to LogWriterConfig.SyncedMarkerCallback.
+// External synchronisation provided by commitPipeline.mu.
+func (w *LogWriter) SetMarker(marker uint64) {
+	w.nextMarker = marker
+}
+
 // Size returns the current size of the file.
 // External synchronisation provided by commitPipeline.mu.
 func (w *LogWriter) Size() int64 {
@@ -964,25 +1095,30 @@ func (w *LogWriter) emitEOFTrailer() {
 	b.written.Store(i + int32(recyclableHeaderSize))
 }
 
-func (w *LogWriter) emitFragment(n int, p []byte) (remainingP []byte) {
+func (w *LogWriter) emitFragment(n int, p []byte, compressed bool) (remainingP []byte) {
 	b := w.block
 	i := b.written.Load()
 	first := n == 0
 	last := blockSize-i-recyclableHeaderSize >= int32(len(p))
 
+	var chunkType byte
 	if last {
 		if first {
-			b.buf[i+6] = recyclableFullChunkType
+			chunkType = recyclableFullChunkType
 		} else {
-			b.buf[i+6] = recyclableLastChunkType
+			chunkType = recyclableLastChunkType
 		}
 	} else {
 		if first {
-			b.buf[i+6] = recyclableFirstChunkType
+			chunkType = recyclableFirstChunkType
 		} else {
-			b.buf[i+6] = recyclableMiddleChunkType
+			chunkType = recyclableMiddleChunkType
 		}
 	}
+	if compressed {
+		chunkType += compressedFullChunkType - recyclableFullChunkType
+	}
+	b.buf[i+6] = chunkType
 
 	binary.LittleEndian.PutUint32(b.buf[i+7:i+11], w.logNum)
 
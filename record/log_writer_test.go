@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"slices"
 	"sort"
 	"sync"
 	"sync/atomic"
@@ -366,6 +367,119 @@ func TestMinSyncIntervalClose(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSyncWithin(t *testing.T) {
+	const syncWithin = 100 * time.Millisecond
+
+	f := &syncFile{}
+	w := NewLogWriter(f, 0, LogWriterConfig{
+		WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+	})
+
+	var timer fakeTimer
+	var timers int
+	w.afterFunc = func(d time.Duration, f func()) syncTimer {
+		if d != syncWithin {
+			t.Fatalf("expected sync deadline %s, but found %s", syncWithin, d)
+		}
+		timers++
+		timer.f = f
+		return &timer
+	}
+
+	// Write a bunch of records with a sync deadline. They are written, but not
+	// synced until the deadline is reached, and share a single timer.
+	for i := 0; i < 10; i++ {
+		_, err := w.WriteRecord(bytes.Repeat([]byte{'a'}, 10000))
+		require.NoError(t, err)
+		w.SyncWithin(syncWithin)
+	}
+	require.Equal(t, 1, timers)
+	err := try(time.Millisecond, 5*time.Second, func() error {
+		if v := f.writePos.Load(); v != w.Size() {
+			return errors.Errorf("expected writePos %d, but found %d", w.Size(), v)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), f.syncPos.Load())
+
+	// Fire the timer, and wait for the records to be synced.
+	timer.f()
+	err = try(time.Millisecond, 5*time.Second, func() error {
+		if v := f.syncPos.Load(); v != w.Size() {
+			return errors.Errorf("expected syncPos %d, but found %d", w.Size(), v)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// A sync requested by SyncRecord also satisfies the deadline.
+	_, err = w.WriteRecord([]byte("hello"))
+	require.NoError(t, err)
+	w.SyncWithin(syncWithin)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	offset, err := w.SyncRecord([]byte("world"), &wg, new(error))
+	require.NoError(t, err)
+	wg.Wait()
+	require.Equal(t, offset, f.syncPos.Load())
+	w.flusher.Lock()
+	require.True(t, w.flusher.syncDeadline.IsZero())
+	require.False(t, w.flusher.syncDeadlineExpired)
+	w.flusher.Unlock()
+
+	// A deadline that has already passed forces an immediate sync.
+	offset, err = w.WriteRecord([]byte("hello"))
+	require.NoError(t, err)
+	w.SyncWithin(0)
+	err = try(time.Millisecond, 5*time.Second, func() error {
+		if v := f.syncPos.Load(); v != offset {
+			return errors.Errorf("expected syncPos %d, but found %d", offset, v)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func TestSyncedMarker(t *testing.T) {
+	f := &syncFile{}
+	var mu sync.Mutex
+	var markers []uint64
+	w := NewLogWriter(f, 0, LogWriterConfig{
+		WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		SyncedMarkerCallback: func(marker uint64) {
+			mu.Lock()
+			defer mu.Unlock()
+			markers = append(markers, marker)
+		},
+	})
+	syncedMarkers := func() []uint64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(markers)
+	}
+
+	// A record without a sync is not reported until a later sync covers it.
+	w.SetMarker(1)
+	_, err := w.WriteRecord([]byte("hello"))
+	require.NoError(t, err)
+	w.SetMarker(2)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	_, err = w.SyncRecord([]byte("world"), &wg, new(error))
+	require.NoError(t, err)
+	wg.Wait()
+	require.Equal(t, []uint64{2}, syncedMarkers())
+
+	// The records written before the close are reported by the close.
+	w.SetMarker(3)
+	_, err = w.WriteRecord([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, []uint64{2, 3}, syncedMarkers())
+}
+
 type syncFileWithWait struct {
 	f       syncFile
 	writeWG sync.WaitGroup
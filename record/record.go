@@ -94,6 +94,11 @@
 // (i.e. full, first, middle, last). The CRC is computed over the type, log
 // number, and payload.
 //
+// A record compressed by a LogWriter (see Compression) uses recyclable chunks
+// with 4 other "compressed" chunk types, which also map directly to the legacy
+// chunk types. The payload of the record is the compressed record, which the
+// Reader transparently decompresses.
+//
 // The wire format allows for limited recovery in the face of data corruption:
 // on a format error (such as a checksum mismatch), the reader moves to the
 // next block and looks for the next full or first chunk.
@@ -124,6 +129,11 @@ const (
 	recyclableFirstChunkType  = 6
 	recyclableMiddleChunkType = 7
 	recyclableLastChunkType   = 8
+
+	compressedFullChunkType   = 9
+	compressedFirstChunkType  = 10
+	compressedMiddleChunkType = 11
+	compressedLastChunkType   = 12
 )
 
 const (
@@ -178,8 +188,19 @@ type Reader struct {
 	recovering bool
 	// last is whether the current chunk is the last chunk of the record.
 	last bool
+	// compressed is whether the current record is compressed, and
+	// chunkCompressed whether the current chunk is. The chunks of a record are
+	// all compressed or all uncompressed.
+	compressed      bool
+	chunkCompressed bool
 	// err is any accumulated error.
 	err error
+	// compressedBuf holds the payload of the current record if it is
+	// compressed, and decompressed[decompressedOffset:] is the unread portion of
+	// the decompressed record.
+	compressedBuf      []byte
+	decompressed       []byte
+	decompressedOffset int
 	// buf is the buffer.
 	buf [blockSize]byte
 }
@@ -215,16 +236,17 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					// Skip the rest of the block, if it looks like it is all
 					// zeroes. This is common with WAL preallocation.
 					//
-					// Set r.err to be an error so r.recover actually recovers.
+					// Set r.err to be an error so r.Recover actually recovers.
 					r.err = ErrZeroedChunk
-					r.recover()
+					r.Recover()
 					continue
 				}
 				return ErrZeroedChunk
 			}
 
 			headerSize := legacyHeaderSize
-			if chunkType >= recyclableFullChunkType && chunkType <= recyclableLastChunkType {
+			compressed := chunkType >= compressedFullChunkType && chunkType <= compressedLastChunkType
+			if compressed || (chunkType >= recyclableFullChunkType && chunkType <= recyclableLastChunkType) {
 				headerSize = recyclableHeaderSize
 				if r.end+headerSize > r.n {
 					return ErrInvalidChunk
@@ -242,7 +264,11 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					return ErrInvalidChunk
 				}
 
-				chunkType -= (recyclableFullChunkType - 1)
+				if compressed {
+					chunkType -= (compressedFullChunkType - 1)
+				} else {
+					chunkType -= (recyclableFullChunkType - 1)
+				}
 			}
 
 			r.begin = r.end + headerSize
@@ -250,14 +276,14 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 			if r.end > r.n {
 				// The chunk straddles a 32KB boundary (or the end of file).
 				if r.recovering {
-					r.recover()
+					r.Recover()
 					continue
 				}
 				return ErrInvalidChunk
 			}
 			if checksum != crc.New(r.buf[r.begin-headerSize+6:r.end]).Value() {
 				if r.recovering {
-					r.recover()
+					r.Recover()
 					continue
 				}
 				return ErrInvalidChunk
@@ -267,6 +293,7 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					continue
 				}
 			}
+			r.chunkCompressed = compressed
 			r.last = chunkType == fullChunkType || chunkType == lastChunkType
 			r.recovering = false
 			return nil
@@ -305,9 +332,39 @@ func (r *Reader) Next() (io.Reader, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
+	r.compressed = r.chunkCompressed
+	if r.compressed {
+		return r.decompressRecord()
+	}
 	return singleReader{r, r.seq}, nil
 }
 
+// decompressRecord reads and decompresses the current record, which is
+// compressed.
+func (r *Reader) decompressRecord() (io.Reader, error) {
+	r.compressedBuf = r.compressedBuf[:0]
+	for {
+		r.compressedBuf = append(r.compressedBuf, r.buf[r.begin:r.end]...)
+		r.begin = r.end
+		if r.last {
+			break
+		}
+		if r.err = r.nextChunk(false); r.err != nil {
+			return nil, r.err
+		}
+		if !r.chunkCompressed {
+			r.err = ErrInvalidChunk
+			return nil, r.err
+		}
+	}
+	r.decompressed, r.err = decompressRecord(r.decompressed, r.compressedBuf)
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.decompressedOffset = 0
+	return decompressedReader{r, r.seq}, nil
+}
+
 // Offset returns the current offset within the file. If called immediately
 // before a call to Next(), Offset() will return the record offset.
 func (r *Reader) Offset() int64 {
@@ -317,12 +374,12 @@ func (r *Reader) Offset() int64 {
 	return int64(r.blockNum)*blockSize + int64(r.end)
 }
 
-// recover clears any errors read so far, so that calling Next will start
+// Recover clears any errors read so far, so that calling Next will start
 // reading from the next good 32KiB block. If there are no such blocks, Next
-// will return io.EOF. recover also marks the current reader, the one most
-// recently returned by Next, as stale. If recover is called without any
+// will return io.EOF. Recover also marks the current reader, the one most
+// recently returned by Next, as stale. If Recover is called without any
 // prior error, then recover is a no-op.
-func (r *Reader) recover() {
+func (r *Reader) Recover() {
 	if r.err == nil {
 		return
 	}
@@ -403,12 +460,36 @@ func (x singleReader) Read(p []byte) (int, error) {
 		if r.err = r.nextChunk(false); r.err != nil {
 			return 0, r.err
 		}
+		if r.chunkCompressed {
+			r.err = ErrInvalidChunk
+			return 0, r.err
+		}
 	}
 	n := copy(p, r.buf[r.begin:r.end])
 	r.begin += n
 	return n, nil
 }
 
+// decompressedReader reads a compressed record, which was decompressed by
+// Reader.Next.
+type decompressedReader struct {
+	r   *Reader
+	seq int
+}
+
+func (x decompressedReader) Read(p []byte) (int, error) {
+	r := x.r
+	if r.seq != x.seq {
+		return 0, errors.New("pebble/record: stale reader")
+	}
+	if r.decompressedOffset == len(r.decompressed) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.decompressed[r.decompressedOffset:])
+	r.decompressedOffset += n
+	return n, nil
+}
+
 // Writer writes records to an underlying io.Writer.
 type Writer struct {
 	// w is the underlying writer.
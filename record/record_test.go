@@ -16,6 +16,7 @@ import (
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
@@ -375,7 +376,7 @@ func TestRecoverNoOp(t *testing.T) {
 	seq, begin, end, n := r.seq, r.begin, r.end, r.n
 
 	// Should be a no-op since r.err == nil.
-	r.recover()
+	r.Recover()
 
 	// r.err was nil, nothing should have changed.
 	if seq != r.seq || begin != r.begin || end != r.end || n != r.n {
@@ -422,7 +423,7 @@ func TestBasicRecover(t *testing.T) {
 	}
 
 	// Recover from that checksum mismatch.
-	r.recover()
+	r.Recover()
 	currentOffset, err := underlyingReader.Seek(0, io.SeekCurrent)
 	if err != nil {
 		t.Fatalf("current offset: %v", err)
@@ -479,7 +480,7 @@ func TestRecoverSingleBlock(t *testing.T) {
 	}
 
 	// Recover from that checksum mismatch.
-	r.recover()
+	r.Recover()
 
 	// All of the data in the second record r1 is lost because the first record
 	// r0 shared a partial block with it. The second record also overlapped
@@ -537,7 +538,7 @@ func TestRecoverMultipleBlocks(t *testing.T) {
 	}
 
 	// Recover from that checksum mismatch.
-	r.recover()
+	r.Recover()
 
 	// All of the data in the second record is lost because the first
 	// record shared a partial block with it. The following two records
@@ -567,7 +568,7 @@ func verifyLastBlockRecover(recs *testRecords) error {
 			if err == nil {
 				return errors.New("Expected a checksum mismatch error, got nil")
 			}
-			r.recover()
+			r.Recover()
 		case len(recs.records):
 			if err != io.EOF {
 				return errors.Errorf("Expected io.EOF, got %v", err)
@@ -698,7 +699,7 @@ func TestSeekRecord(t *testing.T) {
 	if _, err = r.Next(); err == nil {
 		t.Fatalf("Expected an error seeking to an invalid chunk boundary")
 	}
-	r.recover()
+	r.Recover()
 
 	// Seek to the fifth block and verify all records can be read as appropriate.
 	err = r.seekRecord(blockSize * 4)
@@ -736,7 +737,7 @@ func TestSeekRecord(t *testing.T) {
 	if err != io.ErrUnexpectedEOF {
 		t.Fatalf("Seeking past EOF raised unexpected error: %v", err)
 	}
-	r.recover() // Verify recovery works.
+	r.Recover() // Verify recovery works.
 
 	// Validate the current records are returned after seeking to a valid offset.
 	err = r.seekRecord(blockSize * 4)
@@ -1062,3 +1063,93 @@ func BenchmarkRecordWrite(b *testing.B) {
 		})
 	}
 }
+
+func TestCompressedRecords(t *testing.T) {
+	for _, c := range []Compression{SnappyCompression, ZstdCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+			randBytes := func(n int) []byte {
+				b := make([]byte, n)
+				for i := range b {
+					b[i] = byte(rnd.Uint32())
+				}
+				return b
+			}
+			records := [][]byte{
+				// Too small to be compressed.
+				[]byte("hello"),
+				// Compressible.
+				[]byte(big("compressible", 1000)),
+				// Spans several blocks, even once compressed.
+				append([]byte(big("abcd", 3*blockSize)), randBytes(2*blockSize)...),
+				// Incompressible.
+				randBytes(1000),
+				[]byte(big("world", 100)),
+			}
+
+			var buf bytes.Buffer
+			w := NewLogWriter(&buf, base.DiskFileNum(1), LogWriterConfig{
+				WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+				Compression:     c,
+			})
+			var uncompressedSize int
+			for _, rec := range records {
+				_, err := w.WriteRecord(rec)
+				require.NoError(t, err)
+				uncompressedSize += len(rec)
+			}
+			require.NoError(t, w.Close())
+			require.Less(t, buf.Len(), uncompressedSize)
+
+			r := NewReader(bytes.NewReader(buf.Bytes()), base.DiskFileNum(1))
+			for i, rec := range records {
+				offset := r.Offset()
+				rr, err := r.Next()
+				require.NoError(t, err)
+				got, err := io.ReadAll(rr)
+				require.NoError(t, err)
+				require.Equal(t, rec, got, "record %d", i)
+
+				// Seeking to the offset of the record returns it again.
+				r2 := NewReader(bytes.NewReader(buf.Bytes()), base.DiskFileNum(1))
+				require.NoError(t, r2.seekRecord(offset))
+				rr, err = r2.Next()
+				require.NoError(t, err)
+				got, err = io.ReadAll(rr)
+				require.NoError(t, err)
+				require.Equal(t, rec, got, "record %d", i)
+			}
+			_, err := r.Next()
+			require.Equal(t, io.EOF, err)
+
+			// A reader for another log doesn't return the records.
+			r = NewReader(bytes.NewReader(buf.Bytes()), base.DiskFileNum(2))
+			_, err = r.Next()
+			require.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+func TestCompressedRecordCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLogWriter(&buf, base.DiskFileNum(1), LogWriterConfig{
+		WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		Compression:     SnappyCompression,
+	})
+	_, err := w.WriteRecord([]byte(big("compressible", 1000)))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// Corrupt the algorithm of the compressed payload, and fix up the
+	// checksum of the chunk.
+	b := buf.Bytes()
+	require.Equal(t, byte(compressedFullChunkType), b[6])
+	b[recyclableHeaderSize] = 0xff
+	length := int(binary.LittleEndian.Uint16(b[4:6]))
+	binary.LittleEndian.PutUint32(b[0:4], crc.New(b[6:recyclableHeaderSize+length]).Value())
+
+	r := NewReader(bytes.NewReader(b), base.DiskFileNum(1))
+	_, err = r.Next()
+	require.Error(t, err)
+	require.True(t, errors.Is(err, base.ErrCorruption), "%v", err)
+}
@@ -0,0 +1,566 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/remoteobjcat"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/record"
+)
+
+// replicaManifestVersion is the version of the encoding of the objects written
+// by PublishReplicaManifest.
+const replicaManifestVersion = 1
+
+// PublishReplicaManifest writes a snapshot of the current version of the LSM
+// to the object objName in the remote storage with the given locator, from
+// which replicas opened with OpenReplica refresh. It must be called
+// periodically (e.g. after flushes and compactions) for the replicas to
+// observe new data; each call overwrites the previous snapshot.
+//
+// All the tables must be on remote storage (see
+// Options.Experimental.CreateOnShared), and the creator ID must be set. Data
+// that has not been flushed is not published.
+func (d *DB) PublishReplicaManifest(locator remote.Locator, objName string) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.Experimental.RemoteStorage == nil {
+		return errors.New("pebble: remote storage is not configured")
+	}
+
+	readState := d.loadReadState()
+	defer readState.unref()
+	current := readState.current
+
+	d.mu.Lock()
+	// The version was loaded first, so these are upper bounds on the file
+	// numbers and sequence numbers it contains.
+	ve := versionEdit{
+		ComparerName: d.opts.Comparer.Name,
+		NextFileNum:  d.mu.versions.nextFileNum,
+		LastSeqNum:   d.mu.versions.logSeqNum.Load() - 1,
+	}
+	formatVers := d.FormatMajorVersion()
+	d.mu.Unlock()
+
+	// The backings are protected from deletion by the handles until the
+	// snapshot is written; after that, the replicas verify that the objects are
+	// still referenced when they attach them.
+	backings := make(map[base.DiskFileNum]objstorage.RemoteObjectBacking)
+	var handles []objstorage.RemoteObjectBackingHandle
+	defer func() {
+		for _, h := range handles {
+			h.Close()
+		}
+	}()
+	for level := range current.Levels {
+		iter := current.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: level, Meta: f})
+			n := f.FileBacking.DiskFileNum
+			if _, ok := backings[n]; ok {
+				continue
+			}
+			if f.Virtual {
+				ve.CreatedBackingTables = append(ve.CreatedBackingTables, f.FileBacking)
+			}
+			meta, err := d.objProvider.Lookup(fileTypeTable, n)
+			if err != nil {
+				return err
+			}
+			if !meta.IsRemote() {
+				return errors.Errorf("pebble: table %s is not on remote storage", n)
+			}
+			h, err := d.objProvider.RemoteObjectBacking(&meta)
+			if err != nil {
+				return err
+			}
+			handles = append(handles, h)
+			if backings[n], err = h.Get(); err != nil {
+				return err
+			}
+		}
+	}
+
+	buf, err := encodeReplicaManifest(formatVers, &ve, backings)
+	if err != nil {
+		return err
+	}
+	storage, err := d.opts.Experimental.RemoteStorage.CreateStorage(locator)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	w, err := storage.CreateObject(objName)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return errors.CombineErrors(err, w.Close())
+}
+
+// encodeReplicaManifest encodes a snapshot published by PublishReplicaManifest.
+// The snapshot is a sequence of records (as in a MANIFEST): a header with the
+// encoding version and the format major version, the version edit that
+// creates the version, and the remote object backings of the tables.
+func encodeReplicaManifest(
+	formatVers FormatMajorVersion,
+	ve *versionEdit,
+	backings map[base.DiskFileNum]objstorage.RemoteObjectBacking,
+) ([]byte, error) {
+	var buf bytes.Buffer
+	w := record.NewWriter(&buf)
+	writeRecord := func(fn func(w io.Writer) error) error {
+		rw, err := w.Next()
+		if err != nil {
+			return err
+		}
+		return fn(rw)
+	}
+
+	if err := writeRecord(func(rw io.Writer) error {
+		b := binary.AppendUvarint(nil, replicaManifestVersion)
+		b = binary.AppendUvarint(b, uint64(formatVers))
+		_, err := rw.Write(b)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := writeRecord(ve.Encode); err != nil {
+		return nil, err
+	}
+	if err := writeRecord(func(rw io.Writer) error {
+		nums := make([]base.DiskFileNum, 0, len(backings))
+		for n := range backings {
+			nums = append(nums, n)
+		}
+		slices.Sort(nums)
+		b := binary.AppendUvarint(nil, uint64(len(nums)))
+		for _, n := range nums {
+			b = binary.AppendUvarint(b, uint64(n))
+			b = binary.AppendUvarint(b, uint64(len(backings[n])))
+			b = append(b, backings[n]...)
+		}
+		_, err := rw.Write(b)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// replicaManifest is a decoded snapshot published by PublishReplicaManifest.
+type replicaManifest struct {
+	formatVers FormatMajorVersion
+	ve         versionEdit
+	backings   map[base.DiskFileNum]objstorage.RemoteObjectBacking
+}
+
+func decodeReplicaManifest(buf []byte) (replicaManifest, error) {
+	var m replicaManifest
+	r := record.NewReader(bytes.NewReader(buf), 0 /* logNum */)
+	readRecord := func() ([]byte, error) {
+		rr, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(rr)
+	}
+	corrupt := func() (replicaManifest, error) {
+		return replicaManifest{}, base.CorruptionErrorf("pebble: corrupt replica manifest")
+	}
+
+	header, err := readRecord()
+	if err != nil {
+		return replicaManifest{}, err
+	}
+	version, n := binary.Uvarint(header)
+	if n <= 0 {
+		return corrupt()
+	}
+	if version != replicaManifestVersion {
+		return replicaManifest{}, errors.Errorf("pebble: unsupported replica manifest version %d", version)
+	}
+	formatVers, n2 := binary.Uvarint(header[n:])
+	if n2 <= 0 {
+		return corrupt()
+	}
+	m.formatVers = FormatMajorVersion(formatVers)
+
+	rr, err := r.Next()
+	if err != nil {
+		return replicaManifest{}, err
+	}
+	if err := m.ve.Decode(rr); err != nil {
+		return replicaManifest{}, err
+	}
+
+	b, err := readRecord()
+	if err != nil {
+		return replicaManifest{}, err
+	}
+	count, n := binary.Uvarint(b)
+	if n <= 0 {
+		return corrupt()
+	}
+	b = b[n:]
+	m.backings = make(map[base.DiskFileNum]objstorage.RemoteObjectBacking, count)
+	for i := uint64(0); i < count; i++ {
+		fileNum, n1 := binary.Uvarint(b)
+		if n1 <= 0 {
+			return corrupt()
+		}
+		length, n2 := binary.Uvarint(b[n1:])
+		if n2 <= 0 || uint64(len(b)-n1-n2) < length {
+			return corrupt()
+		}
+		b = b[n1+n2:]
+		m.backings[base.DiskFileNum(fileNum)] = objstorage.RemoteObjectBacking(b[:length])
+		b = b[length:]
+	}
+	return m, nil
+}
+
+// ReplicaOptions configures a replica opened with OpenReplica.
+type ReplicaOptions struct {
+	// Locator and ObjName identify the object to which the writer publishes its
+	// MANIFEST (see DB.PublishReplicaManifest).
+	Locator remote.Locator
+	ObjName string
+	// CreatorID identifies the replica in the remote storage. The replica
+	// creates ref markers with this ID for the objects it uses, which prevents
+	// the writer from deleting them while the replica can read them. It must be
+	// unique among all the stores that share the remote storage, and must not
+	// change when the replica is reopened.
+	CreatorID uint64
+	// RefreshInterval, if non-zero, is the interval at which the replica is
+	// refreshed in the background. Refresh errors are logged. The replica can
+	// also be refreshed explicitly with DB.RefreshReplica.
+	RefreshInterval time.Duration
+}
+
+// replicaState is the state of a DB opened with OpenReplica.
+type replicaState struct {
+	opts    ReplicaOptions
+	storage remote.Storage
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	// mu serializes the refreshes, and the refreshes with close.
+	mu struct {
+		sync.Mutex
+		closed bool
+		// nextFileNum is the NextFileNum of the last applied snapshot. Older
+		// snapshots (which can be observed with eventually consistent storage)
+		// are ignored.
+		nextFileNum uint64
+	}
+}
+
+// OpenReplica opens a read-only replica of a DB whose tables live in remote
+// storage, from the MANIFEST published by the writer with
+// DB.PublishReplicaManifest. The replica reads the tables directly from the
+// remote storage (through the secondary cache, if configured; see
+// Options.Experimental.SecondaryCacheSizeBytes), and observes the writer's new
+// data when it is refreshed (see DB.RefreshReplica and
+// ReplicaOptions.RefreshInterval).
+//
+// The directory contains the replica's own small local state: an empty MANIFEST
+// and its remote object catalog, which hold its creator ID. It is created if it
+// does not exist, and can be reused across restarts; apart from its creation,
+// the replica never writes to it, as refreshes are only applied in memory. The options must
+// configure the remote storage, and must have the writer's comparer.
+func OpenReplica(dirname string, opts *Options, replicaOpts ReplicaOptions) (*DB, error) {
+	if opts == nil || opts.Experimental.RemoteStorage == nil {
+		return nil, errors.New("pebble: remote storage is not configured")
+	}
+	if replicaOpts.CreatorID == 0 {
+		return nil, errors.New("pebble: replica creator ID is not set")
+	}
+	opts = opts.Clone().EnsureDefaults()
+	if err := bootstrapReplica(dirname, opts, objstorage.CreatorID(replicaOpts.CreatorID)); err != nil {
+		return nil, errors.Wrapf(err, "pebble: creating replica at %q", dirname)
+	}
+	opts.ReadOnly = true
+	d, err := Open(dirname, opts)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := opts.Experimental.RemoteStorage.CreateStorage(replicaOpts.Locator)
+	if err != nil {
+		return nil, errors.CombineErrors(err, d.Close())
+	}
+	d.replica = &replicaState{
+		opts:    replicaOpts,
+		storage: storage,
+		stopCh:  make(chan struct{}),
+	}
+	if err := d.RefreshReplica(); err != nil {
+		return nil, errors.CombineErrors(err, d.Close())
+	}
+	if replicaOpts.RefreshInterval > 0 {
+		d.replica.wg.Add(1)
+		go d.replica.refreshLoop(d)
+	}
+	return d, nil
+}
+
+// bootstrapReplica creates an empty store with the replica's creator ID in
+// dirname, unless it already exists.
+func bootstrapReplica(dirname string, opts *Options, creatorID objstorage.CreatorID) error {
+	desc, err := Peek(dirname, opts.FS)
+	if err != nil && !oserror.IsNotExist(err) {
+		return err
+	}
+	if desc != nil && desc.Exists {
+		contents, err := remoteobjcat.ReadContents(opts.FS, dirname)
+		if err != nil {
+			return err
+		}
+		if contents.CreatorID == creatorID {
+			return nil
+		}
+		if contents.CreatorID.IsSet() {
+			return errors.Errorf("replica has creator ID %s, not %s", contents.CreatorID, creatorID)
+		}
+	}
+	o := opts.Clone()
+	o.ReadOnly = false
+	d, err := Open(dirname, o)
+	if err != nil {
+		return err
+	}
+	return errors.CombineErrors(d.SetCreatorID(uint64(creatorID)), d.Close())
+}
+
+func (r *replicaState) refreshLoop(d *DB) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.opts.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			if err := d.RefreshReplica(); err != nil {
+				d.opts.Logger.Errorf("pebble: refreshing replica: %s", err)
+			}
+		}
+	}
+}
+
+// close stops the background refreshes and waits for the refresh in progress,
+// if any.
+func (r *replicaState) close() error {
+	r.stopOnce.Do(func() { close(r.stopCh) })
+	r.wg.Wait()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mu.closed {
+		return nil
+	}
+	r.mu.closed = true
+	return r.storage.Close()
+}
+
+// RefreshReplica refreshes a replica opened with OpenReplica to the latest
+// MANIFEST published by the writer. The new version is installed atomically:
+// existing iterators are unaffected, and new ones observe the refreshed data.
+// The tables that are no longer used by the writer are released once they are
+// no longer used by the replica.
+//
+// The new version is only installed in memory: the refresh never writes to or
+// deletes from the replica's directory. Snapshots of a replica survive
+// refreshes, by reading the version that was current when they were created.
+//
+// RefreshReplica returns ErrClosed if the replica is closed.
+func (d *DB) RefreshReplica() error {
+	r := d.replica
+	if r == nil {
+		return errors.New("pebble: not a replica")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mu.closed {
+		return errors.WithStack(ErrClosed)
+	}
+
+	m, err := readReplicaManifest(r.storage, r.opts.ObjName)
+	if err != nil {
+		return errors.Wrapf(err, "pebble: reading replica manifest %q", errors.Safe(r.opts.ObjName))
+	}
+	if m.ve.ComparerName != d.opts.Comparer.Name {
+		return errors.Errorf("pebble: replica manifest comparer name %q != comparer name from Options %q",
+			errors.Safe(m.ve.ComparerName), errors.Safe(d.opts.Comparer.Name))
+	}
+	if m.formatVers > d.FormatMajorVersion() {
+		return errors.Errorf("pebble: writer's format major version %s is newer than the replica's %s",
+			m.formatVers, d.FormatMajorVersion())
+	}
+	if m.ve.NextFileNum < r.mu.nextFileNum {
+		// The snapshot is older than the one we applied.
+		return nil
+	}
+
+	// Attach the objects that the replica does not know about yet. This creates
+	// the replica's ref markers, and verifies that the writer still references
+	// the objects. The remote object catalog is not synced, as the replica
+	// doesn't write to its directory: the objects are only known in memory.
+	var toAttach []objstorage.RemoteObjectToAttach
+	for n, backing := range m.backings {
+		if _, err := d.objProvider.Lookup(fileTypeTable, n); err == nil {
+			continue
+		}
+		toAttach = append(toAttach, objstorage.RemoteObjectToAttach{
+			FileNum:  n,
+			FileType: fileTypeTable,
+			Backing:  backing,
+		})
+	}
+	if len(toAttach) > 0 {
+		slices.SortFunc(toAttach, func(a, b objstorage.RemoteObjectToAttach) int {
+			return cmp.Compare(a.FileNum, b.FileNum)
+		})
+		if _, err := d.objProvider.AttachRemoteObjects(toAttach); err != nil {
+			return err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.applyReplicaManifestLocked(&m); err != nil {
+		return err
+	}
+	r.mu.nextFileNum = m.ve.NextFileNum
+	return nil
+}
+
+func readReplicaManifest(storage remote.Storage, objName string) (replicaManifest, error) {
+	ctx := context.Background()
+	reader, size, err := storage.ReadObject(ctx, objName)
+	if err != nil {
+		return replicaManifest{}, err
+	}
+	defer reader.Close()
+	buf := make([]byte, size)
+	if err := reader.ReadAt(ctx, buf, 0); err != nil {
+		return replicaManifest{}, err
+	}
+	return decodeReplicaManifest(buf)
+}
+
+// applyReplicaManifestLocked installs a version with the tables of a published
+// snapshot. The backings of the tables must have been attached. The replica is
+// read-only, so logAndApply doesn't write the version edit to the MANIFEST. The
+// tables that become obsolete are released when their last reader is done
+// (see releaseReadOnlyObsoleteTablesLocked). d.mu must be held.
+func (d *DB) applyReplicaManifestLocked(m *replicaManifest) error {
+	type levelFile struct {
+		level int
+		meta  *fileMetadata
+	}
+	current := d.mu.versions.currentVersion()
+	existing := make(map[base.FileNum]levelFile)
+	// physicalBackings are the backings of the physical tables in the current
+	// version; when a table is virtualized, its backing is reused.
+	physicalBackings := make(map[base.DiskFileNum]*fileBacking)
+	for level := range current.Levels {
+		iter := current.Levels[level].Iter()
+		for f := iter.First(); f != nil; f = iter.Next() {
+			existing[f.FileNum] = levelFile{level: level, meta: f}
+			if !f.Virtual {
+				physicalBackings[f.FileBacking.DiskFileNum] = f.FileBacking
+			}
+		}
+	}
+	// createdBackings are the virtual backings in the snapshot, and newBackings
+	// the ones among them that the replica does not have yet.
+	createdBackings := make(map[base.DiskFileNum]*fileBacking, len(m.ve.CreatedBackingTables))
+	for _, b := range m.ve.CreatedBackingTables {
+		createdBackings[b.DiskFileNum] = b
+	}
+	newBackings := make(map[base.DiskFileNum]*fileBacking)
+
+	ve := &versionEdit{
+		DeletedFiles: make(map[deletedFileEntry]*fileMetadata),
+	}
+	published := make(map[base.FileNum]struct{}, len(m.ve.NewFiles))
+	for _, nf := range m.ve.NewFiles {
+		published[nf.Meta.FileNum] = struct{}{}
+		e, ok := existing[nf.Meta.FileNum]
+		if ok && e.level == nf.Level {
+			continue
+		}
+		meta := nf.Meta
+		if ok {
+			// The table moved to a different level.
+			ve.DeletedFiles[deletedFileEntry{Level: e.level, FileNum: e.meta.FileNum}] = e.meta
+			meta = e.meta
+		} else if meta.Virtual {
+			b, ok := d.mu.versions.virtualBackings.Get(nf.BackingFileNum)
+			if !ok {
+				b, ok = newBackings[nf.BackingFileNum]
+			}
+			if !ok {
+				if b, ok = physicalBackings[nf.BackingFileNum]; !ok {
+					b, ok = createdBackings[nf.BackingFileNum]
+				}
+				if !ok {
+					return base.CorruptionErrorf("pebble: replica manifest has no backing %s for table %s",
+						nf.BackingFileNum, meta.FileNum)
+				}
+				newBackings[nf.BackingFileNum] = b
+				ve.CreatedBackingTables = append(ve.CreatedBackingTables, b)
+			}
+			meta.FileBacking = b
+		}
+		ve.NewFiles = append(ve.NewFiles, newFileEntry{Level: nf.Level, Meta: meta})
+	}
+	for fileNum, e := range existing {
+		if _, ok := published[fileNum]; !ok {
+			ve.DeletedFiles[deletedFileEntry{Level: e.level, FileNum: fileNum}] = e.meta
+		}
+	}
+
+	// The tables may contain sequence numbers up to LastSeqNum, which must be
+	// visible to new reads.
+	if seqNum := m.ve.LastSeqNum + 1; seqNum > d.mu.versions.logSeqNum.Load() {
+		d.mu.versions.logSeqNum.Store(seqNum)
+		d.mu.versions.visibleSeqNum.Store(seqNum)
+	}
+	d.mu.versions.markFileNumUsed(base.DiskFileNum(m.ve.NextFileNum - 1))
+	if len(ve.NewFiles) == 0 && len(ve.DeletedFiles) == 0 {
+		return nil
+	}
+
+	jobID := d.newJobIDLocked()
+	d.mu.versions.logLock()
+	if err := d.mu.versions.logAndApply(jobID, ve, nil /* metrics */, false /* forceRotation */, func() []compactionInfo {
+		return nil
+	}); err != nil {
+		return err
+	}
+	d.updateReadStateLocked(d.opts.DebugCheck)
+	return nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// unclosableStorage wraps a remote.Storage and ignores Close, so that the
+// in-memory storage survives the DBs that use it.
+type unclosableStorage struct {
+	remote.Storage
+}
+
+func (unclosableStorage) Close() error { return nil }
+
+func TestReplica(t *testing.T) {
+	storage := unclosableStorage{remote.NewInMem()}
+	makeOpts := func() *Options {
+		opts := &Options{
+			FS:                 vfs.NewMem(),
+			FormatMajorVersion: FormatNewest,
+			// Keep the writer's tables in L0 until it is compacted manually.
+			DisableAutomaticCompactions: true,
+		}
+		opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+			"": storage,
+		})
+		opts.Experimental.CreateOnShared = remote.CreateOnSharedAll
+		opts.private.testingAlwaysWaitForCleanup = true
+		return opts
+	}
+	const manifestObj = "replica-manifest"
+	replicaOpts := ReplicaOptions{ObjName: manifestObj, CreatorID: 2}
+
+	w, err := Open("", makeOpts())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, w.Close()) }()
+	require.NoError(t, w.SetCreatorID(1))
+
+	set := func(start, end int, value string) {
+		for i := start; i < end; i++ {
+			require.NoError(t, w.Set([]byte(fmt.Sprintf("k%03d", i)), []byte(value), nil))
+		}
+		require.NoError(t, w.Flush())
+	}
+	// scan returns the contents of the DB, with the keys that have the same
+	// value collapsed into ranges.
+	scan := func(r Reader) string {
+		iter, err := r.NewIter(nil)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, iter.Close()) }()
+		var b strings.Builder
+		var first, last, value string
+		flush := func() {
+			if first != "" {
+				fmt.Fprintf(&b, "%s-%s:%s ", first, last, value)
+			}
+		}
+		for iter.First(); iter.Valid(); iter.Next() {
+			if string(iter.Value()) != value {
+				flush()
+				first, value = string(iter.Key()), string(iter.Value())
+			}
+			last = string(iter.Key())
+		}
+		flush()
+		return strings.TrimSpace(b.String())
+	}
+	// objects returns the number of tables and ref markers in the storage.
+	objects := func() (tables, refs int) {
+		names, err := storage.List("", "")
+		require.NoError(t, err)
+		for _, name := range names {
+			if strings.Contains(name, ".ref.") {
+				refs++
+			} else if name != manifestObj {
+				tables++
+			}
+		}
+		return tables, refs
+	}
+
+	// The replica cannot be opened before the writer publishes a MANIFEST.
+	_, err = OpenReplica("replica", makeOpts(), replicaOpts)
+	require.True(t, storage.IsNotExistError(errors.UnwrapAll(err)), "%v", err)
+
+	set(0, 100, "a")
+	set(50, 150, "b")
+	require.NoError(t, w.PublishReplicaManifest("", manifestObj))
+
+	replicaFS := vfs.NewMem()
+	openReplica := func() *DB {
+		opts := makeOpts()
+		opts.FS = replicaFS
+		r, err := OpenReplica("replica", opts, replicaOpts)
+		require.NoError(t, err)
+		return r
+	}
+	// dirContents returns the files of the replica's directory with their
+	// sizes; refreshes must not change them.
+	dirContents := func() string {
+		names, err := replicaFS.List("replica")
+		require.NoError(t, err)
+		slices.Sort(names)
+		var b strings.Builder
+		for _, name := range names {
+			fi, err := replicaFS.Stat(replicaFS.PathJoin("replica", name))
+			require.NoError(t, err)
+			fmt.Fprintf(&b, "%s:%d\n", name, fi.Size())
+		}
+		return b.String()
+	}
+	r := openReplica()
+	require.Equal(t, "k000-k049:a k050-k149:b", scan(r))
+	require.ErrorIs(t, r.Set([]byte("k"), nil, nil), ErrReadOnly)
+	require.Equal(t, int64(2), r.Metrics().Levels[0].NumFiles)
+	dir := dirContents()
+
+	// The writer compacts its tables away; the replica keeps reading them until
+	// it is refreshed.
+	set(100, 200, "c")
+	require.NoError(t, w.Compact([]byte("k000"), []byte("k999"), true /* parallelize */))
+	require.NoError(t, w.PublishReplicaManifest("", manifestObj))
+	iter, err := r.NewIter(nil)
+	require.NoError(t, err)
+	snap := r.NewSnapshot()
+	require.Equal(t, "k000-k049:a k050-k149:b", scan(r))
+	// The replica's ref markers keep the compacted tables alive.
+	tables, refs := objects()
+	l6Files := int(w.Metrics().Levels[6].NumFiles)
+	require.Equal(t, 2+l6Files, tables)
+	require.Equal(t, 2+l6Files, refs)
+
+	require.NoError(t, r.RefreshReplica())
+	require.Equal(t, "k000-k049:a k050-k099:b k100-k199:c", scan(r))
+	// The iterator opened before the refresh reads the old version, even though
+	// its tables are no longer used by the writer.
+	require.True(t, iter.SeekGE([]byte("k120")))
+	require.Equal(t, "b", string(iter.Value()))
+	require.NoError(t, iter.Close())
+	// So does the snapshot taken before the refresh.
+	require.Equal(t, "k000-k049:a k050-k149:b", scan(snap))
+	v, closer, err := snap.Get([]byte("k120"))
+	require.NoError(t, err)
+	require.Equal(t, "b", string(v))
+	require.NoError(t, closer.Close())
+	require.NoError(t, snap.Close())
+	// The refresh didn't write to the replica's directory.
+	require.Equal(t, dir, dirContents())
+	require.Zero(t, r.Metrics().Levels[0].NumFiles)
+	require.Equal(t, w.Metrics().Levels[6].NumFiles, r.Metrics().Levels[6].NumFiles)
+
+	// Refreshing again is a no-op.
+	require.NoError(t, r.RefreshReplica())
+	require.Equal(t, "k000-k049:a k050-k099:b k100-k199:c", scan(r))
+
+	// The replica picks up virtual tables created by an excise.
+	f, err := w.opts.FS.Create("ext.sst", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	sw := sstable.NewWriter(objstorageprovider.NewFileWritable(f), sstable.WriterOptions{
+		TableFormat: w.FormatMajorVersion().MaxTableFormat(),
+	})
+	require.NoError(t, sw.Set([]byte("k125"), []byte("x")))
+	require.NoError(t, sw.Close())
+	_, err = w.IngestAndExcise([]string{"ext.sst"}, nil, nil, KeyRange{Start: []byte("k120"), End: []byte("k130")}, false)
+	require.NoError(t, err)
+	require.NoError(t, w.PublishReplicaManifest("", manifestObj))
+	require.NoError(t, r.RefreshReplica())
+	require.Equal(t, "k000-k049:a k050-k099:b k100-k119:c k125-k125:x k130-k199:c", scan(r))
+	require.NotZero(t, r.Metrics().Levels[6].NumVirtualFiles)
+	require.Equal(t, dir, dirContents())
+
+	// The replica can be reopened, and fetches the latest MANIFEST.
+	require.NoError(t, r.Close())
+	require.ErrorIs(t, r.RefreshReplica(), ErrClosed)
+	require.Equal(t, dir, dirContents())
+	set(200, 210, "d")
+	require.NoError(t, w.PublishReplicaManifest("", manifestObj))
+	r = openReplica()
+	require.Equal(t, scan(w), scan(r))
+
+	// Once the replica no longer uses the writer's old tables, only the writer's
+	// live tables remain, with a ref marker from each store.
+	tables, refs = objects()
+	live := len(w.objProvider.List())
+	require.Equal(t, live, tables)
+	require.Equal(t, 2*live, refs)
+	require.NoError(t, r.Close())
+
+	// A replica cannot be reopened with a different creator ID.
+	opts := makeOpts()
+	opts.FS = replicaFS
+	_, err = OpenReplica("replica", opts, ReplicaOptions{ObjName: manifestObj, CreatorID: 3})
+	require.Error(t, err)
+
+	// The replica is refreshed in the background.
+	replicaOpts.RefreshInterval = time.Millisecond
+	r = openReplica()
+	defer func() { require.NoError(t, r.Close()) }()
+	set(300, 310, "e")
+	require.NoError(t, w.PublishReplicaManifest("", manifestObj))
+	require.Eventually(t, func() bool {
+		return scan(w) == scan(r)
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestPublishReplicaManifestLocalTables(t *testing.T) {
+	opts := &Options{FS: vfs.NewMem()}
+	opts.Experimental.RemoteStorage = remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{
+		"": remote.NewInMem(),
+	})
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, d.Close()) }()
+	require.NoError(t, d.Set([]byte("a"), nil, nil))
+	require.NoError(t, d.Flush())
+	require.ErrorContains(t, d.PublishReplicaManifest("", "replica-manifest"), "is not on remote storage")
+}
@@ -0,0 +1,375 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package ribbon implements Ribbon filters, a space-efficient alternative to
+// Bloom filters.
+//
+// A Ribbon filter ("Rapid Incremental Boolean Banding ON the fly", Dillinger
+// and Walzer, 2021) stores an r-bit solution for each of m slots such that,
+// for every key in the filter, the XOR of the solutions of the slots selected
+// by the key's 64-bit coefficient row equals an r-bit fingerprint of the key.
+// A key that is not in the filter matches with probability 2^-r. For the same
+// or a lower false positive rate, a Ribbon filter uses ~25% less space than a
+// Bloom filter, at the cost of more CPU to construct.
+//
+// The construction of a Ribbon filter fails with a small probability that
+// grows with the number of keys, in which case it is retried with another
+// hash seed. To bound the failure probability, the keys are sharded by hash
+// into segments of up to segmentKeys keys, each of which is solved
+// independently with its own seed. The filter is encoded as follows:
+//
+//	+-------------------------+-----------------+-------------+---------------+------------+
+//	| solution                | seeds           | numSegments | segmentBlocks | resultBits |
+//	| (numSegments*           | (numSegments    | (uint32)    | (uint32)      | (uint8)    |
+//	|  segmentBlocks*r words) |  bytes)         |             |               |            |
+//	+-------------------------+-----------------+-------------+---------------+------------+
+//
+// Each segment has segmentBlocks*64 slots, grouped in blocks of 64 slots. The
+// solution for a block is stored "interleaved column-major": the k'th uint64
+// of a block holds bit k of the solution of each of the block's slots. A
+// query thus reads at most 2*r words.
+package ribbon // import "github.com/cockroachdb/pebble/ribbon"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+const (
+	// ribbonWidth is the number of slots spanned by a key's coefficient row.
+	ribbonWidth = 64
+	// segmentKeys is the maximum average number of keys per segment.
+	segmentKeys = 8192
+	// trailerLen is the length of the encoded numSegments, segmentBlocks and
+	// resultBits.
+	trailerLen = 9
+	// maxSeeds is the number of hash seeds tried for a segment before the
+	// number of slots per segment is increased.
+	maxSeeds = 64
+	// maxResultBits is the maximum number of bits stored per slot.
+	maxResultBits = 32
+)
+
+// slotsForKeys returns the number of slots to use for a segment of n keys.
+// The overhead over n keeps the probability of a construction failure (which
+// requires retrying with another seed) low.
+func slotsForKeys(n int) int {
+	return n + n/20 + 2*ribbonWidth
+}
+
+// segmentOf returns the segment of the key with hash h. It uses different
+// bits of h than deriveRow, and does not depend on the seed.
+func segmentOf(h uint64, numSegments uint32) uint32 {
+	return uint32((uint64(uint32(h)) * uint64(numSegments)) >> 32)
+}
+
+func remix(h, seed uint64) uint64 {
+	h ^= (seed + 1) * 0x9e3779b97f4a7c15
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// deriveRow derives the start slot, coefficient row and fingerprint for the key
+// with hash h.
+func deriveRow(
+	h uint64, seed uint8, numStarts uint32, mask uint32,
+) (start uint32, coeff uint64, result uint32) {
+	a := remix(h, uint64(seed))
+	start = uint32((uint64(uint32(a>>32)) * uint64(numStarts)) >> 32)
+	result = uint32(a) & mask
+	// The lowest bit of the coefficient row is always set so that the row
+	// starts at start.
+	coeff = remix(a, uint64(seed)+maxSeeds) | 1
+	return start, coeff, result
+}
+
+// dot returns the XOR of the solutions of the slots selected by the
+// coefficient row coeff starting at slot start. word(i) returns the i'th
+// solution word.
+func dot(word func(i int) uint64, start uint32, coeff uint64, resultBits int) uint32 {
+	b, o := int(start/ribbonWidth), start%ribbonWidth
+	lo := coeff << o
+	var hi uint64
+	if o > 0 {
+		hi = coeff >> (ribbonWidth - o)
+	}
+	var v uint32
+	for k := 0; k < resultBits; k++ {
+		n := bits.OnesCount64(word(b*resultBits+k) & lo)
+		if hi != 0 {
+			n += bits.OnesCount64(word((b+1)*resultBits+k) & hi)
+		}
+		v |= uint32(n&1) << k
+	}
+	return v
+}
+
+type tableFilter []byte
+
+func (f tableFilter) MayContain(key []byte) bool {
+	if len(f) <= trailerLen {
+		return false
+	}
+	n := len(f) - trailerLen
+	numSegments := binary.LittleEndian.Uint32(f[n:])
+	segmentBlocks := binary.LittleEndian.Uint32(f[n+4:])
+	resultBits := int(f[n+8])
+	if numSegments == 0 || segmentBlocks == 0 || resultBits == 0 || resultBits > maxResultBits ||
+		uint64(n) != uint64(numSegments)*(uint64(segmentBlocks)*uint64(resultBits)*8+1) {
+		return false
+	}
+	seeds := f[n-int(numSegments) : n]
+	h := xxhash.Sum64(key)
+	seg := segmentOf(h, numSegments)
+	numStarts := segmentBlocks*ribbonWidth - ribbonWidth + 1
+	mask := uint32(uint64(1)<<resultBits - 1)
+	start, coeff, result := deriveRow(h, seeds[seg], numStarts, mask)
+	words := f[int(seg)*int(segmentBlocks)*resultBits*8:]
+	word := func(i int) uint64 {
+		return binary.LittleEndian.Uint64(words[i*8:])
+	}
+	return dot(word, start, coeff, resultBits) == result
+}
+
+// resultBitsForBitsPerKey returns the number of bits stored per slot that
+// yields a false positive rate at most that of a Bloom filter using
+// bitsPerKey bits per key.
+func resultBitsForBitsPerKey(bitsPerKey int) int {
+	// A Bloom filter with b bits per key and an optimal number of probes has a
+	// false positive rate of ~0.6185^b = 2^(-0.69*b).
+	r := int(float64(bitsPerKey)*0.69 + 0.5)
+	if r < 1 {
+		r = 1
+	}
+	if r > maxResultBits {
+		r = maxResultBits
+	}
+	return r
+}
+
+type tableFilterWriter struct {
+	resultBits int
+
+	hashes   []uint64
+	lastHash uint64
+
+	// The following fields hold scratch space used by Finish. They are
+	// retained to reduce allocations when the writer is reused.
+	//
+	// sorted holds the hashes ordered by segment. coeffs and results hold the
+	// banding matrix of a segment.
+	sorted  []uint64
+	offsets []int
+	coeffs  []uint64
+	results []uint32
+	words   []uint64
+	seeds   []byte
+}
+
+func newTableFilterWriter(bitsPerKey int) *tableFilterWriter {
+	return &tableFilterWriter{
+		resultBits: resultBitsForBitsPerKey(bitsPerKey),
+	}
+}
+
+// AddKey implements the base.FilterWriter interface.
+func (w *tableFilterWriter) AddKey(key []byte) {
+	h := xxhash.Sum64(key)
+	if len(w.hashes) != 0 && h == w.lastHash {
+		return
+	}
+	w.hashes = append(w.hashes, h)
+	w.lastHash = h
+}
+
+// Finish implements the base.FilterWriter interface.
+func (w *tableFilterWriter) Finish(buf []byte) []byte {
+	var numSegments, segmentBlocks int
+	if len(w.hashes) > 0 {
+		numSegments = (len(w.hashes) + segmentKeys - 1) / segmentKeys
+		segmentBlocks = w.build(numSegments)
+	}
+
+	numWords := numSegments * segmentBlocks * w.resultBits
+	n := numWords*8 + numSegments
+	buf = append(buf, make([]byte, n+trailerLen)...)
+	filter := buf[len(buf)-n-trailerLen:]
+	for i, v := range w.words[:numWords] {
+		binary.LittleEndian.PutUint64(filter[i*8:], v)
+	}
+	copy(filter[numWords*8:], w.seeds[:numSegments])
+	binary.LittleEndian.PutUint32(filter[n:], uint32(numSegments))
+	binary.LittleEndian.PutUint32(filter[n+4:], uint32(segmentBlocks))
+	filter[n+8] = byte(w.resultBits)
+
+	w.hashes = w.hashes[:0]
+	return buf
+}
+
+// build solves the system of equations for the hashes added to the writer,
+// leaving the solution in w.words and the seed of each segment in w.seeds. It
+// returns the number of blocks per segment.
+func (w *tableFilterWriter) build(numSegments int) (segmentBlocks int) {
+	// Order the hashes by segment.
+	w.offsets = resize(w.offsets, numSegments+1)
+	for _, h := range w.hashes {
+		w.offsets[segmentOf(h, uint32(numSegments))+1]++
+	}
+	for i := 1; i <= numSegments; i++ {
+		w.offsets[i] += w.offsets[i-1]
+	}
+	w.sorted = resize(w.sorted, len(w.hashes))
+	next := append([]int(nil), w.offsets[:numSegments]...)
+	for _, h := range w.hashes {
+		seg := segmentOf(h, uint32(numSegments))
+		w.sorted[next[seg]] = h
+		next[seg]++
+	}
+
+	meanKeys := (len(w.hashes) + numSegments - 1) / numSegments
+	segmentBlocks = (slotsForKeys(meanKeys) + ribbonWidth - 1) / ribbonWidth
+	w.seeds = resize(w.seeds, numSegments)
+	for {
+		numWords := numSegments * segmentBlocks * w.resultBits
+		w.words = resize(w.words, numWords)
+		ok := true
+		for seg := 0; seg < numSegments && ok; seg++ {
+			hashes := w.sorted[w.offsets[seg]:w.offsets[seg+1]]
+			words := w.words[seg*segmentBlocks*w.resultBits : (seg+1)*segmentBlocks*w.resultBits]
+			ok = false
+			for seed := 0; seed < maxSeeds; seed++ {
+				if w.band(hashes, segmentBlocks, uint8(seed)) {
+					w.backSubstitute(words, segmentBlocks, uint8(seed))
+					w.seeds[seg] = uint8(seed)
+					ok = true
+					break
+				}
+			}
+		}
+		if ok {
+			return segmentBlocks
+		}
+		// Construction failing with all seeds is exceedingly unlikely, but it
+		// can always be made to succeed by increasing the number of slots.
+		segmentBlocks += segmentBlocks/8 + 1
+	}
+}
+
+// band performs on-the-fly Gaussian elimination of the rows for the hashes of
+// a segment, returning false if the system of equations is inconsistent.
+func (w *tableFilterWriter) band(hashes []uint64, segmentBlocks int, seed uint8) bool {
+	m := segmentBlocks * ribbonWidth
+	w.coeffs = resize(w.coeffs, m)
+	w.results = resize(w.results, m)
+
+	numStarts := uint32(m - ribbonWidth + 1)
+	mask := uint32(uint64(1)<<w.resultBits - 1)
+	for _, h := range hashes {
+		start, coeff, result := deriveRow(h, seed, numStarts, mask)
+		for {
+			if w.coeffs[start] == 0 {
+				w.coeffs[start] = coeff
+				w.results[start] = result
+				break
+			}
+			coeff ^= w.coeffs[start]
+			result ^= w.results[start]
+			if coeff == 0 {
+				// The row is a linear combination of existing rows. This is
+				// fine as long as the fingerprints agree, which is always the
+				// case for duplicate hashes.
+				if result != 0 {
+					return false
+				}
+				break
+			}
+			tz := bits.TrailingZeros64(coeff)
+			start += uint32(tz)
+			coeff >>= tz
+		}
+	}
+	return true
+}
+
+// backSubstitute computes the solution of the banded system of equations of a
+// segment into words, which must be zeroed.
+func (w *tableFilterWriter) backSubstitute(words []uint64, segmentBlocks int, seed uint8) {
+	word := func(i int) uint64 {
+		return words[i]
+	}
+	mask := uint32(uint64(1)<<w.resultBits - 1)
+	for i := segmentBlocks*ribbonWidth - 1; i >= 0; i-- {
+		var v uint32
+		if coeff := w.coeffs[i]; coeff != 0 {
+			// The solution for slot i is still zero, so it does not contribute
+			// to the dot product.
+			v = w.results[i] ^ dot(word, uint32(i), coeff, w.resultBits)
+		} else {
+			// Slots without a row are unconstrained. Filling them with
+			// pseudo-random values keeps the false positive rate at 2^-r.
+			v = uint32(remix(uint64(i), uint64(seed))) & mask
+		}
+		b, o := i/ribbonWidth, uint(i%ribbonWidth)
+		for k := 0; k < w.resultBits; k++ {
+			words[b*w.resultBits+k] |= uint64((v>>k)&1) << o
+		}
+	}
+}
+
+// resize returns a zeroed slice of length n, reusing the memory of s if
+// possible.
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	s = s[:n]
+	clear(s)
+	return s
+}
+
+// FilterPolicy implements the FilterPolicy interface from the pebble package.
+//
+// The integer value is the number of bits per key of a Bloom filter with the
+// desired false positive rate (see bloom.FilterPolicy); the Ribbon filter
+// achieves the same or a lower false positive rate using ~25% less space. A
+// good value is 10, which yields a filter with ~ 1% false positive rate using
+// ~7.5 bits per key.
+type FilterPolicy int
+
+var _ base.FilterPolicy = FilterPolicy(0)
+
+// Name implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) Name() string {
+	// The number of bits per key is encoded in each filter, so the name does
+	// not depend on it.
+	return "pebble.RibbonFilter"
+}
+
+// MayContain implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) MayContain(ftype base.FilterType, f, key []byte) bool {
+	switch ftype {
+	case base.TableFilter:
+		return tableFilter(f).MayContain(key)
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
+
+// NewWriter implements the pebble.FilterPolicy interface.
+func (p FilterPolicy) NewWriter(ftype base.FilterType) base.FilterWriter {
+	switch ftype {
+	case base.TableFilter:
+		return newTableFilterWriter(int(p))
+	default:
+		panic(fmt.Sprintf("unknown filter type: %v", ftype))
+	}
+}
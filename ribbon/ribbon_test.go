@@ -0,0 +1,156 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package ribbon
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/cockroachdb/pebble/bloom"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/stretchr/testify/require"
+)
+
+func newTableFilter(bitsPerKey int, keys ...[]byte) tableFilter {
+	w := FilterPolicy(bitsPerKey).NewWriter(base.TableFilter)
+	for _, key := range keys {
+		w.AddKey(key)
+	}
+	return tableFilter(w.Finish(nil))
+}
+
+func le32(i int) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(i))
+	return b
+}
+
+func TestEmptyRibbonFilter(t *testing.T) {
+	f := newTableFilter(10)
+	require.Equal(t, trailerLen, len(f))
+	require.False(t, f.MayContain([]byte("hello")))
+	require.False(t, tableFilter(nil).MayContain([]byte("hello")))
+}
+
+func TestSmallRibbonFilter(t *testing.T) {
+	f := newTableFilter(10, []byte("hello"), []byte("world"))
+	require.True(t, f.MayContain([]byte("hello")))
+	require.True(t, f.MayContain([]byte("world")))
+	require.False(t, f.MayContain([]byte("x")))
+	require.False(t, f.MayContain([]byte("foo")))
+}
+
+func TestRibbonFilter(t *testing.T) {
+	nextLength := func(x int) int {
+		if x < 10 {
+			return x + 1
+		}
+		if x < 100 {
+			return x + 10
+		}
+		if x < 1000 {
+			return x + 100
+		}
+		return x + 1000
+	}
+
+	for length := 1; length <= 20000; length = nextLength(length) {
+		keys := make([][]byte, 0, length)
+		for i := 0; i < length; i++ {
+			keys = append(keys, le32(i))
+		}
+		f := newTableFilter(10, keys...)
+		bf := bloom.FilterPolicy(10).NewWriter(base.TableFilter)
+		for _, key := range keys {
+			bf.AddKey(key)
+		}
+		if bloomLen := len(bf.Finish(nil)); length >= 1000 && len(f) > bloomLen*4/5 {
+			t.Errorf("length=%d: len(f)=%d > 4/5 of bloom filter len %d", length, len(f), bloomLen)
+		}
+
+		// All added keys must match.
+		for _, key := range keys {
+			if !f.MayContain(key) {
+				t.Fatalf("length=%d: did not contain key %q", length, key)
+			}
+		}
+
+		// Check false positive rate. A 10 bits per key Bloom filter has a ~1%
+		// false positive rate; the Ribbon filter stores 7 bits per slot for a
+		// false positive rate of 2^-7 = ~0.8%.
+		nFalsePositive := 0
+		for i := 0; i < 10000; i++ {
+			if f.MayContain(le32(1e9 + i)) {
+				nFalsePositive++
+			}
+		}
+		if nFalsePositive > 0.0125*10000 {
+			t.Errorf("length=%d: %d false positives in 10000", length, nFalsePositive)
+		}
+	}
+}
+
+func TestRibbonFilterWriterReuse(t *testing.T) {
+	w := FilterPolicy(10).NewWriter(base.TableFilter)
+	for round := 0; round < 3; round++ {
+		var keys [][]byte
+		for i := 0; i < 1000*(round+1); i++ {
+			keys = append(keys, le32(round<<24|i))
+			w.AddKey(keys[len(keys)-1])
+			// Duplicate keys are ignored.
+			w.AddKey(keys[len(keys)-1])
+		}
+		f := tableFilter(w.Finish(nil))
+		for _, key := range keys {
+			require.True(t, f.MayContain(key))
+		}
+	}
+}
+
+func TestRibbonFilterRetry(t *testing.T) {
+	w := newTableFilterWriter(10)
+	var keys [][]byte
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, le32(i))
+		w.AddKey(keys[i])
+	}
+	// A segment with far fewer slots than keys cannot be constructed with any
+	// seed.
+	require.False(t, w.band(w.hashes, 1, 0))
+	segmentBlocks := w.build(1)
+	require.LessOrEqual(t, segmentBlocks*ribbonWidth, slotsForKeys(len(keys))+ribbonWidth)
+	f := tableFilter(w.Finish(nil))
+	for _, key := range keys {
+		require.True(t, f.MayContain(key))
+	}
+}
+
+func TestResultBitsForBitsPerKey(t *testing.T) {
+	for _, tc := range []struct{ bitsPerKey, resultBits int }{
+		{0, 1}, {1, 1}, {5, 3}, {10, 7}, {20, 14}, {100, 32},
+	} {
+		require.Equal(t, tc.resultBits, resultBitsForBitsPerKey(tc.bitsPerKey), "bitsPerKey=%d", tc.bitsPerKey)
+	}
+}
+
+func BenchmarkRibbonFilter(b *testing.B) {
+	const keyLen = 128
+	const numKeys = 1024
+	keys := make([][]byte, numKeys)
+	for i := range keys {
+		keys[i] = make([]byte, keyLen)
+		_, _ = rand.Read(keys[i])
+	}
+	b.ResetTimer()
+	policy := FilterPolicy(10)
+	for i := 0; i < b.N; i++ {
+		w := policy.NewWriter(base.TableFilter)
+		for _, key := range keys {
+			w.AddKey(key)
+		}
+		w.Finish(nil)
+	}
+}
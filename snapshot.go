@@ -21,6 +21,11 @@ type Snapshot struct {
 	// The db the snapshot was created from.
 	db     *DB
 	seqNum uint64
+	// readState is set for the snapshots of a replica (see OpenReplica): the
+	// versions installed by RefreshReplica don't contain the keys visible at
+	// seqNum, which was assigned by the writer, so the snapshot reads the
+	// version current when it was created.
+	readState *readState
 
 	// Set if part of an EventuallyFileOnlySnapshot.
 	efos *EventuallyFileOnlySnapshot
@@ -62,7 +67,7 @@ func (s *Snapshot) NewIterWithContext(ctx context.Context, o *IterOptions) (*Ite
 		panic(ErrClosed)
 	}
 	return s.db.newIter(ctx, nil /* batch */, newIterOpts{
-		snapshot: snapshotIterOpts{seqNum: s.seqNum},
+		snapshot: snapshotIterOpts{seqNum: s.seqNum, readState: s.readState},
 	}, o), nil
 }
 
@@ -99,7 +104,7 @@ func (s *Snapshot) ScanInternal(
 		},
 	}
 
-	iter, err := s.db.newInternalIter(ctx, snapshotIterOpts{seqNum: s.seqNum}, scanInternalOpts)
+	iter, err := s.db.newInternalIter(ctx, snapshotIterOpts{seqNum: s.seqNum, readState: s.readState}, scanInternalOpts)
 	if err != nil {
 		return err
 	}
@@ -118,6 +123,11 @@ func (s *Snapshot) closeLocked() error {
 	if e := s.db.mu.snapshots.earliest(); e > s.seqNum {
 		s.db.maybeScheduleCompactionPicker(pickElisionOnly)
 	}
+	if s.readState != nil {
+		s.readState.unrefLocked()
+		s.readState = nil
+		s.db.maybeScheduleObsoleteTableDeletionLocked()
+	}
 	s.db = nil
 	return nil
 }
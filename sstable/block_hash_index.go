@@ -0,0 +1,176 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"encoding/binary"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// Data block hash index
+//
+// For TableFormatPebblev5 onwards, a data block may optionally carry a hash
+// index mapping the hash of each user key in the block to the restart
+// interval containing the first occurrence of that user key. A point lookup
+// (blockIter.SeekGE for a key that is present in the block) can then jump
+// directly to the right restart interval instead of binary searching over the
+// restart points, which requires decoding and comparing O(log(numRestarts))
+// keys.
+//
+// The hash index is appended after the restart points:
+//
+//	+------------------+------------------+-----------------+------------------+
+//	| entries ...      | restarts         | buckets         | numBuckets       |
+//	|                  | (4*numRestarts)  | (1*numBuckets)  | (uint16)         |
+//	+------------------+------------------+-----------------+------------------+
+//	| numRestarts | dataBlockHashIndexBit (uint32)                             |
+//	+---------------------------------------------------------------------------+
+//
+// Each bucket is a single byte holding either the index of a restart point,
+// hashIndexEmpty (no user key in the block hashes to the bucket), or
+// hashIndexCollision (user keys in more than one restart interval hash to the
+// bucket). Since restart indexes are stored in a byte, a block with more than
+// hashIndexMaxRestarts restart points is written without a hash index.
+//
+// The most significant bit of the trailing uint32 indicates the presence of
+// the hash index. This bit is never set for blocks without a hash index,
+// since MaximumBlockSize ensures the number of restarts fits in fewer bits.
+// This leaves the encoding of blocks written by older table formats (or
+// without WriterOptions.DataBlockHashIndex) unchanged.
+//
+// The hash index is only a hint: a lookup that finds an empty or colliding
+// bucket, or that does not find the sought user key in the restart interval
+// named by the bucket, falls back to the binary search over restart points.
+// Since the index is built from the bytes of user keys, it is only useful for
+// comparers where Compare(a, b) == 0 implies bytes.Equal(a, b).
+
+const (
+	hashIndexEmpty     byte = 255
+	hashIndexCollision byte = 254
+	// hashIndexMaxRestarts is the maximum number of restart points in a block
+	// for which a hash index is written.
+	hashIndexMaxRestarts = int(hashIndexCollision)
+	// hashIndexMaxBuckets is the maximum number of buckets, bounded by the
+	// uint16 encoding of numBuckets.
+	hashIndexMaxBuckets = 1<<16 - 1
+	// hashIndexFooterLen is the length of the encoded numBuckets.
+	hashIndexFooterLen = 2
+	// dataBlockHashIndexBit is set in the trailing uint32 of a block, which
+	// otherwise encodes the number of restart points, when the block contains
+	// a hash index.
+	dataBlockHashIndexBit uint32 = 1 << 31
+)
+
+// hashIndexUtilRatio is the target ratio of user keys to buckets. A lower
+// ratio reduces collisions at the cost of space.
+const hashIndexUtilRatio = 0.75
+
+func hashIndexHash(userKey []byte) uint32 {
+	return uint32(xxhash.Sum64(userKey))
+}
+
+// hashIndexEntry records the hash of a user key and the restart interval
+// containing its first occurrence in the block.
+type hashIndexEntry struct {
+	hash    uint32
+	restart uint8
+}
+
+// hashIndexBuilder accumulates the entries of a data block hash index while a
+// block is being written.
+type hashIndexBuilder struct {
+	entries []hashIndexEntry
+	// overflow is set if the block has too many restart points to be indexed.
+	overflow bool
+	// buckets is reusable scratch space used by finish.
+	buckets []byte
+}
+
+func (b *hashIndexBuilder) reset() {
+	b.entries = b.entries[:0]
+	b.overflow = false
+}
+
+// add records userKey as first occurring in the restart interval with the
+// given index.
+func (b *hashIndexBuilder) add(userKey []byte, restartIndex int) {
+	if b.overflow {
+		return
+	}
+	if restartIndex >= hashIndexMaxRestarts {
+		b.overflow = true
+		b.entries = b.entries[:0]
+		return
+	}
+	b.entries = append(b.entries, hashIndexEntry{
+		hash:    hashIndexHash(userKey),
+		restart: uint8(restartIndex),
+	})
+}
+
+func (b *hashIndexBuilder) numBuckets() int {
+	n := int(float64(len(b.entries))/hashIndexUtilRatio) + 1
+	if n > hashIndexMaxBuckets {
+		n = hashIndexMaxBuckets
+	}
+	return n
+}
+
+// estimatedSize returns the number of bytes the hash index will add to the
+// block.
+func (b *hashIndexBuilder) estimatedSize() int {
+	if b.overflow || len(b.entries) == 0 {
+		return 0
+	}
+	return b.numBuckets() + hashIndexFooterLen
+}
+
+// finish appends the encoded hash index (buckets followed by numBuckets) to
+// buf, returning the extended buffer and whether an index was written. If no
+// index can be written for the block, buf is returned unchanged.
+func (b *hashIndexBuilder) finish(buf []byte) ([]byte, bool) {
+	if b.overflow || len(b.entries) == 0 {
+		return buf, false
+	}
+	numBuckets := b.numBuckets()
+	if cap(b.buckets) < numBuckets {
+		b.buckets = make([]byte, numBuckets)
+	}
+	buckets := b.buckets[:numBuckets]
+	for i := range buckets {
+		buckets[i] = hashIndexEmpty
+	}
+	for _, e := range b.entries {
+		j := e.hash % uint32(numBuckets)
+		switch buckets[j] {
+		case hashIndexEmpty:
+			buckets[j] = e.restart
+		case e.restart, hashIndexCollision:
+		default:
+			buckets[j] = hashIndexCollision
+		}
+	}
+	buf = append(buf, buckets...)
+	var tmp [hashIndexFooterLen]byte
+	binary.LittleEndian.PutUint16(tmp[:], uint16(numBuckets))
+	return append(buf, tmp[:]...), true
+}
+
+// hashIndexLookup returns the index of the restart interval that contains the
+// first occurrence of userKey in the block, if userKey is in the block. ok is
+// false if the hash index cannot identify the restart interval; userKey may
+// or may not be in the block, and the caller must fall back to a binary
+// search. Note that ok may be true even if userKey is not in the block.
+func hashIndexLookup(buckets []byte, userKey []byte) (restartIndex int32, ok bool) {
+	if len(buckets) == 0 {
+		return 0, false
+	}
+	b := buckets[hashIndexHash(userKey)%uint32(len(buckets))]
+	if b == hashIndexEmpty || b == hashIndexCollision {
+		return 0, false
+	}
+	return int32(b), true
+}
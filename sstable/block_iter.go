@@ -131,8 +131,11 @@ type blockIter struct {
 	// Number of restart points in this block. Encoded at the end of the block
 	// as a uint32.
 	numRestarts int32
-	ptr         unsafe.Pointer
-	data        []byte
+	// hashIndex holds the buckets of the data block hash index, if the block
+	// has one. See block_hash_index.go.
+	hashIndex []byte
+	ptr       unsafe.Pointer
+	data      []byte
 	// key contains the raw key the iterator is currently pointed at. This may
 	// point directly to data stored in the block (for a key which has no prefix
 	// compression), to fullKey (for a prefix compressed key), or to a slice of
@@ -213,7 +216,8 @@ func (i *blockIter) String() string {
 }
 
 func (i *blockIter) init(cmp Compare, split Split, block block, transforms IterTransforms) error {
-	numRestarts := int32(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	trailer := binary.LittleEndian.Uint32(block[len(block)-4:])
+	numRestarts := int32(trailer &^ dataBlockHashIndexBit)
 	if numRestarts == 0 {
 		return base.CorruptionErrorf("pebble/table: invalid table (block has no restart points)")
 	}
@@ -222,6 +226,19 @@ func (i *blockIter) init(cmp Compare, split Split, block block, transforms IterT
 	i.split = split
 	i.cmp = cmp
 	i.restarts = int32(len(block)) - 4*(1+numRestarts)
+	i.hashIndex = nil
+	if trailer&dataBlockHashIndexBit != 0 {
+		end := len(block) - 4 - hashIndexFooterLen
+		if end < 0 {
+			return base.CorruptionErrorf("pebble/table: invalid table (block hash index is truncated)")
+		}
+		numBuckets := int(binary.LittleEndian.Uint16(block[end:]))
+		if numBuckets == 0 || end-numBuckets-4*int(numRestarts) < 0 {
+			return base.CorruptionErrorf("pebble/table: invalid table (block hash index is truncated)")
+		}
+		i.hashIndex = block[end-numBuckets : end : end]
+		i.restarts = int32(end-numBuckets) - 4*numRestarts
+	}
 	i.numRestarts = numRestarts
 	i.ptr = unsafe.Pointer(&block[0])
 	i.data = block
@@ -261,6 +278,7 @@ func (i *blockIter) invalidate() {
 	i.nextOffset = 0
 	i.restarts = 0
 	i.numRestarts = 0
+	i.hashIndex = nil
 	i.data = nil
 }
 
@@ -497,6 +515,45 @@ func (i *blockIter) getFirstUserKey() []byte {
 	return i.firstUserKey
 }
 
+// seekHashIndex uses the block's hash index to find the offset of the first
+// entry with a user key equal to key. searchKey is key with any synthetic
+// prefix removed, i.e. the user key as stored in the block. It returns false
+// if the hash index cannot locate key, in which case the caller must fall
+// back to a binary search over the restart points.
+func (i *blockIter) seekHashIndex(key, searchKey []byte) (offset int32, ok bool) {
+	index, ok := hashIndexLookup(i.hashIndex, searchKey)
+	if !ok || index >= i.numRestarts {
+		return 0, false
+	}
+	limit := i.restarts
+	if index+1 < i.numRestarts {
+		limit = decodeRestart(i.data[i.restarts+4*(index+1):])
+	}
+	// The bucket names the restart interval containing the first occurrence of
+	// every user key in the block that hashes to it. Scan that interval for
+	// key; if it is absent, the key is not in the block and the hash index
+	// provides no positioning information. Note that readEntry prepends any
+	// synthetic prefix to i.key, so the scan compares against key rather than
+	// searchKey.
+	i.offset = decodeRestart(i.data[i.restarts+4*index:])
+	for i.offset < limit {
+		i.readEntry()
+		n := len(i.key) - base.InternalTrailerLen
+		if n < 0 {
+			return 0, false
+		}
+		if c := i.cmp(i.key[:n:n], key); c > 0 {
+			return 0, false
+		} else if c == 0 {
+			// The hash index is built over the bytes of user keys, so it can
+			// only vouch for the position of a byte-equal key.
+			return i.offset, bytes.Equal(i.key[:n:n], key)
+		}
+		i.offset = i.nextOffset
+	}
+	return 0, false
+}
+
 // SeekGE implements internalIterator.SeekGE, as documented in the pebble
 // package.
 func (i *blockIter) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKV {
@@ -523,6 +580,12 @@ func (i *blockIter) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKV
 	}
 
 	i.clearCache()
+	if i.hashIndex != nil && !i.transforms.SyntheticSuffix.IsSet() {
+		if offset, ok := i.seekHashIndex(key, searchKey); ok {
+			i.offset = offset
+			return i.seekGEFromOffset(key)
+		}
+	}
 	// Find the index of the smallest restart point whose key is > the key
 	// sought; index will be numRestarts if there is no such restart point.
 	i.offset = 0
@@ -611,6 +674,13 @@ func (i *blockIter) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKV
 	if index > 0 {
 		i.offset = decodeRestart(i.data[i.restarts+4*(index-1):])
 	}
+	return i.seekGEFromOffset(key)
+}
+
+// seekGEFromOffset iterates forward from i.offset, which must be the offset
+// of an entry such that all preceding entries in the block have user keys <
+// key, to the first entry with user key >= key.
+func (i *blockIter) seekGEFromOffset(key []byte) *base.InternalKV {
 	i.readEntry()
 	hiddenPoint := i.decodeInternalKey(i.key)
 
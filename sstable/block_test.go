@@ -580,6 +580,117 @@ func TestBlockSyntheticSuffix(t *testing.T) {
 	}
 }
 
+func TestBlockHashIndex(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	for _, restarts := range []int{1, 2, 4, 16} {
+		t.Run(fmt.Sprintf("restarts=%d", restarts), func(t *testing.T) {
+			plainWriter := &blockWriter{restartInterval: restarts}
+			hashWriter := &blockWriter{restartInterval: restarts, hashIndex: true}
+
+			// Write a block with a random number of versions of each user key, so
+			// that some user keys span restart intervals.
+			var userKeys [][]byte
+			for i := 0; i < 200; i++ {
+				k := []byte(fmt.Sprintf("key%05d", 2*i))
+				userKeys = append(userKeys, k)
+				versions := 1 + rng.Intn(5)
+				for v := versions; v > 0; v-- {
+					ik := base.MakeInternalKey(k, uint64(v), InternalKeyKindSet)
+					plainWriter.add(ik, []byte("value"))
+					hashWriter.add(ik, []byte("value"))
+				}
+			}
+			plainBlock := plainWriter.finish()
+			hashBlock := hashWriter.finish()
+
+			expect, err := newBlockIter(bytes.Compare, nil, plainBlock, NoTransforms)
+			require.NoError(t, err)
+			got, err := newBlockIter(bytes.Compare, nil, hashBlock, NoTransforms)
+			require.NoError(t, err)
+			require.Equal(t, expect.numRestarts, got.numRestarts)
+			require.Equal(t, expect.restarts, got.restarts)
+			if int(got.numRestarts) <= hashIndexMaxRestarts {
+				require.NotNil(t, got.hashIndex)
+			} else {
+				require.Nil(t, got.hashIndex)
+			}
+
+			c := checker{
+				t: t,
+				alsoCheck: func() {
+					require.Equal(t, expect.valid(), got.valid())
+				},
+			}
+			for _, k := range userKeys {
+				c.check(expect.SeekGE(k, base.SeekGEFlagsNone))(got.SeekGE(k, base.SeekGEFlagsNone))
+				c.check(expect.Next())(got.Next())
+				c.check(expect.Prev())(got.Prev())
+			}
+			// Seek to keys absent from the block.
+			for i := 0; i < 100; i++ {
+				k := []byte(fmt.Sprintf("key%05d", 2*rng.Intn(len(userKeys)+2)-1))
+				c.check(expect.SeekGE(k, base.SeekGEFlagsNone))(got.SeekGE(k, base.SeekGEFlagsNone))
+				c.check(expect.Prev())(got.Prev())
+			}
+			c.check(expect.First())(got.First())
+			c.check(expect.Last())(got.Last())
+		})
+	}
+}
+
+func TestBlockHashIndexSyntheticPrefix(t *testing.T) {
+	prefix := []byte("prefix_")
+	plainWriter := &blockWriter{restartInterval: 4}
+	hashWriter := &blockWriter{restartInterval: 4, hashIndex: true}
+	var userKeys [][]byte
+	for i := 0; i < 100; i++ {
+		k := []byte(fmt.Sprintf("key%05d", 2*i))
+		userKeys = append(userKeys, k)
+		for v := 2; v > 0; v-- {
+			ik := base.MakeInternalKey(k, uint64(v), InternalKeyKindSet)
+			plainWriter.add(ik, []byte("value"))
+			hashWriter.add(ik, []byte("value"))
+		}
+	}
+	hashBlock := hashWriter.finish()
+	transforms := IterTransforms{SyntheticPrefix: prefix}
+	expect, err := newBlockIter(bytes.Compare, nil, plainWriter.finish(), transforms)
+	require.NoError(t, err)
+	got, err := newBlockIter(bytes.Compare, nil, hashBlock, transforms)
+	require.NoError(t, err)
+	require.NotNil(t, got.hashIndex)
+	noPrefix, err := newBlockIter(bytes.Compare, nil, hashBlock, NoTransforms)
+	require.NoError(t, err)
+
+	c := checker{
+		t: t,
+		alsoCheck: func() {
+			require.Equal(t, expect.valid(), got.valid())
+		},
+	}
+	var hits int
+	for _, k := range userKeys {
+		pk := append(append([]byte(nil), prefix...), k...)
+		// The hash index must locate a key under a synthetic prefix exactly as
+		// it does without one.
+		wantOffset, wantOK := noPrefix.seekHashIndex(k, k)
+		offset, ok := got.seekHashIndex(pk, k)
+		require.Equal(t, wantOK, ok, "%q", k)
+		require.Equal(t, wantOffset, offset, "%q", k)
+		if ok {
+			hits++
+		}
+
+		c.check(expect.SeekGE(pk, base.SeekGEFlagsNone))(got.SeekGE(pk, base.SeekGEFlagsNone))
+		c.check(expect.Next())(got.Next())
+		c.check(expect.Prev())(got.Prev())
+	}
+	require.Greater(t, hits, len(userKeys)/2)
+}
+
 var (
 	benchSynthSuffix = []byte("@15")
 	benchPrefix      = []byte("2_")
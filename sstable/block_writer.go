@@ -5,6 +5,7 @@
 package sstable
 
 import (
+	"bytes"
 	"encoding/binary"
 
 	"github.com/cockroachdb/errors"
@@ -46,6 +47,10 @@ type blockWriter struct {
 	// will optimize by stepping through restarts only within the same block.
 	// Note that the first restart is the first key in the block.
 	setHasSameKeyPrefixSinceLastRestart bool
+	// hashIndex is set for data blocks in TableFormatPebblev5 onwards when
+	// WriterOptions.DataBlockHashIndex is enabled. See block_hash_index.go.
+	hashIndex        bool
+	hashIndexBuilder hashIndexBuilder
 }
 
 func (w *blockWriter) clear() {
@@ -55,6 +60,10 @@ func (w *blockWriter) clear() {
 		curKey:   w.curKey[:0],
 		curValue: w.curValue[:0],
 		prevKey:  w.prevKey[:0],
+		hashIndexBuilder: hashIndexBuilder{
+			entries: w.hashIndexBuilder.entries[:0],
+			buckets: w.hashIndexBuilder.buckets[:0],
+		},
 	}
 }
 
@@ -227,6 +236,14 @@ func (w *blockWriter) addWithOptionalValuePrefix(
 
 	w.storeWithOptionalValuePrefix(
 		size, value, maxSharedKeyLen, addValuePrefix, valuePrefix, setHasSameKeyPrefix)
+
+	if w.hashIndex {
+		// Only the first occurrence of each user key is indexed. The entry was
+		// stored in the restart interval that began with the last restart.
+		if w.nEntries == 1 || !bytes.Equal(key.UserKey, w.prevKey[:len(w.prevKey)-base.InternalTrailerLen]) {
+			w.hashIndexBuilder.add(key.UserKey, len(w.restarts)-1)
+		}
+	}
 }
 
 func (w *blockWriter) finish() []byte {
@@ -245,7 +262,14 @@ func (w *blockWriter) finish() []byte {
 		binary.LittleEndian.PutUint32(tmp4, x)
 		w.buf = append(w.buf, tmp4...)
 	}
-	binary.LittleEndian.PutUint32(tmp4, uint32(len(w.restarts)))
+	trailer := uint32(len(w.restarts))
+	if w.hashIndex {
+		var ok bool
+		if w.buf, ok = w.hashIndexBuilder.finish(w.buf); ok {
+			trailer |= dataBlockHashIndexBit
+		}
+	}
+	binary.LittleEndian.PutUint32(tmp4, trailer)
 	w.buf = append(w.buf, tmp4...)
 	result := w.buf
 
@@ -254,6 +278,7 @@ func (w *blockWriter) finish() []byte {
 	w.nextRestart = 0
 	w.buf = w.buf[:0]
 	w.restarts = w.restarts[:0]
+	w.hashIndexBuilder.reset()
 	return result
 }
 
@@ -263,5 +288,9 @@ func (w *blockWriter) finish() []byte {
 const emptyBlockSize = 4
 
 func (w *blockWriter) estimatedSize() int {
-	return len(w.buf) + 4*len(w.restarts) + emptyBlockSize
+	size := len(w.buf) + 4*len(w.restarts) + emptyBlockSize
+	if w.hashIndex {
+		size += w.hashIndexBuilder.estimatedSize()
+	}
+	return size
 }
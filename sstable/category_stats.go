@@ -65,6 +65,13 @@ func StringToQoSForTesting(s string) QoSLevel {
 type CategoryAndQoS struct {
 	Category
 	QoSLevel
+	// NoCacheAdmission, if true, prevents the data, value and index blocks read
+	// by the iterator from being added to the block cache, and the reads from
+	// being recorded by the admission filter of the cache (see
+	// cache.Cache.EnableAdmissionFilter). Blocks that are already in the cache
+	// are used. This is meant for large scans (e.g. exports) that would
+	// otherwise evict the working set from the cache.
+	NoCacheAdmission bool
 }
 
 // CategoryStats provides stats about a category of reads.
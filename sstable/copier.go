@@ -55,10 +55,17 @@ func CopySpan(
 		return copyWholeFileBecauseOfUnsupportedFeature(ctx, input, output) // Finishes/Aborts output.
 	}
 
-	// If our input has not filters, our output cannot have filters either.
-	if r.tableFilter == nil {
+	// If our input has not filters, our output cannot have filters either. The
+	// partitions of a partitioned filter are aligned with the index partitions
+	// of the input, which we rebuild below, so such filters are dropped too.
+	if r.tableFilter == nil || r.partitionedFilter {
 		o.FilterPolicy = nil
 	}
+	// The filter block of the input is copied verbatim as a table filter.
+	o.FilterType = TableFilter
+	// Keys are not passed through the writer, so a range filter cannot be
+	// built.
+	o.RangeFilterPolicy = nil
 	o.TableFormat = r.tableFormat
 	w := NewWriter(output, o)
 
@@ -4,7 +4,12 @@
 
 package sstable
 
-import "sync/atomic"
+import (
+	"bytes"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble/internal/bytealloc"
+)
 
 // FilterMetrics holds metrics for the filter policy.
 type FilterMetrics struct {
@@ -56,9 +61,19 @@ type BlockHandleWithProperties struct {
 	Props []byte
 }
 
+// writeBlockFunc writes a block of a table with the given compression,
+// returning its handle.
+type writeBlockFunc func(b []byte, compression Compression) (BlockHandle, error)
+
 type filterWriter interface {
 	addKey(key []byte)
-	finish() ([]byte, error)
+	// finishDataBlock is called when a data block with index separator sep is
+	// finished. newIndexPartition indicates that the data block is the first
+	// data block of a new index partition.
+	finishDataBlock(sep InternalKey, newIndexPartition bool)
+	// writeFilter writes the blocks of the filter using writeBlock, returning
+	// the handle of the block referenced by the metaindex.
+	writeFilter(writeBlock writeBlockFunc) (BlockHandle, error)
 	metaName() string
 	policyName() string
 }
@@ -77,6 +92,11 @@ func newTableFilterReader(policy FilterPolicy) *tableFilterReader {
 
 func (f *tableFilterReader) mayContain(data, key []byte) bool {
 	mayContain := f.policy.MayContain(TableFilter, data, key)
+	f.record(mayContain)
+	return mayContain
+}
+
+func (f *tableFilterReader) record(mayContain bool) {
 	if f.metrics != nil {
 		if mayContain {
 			f.metrics.misses.Add(1)
@@ -84,7 +104,6 @@ func (f *tableFilterReader) mayContain(data, key []byte) bool {
 			f.metrics.hits.Add(1)
 		}
 	}
-	return mayContain
 }
 
 type tableFilterWriter struct {
@@ -106,11 +125,14 @@ func (f *tableFilterWriter) addKey(key []byte) {
 	f.writer.AddKey(key)
 }
 
-func (f *tableFilterWriter) finish() ([]byte, error) {
-	if f.count == 0 {
-		return nil, nil
+func (f *tableFilterWriter) finishDataBlock(sep InternalKey, newIndexPartition bool) {}
+
+func (f *tableFilterWriter) writeFilter(writeBlock writeBlockFunc) (BlockHandle, error) {
+	var b []byte
+	if f.count > 0 {
+		b = f.writer.Finish(nil)
 	}
-	return f.writer.Finish(nil), nil
+	return writeBlock(b, NoCompression)
 }
 
 func (f *tableFilterWriter) metaName() string {
@@ -120,3 +142,154 @@ func (f *tableFilterWriter) metaName() string {
 func (f *tableFilterWriter) policyName() string {
 	return f.policy.Name()
 }
+
+// filterPartition is a finished partition of a partitioned filter.
+type filterPartition struct {
+	// sep is the separator of the index partition the filter partition
+	// corresponds to.
+	sep  InternalKey
+	data []byte
+}
+
+// partitionedFilterWriter writes a filter partitioned in alignment with the
+// partitions of a two-level index. Each partition is encoded as a table-level
+// filter. See the comment in table.go for the format.
+//
+// Keys added to the filter are buffered until the data block containing them
+// is finished, at which point the Writer informs the partitionedFilterWriter
+// whether the data block begins a new index partition.
+type partitionedFilterWriter struct {
+	policy FilterPolicy
+	writer FilterWriter
+	// indexCompression is the compression of the top-level filter index.
+	indexCompression Compression
+	// pending holds the keys added since the last call to finishDataBlock.
+	pending      [][]byte
+	pendingAlloc bytealloc.A
+	// count is the number of keys added to the current partition.
+	count int
+	// totalCount is the number of keys added to the filter.
+	totalCount int
+	// lastSep is the separator of the most recently finished data block.
+	lastSep    InternalKey
+	sepAlloc   bytealloc.A
+	partitions []filterPartition
+}
+
+var _ filterWriter = (*partitionedFilterWriter)(nil)
+
+func newPartitionedFilterWriter(
+	policy FilterPolicy, indexCompression Compression,
+) *partitionedFilterWriter {
+	return &partitionedFilterWriter{
+		policy:           policy,
+		writer:           policy.NewWriter(TableFilter),
+		indexCompression: indexCompression,
+	}
+}
+
+func (f *partitionedFilterWriter) addKey(key []byte) {
+	if n := len(f.pending); n > 0 && bytes.Equal(f.pending[n-1], key) {
+		return
+	}
+	var k []byte
+	f.pendingAlloc, k = f.pendingAlloc.Copy(key)
+	f.pending = append(f.pending, k)
+	f.totalCount++
+}
+
+// finishDataBlock implements filterWriter. If the data block begins a new
+// index partition, the current filter partition is finished first.
+func (f *partitionedFilterWriter) finishDataBlock(sep InternalKey, newIndexPartition bool) {
+	if newIndexPartition {
+		// The partition for the previous index partition also receives the
+		// first key of the new index partition, so that a seek which lands on
+		// the previous partition (because its separator is >= the sought key)
+		// is not filtered out when the sought prefix begins the new partition.
+		if len(f.pending) > 0 {
+			f.writer.AddKey(f.pending[0])
+			f.count++
+		}
+		f.finishPartition()
+	}
+	for _, k := range f.pending {
+		f.writer.AddKey(k)
+		f.count++
+	}
+	f.pending = f.pending[:0]
+	f.pendingAlloc = f.pendingAlloc.Reset()
+	f.sepAlloc, f.lastSep = cloneKeyWithBuf(sep, f.sepAlloc)
+}
+
+func (f *partitionedFilterWriter) finishPartition() {
+	f.partitions = append(f.partitions, filterPartition{
+		sep:  f.lastSep,
+		data: f.writer.Finish(nil),
+	})
+	f.count = 0
+}
+
+// finishPartitions finishes the final filter partition, returning all of the
+// partitions. It returns nil if no keys were added to the filter.
+func (f *partitionedFilterWriter) finishPartitions() []filterPartition {
+	if f.totalCount == 0 {
+		return nil
+	}
+	if f.count > 0 || len(f.pending) > 0 {
+		for _, k := range f.pending {
+			f.writer.AddKey(k)
+		}
+		f.pending = f.pending[:0]
+		f.finishPartition()
+	}
+	return f.partitions
+}
+
+// writeFilter implements filterWriter. It writes the partitions followed by
+// the top-level filter index, returning the handle of the latter.
+func (f *partitionedFilterWriter) writeFilter(writeBlock writeBlockFunc) (BlockHandle, error) {
+	topLevel := blockWriter{restartInterval: 1}
+	var tmp [blockHandleMaxLenWithoutProperties]byte
+	for _, p := range f.finishPartitions() {
+		bh, err := writeBlock(p.data, NoCompression)
+		if err != nil {
+			return BlockHandle{}, err
+		}
+		n := encodeBlockHandle(tmp[:], bh)
+		topLevel.add(p.sep, tmp[:n])
+	}
+	return writeBlock(topLevel.finish(), f.indexCompression)
+}
+
+func (f *partitionedFilterWriter) metaName() string {
+	return "partitionedfilter." + f.policy.Name()
+}
+
+func (f *partitionedFilterWriter) policyName() string {
+	return f.policy.Name()
+}
+
+// rangeFilterWriter accumulates the range filter block of a table.
+type rangeFilterWriter struct {
+	policy RangeFilterPolicy
+	writer RangeFilterWriter
+}
+
+func newRangeFilterWriter(policy RangeFilterPolicy) *rangeFilterWriter {
+	return &rangeFilterWriter{
+		policy: policy,
+		writer: policy.NewWriter(),
+	}
+}
+
+func (f *rangeFilterWriter) addKey(key []byte) {
+	f.writer.AddKey(key)
+}
+
+func (f *rangeFilterWriter) finish() []byte {
+	return f.writer.Finish(nil)
+}
+
+func (f *rangeFilterWriter) metaName() string {
+	return "rangefilter." + f.policy.Name()
+}
@@ -55,6 +55,18 @@ func TestTableFormat_RoundTrip(t *testing.T) {
 			version: 4,
 			want:    TableFormatPebblev4,
 		},
+		{
+			name:    "PebbleDBv5",
+			magic:   pebbleDBMagic,
+			version: 5,
+			want:    TableFormatPebblev5,
+		},
+		{
+			name:    "PebbleDBv6",
+			magic:   pebbleDBMagic,
+			version: 6,
+			want:    TableFormatPebblev6,
+		},
 		// Invalid cases.
 		{
 			name:    "Invalid RocksDB version",
@@ -65,8 +77,8 @@ func TestTableFormat_RoundTrip(t *testing.T) {
 		{
 			name:    "Invalid PebbleDB version",
 			magic:   pebbleDBMagic,
-			version: 5,
-			wantErr: "pebble/table: unsupported pebble format version 5",
+			version: 7,
+			wantErr: "pebble/table: unsupported pebble format version 7",
 		},
 		{
 			name:    "Unknown magic string",
@@ -24,18 +24,20 @@ type Layout struct {
 	// ValidateBlockChecksums, which validates a static list of BlockHandles
 	// referenced in this struct.
 
-	Data       []BlockHandleWithProperties
-	Index      []BlockHandle
-	TopIndex   BlockHandle
-	Filter     BlockHandle
-	RangeDel   BlockHandle
-	RangeKey   BlockHandle
-	ValueBlock []BlockHandle
-	ValueIndex BlockHandle
-	Properties BlockHandle
-	MetaIndex  BlockHandle
-	Footer     BlockHandle
-	Format     TableFormat
+	Data             []BlockHandleWithProperties
+	Index            []BlockHandle
+	TopIndex         BlockHandle
+	Filter           BlockHandle
+	FilterPartitions []BlockHandle
+	RangeFilter      BlockHandle
+	RangeDel         BlockHandle
+	RangeKey         BlockHandle
+	ValueBlock       []BlockHandle
+	ValueIndex       BlockHandle
+	Properties       BlockHandle
+	MetaIndex        BlockHandle
+	Footer           BlockHandle
+	Format           TableFormat
 }
 
 // Describe returns a description of the layout. If the verbose parameter is
@@ -59,9 +61,15 @@ func (l *Layout) Describe(
 	if l.TopIndex.Length != 0 {
 		blocks = append(blocks, block{l.TopIndex, "top-index"})
 	}
+	for i := range l.FilterPartitions {
+		blocks = append(blocks, block{l.FilterPartitions[i], "filter-partition"})
+	}
 	if l.Filter.Length != 0 {
 		blocks = append(blocks, block{l.Filter, "filter"})
 	}
+	if l.RangeFilter.Length != 0 {
+		blocks = append(blocks, block{l.RangeFilter, "range-filter"})
+	}
 	if l.RangeDel.Length != 0 {
 		blocks = append(blocks, block{l.RangeDel, "range-del"})
 	}
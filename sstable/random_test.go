@@ -19,6 +19,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/bytealloc"
 	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/vfs/errorfs"
 	"github.com/stretchr/testify/require"
@@ -289,10 +290,19 @@ func (cfg *randomTableConfig) randomize() {
 		}
 		if v := cfg.rng.Intn(11); v > 0 {
 			cfg.wopts.FilterPolicy = bloom.FilterPolicy(v)
+			if cfg.rng.Intn(2) == 1 {
+				cfg.wopts.FilterPolicy = ribbon.FilterPolicy(v)
+			}
+			if cfg.rng.Intn(2) == 1 {
+				cfg.wopts.FilterType = PartitionedFilter
+			}
 		}
 		if cfg.wopts.TableFormat >= TableFormatPebblev1 && cfg.rng.Float64() < 0.75 {
 			cfg.wopts.BlockPropertyCollectors = append(cfg.wopts.BlockPropertyCollectors, NewTestKeysBlockPropertyCollector)
 		}
+		if cfg.wopts.TableFormat >= TableFormatPebblev5 {
+			cfg.wopts.DataBlockHashIndex = cfg.rng.Intn(2) == 1
+		}
 	}
 	cfg.wopts.ensureDefaults()
 	cfg.wopts.Comparer = testkeys.Comparer
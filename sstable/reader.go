@@ -26,6 +26,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/private"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/objiotracing"
+	"github.com/cockroachdb/pebble/vfs"
 )
 
 var errReaderClosed = errors.New("pebble/table: reader is closed")
@@ -233,6 +234,7 @@ type Reader struct {
 	err               error
 	indexBH           BlockHandle
 	filterBH          BlockHandle
+	rangeFilterBH     BlockHandle
 	rangeDelBH        BlockHandle
 	rangeKeyBH        BlockHandle
 	rangeDelTransform blockTransform
@@ -246,13 +248,23 @@ type Reader struct {
 	FormatKey         base.FormatKey
 	Split             Split
 	tableFilter       *tableFilterReader
+	rangeFilter       RangeFilterPolicy
+	// filterIndex holds the top-level index of a partitioned filter, which is
+	// loaded when the table is opened.
+	filterIndex []byte
 	// Keep types that are not multiples of 8 bytes at the end and with
 	// decreasing size.
 	Properties    Properties
 	tableFormat   TableFormat
 	rawTombstones bool
 	mergerOK      bool
-	checksumType  ChecksumType
+	// partitionedFilter is set if filterBH refers to the top-level index of a
+	// partitioned filter.
+	partitionedFilter bool
+	// ownsCacheID is set if the Reader allocated its cache ID, which it then
+	// releases when closed.
+	ownsCacheID  bool
+	checksumType ChecksumType
 	// metaBufferPool is a buffer pool used exclusively when opening a table and
 	// loading its meta blocks. metaBufferPoolAlloc is used to batch-allocate
 	// the BufferPool.pool slice as a part of the Reader allocation. It's
@@ -267,6 +279,10 @@ var _ CommonReader = (*Reader)(nil)
 
 // Close implements DB.Close, as documented in the pebble package.
 func (r *Reader) Close() error {
+	if r.ownsCacheID {
+		r.opts.Cache.ReleaseID(r.cacheID)
+		r.ownsCacheID = false
+	}
 	r.opts.Cache.Unref()
 
 	if r.readable != nil {
@@ -516,6 +532,87 @@ func (r *Reader) readFilter(
 	return r.readBlock(ctx, r.filterBH, nil /* transform */, nil /* readHandle */, stats, iterStats, nil /* buffer pool */)
 }
 
+// filterMayContain consults the table's filter, returning false if the table
+// is known not to contain any keys with the given prefix that are >= key. For
+// a partitioned filter, key is used to locate the filter partition to
+// consult.
+func (r *Reader) filterMayContain(
+	ctx context.Context,
+	prefix, key []byte,
+	stats *base.InternalIteratorStats,
+	iterStats *iterStatsAccumulator,
+) (bool, error) {
+	if !r.partitionedFilter {
+		filterH, err := r.readFilter(ctx, stats, iterStats)
+		if err != nil {
+			return false, err
+		}
+		defer filterH.Release()
+		return r.tableFilter.mayContain(filterH.Get(), prefix), nil
+	}
+
+	// The top-level filter index maps the separator of each index partition to
+	// the filter partition for the keys in that index partition. The first
+	// partition with a separator >= key may contain key. The filter partition
+	// also contains the first prefix of the following partition, so keys with
+	// the given prefix in later partitions are accounted for as well.
+	var iter blockIter
+	if err := iter.init(r.Compare, r.Split, r.filterIndex, NoTransforms); err != nil {
+		return false, err
+	}
+	defer func() { _ = iter.Close() }()
+	kv := iter.SeekGE(key, base.SeekGEFlagsNone)
+	if kv == nil {
+		if err := iter.Error(); err != nil {
+			return false, err
+		}
+		// key is past the end of the table.
+		r.tableFilter.record(false)
+		return false, nil
+	}
+	bh, n := decodeBlockHandle(kv.InPlaceValue())
+	if n == 0 || n != len(kv.InPlaceValue()) {
+		return false, base.CorruptionErrorf("pebble/table: corrupt filter index entry")
+	}
+	ctx = objiotracing.WithBlockType(ctx, objiotracing.FilterBlock)
+	partitionH, err := r.readBlock(ctx, bh, nil /* transform */, nil /* readHandle */, stats, iterStats, nil /* buffer pool */)
+	if err != nil {
+		return false, err
+	}
+	defer partitionH.Release()
+	return r.tableFilter.mayContain(partitionH.Get(), prefix), nil
+}
+
+// MayContainRange returns false if the table's range filter proves that the
+// table contains no point keys k with lower <= k < upper. A nil lower or upper
+// bound is unbounded. MayContainRange returns true if the table has no range
+// filter, or if its range filter policy is not present in
+// ReaderOptions.RangeFilters.
+func (r *Reader) MayContainRange(ctx context.Context, lower, upper []byte) (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	if r.rangeFilter == nil || (lower == nil && upper == nil) {
+		return true, nil
+	}
+	// The range filter holds the prefixes of the keys in the table. Prefixes
+	// are used to order keys (see base.Split), so the prefix of any key k with
+	// lower <= k < upper is within [prefix(lower), prefix(upper)].
+	if lower != nil && r.Split != nil {
+		lower = lower[:r.Split(lower)]
+	}
+	if upper != nil && r.Split != nil {
+		upper = upper[:r.Split(upper)]
+	}
+	ctx = objiotracing.WithBlockType(ctx, objiotracing.FilterBlock)
+	h, err := r.readBlock(ctx, r.rangeFilterBH, nil /* transform */, nil /* readHandle */, nil /* stats */, nil /* iterStats */, nil /* buffer pool */)
+	if err != nil {
+		return false, err
+	}
+	defer h.Release()
+	return r.rangeFilter.MayContainRange(h.Get(), lower, upper), nil
+}
+
 func (r *Reader) readRangeDel(
 	stats *base.InternalIteratorStats, iterStats *iterStatsAccumulator,
 ) (bufferHandle, error) {
@@ -604,7 +701,30 @@ func (r *Reader) readBlock(
 	iterStats *iterStatsAccumulator,
 	bufferPool *BufferPool,
 ) (handle bufferHandle, _ error) {
-	if h := r.opts.Cache.Get(r.cacheID, r.fileNum, bh.Offset); h.Get() != nil {
+	return r.readBlockInternal(ctx, bh, transform, readHandle, stats, iterStats, bufferPool,
+		false /* noCacheAdmission */)
+}
+
+// readBlockInternal is like readBlock. If noCacheAdmission is true, a block
+// that is not in the cache is not added to it, and the read is not recorded by
+// the admission filter of the cache.
+func (r *Reader) readBlockInternal(
+	ctx context.Context,
+	bh BlockHandle,
+	transform blockTransform,
+	readHandle objstorage.ReadHandle,
+	stats *base.InternalIteratorStats,
+	iterStats *iterStatsAccumulator,
+	bufferPool *BufferPool,
+	noCacheAdmission bool,
+) (handle bufferHandle, _ error) {
+	var h cache.Handle
+	if noCacheAdmission {
+		h = r.opts.Cache.Peek(r.cacheID, r.fileNum, bh.Offset)
+	} else {
+		h = r.opts.Cache.Get(r.cacheID, r.fileNum, bh.Offset)
+	}
+	if h.Get() != nil {
 		// Cache hit.
 		if readHandle != nil {
 			readHandle.RecordCacheHit(ctx, int64(bh.Offset), int64(bh.Length+blockTrailerLen))
@@ -660,9 +780,36 @@ func (r *Reader) readBlock(
 		compressed.release()
 		return bufferHandle{}, err
 	}
+	decompressed, err := r.decodeBlock(bh, transform, compressed, bufferPool)
+	if err != nil {
+		return bufferHandle{}, err
+	}
+
+	if stats != nil {
+		stats.BlockBytes += bh.Length
+	}
+	if iterStats != nil {
+		iterStats.reportStats(bh.Length, 0, readDuration)
+	}
+	if decompressed.buf.Valid() {
+		return bufferHandle{b: decompressed.buf}, nil
+	}
+	if noCacheAdmission {
+		return bufferHandle{h: cache.UncachedHandle(decompressed.v)}, nil
+	}
+	h = r.opts.Cache.Set(r.cacheID, r.fileNum, bh.Offset, decompressed.v)
+	return bufferHandle{h: h}, nil
+}
+
+// decodeBlock verifies the checksum of a block that was read from the file,
+// and decompresses and transforms it. compressed contains the block followed
+// by its trailer; it is released, unless it is returned.
+func (r *Reader) decodeBlock(
+	bh BlockHandle, transform blockTransform, compressed cacheValueOrBuf, bufferPool *BufferPool,
+) (cacheValueOrBuf, error) {
 	if err := checkChecksum(r.checksumType, compressed.get(), bh, r.fileNum); err != nil {
 		compressed.release()
-		return bufferHandle{}, err
+		return cacheValueOrBuf{}, err
 	}
 
 	typ := blockType(compressed.get()[bh.Length])
@@ -676,7 +823,7 @@ func (r *Reader) readBlock(
 		decodedLen, prefixLen, err := decompressedLen(typ, compressed.get())
 		if err != nil {
 			compressed.release()
-			return bufferHandle{}, err
+			return cacheValueOrBuf{}, err
 		}
 
 		if bufferPool != nil {
@@ -686,7 +833,7 @@ func (r *Reader) readBlock(
 		}
 		if err := decompressInto(typ, compressed.get()[prefixLen:], decompressed.get()); err != nil {
 			compressed.release()
-			return bufferHandle{}, err
+			return cacheValueOrBuf{}, err
 		}
 		compressed.release()
 	}
@@ -697,7 +844,7 @@ func (r *Reader) readBlock(
 		tmpTransformed, err := transform(decompressed.get())
 		if err != nil {
 			decompressed.release()
-			return bufferHandle{}, err
+			return cacheValueOrBuf{}, err
 		}
 
 		var transformed cacheValueOrBuf
@@ -710,18 +857,7 @@ func (r *Reader) readBlock(
 		decompressed.release()
 		decompressed = transformed
 	}
-
-	if stats != nil {
-		stats.BlockBytes += bh.Length
-	}
-	if iterStats != nil {
-		iterStats.reportStats(bh.Length, 0, readDuration)
-	}
-	if decompressed.buf.Valid() {
-		return bufferHandle{b: decompressed.buf}, nil
-	}
-	h := r.opts.Cache.Set(r.cacheID, r.fileNum, bh.Offset, decompressed.v)
-	return bufferHandle{h: h}, nil
+	return decompressed, nil
 }
 
 func (r *Reader) transformRangeDelV1(b []byte) ([]byte, error) {
@@ -852,12 +988,21 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 		r.rangeKeyBH = bh
 	}
 
+	for name, p := range r.opts.RangeFilters {
+		if bh, ok := meta["rangefilter."+name]; ok {
+			r.rangeFilterBH = bh
+			r.rangeFilter = p
+			break
+		}
+	}
+
 	for name, fp := range r.opts.Filters {
 		types := []struct {
 			ftype  FilterType
 			prefix string
 		}{
 			{TableFilter, "fullfilter."},
+			{PartitionedFilter, "partitionedfilter."},
 		}
 		var done bool
 		for _, t := range types {
@@ -867,6 +1012,9 @@ func (r *Reader) readMetaindex(metaindexBH BlockHandle) error {
 				switch t.ftype {
 				case TableFilter:
 					r.tableFilter = newTableFilterReader(fp)
+				case PartitionedFilter:
+					r.tableFilter = newTableFilterReader(fp)
+					r.partitionedFilter = true
 				default:
 					return base.CorruptionErrorf("unknown filter type: %v", errors.Safe(t.ftype))
 				}
@@ -889,15 +1037,16 @@ func (r *Reader) Layout() (*Layout, error) {
 	}
 
 	l := &Layout{
-		Data:       make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
-		Filter:     r.filterBH,
-		RangeDel:   r.rangeDelBH,
-		RangeKey:   r.rangeKeyBH,
-		ValueIndex: r.valueBIH.h,
-		Properties: r.propertiesBH,
-		MetaIndex:  r.metaIndexBH,
-		Footer:     r.footerBH,
-		Format:     r.tableFormat,
+		Data:        make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
+		Filter:      r.filterBH,
+		RangeFilter: r.rangeFilterBH,
+		RangeDel:    r.rangeDelBH,
+		RangeKey:    r.rangeKeyBH,
+		ValueIndex:  r.valueBIH.h,
+		Properties:  r.propertiesBH,
+		MetaIndex:   r.metaIndexBH,
+		Footer:      r.footerBH,
+		Format:      r.tableFormat,
 	}
 
 	indexH, err := r.readIndex(context.Background(), nil, nil)
@@ -955,6 +1104,21 @@ func (r *Reader) Layout() (*Layout, error) {
 			*iter = iter.resetForReuse()
 		}
 	}
+	if r.partitionedFilter {
+		filterH, err := r.readFilter(context.Background(), nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer filterH.Release()
+		iter, _ := newBlockIter(r.Compare, r.Split, filterH.Get(), NoTransforms)
+		for kv := iter.First(); kv != nil; kv = iter.Next() {
+			bh, n := decodeBlockHandle(kv.InPlaceValue())
+			if n == 0 || n != len(kv.InPlaceValue()) {
+				return nil, base.CorruptionErrorf("pebble/table: corrupt filter index entry")
+			}
+			l.FilterPartitions = append(l.FilterPartitions, bh)
+		}
+	}
 	if r.valueBIH.h.Length != 0 {
 		vbiH, err := r.readBlock(context.Background(), r.valueBIH.h, nil, nil, nil, nil, nil /* buffer pool */)
 		if err != nil {
@@ -1007,7 +1171,8 @@ func (r *Reader) ValidateBlockChecksums() error {
 		blocks[i] = l.Data[i].BlockHandle
 	}
 	blocks = append(blocks, l.Index...)
-	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.Properties, l.MetaIndex)
+	blocks = append(blocks, l.FilterPartitions...)
+	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeFilter, l.RangeDel, l.RangeKey, l.Properties, l.MetaIndex)
 
 	// Sorting by offset ensures we are performing a sequential scan of the
 	// file.
@@ -1037,6 +1202,53 @@ func (r *Reader) ValidateBlockChecksums() error {
 	return nil
 }
 
+// PrefetchBlocks reads the blocks that start at the given offsets into the
+// block cache. Only the data, index, filter and value blocks are read; the
+// offsets that do not correspond to the start of such a block are ignored.
+// The blocks are read in batches of parallel reads. The wait function, if set,
+// is called with the total length of the blocks of each batch that were read
+// from the file (rather than found in the cache), and can be used to limit the
+// rate of the reads; an error returned by wait stops the prefetch.
+// Returns the number of blocks and bytes read from the file.
+func (r *Reader) PrefetchBlocks(
+	ctx context.Context, offsets []uint64, wait func(length uint64) error,
+) (blocks int, size uint64, _ error) {
+	if r.err != nil {
+		return 0, 0, r.err
+	}
+	l, err := r.Layout()
+	if err != nil {
+		return 0, 0, err
+	}
+	handles := make(map[uint64]BlockHandle, len(l.Data)+len(l.Index)+len(l.FilterPartitions)+len(l.ValueBlock)+3)
+	add := func(bh BlockHandle) {
+		if bh.Length != 0 {
+			handles[bh.Offset] = bh
+		}
+	}
+	for i := range l.Data {
+		add(l.Data[i].BlockHandle)
+	}
+	for _, bhs := range [][]BlockHandle{l.Index, l.FilterPartitions, l.ValueBlock} {
+		for _, bh := range bhs {
+			add(bh)
+		}
+	}
+	add(l.TopIndex)
+	add(l.Filter)
+	add(l.ValueIndex)
+
+	offsets = slices.Clone(offsets)
+	slices.Sort(offsets)
+	bhs := make([]BlockHandle, 0, len(offsets))
+	for _, offset := range offsets {
+		if bh, ok := handles[offset]; ok {
+			bhs = append(bhs, bh)
+		}
+	}
+	return r.prefetchBlocks(ctx, bhs, wait)
+}
+
 // CommonProperties implemented the CommonReader interface.
 func (r *Reader) CommonProperties() *CommonProperties {
 	return &r.Properties.CommonProperties
@@ -1212,6 +1424,7 @@ func NewReader(f objstorage.Readable, o ReaderOptions, extraOpts ...ReaderOption
 	}
 	if r.cacheID == 0 {
 		r.cacheID = r.opts.Cache.NewID()
+		r.ownsCacheID = true
 	}
 
 	footer, err := readFooter(f)
@@ -1229,6 +1442,17 @@ func NewReader(f objstorage.Readable, o ReaderOptions, extraOpts ...ReaderOption
 	r.indexBH = footer.indexBH
 	r.metaIndexBH = footer.metaindexBH
 	r.footerBH = footer.footerBH
+	if r.partitionedFilter {
+		// The top-level index of a partitioned filter is consulted by every
+		// seek, so it is kept in memory rather than read from the block cache.
+		h, err := r.readFilter(context.Background(), nil /* stats */, nil /* iterStats */)
+		if err != nil {
+			r.err = err
+			return nil, r.Close()
+		}
+		r.filterIndex = slices.Clone(h.Get())
+		h.Release()
+	}
 
 	if r.Properties.ComparerName == "" || o.Comparer.Name == r.Properties.ComparerName {
 		r.Compare = o.Comparer.Compare
@@ -1307,6 +1531,15 @@ func (s *simpleReadable) ReadAt(_ context.Context, p []byte, off int64) error {
 	return err
 }
 
+// ReadAsync is part of the objstorage.Readable interface.
+func (s *simpleReadable) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	return objstorage.StartReads(func() error {
+		return objstorage.ReadBatchWithReadAt(ctx, s, reqs)
+	})
+}
+
 // Close is part of the objstorage.Readable interface.
 func (s *simpleReadable) Close() error {
 	return s.f.Close()
@@ -0,0 +1,360 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/cache"
+	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/objiotracing"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// blockReads is a batch of block reads that were submitted at once with
+// ReadAsync, so that they are executed in parallel. The blocks are added to
+// the block cache when the reads complete.
+type blockReads struct {
+	r       *Reader
+	handles []BlockHandle
+	bufs    []*cache.Value
+	pending *objstorage.PendingReads
+	// start and end delimit the range of the file that contains the blocks.
+	start, end uint64
+}
+
+// startBlockReads starts reading the given blocks, skipping the blocks that
+// are in the block cache. The reads are submitted with readHandle, if it is
+// not nil. Returns nil if all the blocks are in the cache.
+func (r *Reader) startBlockReads(
+	ctx context.Context, bhs []BlockHandle, readHandle objstorage.ReadHandle,
+) *blockReads {
+	var b *blockReads
+	var reqs []vfs.ReadRequest
+	for _, bh := range bhs {
+		if r.opts.Cache.Contains(r.cacheID, r.fileNum, bh.Offset) {
+			continue
+		}
+		if b == nil {
+			b = &blockReads{r: r, start: bh.Offset}
+		}
+		v := cache.Alloc(int(bh.Length + blockTrailerLen))
+		b.handles = append(b.handles, bh)
+		b.bufs = append(b.bufs, v)
+		b.start = min(b.start, bh.Offset)
+		b.end = max(b.end, bh.Offset+bh.Length+blockTrailerLen)
+		reqs = append(reqs, vfs.ReadRequest{Buf: v.Buf(), Offset: int64(bh.Offset)})
+	}
+	if b == nil {
+		return nil
+	}
+	if readHandle != nil {
+		b.pending = readHandle.ReadAsync(ctx, reqs)
+	} else {
+		b.pending = r.readable.ReadAsync(ctx, reqs)
+	}
+	return b
+}
+
+// contains returns true if the block at the given offset is in the range of
+// the batch.
+func (b *blockReads) contains(offset uint64) bool {
+	return b.start <= offset && offset < b.end
+}
+
+// finish waits for the completion of the reads, and adds the blocks to the
+// block cache. Returns the number of blocks and bytes that were added, and the
+// first error.
+func (b *blockReads) finish() (blocks int, size uint64, err error) {
+	err = b.pending.Wait()
+	for i, bh := range b.handles {
+		if err != nil {
+			cache.Free(b.bufs[i])
+			continue
+		}
+		decoded, decodeErr := b.r.decodeBlock(bh, nil /* transform */, cacheValueOrBuf{v: b.bufs[i]}, nil /* bufferPool */)
+		if decodeErr != nil {
+			err = decodeErr
+			continue
+		}
+		b.r.opts.Cache.Set(b.r.cacheID, b.r.fileNum, bh.Offset, decoded.v).Release()
+		blocks++
+		size += bh.Length
+	}
+	return blocks, size, err
+}
+
+// discard waits for the completion of the reads and discards the blocks.
+func (b *blockReads) discard() {
+	_ = b.pending.Wait()
+	for _, v := range b.bufs {
+		cache.Free(v)
+	}
+}
+
+// prefetchBatchSize is the maximum number of blocks read at once by
+// PrefetchBlocks.
+const prefetchBatchSize = 32
+
+// prefetchBlocks implements PrefetchBlocks for the blocks with the given
+// handles, which are sorted by offset.
+func (r *Reader) prefetchBlocks(
+	ctx context.Context, bhs []BlockHandle, wait func(length uint64) error,
+) (blocks int, size uint64, _ error) {
+	rh := r.readable.NewReadHandle(ctx)
+	defer rh.Close()
+	for len(bhs) > 0 {
+		batch := bhs[:min(len(bhs), prefetchBatchSize)]
+		bhs = bhs[len(batch):]
+		b := r.startBlockReads(ctx, batch, rh)
+		if b == nil {
+			continue
+		}
+		n, s, err := b.finish()
+		blocks += n
+		size += s
+		if err != nil {
+			return blocks, size, err
+		}
+		if wait != nil {
+			if err := wait(s); err != nil {
+				return blocks, size, err
+			}
+		}
+	}
+	return blocks, size, nil
+}
+
+// PrefetchKeys starts reading the data blocks that may contain the given keys,
+// which must be sorted, into the block cache: the reads of the blocks are
+// submitted at once and executed in parallel, so that the point lookups of the
+// keys that follow don't wait for the reads one at a time. The keys that the
+// filter of the table proves absent are skipped. The index and filter blocks
+// are read by PrefetchKeys, if they are not in the block cache.
+//
+// The returned function waits for the completion of the reads, and must be
+// called before the Reader is closed. It returns the number of blocks and bytes
+// read from the file.
+func (r *Reader) PrefetchKeys(
+	ctx context.Context, keys [][]byte,
+) (wait func() (blocks int, size uint64, _ error), _ error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	indexH, err := r.readIndex(ctx, nil /* stats */, nil /* iterStats */)
+	if err != nil {
+		return nil, err
+	}
+	defer indexH.Release()
+
+	// bhs are the handles of the blocks of the index which may contain the
+	// keys: the data blocks, or the index partitions for a two-level index.
+	var bhs []BlockHandle
+	var lookups [][]byte
+	var index blockIter
+	if err := index.init(r.Compare, r.Split, indexH.Get(), NoTransforms); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if r.tableFilter != nil {
+			mayContain, err := r.filterMayContain(ctx, key[:r.Split(key)], key, nil /* stats */, nil /* iterStats */)
+			if err != nil {
+				return nil, errors.CombineErrors(err, index.Close())
+			} else if !mayContain {
+				continue
+			}
+		}
+		bh, ok, err := seekIndexBlock(&index, key)
+		if err != nil {
+			return nil, errors.CombineErrors(err, index.Close())
+		} else if ok {
+			bhs = append(bhs, bh)
+			lookups = append(lookups, key)
+		}
+	}
+	if err := index.Close(); err != nil {
+		return nil, err
+	}
+
+	if r.Properties.IndexPartitions != 0 {
+		// The index partitions are read in parallel first. Since the keys are
+		// sorted, the keys of a partition are consecutive.
+		ctx := objiotracing.WithBlockType(ctx, objiotracing.MetadataBlock)
+		if _, _, err := r.prefetchBlocks(ctx, slices.Compact(slices.Clone(bhs)), nil /* wait */); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(lookups); {
+			// The keys in lookups[i:j] are in the same partition.
+			j := i + 1
+			for j < len(lookups) && bhs[j] == bhs[i] {
+				j++
+			}
+			if err := r.seekIndexPartition(ctx, bhs[i], lookups[i:j], bhs[i:j]); err != nil {
+				return nil, err
+			}
+			i = j
+		}
+	}
+
+	slices.SortFunc(bhs, func(a, b BlockHandle) int { return cmp.Compare(a.Offset, b.Offset) })
+	b := r.startBlockReads(objiotracing.WithBlockType(ctx, objiotracing.DataBlock), slices.Compact(bhs), nil /* readHandle */)
+	if b == nil {
+		return func() (int, uint64, error) { return 0, 0, nil }, nil
+	}
+	return b.finish, nil
+}
+
+// seekIndexPartition sets bhs[i] to the handle of the data block that may
+// contain keys[i], for keys in the index partition with the given handle.
+func (r *Reader) seekIndexPartition(
+	ctx context.Context, partitionBH BlockHandle, keys [][]byte, bhs []BlockHandle,
+) error {
+	partitionH, err := r.readBlock(ctx, partitionBH, nil /* transform */, nil, /* readHandle */
+		nil /* stats */, nil /* iterStats */, nil /* buffer pool */)
+	if err != nil {
+		return err
+	}
+	defer partitionH.Release()
+	var index blockIter
+	if err := index.init(r.Compare, r.Split, partitionH.Get(), NoTransforms); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		bh, ok, err := seekIndexBlock(&index, key)
+		if err == nil && !ok {
+			// The separator of the partition in the top-level index is the last
+			// separator of the partition.
+			err = base.CorruptionErrorf("pebble/table: index partition does not contain key")
+		}
+		if err != nil {
+			return errors.CombineErrors(err, index.Close())
+		}
+		bhs[i] = bh
+	}
+	return index.Close()
+}
+
+// seekIndexBlock returns the handle of the first entry of the index block with
+// a separator greater than or equal to key, which is the only block that may
+// contain key. ok is false if key is past the end of the index block.
+func seekIndexBlock(index *blockIter, key []byte) (_ BlockHandle, ok bool, _ error) {
+	kv := index.SeekGE(key, base.SeekGEFlagsNone)
+	if kv == nil {
+		return BlockHandle{}, false, index.Error()
+	}
+	bh, err := decodeBlockHandleWithProperties(kv.InPlaceValue())
+	if err != nil {
+		return BlockHandle{}, false, errCorruptIndexEntry(err)
+	}
+	return bh.BlockHandle, true, nil
+}
+
+// scanPrefetchMinBlocks is the number of consecutive data blocks that an
+// iterator must load in the forward direction before it starts prefetching the
+// next blocks.
+const scanPrefetchMinBlocks = 2
+
+// scanPrefetcher prefetches the next data blocks of a forward scan (see
+// ReaderOptions.ScanPrefetchBlocks): the reads of the blocks are submitted at
+// once, and are executed while the iterator processes the current block.
+type scanPrefetcher struct {
+	// sequential is the number of consecutive data blocks, each adjacent to
+	// the previous one, loaded in the forward direction.
+	sequential int
+	// prevEnd is the end of the last data block that was loaded.
+	prevEnd uint64
+	// end is the end of the last data block that was prefetched (whether or
+	// not it had to be read).
+	end uint64
+	// pending contains the reads of the last prefetch, if they were not
+	// finished yet.
+	pending *blockReads
+	// index is used to find the blocks that follow the current block, without
+	// repositioning the index iterator.
+	index   blockIter
+	handles []BlockHandle
+}
+
+// waitFor is called before loading a data block; if the block is being
+// prefetched, it waits for the prefetch to complete, so that the block is
+// found in the cache.
+func (p *scanPrefetcher) waitFor(bh BlockHandle) {
+	if p.pending != nil && p.pending.contains(bh.Offset) {
+		// An error is ignored: the block is read again, which returns the error.
+		_, _, _ = p.pending.finish()
+		p.pending = nil
+	}
+}
+
+// close discards the blocks that are being prefetched.
+func (p *scanPrefetcher) close() {
+	if p.pending != nil {
+		p.pending.discard()
+		p.pending = nil
+	}
+}
+
+// maybePrefetch is called after a data block was loaded; when the iterator
+// has loaded enough consecutive blocks in the forward direction and reaches
+// the end of the blocks that were prefetched, it starts prefetching the next
+// ScanPrefetchBlocks blocks of the current index block.
+func (i *singleLevelIterator) maybePrefetch(dir int8) {
+	p := &i.prefetch
+	bh := i.dataBH
+	if dir > 0 && bh.Offset == p.prevEnd {
+		p.sequential++
+	} else {
+		p.sequential = 0
+		p.end = 0
+	}
+	p.prevEnd = bh.Offset + bh.Length + blockTrailerLen
+	// Prefetching is disabled for compactions, which use OS readahead, for
+	// iterators that don't add the blocks to the cache, and for iterators
+	// with block property filters, which may skip the blocks.
+	if p.sequential < scanPrefetchMinBlocks || p.prevEnd < p.end ||
+		i.bufferPool != nil || i.noCacheAdmission || i.bpfs != nil {
+		return
+	}
+	if p.pending != nil {
+		_, _, _ = p.pending.finish()
+		p.pending = nil
+	}
+
+	// Find the blocks that follow the current block.
+	if err := p.index.init(i.cmp, i.reader.Split, i.index.data, i.index.transforms); err != nil {
+		return
+	}
+	kv := p.index.SeekGE(i.index.ikv.K.UserKey, base.SeekGEFlagsNone)
+	if kv == nil {
+		return
+	}
+	if cur, err := decodeBlockHandleWithProperties(kv.InPlaceValue()); err != nil || cur.BlockHandle != bh {
+		return
+	}
+	p.handles = p.handles[:0]
+	for kv = p.index.Next(); kv != nil && len(p.handles) < i.reader.opts.ScanPrefetchBlocks; kv = p.index.Next() {
+		next, err := decodeBlockHandleWithProperties(kv.InPlaceValue())
+		if err != nil {
+			break
+		}
+		p.handles = append(p.handles, next.BlockHandle)
+		// The index key is greater than or equal to all the keys of the block,
+		// and smaller than the keys of the following blocks.
+		if i.upper != nil && i.cmp(kv.K.UserKey, i.upper) >= 0 {
+			break
+		}
+	}
+	if len(p.handles) == 0 {
+		return
+	}
+	last := p.handles[len(p.handles)-1]
+	p.end = last.Offset + last.Length + blockTrailerLen
+	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.DataBlock)
+	p.pending = i.reader.startBlockReads(ctx, p.handles, i.dataRH)
+}
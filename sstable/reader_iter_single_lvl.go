@@ -65,6 +65,13 @@ type singleLevelIterator struct {
 	stats      *base.InternalIteratorStats
 	iterStats  iterStatsAccumulator
 	bufferPool *BufferPool
+	// noCacheAdmission is CategoryAndQoS.NoCacheAdmission; if set, the data,
+	// value and lower-level index blocks read by the iterator are not added to
+	// the block cache.
+	noCacheAdmission bool
+	// prefetch is used to prefetch the next data blocks during forward scans,
+	// if ReaderOptions.ScanPrefetchBlocks is set.
+	prefetch scanPrefetcher
 
 	// boundsCmp and positionedUsingLatestBounds are for optimizing iteration
 	// that uses multiple adjacent bounds. The seek after setting a new bound
@@ -214,6 +221,7 @@ func (i *singleLevelIterator) init(
 	i.stats = stats
 	i.transforms = transforms
 	i.bufferPool = bufferPool
+	i.noCacheAdmission = categoryAndQoS.NoCacheAdmission
 	err = i.index.initHandle(i.cmp, r.Split, indexH, transforms)
 	if err != nil {
 		// blockIter.Close releases indexH and always returns a nil error
@@ -271,8 +279,12 @@ func (i *singleLevelIterator) setupForCompaction() {
 
 func (i *singleLevelIterator) resetForReuse() singleLevelIterator {
 	return singleLevelIterator{
-		index:  i.index.resetForReuse(),
-		data:   i.data.resetForReuse(),
+		index: i.index.resetForReuse(),
+		data:  i.data.resetForReuse(),
+		prefetch: scanPrefetcher{
+			index:   i.prefetch.index.resetForReuse(),
+			handles: i.prefetch.handles[:0],
+		},
 		inPool: true,
 	}
 }
@@ -451,8 +463,10 @@ func (i *singleLevelIterator) loadBlock(dir int8) loadBlockResult {
 		// blockIntersects
 	}
 	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.DataBlock)
-	block, err := i.reader.readBlock(
-		ctx, i.dataBH, nil /* transform */, i.dataRH, i.stats, &i.iterStats, i.bufferPool)
+	i.prefetch.waitFor(i.dataBH)
+	block, err := i.reader.readBlockInternal(
+		ctx, i.dataBH, nil /* transform */, i.dataRH, i.stats, &i.iterStats, i.bufferPool,
+		i.noCacheAdmission)
 	if err != nil {
 		i.err = err
 		return loadBlockFailed
@@ -464,6 +478,9 @@ func (i *singleLevelIterator) loadBlock(dir int8) loadBlockResult {
 		return loadBlockFailed
 	}
 	i.initBounds()
+	if i.reader.opts.ScanPrefetchBlocks > 0 {
+		i.maybePrefetch(dir)
+	}
 	return loadBlockOK
 }
 
@@ -473,7 +490,8 @@ func (i *singleLevelIterator) readBlockForVBR(
 	h BlockHandle, stats *base.InternalIteratorStats,
 ) (bufferHandle, error) {
 	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.ValueBlock)
-	return i.reader.readBlock(ctx, h, nil, i.vbRH, stats, &i.iterStats, i.bufferPool)
+	return i.reader.readBlockInternal(ctx, h, nil, i.vbRH, stats, &i.iterStats, i.bufferPool,
+		i.noCacheAdmission)
 }
 
 // resolveMaybeExcluded is invoked when the block-property filterer has found
@@ -782,14 +800,12 @@ func (i *singleLevelIterator) seekPrefixGE(
 		}
 		i.lastBloomFilterMatched = false
 		// Check prefix bloom filter.
-		var dataH bufferHandle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats, &i.iterStats)
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(i.ctx, prefix, key, i.stats, &i.iterStats)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -1448,6 +1464,7 @@ func (i *singleLevelIterator) Close() error {
 	}
 	err = firstError(err, i.data.Close())
 	err = firstError(err, i.index.Close())
+	i.prefetch.close()
 	if i.dataRH != nil {
 		err = firstError(err, i.dataRH.Close())
 		i.dataRH = nil
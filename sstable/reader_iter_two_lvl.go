@@ -57,8 +57,9 @@ func (i *twoLevelIterator) loadIndex(dir int8) loadBlockResult {
 		// blockIntersects
 	}
 	ctx := objiotracing.WithBlockType(i.ctx, objiotracing.MetadataBlock)
-	indexBlock, err := i.reader.readBlock(
-		ctx, bhp.BlockHandle, nil /* transform */, nil /* readHandle */, i.stats, &i.iterStats, i.bufferPool)
+	indexBlock, err := i.reader.readBlockInternal(
+		ctx, bhp.BlockHandle, nil /* transform */, nil /* readHandle */, i.stats, &i.iterStats, i.bufferPool,
+		i.noCacheAdmission)
 	if err != nil {
 		i.err = err
 		return loadBlockFailed
@@ -173,6 +174,7 @@ func (i *twoLevelIterator) init(
 	i.stats = stats
 	i.transforms = transforms
 	i.bufferPool = bufferPool
+	i.noCacheAdmission = categoryAndQoS.NoCacheAdmission
 	err = i.topLevelIndex.initHandle(i.cmp, i.reader.Split, topLevelIndexH, transforms)
 	if err != nil {
 		// blockIter.Close releases topLevelIndexH and always returns a nil error
@@ -384,14 +386,12 @@ func (i *twoLevelIterator) SeekPrefixGE(
 			flags = flags.DisableTrySeekUsingNext()
 		}
 		i.lastBloomFilterMatched = false
-		var dataH bufferHandle
-		dataH, i.err = i.reader.readFilter(i.ctx, i.stats, &i.iterStats)
+		var mayContain bool
+		mayContain, i.err = i.reader.filterMayContain(i.ctx, prefix, key, i.stats, &i.iterStats)
 		if i.err != nil {
 			i.data.invalidate()
 			return nil
 		}
-		mayContain := i.reader.tableFilter.mayContain(dataH.Get(), prefix)
-		dataH.Release()
 		if !mayContain {
 			// This invalidation may not be necessary for correctness, and may
 			// be a place to optimize later by reusing the already loaded
@@ -968,6 +968,7 @@ func (i *twoLevelIterator) Close() error {
 	err = firstError(err, i.data.Close())
 	err = firstError(err, i.index.Close())
 	err = firstError(err, i.topLevelIndex.Close())
+	i.prefetch.close()
 	if i.dataRH != nil {
 		err = firstError(err, i.dataRH.Close())
 		i.dataRH = nil
@@ -17,6 +17,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -43,18 +44,16 @@ func (r *Reader) get(key []byte) (value []byte, err error) {
 	}
 
 	if r.tableFilter != nil {
-		dataH, err := r.readFilter(context.Background(), nil /* stats */, nil)
-		if err != nil {
-			return nil, err
-		}
 		var lookupKey []byte
 		if r.Split != nil {
 			lookupKey = key[:r.Split(key)]
 		} else {
 			lookupKey = key
 		}
-		mayContain := r.tableFilter.mayContain(dataH.Get(), lookupKey)
-		dataH.Release()
+		mayContain, err := r.filterMayContain(context.Background(), lookupKey, key, nil /* stats */, nil)
+		if err != nil {
+			return nil, err
+		}
 		if !mayContain {
 			return nil, base.ErrNotFound
 		}
@@ -579,6 +578,8 @@ func TestReaderStats(t *testing.T) {
 			TableFormatPebblev2:    "testdata/readerstats_LevelDB",
 			TableFormatPebblev3:    "testdata/readerstats_Pebblev3",
 			TableFormatPebblev4:    "testdata/readerstats_Pebblev3",
+			TableFormatPebblev5:    "testdata/readerstats_Pebblev3",
+			TableFormatPebblev6:    "testdata/readerstats_Pebblev3",
 		}, func(t *testing.T, format TableFormat, dir string) {
 			if dir == "" {
 				t.Skip()
@@ -611,6 +612,8 @@ func TestReaderWithBlockPropertyFilter(t *testing.T) {
 			TableFormatPebblev2:    "testdata/reader_bpf/Pebblev2",
 			TableFormatPebblev3:    "testdata/reader_bpf/Pebblev3",
 			TableFormatPebblev4:    "testdata/reader_bpf/Pebblev3",
+			TableFormatPebblev5:    "testdata/reader_bpf/Pebblev3",
+			TableFormatPebblev6:    "testdata/reader_bpf/Pebblev3",
 		}, func(t *testing.T, format TableFormat, dir string) {
 			if dir == "" {
 				t.Skip("Block-properties unsupported")
@@ -2387,3 +2390,325 @@ func newReader(r ReadableFile, o ReaderOptions, extraOpts ...ReaderOption) (*Rea
 	}
 	return NewReader(readable, o, extraOpts...)
 }
+
+func TestReaderPrefetchBlocks(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize:      1024,
+		IndexBlockSize: 128,
+		TableFormat:    TableFormatPebblev4,
+	})
+	for i := 0; i < 2000; i++ {
+		require.NoError(t, w.Set([]byte(fmt.Sprintf("key%05d", i)), bytes.Repeat([]byte("v"), 20)))
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	c := cache.New(128 << 20)
+	defer c.Unref()
+	r, err := newReader(f, ReaderOptions{Cache: c})
+	require.NoError(t, err)
+	defer r.Close()
+	l, err := r.Layout()
+	require.NoError(t, err)
+	require.Greater(t, len(l.Data), 3)
+	require.NotZero(t, l.TopIndex.Length)
+
+	offsets := []uint64{
+		l.Data[3].Offset, l.Data[0].Offset, l.Index[1].Offset,
+		// Offsets that are not the start of a data block are ignored.
+		l.Data[1].Offset + 1, l.Properties.Offset,
+	}
+	var waited uint64
+	blocks, size, err := r.PrefetchBlocks(context.Background(), offsets, func(length uint64) error {
+		waited += length
+		return nil
+	})
+	require.NoError(t, err)
+	// The index blocks were cached by Layout.
+	require.Equal(t, 2, blocks)
+	require.Equal(t, l.Data[0].Length+l.Data[3].Length, size)
+	require.Equal(t, size, waited)
+	for _, bh := range []BlockHandle{l.Data[0].BlockHandle, l.Data[3].BlockHandle} {
+		h := c.Get(r.cacheID, r.fileNum, bh.Offset)
+		require.NotNil(t, h.Get())
+		h.Release()
+	}
+	require.Nil(t, c.Get(r.cacheID, r.fileNum, l.Data[1].Offset).Get())
+
+	// Cached blocks are not read again.
+	blocks, _, err = r.PrefetchBlocks(context.Background(), offsets, nil)
+	require.NoError(t, err)
+	require.Zero(t, blocks)
+
+	// The blocks are read in batches; an error returned by wait stops the
+	// prefetch after the first batch.
+	offsets = offsets[:0]
+	for i := 4; i < len(l.Data); i++ {
+		offsets = append(offsets, l.Data[i].Offset)
+	}
+	require.Greater(t, len(offsets), prefetchBatchSize)
+	blocks, _, err = r.PrefetchBlocks(context.Background(), offsets, func(uint64) error {
+		return errors.New("stop")
+	})
+	require.EqualError(t, err, "stop")
+	require.Equal(t, prefetchBatchSize, blocks)
+	h := c.Get(r.cacheID, r.fileNum, l.Data[4].Offset)
+	require.NotNil(t, h.Get())
+	h.Release()
+	require.Nil(t, c.Get(r.cacheID, r.fileNum, l.Data[len(l.Data)-1].Offset).Get())
+}
+
+func TestReaderPrefetchKeys(t *testing.T) {
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+	for _, indexBlockSize := range []int{0, 128} {
+		t.Run(fmt.Sprintf("index-block-size=%d", indexBlockSize), func(t *testing.T) {
+			mem := vfs.NewMem()
+			f, err := mem.Create("test", vfs.WriteCategoryUnspecified)
+			require.NoError(t, err)
+			w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+				BlockSize:      1024,
+				IndexBlockSize: indexBlockSize,
+				FilterPolicy:   bloom.FilterPolicy(10),
+				TableFormat:    TableFormatPebblev4,
+			})
+			for i := 0; i < 2000; i++ {
+				require.NoError(t, w.Set(key(i), bytes.Repeat([]byte("v"), 20)))
+			}
+			require.NoError(t, w.Close())
+
+			f, err = mem.Open("test")
+			require.NoError(t, err)
+			c := cache.New(128 << 20)
+			defer c.Unref()
+			filter := bloom.FilterPolicy(10)
+			r, err := newReader(f, ReaderOptions{
+				Cache:   c,
+				Filters: map[string]FilterPolicy{filter.Name(): filter},
+			})
+			require.NoError(t, err)
+			defer r.Close()
+			l, err := r.Layout()
+			require.NoError(t, err)
+			require.Greater(t, len(l.Data), 3)
+
+			// The first and the last keys are in the first and the last data
+			// blocks; the keys that are not in the table are skipped.
+			keys := [][]byte{key(0), []byte("key00500a"), key(1999), []byte("zzz")}
+			wait, err := r.PrefetchKeys(context.Background(), keys)
+			require.NoError(t, err)
+			blocks, size, err := wait()
+			require.NoError(t, err)
+			first, last := l.Data[0].BlockHandle, l.Data[len(l.Data)-1].BlockHandle
+			require.Equal(t, 2, blocks)
+			require.Equal(t, first.Length+last.Length, size)
+			for _, bh := range []BlockHandle{first, last} {
+				h := c.Get(r.cacheID, r.fileNum, bh.Offset)
+				require.NotNil(t, h.Get())
+				h.Release()
+			}
+			require.Nil(t, c.Get(r.cacheID, r.fileNum, l.Data[1].Offset).Get())
+
+			// Cached blocks are not read again.
+			wait, err = r.PrefetchKeys(context.Background(), keys[:1])
+			require.NoError(t, err)
+			blocks, _, err = wait()
+			require.NoError(t, err)
+			require.Zero(t, blocks)
+		})
+	}
+}
+
+// asyncCountingReadable wraps a Readable and counts the reads submitted with
+// ReadAsync.
+type asyncCountingReadable struct {
+	objstorage.Readable
+	rh      objstorage.NoopReadHandle
+	batches atomic.Int32
+	reads   atomic.Int32
+}
+
+func (r *asyncCountingReadable) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	r.batches.Add(1)
+	r.reads.Add(int32(len(reqs)))
+	return r.Readable.ReadAsync(ctx, reqs)
+}
+
+func (r *asyncCountingReadable) NewReadHandle(_ context.Context) objstorage.ReadHandle {
+	return &r.rh
+}
+
+func TestReaderScanPrefetch(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize:      1024,
+		IndexBlockSize: 512,
+		TableFormat:    TableFormatPebblev4,
+	})
+	const numKeys = 5000
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+	for i := 0; i < numKeys; i++ {
+		require.NoError(t, w.Set(key(i), bytes.Repeat([]byte("v"), 20)))
+	}
+	require.NoError(t, w.Close())
+
+	open := func(prefetchBlocks int) (*Reader, *asyncCountingReadable, *cache.Cache) {
+		f, err := mem.Open("test")
+		require.NoError(t, err)
+		readable, err := NewSimpleReadable(f)
+		require.NoError(t, err)
+		cr := &asyncCountingReadable{Readable: readable}
+		cr.rh = objstorage.MakeNoopReadHandle(cr)
+		c := cache.New(128 << 20)
+		r, err := NewReader(cr, ReaderOptions{Cache: c, ScanPrefetchBlocks: prefetchBlocks})
+		require.NoError(t, err)
+		return r, cr, c
+	}
+	newIter := func(r *Reader, upper []byte) Iterator {
+		iter, err := r.NewIter(NoTransforms, nil /* lower */, upper)
+		require.NoError(t, err)
+		return iter
+	}
+
+	t.Run("forward", func(t *testing.T) {
+		r, cr, c := open(4)
+		defer c.Unref()
+		defer r.Close()
+		l, err := r.Layout()
+		require.NoError(t, err)
+		iter := newIter(r, nil /* upper */)
+		n := 0
+		for kv := iter.First(); kv != nil; kv = iter.Next() {
+			require.Equal(t, string(key(n)), string(kv.K.UserKey))
+			n++
+		}
+		require.Equal(t, numKeys, n)
+		require.NoError(t, iter.Close())
+		// Most of the blocks were prefetched, several at a time (the blocks of
+		// different index blocks are not prefetched together).
+		require.Greater(t, int(cr.reads.Load()), len(l.Data)/2)
+		require.Greater(t, cr.reads.Load(), cr.batches.Load())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		r, cr, c := open(0)
+		defer c.Unref()
+		defer r.Close()
+		iter := newIter(r, nil /* upper */)
+		n := 0
+		for kv := iter.First(); kv != nil; kv = iter.Next() {
+			n++
+		}
+		require.Equal(t, numKeys, n)
+		require.NoError(t, iter.Close())
+		require.Zero(t, cr.batches.Load())
+	})
+
+	t.Run("reverse", func(t *testing.T) {
+		r, cr, c := open(4)
+		defer c.Unref()
+		defer r.Close()
+		iter := newIter(r, nil /* upper */)
+		n := 0
+		for kv := iter.Last(); kv != nil; kv = iter.Prev() {
+			n++
+		}
+		require.Equal(t, numKeys, n)
+		require.NoError(t, iter.Close())
+		require.Zero(t, cr.batches.Load())
+	})
+
+	t.Run("upper-bound", func(t *testing.T) {
+		r, cr, c := open(16)
+		defer c.Unref()
+		defer r.Close()
+		l, err := r.Layout()
+		require.NoError(t, err)
+		iter := newIter(r, key(500))
+		n := 0
+		for kv := iter.First(); kv != nil; kv = iter.Next() {
+			n++
+		}
+		require.Equal(t, 500, n)
+		lastBH := iter.(*twoLevelIterator).dataBH
+		require.NoError(t, iter.Close())
+		require.NotZero(t, cr.batches.Load())
+		// The blocks past the upper bound are not prefetched.
+		for _, bh := range l.Data {
+			if bh.Offset > lastBH.Offset {
+				require.False(t, c.Contains(r.cacheID, r.fileNum, bh.Offset))
+			}
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		// Closing an iterator discards the blocks being prefetched.
+		r, cr, c := open(16)
+		defer c.Unref()
+		defer r.Close()
+		iter := newIter(r, nil /* upper */)
+		kv := iter.First()
+		for i := 0; i < 200 && kv != nil; i++ {
+			kv = iter.Next()
+		}
+		require.NotZero(t, cr.batches.Load())
+		require.NoError(t, iter.Close())
+	})
+}
+
+func TestReaderNoCacheAdmission(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("test", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize:      1024,
+		IndexBlockSize: 128,
+		TableFormat:    TableFormatPebblev4,
+	})
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, w.Set([]byte(fmt.Sprintf("key%05d", i)), bytes.Repeat([]byte("v"), 20)))
+	}
+	require.NoError(t, w.Close())
+
+	f, err = mem.Open("test")
+	require.NoError(t, err)
+	c := cache.New(128 << 20)
+	defer c.Unref()
+	r, err := newReader(f, ReaderOptions{Cache: c})
+	require.NoError(t, err)
+	defer r.Close()
+
+	scan := func(noCacheAdmission bool) int {
+		iter, err := r.NewIterWithBlockPropertyFilters(
+			NoTransforms, nil /* lower */, nil /* upper */, nil /* filterer */, false, /* useFilterBlock */
+			nil /* stats */, CategoryAndQoS{NoCacheAdmission: noCacheAdmission}, nil /* statsCollector */, TrivialReaderProvider{Reader: r})
+		require.NoError(t, err)
+		var n int
+		for kv := iter.First(); kv != nil; kv = iter.Next() {
+			n++
+		}
+		require.NoError(t, iter.Close())
+		return n
+	}
+	// The top-level index block is always cached.
+	before := c.Metrics()
+	require.Equal(t, 1000, scan(true /* noCacheAdmission */))
+	after := c.Metrics()
+	require.LessOrEqual(t, after.Count-before.Count, int64(1))
+	require.Equal(t, 1000, scan(true /* noCacheAdmission */))
+	require.Equal(t, after.Count, c.Metrics().Count)
+
+	require.Equal(t, 1000, scan(false /* noCacheAdmission */))
+	require.Greater(t, c.Metrics().Count, after.Count+10)
+	// Blocks that are in the cache are used.
+	hits := c.Metrics().Hits
+	require.Equal(t, 1000, scan(true /* noCacheAdmission */))
+	require.Greater(t, c.Metrics().Hits, hits+10)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/cockroachdb/pebble/internal/rangekey"
 	"github.com/cockroachdb/pebble/objstorage"
+	"github.com/cockroachdb/pebble/vfs"
 )
 
 // RewriteKeySuffixesAndReturnFormat copies the content of the passed SSTable
@@ -93,6 +94,17 @@ func rewriteKeySuffixesInBlocks(
 
 	tableFormat := r.tableFormat
 	o.TableFormat = tableFormat
+	// The filter block of a table filter is copied verbatim. The partitions of
+	// a partitioned filter are aligned with the index partitions, which may
+	// differ in the output, so a partitioned filter is rebuilt from the key
+	// prefixes, which suffix replacement leaves unchanged.
+	o.FilterType = TableFilter
+	if r.partitionedFilter {
+		o.FilterType = PartitionedFilter
+	}
+	// Keys are not passed through the writer, so a range filter cannot be
+	// built.
+	o.RangeFilterPolicy = nil
 	w := NewWriter(out, o)
 	defer func() {
 		if w != nil {
@@ -123,7 +135,7 @@ func rewriteKeySuffixesInBlocks(
 
 	// Copy over the filter block if it exists (rewriteDataBlocksToWriter will
 	// already have ensured this is valid if it exists).
-	if w.filter != nil && l.Filter.Length > 0 {
+	if w.filter != nil && !r.partitionedFilter && l.Filter.Length > 0 {
 		filterBlock, _, err := readBlockBuf(r, l.Filter, nil)
 		if err != nil {
 			return nil, TableFormatUnspecified, errors.Wrap(err, "reading filter")
@@ -147,6 +159,9 @@ var errBadKind = errors.New("key does not have expected kind (set)")
 type blockWithSpan struct {
 	start, end InternalKey
 	data       []byte
+	// prefixes holds the distinct key prefixes of the block, if they are
+	// needed to rebuild the filter.
+	prefixes [][]byte
 }
 
 func rewriteBlocks(
@@ -159,6 +174,7 @@ func rewriteBlocks(
 	totalWorkers, worker int,
 	from, to []byte,
 	split Split,
+	collectPrefixes bool,
 ) error {
 	bw := blockWriter{
 		restartInterval: restartInterval,
@@ -170,6 +186,7 @@ func rewriteBlocks(
 
 	var blockAlloc bytealloc.A
 	var keyAlloc bytealloc.A
+	var prefixAlloc bytealloc.A
 	var scratch InternalKey
 
 	var inputBlock, inputBlockBuf []byte
@@ -189,6 +206,8 @@ func rewriteBlocks(
 		if err := iter.init(r.Compare, r.Split, inputBlock, NoTransforms); err != nil {
 			return err
 		}
+		// Rebuild the data block hash index, if any, over the rewritten keys.
+		bw.hashIndex = iter.hashIndex != nil
 
 		if cap(bw.restarts) < int(iter.restarts) {
 			bw.restarts = make([]uint32, 0, iter.restarts)
@@ -242,6 +261,14 @@ func rewriteBlocks(
 			if output[i].start.UserKey == nil {
 				keyAlloc, output[i].start = cloneKeyWithBuf(scratch, keyAlloc)
 			}
+			if collectPrefixes {
+				prefixes := output[i].prefixes
+				if n := len(prefixes); n == 0 || !bytes.Equal(prefixes[n-1], scratch.UserKey[:si]) {
+					var prefix []byte
+					prefixAlloc, prefix = prefixAlloc.Copy(scratch.UserKey[:si])
+					output[i].prefixes = append(prefixes, prefix)
+				}
+			}
 		}
 		*iter = iter.resetForReuse()
 
@@ -281,10 +308,14 @@ func rewriteDataBlocksToWriter(
 	}
 	blocks := make([]blockWithSpan, len(data))
 
+	// A partitioned filter is rebuilt by adding the prefixes of each block to
+	// the filter as the block is added to the index.
+	var rebuildFilter bool
 	if w.filter != nil {
 		if err := checkWriterFilterMatchesReader(r, w); err != nil {
 			return err
 		}
+		rebuildFilter = r.partitionedFilter
 	}
 
 	g := &sync.WaitGroup{}
@@ -305,6 +336,7 @@ func rewriteDataBlocksToWriter(
 				worker,
 				from, to,
 				split,
+				rebuildFilter,
 			)
 			if err != nil {
 				errCh <- err
@@ -375,6 +407,9 @@ func rewriteDataBlocksToWriter(
 		if err != nil {
 			return err
 		}
+		for _, prefix := range blocks[i].prefixes {
+			w.filter.addKey(prefix)
+		}
 		var nextKey InternalKey
 		if i+1 < len(blocks) {
 			nextKey = blocks[i+1].start
@@ -438,10 +473,14 @@ type copyFilterWriter struct {
 	data           []byte
 }
 
-func (copyFilterWriter) addKey(key []byte)         { panic("unimplemented") }
-func (c copyFilterWriter) finish() ([]byte, error) { return c.data, nil }
-func (c copyFilterWriter) metaName() string        { return c.origMetaName }
-func (c copyFilterWriter) policyName() string      { return c.origPolicyName }
+func (copyFilterWriter) addKey(key []byte)                                       { panic("unimplemented") }
+func (copyFilterWriter) finishDataBlock(sep InternalKey, newIndexPartition bool) {}
+func (c copyFilterWriter) metaName() string                                      { return c.origMetaName }
+func (c copyFilterWriter) policyName() string                                    { return c.origPolicyName }
+
+func (c copyFilterWriter) writeFilter(writeBlock writeBlockFunc) (BlockHandle, error) {
+	return writeBlock(c.data, NoCompression)
+}
 
 // RewriteKeySuffixesViaWriter is similar to RewriteKeySuffixes but uses just a
 // single loop over the Reader that writes each key to the Writer with the new
@@ -564,6 +603,15 @@ func (m *memReader) ReadAt(_ context.Context, p []byte, off int64) error {
 	return err
 }
 
+// ReadAsync is part of objstorage.Readable.
+func (m *memReader) ReadAsync(
+	ctx context.Context, reqs []vfs.ReadRequest,
+) *objstorage.PendingReads {
+	return objstorage.StartReads(func() error {
+		return objstorage.ReadBatchWithReadAt(ctx, m, reqs)
+	})
+}
+
 // Close is part of objstorage.Readable.
 func (*memReader) Close() error {
 	return nil
@@ -2,6 +2,7 @@ package sstable
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
@@ -69,7 +70,7 @@ func TestRewriteSuffixProps(t *testing.T) {
 
 			var sstBytes [2][]byte
 			adjustPropsForEffectiveFormat := func(effectiveFormat TableFormat) {
-				if effectiveFormat == TableFormatPebblev4 {
+				if effectiveFormat >= TableFormatPebblev4 {
 					expectedProps["obsolete-key"] = string([]byte{3})
 				} else {
 					delete(expectedProps, "obsolete-key")
@@ -145,6 +146,55 @@ func TestRewriteSuffixProps(t *testing.T) {
 	}
 }
 
+func TestRewriteSuffixPartitionedFilter(t *testing.T) {
+	from, to := []byte("_212"), []byte("_646")
+	wOpts := WriterOptions{
+		BlockSize:      100,
+		IndexBlockSize: 100,
+		FilterPolicy:   bloom.FilterPolicy(10),
+		FilterType:     PartitionedFilter,
+		Comparer:       test4bSuffixComparer,
+		TableFormat:    TableFormatPebblev6,
+	}
+	sst := make4bSuffixTestSST(t, wOpts, from, 1000, 0)
+	readerOpts := ReaderOptions{
+		Comparer: test4bSuffixComparer,
+		Filters:  map[string]base.FilterPolicy{wOpts.FilterPolicy.Name(): wOpts.FilterPolicy},
+	}
+	r, err := NewMemReader(sst, readerOpts)
+	require.NoError(t, err)
+	defer r.Close()
+	require.True(t, r.partitionedFilter)
+
+	// The partitioned filter is rebuilt, identically to the filter built by
+	// passing the rewritten keys through a writer.
+	rewrittenSST := &memFile{}
+	_, _, err = rewriteKeySuffixesInBlocks(r, rewrittenSST, wOpts, from, to, 2)
+	require.NoError(t, err)
+	viaWriterSST := &memFile{}
+	_, err = RewriteKeySuffixesViaWriter(r, viaWriterSST, wOpts, from, to)
+	require.NoError(t, err)
+	require.Equal(t, viaWriterSST.Data(), rewrittenSST.Data())
+
+	rRewritten, err := NewMemReader(rewrittenSST.Data(), readerOpts)
+	require.NoError(t, err)
+	defer rRewritten.Close()
+	require.True(t, rRewritten.partitionedFilter)
+	require.NoError(t, rRewritten.ValidateBlockChecksums())
+	iter, err := rRewritten.NewIter(NoTransforms, nil, nil)
+	require.NoError(t, err)
+	defer iter.Close()
+	var n int
+	for kv := iter.First(); kv != nil; kv = iter.Next() {
+		prefix := kv.K.UserKey[:test4bSuffixComparer.Split(kv.K.UserKey)]
+		mayContain, err := rRewritten.filterMayContain(context.Background(), prefix, kv.K.UserKey, nil, nil)
+		require.NoError(t, err)
+		require.True(t, mayContain, "%s", kv.K.UserKey)
+		n++
+	}
+	require.Equal(t, 1000, n)
+}
+
 // memFile is a file-like struct that buffers all data written to it in memory.
 // Implements the objstorage.Writable interface.
 type memFile struct {
@@ -181,6 +181,22 @@ Data blocks have some additional features:
     in the context of that sstable (for a reader that reads at a higher seqnum
     than the highest seqnum in the sstable). For details, see the comment in
     format.go.
+
+- For TableFormatPebblev5 onwards:
+  - Data blocks may contain a hash index after the restart points, mapping
+    user keys to restart points, signalled by the most significant bit of the
+    trailing number of restart points. See block_hash_index.go.
+
+For TableFormatPebblev6 onwards, the filter may be partitioned (see
+WriterOptions.FilterType). A partitioned filter is stored as a sequence of
+filter partitions, each encoded as a table-level filter, followed by a
+top-level filter index block. The top-level filter index has one entry per
+index partition, keyed by the same separator as the index partition, with the
+block handle of the filter partition as its value. The filter partition
+corresponding to an index partition contains the prefixes of all keys in the
+data blocks referenced by that index partition, plus the prefix of the first
+key of the next index partition. The metaindex block refers to the top-level
+filter index using the name "partitionedfilter.<policy name>".
 */
 
 const (
@@ -443,7 +459,8 @@ func supportsTwoLevelIndex(format TableFormat) bool {
 	switch format {
 	case TableFormatLevelDB:
 		return false
-	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2, TableFormatPebblev3, TableFormatPebblev4:
+	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2, TableFormatPebblev3,
+		TableFormatPebblev4, TableFormatPebblev5, TableFormatPebblev6:
 		return true
 	default:
 		panic("sstable: unspecified table format version")
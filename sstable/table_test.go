@@ -20,7 +20,10 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/testkeys"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/rangefilter"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/kr/pretty"
 	"github.com/stretchr/testify/require"
@@ -411,8 +414,9 @@ func TestWriterRoundTrip(t *testing.T) {
 	for _, blockSize := range blockSizes {
 		for _, indexBlockSize := range blockSizes {
 			for name, fp := range map[string]FilterPolicy{
-				"none":       nil,
-				"bloom10bit": bloom.FilterPolicy(10),
+				"none":        nil,
+				"bloom10bit":  bloom.FilterPolicy(10),
+				"ribbon10bit": ribbon.FilterPolicy(10),
 			} {
 				t.Run(fmt.Sprintf("bloom=%s", name), func(t *testing.T) {
 					fs := vfs.NewMem()
@@ -422,13 +426,125 @@ func TestWriterRoundTrip(t *testing.T) {
 					)
 					require.NoError(t, err)
 					// Check that we can read a freshly made table.
-					require.NoError(t, check(fs, "test.sst", nil, nil))
+					require.NoError(t, check(fs, "test.sst", nil, fp))
 				})
 			}
 		}
 	}
 }
 
+func TestPartitionedFilter(t *testing.T) {
+	for _, fp := range []FilterPolicy{bloom.FilterPolicy(10), ribbon.FilterPolicy(10)} {
+		for _, indexBlockSize := range []int{100, 1000, math.MaxInt32} {
+			t.Run(fmt.Sprintf("%s/indexBlockSize=%d", fp.Name(), indexBlockSize), func(t *testing.T) {
+				testPartitionedFilter(t, fp, indexBlockSize)
+			})
+		}
+	}
+}
+
+func testPartitionedFilter(t *testing.T, fp FilterPolicy, indexBlockSize int) {
+	fs := vfs.NewMem()
+	f, err := fs.Create("test.sst", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		BlockSize:      100,
+		IndexBlockSize: indexBlockSize,
+		FilterPolicy:   fp,
+		FilterType:     PartitionedFilter,
+		TableFormat:    TableFormatPebblev6,
+	})
+	wordCount := hamletWordCount()
+	for _, k := range wordCount.SortedKeys() {
+		require.NoError(t, w.Set([]byte(k), []byte(wordCount[k])))
+	}
+	require.NoError(t, w.Close())
+
+	c := &countingFilterPolicy{FilterPolicy: fp}
+	require.NoError(t, check(fs, "test.sst", nil, c))
+	require.Zero(t, c.falseNegatives)
+	require.Equal(t, len(wordCount), c.truePositives)
+	require.Less(t, c.falsePositives, c.trueNegatives)
+
+	f, err = fs.Open("test.sst")
+	require.NoError(t, err)
+	r, err := newReader(f, ReaderOptions{
+		Filters: map[string]FilterPolicy{c.Name(): c},
+	})
+	require.NoError(t, err)
+	defer r.Close()
+	require.True(t, r.partitionedFilter)
+	l, err := r.Layout()
+	require.NoError(t, err)
+	require.Equal(t, max(1, int(r.Properties.IndexPartitions)), len(l.FilterPartitions))
+	require.NoError(t, r.ValidateBlockChecksums())
+}
+
+func TestRangeFilter(t *testing.T) {
+	fs := vfs.NewMem()
+	f, err := fs.Create("test.sst", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	fp := rangefilter.FilterPolicy(16)
+	w := NewWriter(objstorageprovider.NewFileWritable(f), WriterOptions{
+		Comparer:          testkeys.Comparer,
+		RangeFilterPolicy: fp,
+	})
+	for _, k := range []string{"apple@3", "apple@1", "banana@2", "cherry@5"} {
+		require.NoError(t, w.Set([]byte(k), []byte(k)))
+	}
+	require.NoError(t, w.Close())
+
+	open := func(rangeFilters map[string]RangeFilterPolicy) *Reader {
+		f, err := fs.Open("test.sst")
+		require.NoError(t, err)
+		r, err := newReader(f, ReaderOptions{
+			Comparer:     testkeys.Comparer,
+			RangeFilters: rangeFilters,
+		})
+		require.NoError(t, err)
+		return r
+	}
+
+	r := open(map[string]RangeFilterPolicy{fp.Name(): fp})
+	defer r.Close()
+	l, err := r.Layout()
+	require.NoError(t, err)
+	require.NotZero(t, l.RangeFilter.Length)
+	require.NoError(t, r.ValidateBlockChecksums())
+	for _, tc := range []struct {
+		lower, upper string
+		want         bool
+	}{
+		{"", "", true},
+		{"a", "b", true},
+		{"apple@9", "apple@0", true},
+		{"apples", "banana", true},
+		{"apples", "b", false},
+		{"blueberry", "c", false},
+		{"cherry@9", "", true},
+		{"d", "", false},
+		{"", "a", false},
+	} {
+		var lower, upper []byte
+		if tc.lower != "" {
+			lower = []byte(tc.lower)
+		}
+		if tc.upper != "" {
+			upper = []byte(tc.upper)
+		}
+		got, err := r.MayContainRange(context.Background(), lower, upper)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, got, "[%s, %s)", tc.lower, tc.upper)
+	}
+
+	// Without the policy, the range filter is ignored.
+	r2 := open(nil)
+	defer r2.Close()
+	got, err := r2.MayContainRange(context.Background(), []byte("d"), nil)
+	require.NoError(t, err)
+	require.True(t, got)
+}
+
 func TestFinalBlockIsWritten(t *testing.T) {
 	keys := []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J"}
 	valueLengths := []int{0, 1, 22, 28, 33, 40, 50, 61, 87, 100, 143, 200}
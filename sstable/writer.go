@@ -137,6 +137,7 @@ type Writer struct {
 	cache                   *cache.Cache
 	restartInterval         int
 	checksumType            ChecksumType
+	dataBlockHashIndex      bool
 	// disableKeyOrderChecks disables the checks that keys are added to an
 	// sstable in order. It is intended for internal use only in the construction
 	// of invalid sstables for testing. See tool/make_test_sstables.go.
@@ -174,6 +175,9 @@ type Writer struct {
 	// nil, or the full keys otherwise.
 	filter          filterWriter
 	indexPartitions []indexBlockAndBlockProperties
+	// rangeFilter accumulates the range filter block. If populated, the range
+	// filter ingests the key prefixes returned by w.split.
+	rangeFilter *rangeFilterWriter
 
 	// indexBlockAlloc is used to bulk-allocate byte slices used to store index
 	// blocks in indexPartitions. These live until the index finishes.
@@ -637,9 +641,10 @@ var dataBlockBufPool = sync.Pool{
 	},
 }
 
-func newDataBlockBuf(restartInterval int, checksumType ChecksumType) *dataBlockBuf {
+func newDataBlockBuf(restartInterval int, checksumType ChecksumType, hashIndex bool) *dataBlockBuf {
 	d := dataBlockBufPool.Get().(*dataBlockBuf)
 	d.dataBlock.restartInterval = restartInterval
+	d.dataBlock.hashIndex = hashIndex
 	d.checksummer.checksumType = checksumType
 	return d
 }
@@ -1370,6 +1375,18 @@ func (w *Writer) maybeAddToFilter(key []byte) {
 		prefix := key[:w.split(key)]
 		w.filter.addKey(prefix)
 	}
+	if w.rangeFilter != nil {
+		w.rangeFilter.addKey(key[:w.split(key)])
+	}
+}
+
+// maybeFinishDataBlockFilter informs the filter that a data block with index
+// separator sep was finished. newIndexPartition indicates that the data block
+// is the first data block of a new index partition.
+func (w *Writer) maybeFinishDataBlockFilter(sep InternalKey, newIndexPartition bool) {
+	if w.filter != nil {
+		w.filter.finishDataBlock(sep, newIndexPartition)
+	}
 }
 
 func (w *Writer) flush(key InternalKey) error {
@@ -1402,6 +1419,7 @@ func (w *Writer) flush(key InternalKey) error {
 	shouldFlushIndexBlock := supportsTwoLevelIndex(w.tableFormat) && w.indexBlock.shouldFlush(
 		sep, encodedBHPEstimatedSize, w.indexBlockSize, w.indexBlockSizeThreshold,
 	)
+	w.maybeFinishDataBlockFilter(sep, shouldFlushIndexBlock)
 
 	var indexProps []byte
 	var flushableIndexBlock *indexBlockBuf
@@ -1443,7 +1461,7 @@ func (w *Writer) flush(key InternalKey) error {
 	} else {
 		err = w.coordination.writeQueue.addSync(writeTask)
 	}
-	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType)
+	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType, w.dataBlockHashIndex)
 
 	return err
 }
@@ -1586,6 +1604,7 @@ func (w *Writer) addIndexEntrySep(
 		w.tableFormat) && w.indexBlock.shouldFlush(
 		sep, encodedBHPEstimatedSize, w.indexBlockSize, w.indexBlockSizeThreshold,
 	)
+	w.maybeFinishDataBlockFilter(sep, shouldFlush)
 	var flushableIndexBlock *indexBlockBuf
 	var props []byte
 	var err error
@@ -1913,18 +1932,20 @@ func (w *Writer) Close() (err error) {
 	var metaindex rawBlockWriter
 	metaindex.restartInterval = 1
 	if w.filter != nil {
-		b, err := w.filter.finish()
-		if err != nil {
-			return err
-		}
-		bh, err := w.writeBlock(b, NoCompression, &w.blockBuf)
+		// The filter size property is the total size of the filter blocks,
+		// excluding their trailers.
+		w.props.FilterSize = 0
+		bh, err := w.filter.writeFilter(func(b []byte, compression Compression) (BlockHandle, error) {
+			bh, err := w.writeBlock(b, compression, &w.blockBuf)
+			w.props.FilterSize += bh.Length
+			return bh, err
+		})
 		if err != nil {
 			return err
 		}
 		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
 		metaindex.add(InternalKey{UserKey: []byte(w.filter.metaName())}, w.blockBuf.tmp[:n])
 		w.props.FilterPolicyName = w.filter.policyName()
-		w.props.FilterSize = bh.Length
 	}
 
 	var indexBH BlockHandle
@@ -2021,6 +2042,15 @@ func (w *Writer) Close() (err error) {
 		metaindex.add(InternalKey{UserKey: []byte(metaRangeKeyName)}, w.blockBuf.tmp[:n])
 	}
 
+	if w.rangeFilter != nil && w.props.NumEntries > 0 {
+		bh, err := w.writeBlock(w.rangeFilter.finish(), NoCompression, &w.blockBuf)
+		if err != nil {
+			return err
+		}
+		n := encodeBlockHandle(w.blockBuf.tmp[:], bh)
+		metaindex.add(InternalKey{UserKey: []byte(w.rangeFilter.metaName())}, w.blockBuf.tmp[:n])
+	}
+
 	{
 		// Finish and record the prop collectors if props are not yet recorded.
 		// Pre-computed props might have been copied by specialized sst creators
@@ -2219,6 +2249,9 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 			Format: o.Comparer.FormatKey,
 		},
 	}
+	if w.tableFormat >= TableFormatPebblev5 {
+		w.dataBlockHashIndex = o.DataBlockHashIndex
+	}
 	if w.tableFormat >= TableFormatPebblev3 {
 		w.shortAttributeExtractor = o.ShortAttributeExtractor
 		w.requiredInPlaceValueBound = o.RequiredInPlaceValueBound
@@ -2230,7 +2263,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		}
 	}
 
-	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType)
+	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType, w.dataBlockHashIndex)
 
 	w.blockBuf = blockBuf{
 		checksummer: checksummer{checksumType: o.Checksum},
@@ -2257,11 +2290,21 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		switch o.FilterType {
 		case TableFilter:
 			w.filter = newTableFilterWriter(o.FilterPolicy)
+		case PartitionedFilter:
+			if w.tableFormat >= TableFormatPebblev6 {
+				w.filter = newPartitionedFilterWriter(o.FilterPolicy, w.compression)
+			} else {
+				w.filter = newTableFilterWriter(o.FilterPolicy)
+			}
 		default:
 			panic(fmt.Sprintf("unknown filter type: %v", o.FilterType))
 		}
 	}
 
+	if o.RangeFilterPolicy != nil {
+		w.rangeFilter = newRangeFilterWriter(o.RangeFilterPolicy)
+	}
+
 	w.props.ComparerName = o.Comparer.Name
 	w.props.CompressionName = o.Compression.String()
 	w.props.MergerName = o.MergerName
@@ -270,6 +270,38 @@ func (c *tableCacheContainer) withReader(meta physicalMeta, fn func(*sstable.Rea
 	return fn(v.reader)
 }
 
+// withBackingReader fetches the Reader of a backing table. The Reader is shared
+// by all the virtual tables that use the backing.
+func (c *tableCacheContainer) withBackingReader(
+	backing *fileBacking, fn func(*sstable.Reader) error,
+) error {
+	s := c.tableCache.getShard(backing.DiskFileNum)
+	v := s.findNode(backing, &c.dbOpts)
+	defer s.unrefValue(v)
+	if v.err != nil {
+		return v.err
+	}
+	return fn(v.reader)
+}
+
+// withReaders fetches the Readers of the given backing tables, and calls fn
+// with them while holding references on all of them.
+func (c *tableCacheContainer) withReaders(
+	backings []*fileBacking, fn func([]*sstable.Reader) error,
+) error {
+	readers := make([]*sstable.Reader, 0, len(backings))
+	for _, b := range backings {
+		s := c.tableCache.getShard(b.DiskFileNum)
+		v := s.findNode(b, &c.dbOpts)
+		defer s.unrefValue(v)
+		if v.err != nil {
+			return v.err
+		}
+		readers = append(readers, v.reader)
+	}
+	return fn(readers)
+}
+
 // withVirtualReader fetches a VirtualReader associated with a virtual sstable.
 func (c *tableCacheContainer) withVirtualReader(
 	meta virtualMeta, fn func(sstable.VirtualReader) error,
@@ -555,6 +587,21 @@ func (c *tableCacheShard) newPointIter(
 			// No point keys within the table match the filters.
 			return nil, nil
 		}
+
+		// Consult the table's range filter, if any, to avoid reading the index
+		// of a table that contains no keys within the iterator's bounds. The
+		// range filter holds unprefixed keys, so it cannot be used for tables
+		// with a synthetic prefix. Compactions read all keys within their
+		// bounds, so they gain nothing from it.
+		if internalOpts.useRangeFilter && !internalOpts.compaction && !file.SyntheticPrefix.IsSet() &&
+			(opts.LowerBound != nil || opts.UpperBound != nil) {
+			ok, err := v.reader.MayContainRange(ctx, opts.LowerBound, opts.UpperBound)
+			if err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, nil
+			}
+		}
 	}
 
 	var iter sstable.Iterator
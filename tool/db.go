@@ -19,6 +19,7 @@ import (
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/humanize"
 	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/mergers"
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/record"
@@ -202,7 +203,7 @@ specified database.
 		cmd.Flags().StringVar(
 			&d.comparerName, "comparer", "", "comparer name (use default if empty)")
 		cmd.Flags().StringVar(
-			&d.mergerName, "merger", "", "merger name (use default if empty)")
+			&d.mergerName, "merger", "", "merger name, e.g. pebble.int64.add (use default if empty)")
 	}
 
 	for _, cmd := range []*cobra.Command{d.Scan, d.Get} {
@@ -259,12 +260,7 @@ func (d *dbT) loadOptions(dir string) error {
 			}
 			return nil, errors.Errorf("unknown comparer %q", errors.Safe(name))
 		},
-		NewMerger: func(name string) (*pebble.Merger, error) {
-			if m := d.mergers[name]; m != nil {
-				return m, nil
-			}
-			return nil, errors.Errorf("unknown merger %q", errors.Safe(name))
-		},
+		NewMerger: d.lookupMerger,
 		SkipUnknown: func(name, value string) bool {
 			return true
 		},
@@ -314,6 +310,19 @@ func (d *dbT) loadOptions(dir string) error {
 	return nil
 }
 
+// lookupMerger returns the merger with the given name, which is either a
+// registered merger or a merger of the mergers package, like the mergers
+// returned by mergers.NewAppend (see mergers.ByName).
+func (d *dbT) lookupMerger(name string) (*pebble.Merger, error) {
+	if m := d.mergers[name]; m != nil {
+		return m, nil
+	}
+	if m, err := mergers.ByName(name); err == nil {
+		return m, nil
+	}
+	return nil, errors.Errorf("unknown merger %q", errors.Safe(name))
+}
+
 // OpenOption is an option that may be applied to the *pebble.Options before
 // calling pebble.Open.
 type OpenOption interface {
@@ -342,9 +351,9 @@ func (d *dbT) openDBInternal(dir string, openOptions ...OpenOption) (*pebble.DB,
 		}
 	}
 	if d.mergerName != "" {
-		d.opts.Merger = d.mergers[d.mergerName]
-		if d.opts.Merger == nil {
-			return nil, errors.Errorf("unknown merger %q", errors.Safe(d.mergerName))
+		var err error
+		if d.opts.Merger, err = d.lookupMerger(d.mergerName); err != nil {
+			return nil, err
 		}
 	}
 	opts := *d.opts
@@ -0,0 +1,264 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/humanize"
+	"github.com/cockroachdb/pebble/internal/manifest"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
+	"github.com/cockroachdb/pebble/objstorage/objstorageprovider/remoteobjcat"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+)
+
+// remoteT implements tools for the remote storage.
+type remoteT struct {
+	Root *cobra.Command
+	GC   *cobra.Command
+
+	locator             string
+	gracePeriod         time.Duration
+	statePath           string
+	dryRun              bool
+	includeUnreferenced bool
+
+	opts *pebble.Options
+}
+
+func newRemote(opts *pebble.Options) *remoteT {
+	r := &remoteT{
+		opts: opts,
+	}
+
+	r.Root = &cobra.Command{
+		Use:   "remote",
+		Short: "remote storage tools",
+	}
+
+	r.GC = &cobra.Command{
+		Use:   "gc <db-dirs>",
+		Short: "delete orphaned objects from remote storage",
+		Long: `
+Find the objects in the remote storage that are no longer referenced by any of
+the given stores and delete those that have been orphaned for longer than the
+grace period. The stores must include every live store that uses the remote
+storage; the objects that are only referenced by other stores (for example
+decommissioned nodes) are considered orphaned.
+
+The time at which each orphaned object was first observed is recorded in the
+state file, which must be preserved between runs for the grace period to
+elapse. The state file is updated even in dry-run mode.
+`,
+		Args: cobra.MinimumNArgs(1),
+		Run:  r.runGC,
+	}
+	r.GC.Flags().StringVar(&r.locator, "locator", "", "locator of the remote storage")
+	r.GC.Flags().DurationVar(&r.gracePeriod, "grace-period", 24*time.Hour,
+		"minimum time an object must be orphaned before it is deleted")
+	r.GC.Flags().StringVar(&r.statePath, "state", "",
+		"path of the file recording when orphaned objects were first seen (required unless the grace period is 0)")
+	r.GC.Flags().BoolVar(&r.dryRun, "dry-run", false, "report the orphaned objects without deleting them")
+	r.GC.Flags().BoolVar(&r.includeUnreferenced, "include-unreferenced", false,
+		"also delete objects that have no ref markers; unsafe if objects are created with SharedNoCleanup")
+	r.Root.AddCommand(r.GC)
+
+	return r
+}
+
+func (r *remoteT) runGC(cmd *cobra.Command, args []string) {
+	stdout, stderr := cmd.OutOrStdout(), cmd.OutOrStderr()
+	if err := r.runGCInternal(stdout, args); err != nil {
+		fmt.Fprintf(stderr, "%s\n", err)
+	}
+}
+
+func (r *remoteT) runGCInternal(stdout io.Writer, dirs []string) error {
+	if r.opts.Experimental.RemoteStorage == nil {
+		return errors.New("remote storage is not configured")
+	}
+	if r.statePath == "" && r.gracePeriod != 0 {
+		return errors.New("--state is required when the grace period is not 0")
+	}
+	storage, err := r.opts.Experimental.RemoteStorage.CreateStorage(remote.Locator(r.locator))
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	stores := make([]objstorageprovider.RemoteGCStore, len(dirs))
+	for i, dir := range dirs {
+		if stores[i], err = r.loadStore(dir); err != nil {
+			return errors.Wrapf(err, "%s", dir)
+		}
+		if !stores[i].Catalog.CreatorID.IsSet() {
+			fmt.Fprintf(stdout, "%s: no creator ID; the store does not use shared objects\n", dir)
+		}
+	}
+
+	firstSeen, err := r.readState()
+	if err != nil {
+		return err
+	}
+	report, gcErr := objstorageprovider.RemoteGC(objstorageprovider.RemoteGCOptions{
+		Storage:             storage,
+		Locator:             remote.Locator(r.locator),
+		Stores:              stores,
+		GracePeriod:         r.gracePeriod,
+		FirstSeen:           firstSeen,
+		IncludeUnreferenced: r.includeUnreferenced,
+		DryRun:              r.dryRun,
+		Now:                 timeNow,
+	})
+	// Write the state even if the collection failed part way, so that the
+	// deleted objects are forgotten.
+	if err := r.writeState(firstSeen); err != nil {
+		return errors.CombineErrors(gcErr, err)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 2, 1, 2, ' ', 0)
+	for _, o := range report.Orphans {
+		status := "pending"
+		switch {
+		case o.Deleted:
+			status = "deleted"
+		case o.Eligible:
+			status = "eligible"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\tfirst seen %s\t%s\n", o.Name, humanize.Bytes.Int64(o.Size), status,
+			o.FirstSeen.UTC().Format(time.RFC3339), o.Reason)
+	}
+	_ = tw.Flush()
+	deleted, deletedBytes := report.Deleted()
+	pending, pendingBytes := report.Pending()
+	fmt.Fprintf(stdout, "orphaned: %d objects (%s)\n", deleted+pending, humanize.Bytes.Int64(deletedBytes+pendingBytes))
+	fmt.Fprintf(stdout, "deleted: %d objects (%s)\n", deleted, humanize.Bytes.Int64(deletedBytes))
+	fmt.Fprintf(stdout, "obsolete in stores (not orphaned): %d objects (%s)\n",
+		report.ObsoleteInStores, humanize.Bytes.Int64(report.ObsoleteInStoresBytes))
+	return gcErr
+}
+
+// loadStore reads the remote object catalog and the MANIFEST of a store,
+// without modifying any files.
+func (r *remoteT) loadStore(dir string) (objstorageprovider.RemoteGCStore, error) {
+	var store objstorageprovider.RemoteGCStore
+	var err error
+	if store.Catalog, err = remoteobjcat.ReadContents(r.opts.FS, dir); err != nil {
+		return store, err
+	}
+	desc, err := pebble.Peek(dir, r.opts.FS)
+	if err != nil {
+		return store, err
+	}
+	if !desc.Exists {
+		return store, errors.New("no database found")
+	}
+	store.LiveBackings, err = readLiveBackings(r.opts, desc.ManifestFilename)
+	return store, err
+}
+
+// readLiveBackings replays a MANIFEST and returns the file numbers of the
+// backing tables referenced by the latest version.
+func readLiveBackings(opts *pebble.Options, path string) (map[base.DiskFileNum]struct{}, error) {
+	f, err := opts.FS.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// tables maps the tables in the latest version to their backing file number.
+	tables := make(map[base.FileNum]base.DiskFileNum)
+	rr := record.NewReader(f, 0 /* logNum */)
+	for {
+		rec, err := rr.Next()
+		if err == io.EOF || record.IsInvalidRecord(err) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		var ve manifest.VersionEdit
+		if err := ve.Decode(rec); err != nil {
+			return nil, err
+		}
+		for df := range ve.DeletedFiles {
+			delete(tables, df.FileNum)
+		}
+		for _, nf := range ve.NewFiles {
+			backing := base.PhysicalTableDiskFileNum(nf.Meta.FileNum)
+			if nf.Meta.Virtual {
+				backing = nf.BackingFileNum
+			}
+			tables[nf.Meta.FileNum] = backing
+		}
+	}
+	res := make(map[base.DiskFileNum]struct{}, len(tables))
+	for _, backing := range tables {
+		res[backing] = struct{}{}
+	}
+	return res, nil
+}
+
+// readState reads the state file, which contains a line for each orphaned
+// object with the time it was first observed and its name.
+func (r *remoteT) readState() (map[string]time.Time, error) {
+	res := make(map[string]time.Time)
+	if r.statePath == "" {
+		return res, nil
+	}
+	f, err := r.opts.FS.Open(r.statePath)
+	if oserror.IsNotExist(err) {
+		return res, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		ts, name, ok := strings.Cut(s.Text(), " ")
+		if !ok {
+			return nil, errors.Newf("invalid line in state file %q: %q", r.statePath, s.Text())
+		}
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid line in state file %q", r.statePath)
+		}
+		res[name] = t
+	}
+	return res, s.Err()
+}
+
+func (r *remoteT) writeState(firstSeen map[string]time.Time) error {
+	if r.statePath == "" {
+		return nil
+	}
+	tmpPath := r.statePath + ".tmp"
+	f, err := r.opts.FS.Create(tmpPath, vfs.WriteCategoryUnspecified)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for name, t := range firstSeen {
+		fmt.Fprintf(w, "%s %s\n", t.UTC().Format(time.RFC3339Nano), name)
+	}
+	if err := errors.CombineErrors(w.Flush(), f.Sync()); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return r.opts.FS.Rename(tmpPath, r.statePath)
+}
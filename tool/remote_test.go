@@ -0,0 +1,122 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package tool
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// unclosableStorage wraps a remote.Storage and ignores Close, so that the
+// in-memory storage survives the DBs and tools that use it.
+type unclosableStorage struct {
+	remote.Storage
+}
+
+func (unclosableStorage) Close() error { return nil }
+
+func TestRemoteGC(t *testing.T) {
+	fs := vfs.NewMem()
+	storage := unclosableStorage{remote.NewInMem()}
+	factory := remote.MakeSimpleFactory(map[remote.Locator]remote.Storage{"": storage})
+
+	// Create two stores that share the storage.
+	open := func(dir string, creatorID uint64) *pebble.DB {
+		opts := &pebble.Options{FS: fs}
+		opts.Experimental.RemoteStorage = factory
+		opts.Experimental.CreateOnShared = remote.CreateOnSharedAll
+		d, err := pebble.Open(dir, opts)
+		require.NoError(t, err)
+		require.NoError(t, d.SetCreatorID(creatorID))
+		return d
+	}
+	populate := func(d *pebble.DB, prefix string) {
+		for j := 0; j < 3; j++ {
+			require.NoError(t, d.Set([]byte(fmt.Sprintf("%s-%d", prefix, j)), []byte("value"), nil))
+			require.NoError(t, d.Flush())
+		}
+		require.NoError(t, d.Close())
+	}
+	objects := func() []string {
+		names, err := storage.List("", "")
+		require.NoError(t, err)
+		return names
+	}
+	populate(open("db1", 1), "db1")
+	n1 := len(objects())
+	// Store 2 is decommissioned without cleaning up its objects.
+	populate(open("db2", 2), "db2")
+	n := len(objects())
+	n2 := n - n1
+	require.Greater(t, n1, 0)
+	require.Greater(t, n2, 0)
+
+	run := func(now time.Time, args ...string) string {
+		timeNow = func() time.Time { return now }
+		defer func() { timeNow = time.Now }()
+		tool := New(FS(fs))
+		tool.ConfigureSharedStorage(factory, remote.CreateOnSharedAll, "")
+		var buf bytes.Buffer
+		c := &cobra.Command{}
+		c.AddCommand(tool.Commands...)
+		c.SetArgs(append([]string{"remote", "gc"}, args...))
+		c.SetOut(&buf)
+		c.SetErr(&buf)
+		require.NoError(t, c.Execute())
+		return buf.String()
+	}
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	out := run(t0, "db1")
+	require.Contains(t, out, "--state is required")
+
+	out = run(t0, "--state", "gc-state", "--dry-run", "db1")
+	require.Contains(t, out, fmt.Sprintf("orphaned: %d objects", n2))
+	require.Contains(t, out, "deleted: 0 objects")
+	require.Contains(t, out, "creator 2 is not a known store")
+	require.Equal(t, n2, strings.Count(out, "pending"))
+	require.Len(t, objects(), n)
+
+	// The grace period has not passed yet.
+	out = run(t0.Add(time.Hour), "--state", "gc-state", "db1")
+	require.Equal(t, n2, strings.Count(out, "pending"))
+	require.Len(t, objects(), n)
+
+	out = run(t0.Add(25*time.Hour), "--state", "gc-state", "--dry-run", "db1")
+	require.Equal(t, n2, strings.Count(out, "eligible"))
+	require.Len(t, objects(), n)
+
+	out = run(t0.Add(25*time.Hour), "--state", "gc-state", "db1")
+	require.Contains(t, out, fmt.Sprintf("deleted: %d objects", n2))
+	require.Len(t, objects(), n1)
+	for _, name := range objects() {
+		require.True(t, strings.HasSuffix(name, ".sst") || strings.Contains(name, ".ref.1."), name)
+	}
+
+	// Store 1 is still usable.
+	opts := &pebble.Options{FS: fs}
+	opts.Experimental.RemoteStorage = factory
+	d1, err := pebble.Open("db1", opts)
+	require.NoError(t, err)
+	for j := 0; j < 3; j++ {
+		v, closer, err := d1.Get([]byte(fmt.Sprintf("db1-%d", j)))
+		require.NoError(t, err)
+		require.Equal(t, "value", string(v))
+		require.NoError(t, closer.Close())
+	}
+	require.NoError(t, d1.Close())
+
+	out = run(t0.Add(26*time.Hour), "--state", "gc-state", "db1", "db2")
+	require.Contains(t, out, "orphaned: 0 objects")
+}
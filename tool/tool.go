@@ -8,7 +8,9 @@ import (
 	"github.com/cockroachdb/pebble"
 	"github.com/cockroachdb/pebble/bloom"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/mergers"
 	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/ribbon"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/spf13/cobra"
@@ -30,6 +32,7 @@ type T struct {
 	find            *findT
 	lsm             *lsmT
 	manifest        *manifestT
+	remote          *remoteT
 	remotecat       *remoteCatalogT
 	sstable         *sstableT
 	wal             *walT
@@ -138,8 +141,9 @@ func New(opts ...Option) *T {
 
 	opts = append(opts,
 		Comparers(base.DefaultComparer),
-		Filters(bloom.FilterPolicy(10)),
-		Mergers(base.DefaultMerger))
+		Filters(bloom.FilterPolicy(10), ribbon.FilterPolicy(10)),
+		Mergers(base.DefaultMerger),
+		Mergers(mergers.All()...))
 
 	for _, opt := range opts {
 		opt(t)
@@ -149,6 +153,7 @@ func New(opts ...Option) *T {
 	t.find = newFind(&t.opts, t.comparers, t.defaultComparer, t.mergers)
 	t.lsm = newLSM(&t.opts, t.comparers)
 	t.manifest = newManifest(&t.opts, t.comparers)
+	t.remote = newRemote(&t.opts)
 	t.remotecat = newRemoteCatalog(&t.opts)
 	t.sstable = newSSTable(&t.opts, t.comparers, t.mergers)
 	t.wal = newWAL(&t.opts, t.comparers, t.defaultComparer)
@@ -157,6 +162,7 @@ func New(opts ...Option) *T {
 		t.find.Root,
 		t.lsm.Root,
 		t.manifest.Root,
+		t.remote.Root,
 		t.remotecat.Root,
 		t.sstable.Root,
 		t.wal.Root,
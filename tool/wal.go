@@ -118,6 +118,16 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 					return
 				}
 
+				// The log files of a striped WAL begin with a header, and
+				// contain empty records written to sync them.
+				if index, n, ok := wal.ParseStripeHeader(buf.Bytes()); ok {
+					fmt.Fprintf(stdout, "%d(%d) stripe %d of %d\n", offset, buf.Len(), index, n)
+					continue
+				} else if buf.Len() == 0 {
+					fmt.Fprintf(stdout, "%d(0) sync\n", offset)
+					continue
+				}
+
 				b = pebble.Batch{}
 				if err := b.SetRepr(buf.Bytes()); err != nil {
 					fmt.Fprintf(stdout, "corrupt batch within log file %q: %v", arg, err)
@@ -163,6 +173,10 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 					case base.InternalKeyKindDeleteSized:
 						v, _ := binary.Uvarint(value)
 						fmt.Fprintf(stdout, "%s,%d", w.fmtKey.fn(ukey), v)
+					case base.InternalKeyKindAssertAbsent, base.InternalKeyKindAssertExists:
+						fmt.Fprintf(stdout, "%s", w.fmtKey.fn(ukey))
+					case base.InternalKeyKindAssertValue:
+						fmt.Fprintf(stdout, "%s,%s", w.fmtKey.fn(ukey), w.fmtValue.fn(ukey, value))
 					}
 					fmt.Fprintf(stdout, ")\n")
 				}
@@ -422,6 +422,10 @@ func (vs *versionSet) logUnlock() {
 // (see logLock). Will unconditionally release the manifest lock (via
 // logUnlock) even if an error occurs.
 //
+// In a read-only DB (see Options.ReadOnly), the version edit is only applied
+// in memory: the MANIFEST is neither written nor rotated. This is how replicas
+// (see OpenReplica) install the versions they refresh.
+//
 // inProgressCompactions is called while DB.mu is held, to get the list of
 // in-progress compactions.
 func (vs *versionSet) logAndApply(
@@ -512,9 +516,10 @@ func (vs *versionSet) logAndApply(
 	//
 	// The logic below uses the min of the last snapshot file count and the file
 	// count in the current version.
+	inMemory := vs.opts.ReadOnly
 	vs.rotationHelper.AddRecord(int64(len(ve.DeletedFiles) + len(ve.NewFiles)))
-	sizeExceeded := vs.manifest.Size() >= vs.opts.MaxManifestFileSize
-	requireRotation := forceRotation || vs.manifest == nil
+	sizeExceeded := !inMemory && vs.manifest.Size() >= vs.opts.MaxManifestFileSize
+	requireRotation := !inMemory && (forceRotation || vs.manifest == nil)
 
 	var nextSnapshotFilecount int64
 	for i := range vs.metrics.Levels {
@@ -563,6 +568,9 @@ func (vs *versionSet) logAndApply(
 		if err != nil {
 			return errors.Wrap(err, "MANIFEST apply failed")
 		}
+		if inMemory {
+			return nil
+		}
 
 		if newManifestFileNum != 0 {
 			if err := vs.createManifest(vs.dirname, newManifestFileNum, minUnflushedLogNum, nextFileNum, newManifestVirtualBackings); err != nil {
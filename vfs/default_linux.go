@@ -42,6 +42,7 @@ type linuxDir struct {
 }
 
 func (d *linuxDir) Prefetch(offset int64, length int64) error      { return nil }
+func (d *linuxDir) ReadBatch(reqs []ReadRequest) error             { return ReadBatchConcurrently(d, reqs) }
 func (d *linuxDir) Preallocate(offset, length int64) error         { return nil }
 func (d *linuxDir) SyncData() error                                { return d.Sync() }
 func (d *linuxDir) SyncTo(offset int64) (fullSync bool, err error) { return false, nil }
@@ -35,6 +35,7 @@ type unixFile struct {
 }
 
 func (*unixFile) Prefetch(offset int64, length int64) error { return nil }
+func (f *unixFile) ReadBatch(reqs []ReadRequest) error      { return ReadBatchConcurrently(f, reqs) }
 func (*unixFile) Preallocate(offset, length int64) error    { return nil }
 
 func (f *unixFile) SyncData() error {
@@ -37,6 +37,7 @@ type windowsDir struct {
 }
 
 func (*windowsDir) Prefetch(offset int64, length int64) error { return nil }
+func (d *windowsDir) ReadBatch(reqs []ReadRequest) error      { return ReadBatchConcurrently(d, reqs) }
 func (*windowsDir) Preallocate(off, length int64) error       { return nil }
 
 // Silently ignore Sync() on Windows. This is the same behavior as
@@ -50,6 +51,7 @@ type windowsFile struct {
 }
 
 func (*windowsFile) Prefetch(offset int64, length int64) error { return nil }
+func (f *windowsFile) ReadBatch(reqs []ReadRequest) error      { return ReadBatchConcurrently(f, reqs) }
 func (*windowsFile) Preallocate(offset, length int64) error    { return nil }
 
 func (f *windowsFile) SyncData() error { return f.Sync() }
@@ -0,0 +1,53 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"unsafe"
+
+	"github.com/cockroachdb/errors"
+)
+
+// DirectIOAlignment is the alignment of the offsets, lengths and memory
+// buffers of the reads and writes of files that use direct I/O. It is the
+// page size, which is a multiple of the logical block size of all common
+// devices.
+const DirectIOAlignment = 4096
+
+// ErrDirectIOUnsupported is returned by SetDirectIO if the file does not
+// support direct I/O, e.g. because it is not backed by an OS file or because
+// the filesystem (e.g. tmpfs) does not support it.
+var ErrDirectIOUnsupported = errors.New("pebble: direct I/O is not supported")
+
+// SetDirectIO enables or disables direct I/O for the file, i.e. O_DIRECT on
+// Linux. With direct I/O, reads and writes bypass the OS page cache; their
+// offsets, lengths and buffers must be aligned to DirectIOAlignment (see
+// AlignedBuf). Returns ErrDirectIOUnsupported if the file does not support it,
+// in which case the file is unchanged.
+func SetDirectIO(f File, enabled bool) error {
+	fd := f.Fd()
+	if fd == InvalidFd {
+		return ErrDirectIOUnsupported
+	}
+	return setDirectIO(fd, enabled)
+}
+
+// AlignedBuf returns a buffer of length n whose address is aligned to
+// DirectIOAlignment, which can be used for direct I/O.
+func AlignedBuf(n int) []byte {
+	buf := make([]byte, n+DirectIOAlignment)
+	shift := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (DirectIOAlignment - 1)); rem != 0 {
+		shift = DirectIOAlignment - rem
+	}
+	return buf[shift : shift+n : shift+n]
+}
+
+// IsAligned returns true if the buffer can be used for direct I/O, i.e. if its
+// address and length are aligned to DirectIOAlignment.
+func IsAligned(buf []byte) bool {
+	return len(buf)%DirectIOAlignment == 0 &&
+		(len(buf) == 0 || uintptr(unsafe.Pointer(&buf[0]))%DirectIOAlignment == 0)
+}
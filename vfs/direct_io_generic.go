@@ -0,0 +1,15 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package vfs
+
+func setDirectIO(fd uintptr, enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	return ErrDirectIOUnsupported
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlignedBuf(t *testing.T) {
+	for _, n := range []int{DirectIOAlignment, 3 * DirectIOAlignment, 100 << 10} {
+		buf := AlignedBuf(n)
+		require.Len(t, buf, n)
+		require.True(t, IsAligned(buf))
+		require.False(t, IsAligned(buf[1:]))
+		require.False(t, IsAligned(buf[:n-1]))
+	}
+}
+
+func TestSetDirectIO(t *testing.T) {
+	mem := NewMem()
+	f, err := mem.Create("foo", WriteCategoryUnspecified)
+	require.NoError(t, err)
+	require.ErrorIs(t, SetDirectIO(f, true), ErrDirectIOUnsupported)
+	require.NoError(t, f.Close())
+
+	f, err = Default.Create(filepath.Join(t.TempDir(), "foo"), WriteCategoryUnspecified)
+	require.NoError(t, err)
+	defer f.Close()
+	if err := SetDirectIO(f, true); err == ErrDirectIOUnsupported {
+		t.Skip("direct I/O is not supported by the filesystem")
+	} else {
+		require.NoError(t, err)
+	}
+	buf := AlignedBuf(2 * DirectIOAlignment)
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	_, err = f.Write(buf)
+	require.NoError(t, err)
+	// The unaligned tail is written after disabling direct I/O.
+	require.NoError(t, SetDirectIO(f, false))
+	_, err = f.Write([]byte("tail"))
+	require.NoError(t, err)
+	require.NoError(t, SetDirectIO(f, true))
+
+	// Aligned reads into aligned buffers; the last read is short.
+	res := AlignedBuf(DirectIOAlignment)
+	n, err := f.ReadAt(res, DirectIOAlignment)
+	require.NoError(t, err)
+	require.Equal(t, DirectIOAlignment, n)
+	require.Equal(t, buf[DirectIOAlignment:], res)
+	n, err = f.ReadAt(res, 2*DirectIOAlignment)
+	require.Equal(t, io.EOF, err)
+	require.True(t, bytes.Equal([]byte("tail"), res[:n]))
+}
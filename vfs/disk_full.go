@@ -376,6 +376,10 @@ func (f *enospcFile) ReadAt(p []byte, off int64) (n int, err error) {
 	return f.inner.ReadAt(p, off)
 }
 
+func (f *enospcFile) ReadBatch(reqs []ReadRequest) error {
+	return f.inner.ReadBatch(reqs)
+}
+
 func (f *enospcFile) Write(p []byte) (n int, err error) {
 	gen := f.fs.waitUntilReady()
 
@@ -292,6 +292,11 @@ func (d *diskHealthCheckingFile) ReadAt(p []byte, off int64) (int, error) {
 	return d.file.ReadAt(p, off)
 }
 
+// ReadBatch implements (vfs.File).ReadBatch.
+func (d *diskHealthCheckingFile) ReadBatch(reqs []ReadRequest) error {
+	return d.file.ReadBatch(reqs)
+}
+
 // Write implements the io.Writer interface.
 func (d *diskHealthCheckingFile) Write(p []byte) (n int, err error) {
 	d.timeDiskOp(OpTypeWrite, int64(len(p)), func() {
@@ -48,6 +48,10 @@ func (m mockFile) Prefetch(offset, length int64) error {
 	panic("unimplemented")
 }
 
+func (m mockFile) ReadBatch(reqs []ReadRequest) error {
+	panic("unimplemented")
+}
+
 func (m mockFile) Preallocate(int64, int64) error {
 	time.Sleep(m.syncAndWriteDuration)
 	return nil
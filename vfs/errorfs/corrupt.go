@@ -0,0 +1,68 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package errorfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Corruptor may be implemented by an Injector to corrupt the data read from
+// files, rather than injecting errors. If the Injector of an FS implements
+// Corruptor, MaybeCorrupt is invoked with the data returned by every read
+// operation that didn't inject an error.
+type Corruptor interface {
+	// MaybeCorrupt is invoked with the data p returned by a read operation, which
+	// was read at op.Offset within the file. It may modify p.
+	MaybeCorrupt(op Op, p []byte)
+}
+
+// CorruptAt returns an Injector that doesn't inject errors, but corrupts the
+// data read from the files for which the predicate evaluates to true: the bits
+// of the bytes at the given file offsets are flipped. A nil predicate matches
+// all the files.
+func CorruptAt(p Predicate, offsets ...int64) Injector {
+	return &corruptAt{pred: p, offsets: offsets}
+}
+
+type corruptAt struct {
+	pred    Predicate
+	offsets []int64
+}
+
+// String implements fmt.Stringer.
+func (c *corruptAt) String() string {
+	var sb strings.Builder
+	sb.WriteString("(CorruptAt")
+	if c.pred != nil {
+		fmt.Fprintf(&sb, " %s", c.pred)
+	}
+	for _, off := range c.offsets {
+		fmt.Fprintf(&sb, " %d", off)
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// MaybeError implements Injector.
+func (c *corruptAt) MaybeError(op Op) error { return nil }
+
+// MaybeCorrupt implements Corruptor.
+func (c *corruptAt) MaybeCorrupt(op Op, p []byte) {
+	if c.pred != nil && !c.pred.Evaluate(op) {
+		return
+	}
+	for _, off := range c.offsets {
+		if off >= op.Offset && off < op.Offset+int64(len(p)) {
+			p[off-op.Offset] ^= 0xff
+		}
+	}
+}
+
+func maybeCorrupt(inj Injector, op Op, p []byte) {
+	if c, ok := inj.(Corruptor); ok && len(p) > 0 {
+		c.MaybeCorrupt(op, p)
+	}
+}
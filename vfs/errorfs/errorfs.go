@@ -30,8 +30,8 @@ type Op struct {
 	Kind OpKind
 	// Path is the path of the file of the file being operated on.
 	Path string
-	// Offset is the offset of an operation. It's set for OpFileReadAt and
-	// OpFileWriteAt operations.
+	// Offset is the offset of an operation. It's set for OpFileRead,
+	// OpFileReadAt and OpFileWriteAt operations.
 	Offset int64
 }
 
@@ -307,7 +307,7 @@ func (fs *FS) Create(name string, category vfs.DiskWriteCategory) (vfs.File, err
 	if err != nil {
 		return nil, err
 	}
-	return &errorFile{name, f, fs.inj}, nil
+	return &errorFile{path: name, file: f, inj: fs.inj}, nil
 }
 
 // Link implements FS.Link.
@@ -327,7 +327,7 @@ func (fs *FS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	ef := &errorFile{name, f, fs.inj}
+	ef := &errorFile{path: name, file: f, inj: fs.inj}
 	for _, opt := range opts {
 		opt.Apply(ef)
 	}
@@ -345,7 +345,7 @@ func (fs *FS) OpenReadWrite(
 	if err != nil {
 		return nil, err
 	}
-	ef := &errorFile{name, f, fs.inj}
+	ef := &errorFile{path: name, file: f, inj: fs.inj}
 	for _, opt := range opts {
 		opt.Apply(ef)
 	}
@@ -361,7 +361,7 @@ func (fs *FS) OpenDir(name string) (vfs.File, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &errorFile{name, f, fs.inj}, nil
+	return &errorFile{path: name, file: f, inj: fs.inj}, nil
 }
 
 // GetDiskUsage implements FS.GetDiskUsage.
@@ -463,6 +463,8 @@ type errorFile struct {
 	path string
 	file vfs.File
 	inj  Injector
+	// readOffset is the offset of the next Read.
+	readOffset int64
 }
 
 func (f *errorFile) Close() error {
@@ -472,21 +474,47 @@ func (f *errorFile) Close() error {
 }
 
 func (f *errorFile) Read(p []byte) (int, error) {
-	if err := f.inj.MaybeError(Op{Kind: OpFileRead, Path: f.path}); err != nil {
+	op := Op{Kind: OpFileRead, Path: f.path, Offset: f.readOffset}
+	if err := f.inj.MaybeError(op); err != nil {
 		return 0, err
 	}
-	return f.file.Read(p)
+	n, err := f.file.Read(p)
+	f.readOffset += int64(n)
+	maybeCorrupt(f.inj, op, p[:n])
+	return n, err
 }
 
 func (f *errorFile) ReadAt(p []byte, off int64) (int, error) {
-	if err := f.inj.MaybeError(Op{
+	op := Op{
 		Kind:   OpFileReadAt,
 		Path:   f.path,
 		Offset: off,
-	}); err != nil {
+	}
+	if err := f.inj.MaybeError(op); err != nil {
 		return 0, err
 	}
-	return f.file.ReadAt(p, off)
+	n, err := f.file.ReadAt(p, off)
+	maybeCorrupt(f.inj, op, p[:n])
+	return n, err
+}
+
+func (f *errorFile) ReadBatch(reqs []vfs.ReadRequest) error {
+	for _, req := range reqs {
+		if err := f.inj.MaybeError(Op{
+			Kind:   OpFileReadAt,
+			Path:   f.path,
+			Offset: req.Offset,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := f.file.ReadBatch(reqs); err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		maybeCorrupt(f.inj, Op{Kind: OpFileReadAt, Path: f.path, Offset: req.Offset}, req.Buf)
+	}
+	return nil
 }
 
 func (f *errorFile) Write(p []byte) (int, error) {
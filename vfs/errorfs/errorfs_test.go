@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"github.com/cockroachdb/datadriven"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
 )
 
 func TestErrorFS(t *testing.T) {
@@ -32,3 +34,29 @@ func TestErrorFS(t *testing.T) {
 		}
 	})
 }
+
+func TestCorruptAt(t *testing.T) {
+	mem := vfs.NewMem()
+	f, err := mem.Create("foo", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	fs := Wrap(mem, CorruptAt(PathMatch("foo"), 2, 7))
+	f, err = fs.Open("foo")
+	require.NoError(t, err)
+	defer f.Close()
+	buf := make([]byte, 5)
+	for _, want := range []string{"01\xcd34", "56\xc889"} {
+		n, err := f.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, want, string(buf[:n]))
+	}
+	_, err = f.ReadAt(buf[:3], 6)
+	require.NoError(t, err)
+	require.Equal(t, "6\xc88", string(buf[:3]))
+	_, err = f.ReadAt(buf[:3], 3)
+	require.NoError(t, err)
+	require.Equal(t, "345", string(buf[:3]))
+}
@@ -0,0 +1,390 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+//go:build linux
+// +build linux
+
+package vfs
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sys/unix"
+)
+
+// This file contains a minimal io_uring implementation, which is used to
+// submit the reads of a batch (see File.ReadBatch) with a single system call,
+// so that the device can process them in parallel. Only IORING_OP_READ (Linux
+// 5.6+) is used. If io_uring is not available (e.g. because it is disabled by
+// a seccomp filter), the reads fall back to ReadBatchConcurrently.
+
+const (
+	// ioUringEntries is the size of the submission queue of a ring, which is
+	// the maximum number of reads submitted at once.
+	ioUringEntries = 64
+
+	ioringOpRead         = 22
+	ioringEnterGetEvents = 1 << 0
+	ioringFeatSingleMmap = 1 << 0
+	ioringOffSQRing      = 0
+	ioringOffCQRing      = 0x8000000
+	ioringOffSQEs        = 0x10000000
+	ioUringSQESize       = 64
+	ioUringCQESize       = 16
+)
+
+// ioUringParams is struct io_uring_params.
+type ioUringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        ioSQRingOffsets
+	cqOff        ioCQRingOffsets
+}
+
+// ioSQRingOffsets is struct io_sqring_offsets.
+type ioSQRingOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// ioCQRingOffsets is struct io_cqring_offsets.
+type ioCQRingOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// ioUringSQE is struct io_uring_sqe, restricted to the fields used by reads.
+type ioUringSQE struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	rwFlags  uint32
+	userData uint64
+	_        [3]uint64
+}
+
+// ioUringCQE is struct io_uring_cqe.
+type ioUringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// ioUring is an io_uring instance. It is not safe for concurrent use; see
+// ioUrings.
+type ioUring struct {
+	fd      int
+	entries uint32
+	// sqRing and cqRing may be the same mapping (IORING_FEAT_SINGLE_MMAP).
+	sqRing, cqRing, sqes []byte
+
+	// The head and tail indexes are shared with the kernel.
+	sqTail, sqMask *atomic.Uint32
+	sqArray        unsafe.Pointer
+	cqHead, cqTail *atomic.Uint32
+	cqMask         uint32
+	cqes           unsafe.Pointer
+}
+
+func newIOUring() (*ioUring, error) {
+	var p ioUringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, ioUringEntries, uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	u := &ioUring{fd: int(fd), entries: p.sqEntries}
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*ioUringCQESize)
+	if p.features&ioringFeatSingleMmap != 0 {
+		sqSize = max(sqSize, cqSize)
+	}
+	mmap := func(offset int64, size int) ([]byte, error) {
+		return unix.Mmap(u.fd, offset, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	}
+	var err error
+	if u.sqRing, err = mmap(ioringOffSQRing, sqSize); err != nil {
+		u.close()
+		return nil, err
+	}
+	if p.features&ioringFeatSingleMmap != 0 {
+		u.cqRing = u.sqRing
+	} else if u.cqRing, err = mmap(ioringOffCQRing, cqSize); err != nil {
+		u.close()
+		return nil, err
+	}
+	if u.sqes, err = mmap(ioringOffSQEs, int(p.sqEntries)*ioUringSQESize); err != nil {
+		u.close()
+		return nil, err
+	}
+	u.sqTail = (*atomic.Uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.tail]))
+	u.sqMask = (*atomic.Uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.ringMask]))
+	u.sqArray = unsafe.Pointer(&u.sqRing[p.sqOff.array])
+	u.cqHead = (*atomic.Uint32)(unsafe.Pointer(&u.cqRing[p.cqOff.head]))
+	u.cqTail = (*atomic.Uint32)(unsafe.Pointer(&u.cqRing[p.cqOff.tail]))
+	u.cqMask = *(*uint32)(unsafe.Pointer(&u.cqRing[p.cqOff.ringMask]))
+	u.cqes = unsafe.Pointer(&u.cqRing[p.cqOff.cqes])
+	return u, nil
+}
+
+func (u *ioUring) close() {
+	if u.sqes != nil {
+		_ = unix.Munmap(u.sqes)
+	}
+	if u.cqRing != nil && &u.cqRing[0] != &u.sqRing[0] {
+		_ = unix.Munmap(u.cqRing)
+	}
+	if u.sqRing != nil {
+		_ = unix.Munmap(u.sqRing)
+	}
+	_ = unix.Close(u.fd)
+}
+
+// errReadRejected is returned by ioUring.readBatch if the kernel rejected a
+// read, e.g. because it does not support IORING_OP_READ.
+var errReadRejected = errors.New("pebble: io_uring read rejected")
+
+// readBatch reads the requests from the file, submitting up to u.entries
+// reads at a time; short reads are resubmitted for the remaining bytes.
+// readErr is the error of the reads; if ringErr is set, the reads must be
+// retried without io_uring and the ring must be discarded, and if ringErr is
+// errReadRejected, io_uring must not be used again. The reads submitted to
+// the ring have completed when readBatch returns, even if it fails.
+func (u *ioUring) readBatch(f *linuxFile, reqs []ReadRequest) (readErr, ringErr error) {
+	// done is the number of bytes read by each request.
+	done := make([]int, len(reqs))
+	pending := make([]int, 0, len(reqs))
+	for i := range reqs {
+		if len(reqs[i].Buf) > 0 {
+			pending = append(pending, i)
+		}
+	}
+	var firstErr error
+	rejected := false
+	defer runtime.KeepAlive(reqs)
+	for len(pending) > 0 {
+		var retry []int
+		for start := 0; start < len(pending); start += int(u.entries) {
+			batch := pending[start:min(len(pending), start+int(u.entries))]
+			err := u.submitAndWait(f.fd, reqs, done, batch, func(i int, res int32) {
+				switch {
+				case res == -int32(unix.EINVAL):
+					rejected = true
+				case res < 0:
+					if firstErr == nil {
+						firstErr = &os.PathError{Op: "read", Path: f.Name(), Err: syscall.Errno(-res)}
+					}
+				case res == 0:
+					if firstErr == nil {
+						firstErr = io.EOF
+					}
+				default:
+					done[i] += int(res)
+					if done[i] < len(reqs[i].Buf) {
+						retry = append(retry, i)
+					}
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if rejected {
+			return nil, errReadRejected
+		}
+		pending = retry
+	}
+	return firstErr, nil
+}
+
+// submitAndWait submits the reads of the requests with the given indexes (of
+// the bytes that were not read yet) and waits for their completion.
+func (u *ioUring) submitAndWait(
+	fd uintptr, reqs []ReadRequest, done []int, batch []int, complete func(i int, res int32),
+) error {
+	// Only the application writes the tail of the submission queue.
+	tail := u.sqTail.Load()
+	mask := u.sqMask.Load()
+	for j, i := range batch {
+		idx := (tail + uint32(j)) & mask
+		buf := reqs[i].Buf[done[i]:]
+		*(*ioUringSQE)(unsafe.Add(unsafe.Pointer(&u.sqes[0]), uintptr(idx)*ioUringSQESize)) = ioUringSQE{
+			opcode:   ioringOpRead,
+			fd:       int32(fd),
+			off:      uint64(reqs[i].Offset) + uint64(done[i]),
+			addr:     uint64(uintptr(unsafe.Pointer(&buf[0]))),
+			len:      uint32(len(buf)),
+			userData: uint64(i),
+		}
+		*(*uint32)(unsafe.Add(u.sqArray, uintptr(idx)*4)) = idx
+	}
+	u.sqTail.Store(tail + uint32(len(batch)))
+
+	toSubmit := len(batch)
+	for completed := 0; completed < len(batch); {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER,
+			uintptr(u.fd), uintptr(toSubmit), 1 /* minComplete */, ioringEnterGetEvents, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		} else if errno != 0 {
+			// The reads submitted by the previous calls may still write to the
+			// buffers, which must not be reused (e.g. by the synchronous fallback)
+			// until they complete.
+			u.drain(len(batch) - toSubmit - completed)
+			return errno
+		}
+		toSubmit -= int(n)
+		completed += u.reap(complete)
+	}
+	return nil
+}
+
+// reap calls complete for the completions in the completion queue, and returns
+// their number.
+func (u *ioUring) reap(complete func(i int, res int32)) int {
+	// Only the application writes the head of the completion queue.
+	head := u.cqHead.Load()
+	n := 0
+	for cqTail := u.cqTail.Load(); head != cqTail; head++ {
+		cqe := (*ioUringCQE)(unsafe.Add(u.cqes, uintptr(head&u.cqMask)*ioUringCQESize))
+		complete(int(cqe.userData), cqe.res)
+		n++
+	}
+	u.cqHead.Store(head)
+	return n
+}
+
+// drain waits for the completion of n submitted reads, and discards their
+// results. It panics if the completions cannot be waited for: the kernel
+// could then write to the buffers of the reads after they are reused.
+func (u *ioUring) drain(n int) {
+	for n > 0 {
+		_, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER,
+			uintptr(u.fd), 0 /* toSubmit */, uintptr(n), ioringEnterGetEvents, 0, 0)
+		switch errno {
+		case 0, unix.EINTR, unix.EAGAIN, unix.EBUSY:
+		default:
+			panic(errors.Wrapf(errno, "pebble: waiting for %d io_uring reads", n))
+		}
+		n -= u.reap(func(int, int32) {})
+	}
+}
+
+// ioUrings is the set of rings shared by all the files. A ring is used by one
+// batch at a time; if all the rings are in use and the maximum number of rings
+// was created, the batch is read without io_uring.
+var ioUrings ioUringPool
+
+type ioUringPool struct {
+	mu   sync.Mutex
+	free []*ioUring
+	// n is the number of rings (free or in use).
+	n int
+	// unsupported is set if a ring could not be created, or if the kernel
+	// rejected a read, in which case io_uring is not used again.
+	unsupported atomic.Bool
+}
+
+// maxIOUrings is the maximum number of rings.
+var maxIOUrings = 2 * runtime.GOMAXPROCS(0)
+
+// get returns a ring, or nil if io_uring cannot be used.
+func (p *ioUringPool) get() *ioUring {
+	if p.unsupported.Load() {
+		return nil
+	}
+	p.mu.Lock()
+	if len(p.free) > 0 {
+		u := p.free[len(p.free)-1]
+		p.free = p.free[:len(p.free)-1]
+		p.mu.Unlock()
+		return u
+	}
+	if p.n >= maxIOUrings {
+		p.mu.Unlock()
+		return nil
+	}
+	p.n++
+	p.mu.Unlock()
+	u, err := newIOUring()
+	if err != nil {
+		p.unsupported.Store(true)
+		p.mu.Lock()
+		p.n--
+		p.mu.Unlock()
+		return nil
+	}
+	return u
+}
+
+func (p *ioUringPool) put(u *ioUring) {
+	if p.unsupported.Load() {
+		p.discard(u)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.free = append(p.free, u)
+}
+
+// discard closes a ring that failed.
+func (p *ioUringPool) discard(u *ioUring) {
+	u.close()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.n--
+}
+
+// disable stops the use of io_uring, once the kernel rejected a read on the
+// given ring: every later batch would be rejected as well, and read again
+// without io_uring. The ring and the free rings are closed; the rings in use
+// are closed when they are returned.
+func (p *ioUringPool) disable(u *ioUring) {
+	p.unsupported.Store(true)
+	p.discard(u)
+	p.mu.Lock()
+	free := p.free
+	p.free = nil
+	p.n -= len(free)
+	p.mu.Unlock()
+	for _, u := range free {
+		u.close()
+	}
+}
+
+// ReadBatch implements File.ReadBatch. The reads are submitted with io_uring,
+// if possible.
+func (f *linuxFile) ReadBatch(reqs []ReadRequest) error {
+	if len(reqs) > 1 && f.fd != InvalidFd {
+		if u := ioUrings.get(); u != nil {
+			readErr, ringErr := u.readBatch(f, reqs)
+			switch ringErr {
+			case nil:
+				ioUrings.put(u)
+				return readErr
+			case errReadRejected:
+				ioUrings.disable(u)
+			default:
+				ioUrings.discard(u)
+			}
+		}
+	}
+	return ReadBatchConcurrently(f, reqs)
+}
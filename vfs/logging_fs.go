@@ -155,6 +155,11 @@ func (f *loggingFile) WriteAt(p []byte, offset int64) (int, error) {
 	return f.File.WriteAt(p, offset)
 }
 
+func (f *loggingFile) ReadBatch(reqs []ReadRequest) error {
+	f.logFn("read-batch(%d): %s", len(reqs), f.name)
+	return f.File.ReadBatch(reqs)
+}
+
 func (f *loggingFile) Prefetch(offset int64, length int64) error {
 	f.logFn("prefetch(%d, %d): %s", offset, length, f.name)
 	return f.File.Prefetch(offset, length)
@@ -739,7 +739,11 @@ func (f *memFile) WriteAt(p []byte, ofs int64) (int, error) {
 }
 
 func (f *memFile) Prefetch(offset int64, length int64) error { return nil }
-func (f *memFile) Preallocate(offset, length int64) error    { return nil }
+
+func (f *memFile) ReadBatch(reqs []ReadRequest) error {
+	return ReadBatchConcurrently(f, reqs)
+}
+func (f *memFile) Preallocate(offset, length int64) error { return nil }
 
 func (f *memFile) Stat() (os.FileInfo, error) {
 	f.n.mu.Lock()
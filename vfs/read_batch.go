@@ -0,0 +1,84 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ReadRequest is a read of len(Buf) bytes at Offset, which is part of a batch
+// of reads; see File.ReadBatch.
+type ReadRequest struct {
+	Buf    []byte
+	Offset int64
+}
+
+// ReadBatchConcurrently implements File.ReadBatch for files that cannot submit
+// multiple reads at once: the reads are executed in parallel by a pool of
+// goroutines, using ReadAt. The pool is shared by all the files; if all its
+// goroutines are busy, the reads are executed by the calling goroutine.
+func ReadBatchConcurrently(r io.ReaderAt, reqs []ReadRequest) error {
+	if len(reqs) == 1 {
+		_, err := r.ReadAt(reqs[0].Buf, reqs[0].Offset)
+		return err
+	}
+	readPool.once.Do(readPool.start)
+	errs := make([]error, len(reqs))
+	var wg sync.WaitGroup
+	wg.Add(len(reqs))
+	for i := range reqs {
+		t := readTask{r: r, req: &reqs[i], err: &errs[i], wg: &wg}
+		select {
+		case readPool.tasks <- t:
+		default:
+			t.run()
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readPool is the pool of goroutines used by ReadBatchConcurrently.
+var readPool readBatchPool
+
+type readBatchPool struct {
+	once sync.Once
+	// tasks is unbuffered: a task is only sent if a goroutine is idle.
+	tasks chan readTask
+}
+
+func (p *readBatchPool) start() {
+	p.tasks = make(chan readTask)
+	for i := 0; i < readPoolSize; i++ {
+		go func() {
+			for t := range p.tasks {
+				t.run()
+			}
+		}()
+	}
+}
+
+// readPoolSize is the number of goroutines of readPool; it is the maximum
+// number of reads that are executed in parallel by the pool.
+var readPoolSize = max(32, 4*runtime.GOMAXPROCS(0))
+
+type readTask struct {
+	r   io.ReaderAt
+	req *ReadRequest
+	err *error
+	wg  *sync.WaitGroup
+}
+
+func (t readTask) run() {
+	_, *t.err = t.r.ReadAt(t.req.Buf, t.req.Offset)
+	t.wg.Done()
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBatch(t *testing.T) {
+	const size = 1 << 20
+	data := make([]byte, size)
+	rng := rand.New(rand.NewSource(1))
+	_, _ = rng.Read(data)
+
+	for _, fs := range []struct {
+		name string
+		fs   FS
+		dir  string
+	}{
+		{"mem", NewMem(), ""},
+		{"default", Default, t.TempDir()},
+	} {
+		t.Run(fs.name, func(t *testing.T) {
+			path := fs.fs.PathJoin(fs.dir, "file")
+			f, err := fs.fs.Create(path, WriteCategoryUnspecified)
+			require.NoError(t, err)
+			// Write a copy: with invariants enabled, memFile.Write mutates its
+			// input.
+			_, err = f.Write(append([]byte(nil), data...))
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			f, err = fs.fs.Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+
+			// The number of requests is larger than the size of a ring, so that
+			// the reads are submitted in multiple rounds.
+			for _, n := range []int{1, 2, 200} {
+				reqs := make([]ReadRequest, n)
+				for i := range reqs {
+					length := 1 + rng.Intn(64<<10)
+					reqs[i] = ReadRequest{
+						Buf:    make([]byte, length),
+						Offset: rng.Int63n(size - int64(length)),
+					}
+				}
+				require.NoError(t, f.ReadBatch(reqs))
+				for _, req := range reqs {
+					require.True(t, bytes.Equal(data[req.Offset:req.Offset+int64(len(req.Buf))], req.Buf))
+				}
+			}
+
+			// A read past the end of the file fails.
+			reqs := []ReadRequest{
+				{Buf: make([]byte, 100), Offset: 0},
+				{Buf: make([]byte, 100), Offset: size - 50},
+			}
+			require.ErrorIs(t, f.ReadBatch(reqs), io.EOF)
+		})
+	}
+}
+
+func TestReadBatchConcurrently(t *testing.T) {
+	data := []byte("abcdefghijklmnopqrstuvwxyz")
+	r := bytes.NewReader(data)
+	reqs := make([]ReadRequest, 100)
+	for i := range reqs {
+		reqs[i] = ReadRequest{Buf: make([]byte, 1+i%5), Offset: int64(i % 20)}
+	}
+	require.NoError(t, ReadBatchConcurrently(r, reqs))
+	for _, req := range reqs {
+		require.Equal(t, data[req.Offset:req.Offset+int64(len(req.Buf))], req.Buf)
+	}
+	reqs = append(reqs, ReadRequest{Buf: make([]byte, 10), Offset: 20})
+	require.ErrorIs(t, ReadBatchConcurrently(r, reqs), io.EOF)
+}
@@ -66,6 +66,15 @@ type File interface {
 	// subsequent reads in that range will not issue disk IO.
 	Prefetch(offset int64, length int64) error
 
+	// ReadBatch reads a batch of requests, which are executed in parallel when
+	// possible, and waits for all of them to complete. Like ReadAt, each read
+	// is complete unless an error is returned; the first error is returned.
+	//
+	// On Linux, the reads of a file backed by an OS file are submitted with
+	// io_uring, if it is supported. Other implementations typically use
+	// ReadBatchConcurrently.
+	ReadBatch(reqs []ReadRequest) error
+
 	// Fd returns the raw file descriptor when a File is backed by an *os.File.
 	// It can be used for specific functionality like Prefetch.
 	// Returns InvalidFd if not supported.
@@ -29,4 +29,5 @@ func (*discardFile) Sync() error                                    { return nil
 func (*discardFile) SyncTo(length int64) (fullSync bool, err error) { return false, nil }
 func (*discardFile) SyncData() error                                { return nil }
 func (*discardFile) Prefetch(offset int64, length int64) error      { return nil }
+func (*discardFile) ReadBatch(reqs []vfs.ReadRequest) error         { return nil }
 func (*discardFile) Fd() uintptr                                    { return 0 }
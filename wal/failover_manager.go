@@ -625,8 +625,10 @@ func (wm *failoverManager) Create(wn NumWAL, jobID int) (Writer, error) {
 		minSyncInterval:             wm.opts.MinSyncInterval,
 		fsyncLatency:                wm.opts.FsyncLatency,
 		queueSemChan:                wm.opts.QueueSemChan,
+		compression:                 wm.opts.compression(),
 		stopper:                     wm.stopper,
 		failoverWriteAndSyncLatency: wm.opts.FailoverWriteAndSyncLatency,
+		syncedMarkerCallback:        wm.opts.SyncedMarkerCallback,
 		writerClosed:                wm.writerClosed,
 		writerCreatedForTest:        wm.opts.logWriterCreatedForTesting,
 	}
@@ -138,12 +138,17 @@ type recordQueue struct {
 	lastLogSize int64
 
 	failoverWriteAndSyncLatency prometheus.Histogram
+	// syncedMarkerCallback is Options.SyncedMarkerCallback.
+	syncedMarkerCallback func(marker uint64)
 }
 
-func (q *recordQueue) init(failoverWriteAndSyncLatency prometheus.Histogram) {
+func (q *recordQueue) init(
+	failoverWriteAndSyncLatency prometheus.Histogram, syncedMarkerCallback func(marker uint64),
+) {
 	*q = recordQueue{
 		buffer:                      make([]recordQueueEntry, initialBufferLen),
 		failoverWriteAndSyncLatency: failoverWriteAndSyncLatency,
+		syncedMarkerCallback:        syncedMarkerCallback,
 	}
 }
 
@@ -265,7 +270,9 @@ func (q *recordQueue) pop(index uint32, err error) (numSyncsPopped int) {
 	q.consumerMu.Unlock()
 	addLatencySample := false
 	var maxLatencyNanos int64
+	var marker uint64
 	for i := 0; i < numEntriesToPop; i++ {
+		marker = max(marker, b[i].opts.Marker)
 		// Now that we've synced the entry, we can unref it to signal that we
 		// will not read the written byte slice again.
 		if b[i].unref != nil {
@@ -292,6 +299,9 @@ func (q *recordQueue) pop(index uint32, err error) (numSyncsPopped int) {
 		}
 		q.failoverWriteAndSyncLatency.Observe(float64(maxLatencyNanos))
 	}
+	if err == nil && marker != 0 && q.syncedMarkerCallback != nil {
+		q.syncedMarkerCallback(marker)
+	}
 	return numSyncsPopped
 }
 
@@ -456,9 +466,11 @@ type failoverWriterOpts struct {
 	minSyncInterval func() time.Duration
 	fsyncLatency    prometheus.Histogram
 	queueSemChan    chan struct{}
+	compression     record.Compression
 	stopper         *stopper
 
 	failoverWriteAndSyncLatency prometheus.Histogram
+	syncedMarkerCallback        func(marker uint64)
 	writerClosed                func(logicalLogWithSizesEtc)
 
 	writerCreatedForTest chan<- struct{}
@@ -485,7 +497,7 @@ func newFailoverWriter(
 	ww := &failoverWriter{
 		opts: opts,
 	}
-	ww.q.init(opts.failoverWriteAndSyncLatency)
+	ww.q.init(opts.failoverWriteAndSyncLatency, opts.syncedMarkerCallback)
 	ww.mu.cond = sync.NewCond(&ww.mu)
 	// The initial record.LogWriter creation also happens via a
 	// switchToNewWriter since we don't want it to block newFailoverWriter.
@@ -534,6 +546,9 @@ func (ww *failoverWriter) WriteRecord(
 	}
 	ww.logicalOffset.latestLogSizeInWriteRecord, err = writer.SyncRecordGeneralized(p, &ww.psiForWriteRecordBacking)
 	ww.logicalOffset.latestWriterInWriteRecord = writer
+	if err == nil && opts.Done == nil && opts.SyncWithin > 0 {
+		writer.SyncWithin(opts.SyncWithin)
+	}
 	if notEstimatedOffset {
 		delta := ww.logicalOffset.latestLogSizeInWriteRecord - lastLogSize
 		ww.logicalOffset.offset += delta
@@ -633,6 +648,7 @@ func (ww *failoverWriter) switchToNewDir(dir dirAndFileHandle) error {
 				WALFsyncLatency:           ww.opts.fsyncLatency,
 				QueueSemChan:              ww.opts.queueSemChan,
 				ExternalSyncQueueCallback: ww.doneSyncCallback,
+				Compression:               ww.opts.compression,
 			})
 		closeWriter := func() bool {
 			ww.mu.Lock()
@@ -659,6 +675,11 @@ func (ww *failoverWriter) switchToNewDir(dir dirAndFileHandle) error {
 						}
 						var err error
 						logSize, err = w.SyncRecordGeneralized(entries[i].p, &ww.psiForSwitchBacking)
+						if err == nil && entries[i].opts.Done == nil && entries[i].opts.SyncWithin > 0 {
+							// The record may not have been synced by the previous
+							// writer, so restart its deadline on this writer.
+							w.SyncWithin(entries[i].opts.SyncWithin)
+						}
 						if err != nil {
 							// TODO(sumeer): log periodically. The err will also surface via
 							// the latencyAndErrorRecorder, so if a switch is possible, it
@@ -71,6 +71,17 @@ func (ll LogicalLog) OpenForRead() Reader {
 	return newVirtualWALReader(ll)
 }
 
+// OpenForReadWithLogData opens a logical WAL for reading, like OpenForRead,
+// except that the batches only containing LogData for which keepLogData
+// returns true are returned too, instead of being skipped. Such batches repeat
+// the sequence number of the next batch, and are not deduplicated: the caller
+// must tolerate their repetition.
+func (ll LogicalLog) OpenForReadWithLogData(keepLogData func(repr []byte) bool) Reader {
+	r := newVirtualWALReader(ll)
+	r.keepLogData = keepLogData
+	return r
+}
+
 // String implements fmt.Stringer.
 func (ll LogicalLog) String() string {
 	var sb strings.Builder
@@ -207,7 +218,8 @@ func newVirtualWALReader(wal LogicalLog) *virtualWALReader {
 // ("segments") and implements the wal.Reader interface, providing a merged view
 // of the WAL's logical contents. It's responsible for filtering duplicate
 // records which may be shared by the tail of a segment file and the head of its
-// successor.
+// successor. If the WAL is striped, the segments are its stripes, and their
+// records are read round-robin instead (see striped_writer.go).
 type virtualWALReader struct {
 	// VirtualWAL metadata.
 	LogicalLog
@@ -217,8 +229,17 @@ type virtualWALReader struct {
 	currIndex  int
 	currFile   vfs.File
 	currReader *record.Reader
+	// peeked is set if the first record of the current file was read when
+	// opening the WAL, in which case it is in recordBuf, or peekedErr holds the
+	// error returned when reading it.
+	peeked    bool
+	peekedErr error
 	// off describes the current Offset within the WAL.
 	off Offset
+	// stripes are the stripes of the WAL if it is striped, indexed by their
+	// LogNameIndex, and nextStripe the stripe of the next record.
+	stripes    []stripeReader
+	nextStripe int
 	// lastSeqNum is the sequence number of the batch contained within the last
 	// record returned to the user. A virtual WAL may be split across a sequence
 	// of several physical WAL files. The tail of one physical WAL may be
@@ -232,6 +253,9 @@ type virtualWALReader struct {
 	// file, and then returned to the user. A pointer to this buffer is returned
 	// directly to the caller of NextRecord.
 	recordBuf bytes.Buffer
+	// keepLogData, if set, selects the LogData-only batches which are returned
+	// to the caller. See OpenForReadWithLogData.
+	keepLogData func(repr []byte) bool
 }
 
 // *virtualWALReader implements wal.Reader.
@@ -243,52 +267,23 @@ var _ Reader = (*virtualWALReader)(nil)
 func (r *virtualWALReader) NextRecord() (io.Reader, Offset, error) {
 	r.recordBuf.Reset()
 
-	// On the first call, we need to open the first file.
+	// On the first call, we need to open the first file, and find out whether
+	// the WAL is striped.
 	if r.currIndex < 0 {
-		err := r.nextFile()
+		err := r.open()
 		if err != nil {
 			return nil, Offset{}, err
 		}
 	}
 
 	for {
-		// Update our current physical offset to match the current file offset.
-		r.off.Physical = r.currReader.Offset()
-		// Obtain a Reader for the next record within this log file.
-		rec, err := r.currReader.Next()
-		if errors.Is(err, io.EOF) {
-			// This file is exhausted; continue to the next.
-			err := r.nextFile()
-			if err != nil {
-				return nil, r.off, err
-			}
-			continue
-		}
-
-		// Copy the record into a buffer. This ensures we read its entirety so
-		// that NextRecord returns the next record, even if the caller never
-		// exhausts the previous record's Reader. The record.Reader requires the
-		// record to be exhausted to read all of the record's chunks before
-		// attempting to read the next record. Buffering also also allows us to
-		// easily read the header of the batch down below for deduplication.
-		if err == nil {
-			_, err = io.Copy(&r.recordBuf, rec)
+		var err error
+		if r.stripes != nil {
+			err = r.nextStripedRecord()
+		} else {
+			err = r.nextSegmentRecord()
 		}
-		// The record may be malformed. This is expected during a WAL failover,
-		// because the tail of a WAL may be only partially written or otherwise
-		// unclean because of WAL recycling and the inability to write the EOF
-		// trailer record. If this isn't the last file, we silently ignore the
-		// invalid record at the tail and proceed to the next file. If it is
-		// the last file, bubble the error up and let the client decide what to
-		// do with it. If the virtual WAL is the most recent WAL, Open may also
-		// decide to ignore it because it's consistent with an incomplete
-		// in-flight write at the time of process exit/crash. See #453.
-		if record.IsInvalidRecord(err) && r.currIndex < len(r.segments)-1 {
-			if err := r.nextFile(); err != nil {
-				return nil, r.off, err
-			}
-			continue
-		} else if err != nil {
+		if err != nil {
 			return nil, r.off, err
 		}
 
@@ -320,8 +315,12 @@ func (r *virtualWALReader) NextRecord() (io.Reader, Offset, error) {
 		// batches because they're not relevant for recovery and we do not want
 		// to mistakenly deduplicate the batch containing KVs at the same
 		// sequence number. We can differentiate LogData-only batches through
-		// their batch headers: they'll encode a count of zero.
+		// their batch headers: they'll encode a count of zero. The batches
+		// selected by keepLogData are returned, without deduplication.
 		if h.Count == 0 {
+			if r.keepLogData != nil && r.keepLogData(r.recordBuf.Bytes()) {
+				return &r.recordBuf, r.off, nil
+			}
 			r.recordBuf.Reset()
 			continue
 		}
@@ -338,14 +337,83 @@ func (r *virtualWALReader) NextRecord() (io.Reader, Offset, error) {
 	}
 }
 
+// nextSegmentRecord reads the next record of the segments into recordBuf.
+func (r *virtualWALReader) nextSegmentRecord() error {
+	for {
+		var err error
+		if r.peeked {
+			r.peeked = false
+			err = r.peekedErr
+		} else {
+			// Update our current physical offset to match the current file
+			// offset.
+			r.off.Physical = r.currReader.Offset()
+			// Obtain a Reader for the next record within this log file.
+			var rec io.Reader
+			rec, err = r.currReader.Next()
+			// Copy the record into a buffer. This ensures we read its entirety
+			// so that NextRecord returns the next record, even if the caller
+			// never exhausts the previous record's Reader. The record.Reader
+			// requires the record to be exhausted to read all of the record's
+			// chunks before attempting to read the next record. Buffering also
+			// also allows us to easily read the header of the batch for
+			// deduplication.
+			if err == nil {
+				_, err = io.Copy(&r.recordBuf, rec)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			// This file is exhausted; continue to the next.
+			if err := r.nextFile(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// The record may be malformed. This is expected during a WAL failover,
+		// because the tail of a WAL may be only partially written or otherwise
+		// unclean because of WAL recycling and the inability to write the EOF
+		// trailer record. If this isn't the last file, we silently ignore the
+		// invalid record at the tail and proceed to the next file. If it is
+		// the last file, bubble the error up and let the client decide what to
+		// do with it. If the virtual WAL is the most recent WAL, Open may also
+		// decide to ignore it because it's consistent with an incomplete
+		// in-flight write at the time of process exit/crash. See #453.
+		if record.IsInvalidRecord(err) && r.currIndex < len(r.segments)-1 {
+			r.recordBuf.Reset()
+			if err := r.nextFile(); err != nil {
+				return err
+			}
+			continue
+		}
+		return err
+	}
+}
+
+// Recover clears the error returned by the last call to NextRecord if the
+// record was corrupted, so that the next call to NextRecord skips to the next
+// valid record of the current physical file.
+func (r *virtualWALReader) Recover() {
+	r.recordBuf.Reset()
+	if r.stripes != nil {
+		r.stripes[r.nextStripe].recover()
+	} else if r.currReader != nil {
+		r.currReader.Recover()
+	}
+}
+
 // Close closes the reader, releasing open resources.
 func (r *virtualWALReader) Close() error {
+	var err error
 	if r.currFile != nil {
-		if err := r.currFile.Close(); err != nil {
-			return err
+		err = r.currFile.Close()
+	}
+	for i := range r.stripes {
+		if r.stripes[i].file != nil {
+			err = firstError(err, r.stripes[i].file.Close())
 		}
 	}
-	return nil
+	return err
 }
 
 // nextFile advances the internal state to the next physical segment file.
@@ -372,3 +440,219 @@ func (r *virtualWALReader) nextFile() error {
 	r.currReader = record.NewReader(r.currFile, base.DiskFileNum(r.Num))
 	return nil
 }
+
+// open opens the first segment, and reads its first record to find out
+// whether the WAL is striped, in which case all the stripes are opened.
+func (r *virtualWALReader) open() error {
+	if err := r.nextFile(); err != nil {
+		return err
+	}
+	r.peeked = true
+	r.peekedErr = readRecord(r.currReader, &r.recordBuf)
+	if r.peekedErr == nil {
+		if _, _, ok := ParseStripeHeader(r.recordBuf.Bytes()); ok {
+			return r.openStripes()
+		}
+		return nil
+	}
+	// The header of the first stripe may have been lost in a crash, when the
+	// ones of the other stripes were not.
+	if len(r.segments) > 1 && (errors.Is(r.peekedErr, io.EOF) || record.IsInvalidRecord(r.peekedErr)) {
+		for i := 1; i < len(r.segments); i++ {
+			if striped, err := r.segmentIsStripe(i); err != nil {
+				return err
+			} else if striped {
+				return r.openStripes()
+			}
+		}
+	}
+	return nil
+}
+
+// segmentIsStripe returns whether the segment with the given index begins
+// with the header of a stripe.
+func (r *virtualWALReader) segmentIsStripe(i int) (bool, error) {
+	fs, path := r.LogicalLog.SegmentLocation(i)
+	f, err := fs.Open(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "opening WAL file segment %q", path)
+	}
+	var buf bytes.Buffer
+	err = readRecord(record.NewReader(f, base.DiskFileNum(r.Num)), &buf)
+	_, _, ok := ParseStripeHeader(buf.Bytes())
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+	return err == nil && ok, nil
+}
+
+// openStripes opens the stripes of a striped WAL, and reads their headers.
+// The stripes that are missing, or whose header was lost in a crash, are
+// exhausted: the WAL ends when their turn comes.
+func (r *virtualWALReader) openStripes() error {
+	if err := r.currFile.Close(); err != nil {
+		return err
+	}
+	r.currFile, r.currReader = nil, nil
+	r.peeked, r.peekedErr = false, nil
+	r.recordBuf.Reset()
+	stripes := make([]stripeReader, len(r.segments))
+	defer func() {
+		// Close the stripes if they could not be opened.
+		for i := range stripes {
+			if stripes[i].file != nil && r.stripes == nil {
+				_ = stripes[i].file.Close()
+			}
+		}
+	}()
+	n := 0
+	for i := range r.segments {
+		fs, path := r.LogicalLog.SegmentLocation(i)
+		f, err := fs.Open(path)
+		if err != nil {
+			return errors.Wrapf(err, "opening WAL file segment %q", path)
+		}
+		s := &stripes[i]
+		*s = stripeReader{file: f, path: path, reader: record.NewReader(f, base.DiskFileNum(r.Num))}
+		var buf bytes.Buffer
+		if s.err = readRecord(s.reader, &buf); s.err != nil {
+			// The header was lost, along with the rest of the stripe.
+			continue
+		}
+		index, count, ok := ParseStripeHeader(buf.Bytes())
+		if !ok || index != int(r.segments[i].logNameIndex) || (n != 0 && count != n) {
+			return base.CorruptionErrorf("pebble: corrupt log file %q: invalid stripe header", errors.Safe(path))
+		}
+		n = count
+	}
+	if int(r.segments[len(r.segments)-1].logNameIndex) >= n {
+		return base.CorruptionErrorf("pebble: corrupt log file logNum=%d: too many stripes", r.Num)
+	}
+	// Index the stripes by their LogNameIndex. The stripes of the log files
+	// that are missing are empty.
+	r.stripes = make([]stripeReader, n)
+	for i := range stripes {
+		r.stripes[r.segments[i].logNameIndex] = stripes[i]
+	}
+	return nil
+}
+
+// nextStripedRecord reads the next record of a striped WAL into recordBuf.
+func (r *virtualWALReader) nextStripedRecord() error {
+	for {
+		s := &r.stripes[r.nextStripe]
+		if s.skipped {
+			if r.allStripesSkipped() {
+				return io.EOF
+			}
+			r.nextStripe = (r.nextStripe + 1) % len(r.stripes)
+			continue
+		}
+		var err error
+		r.off.PhysicalFile = s.path
+		r.off.Physical, err = s.next(&r.recordBuf)
+		if err == nil {
+			r.nextStripe = (r.nextStripe + 1) % len(r.stripes)
+			return nil
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		// The WAL ends with the first stripe that is exhausted. The records
+		// that follow in the other stripes were written after the records that
+		// are missing from this one, so they are the unsynced tail of the WAL,
+		// which is reported like a tail that is not cleanly written.
+		for i := range r.stripes {
+			if i != r.nextStripe && !r.stripes[i].skipped && r.stripes[i].hasNext() {
+				return io.ErrUnexpectedEOF
+			}
+		}
+		return io.EOF
+	}
+}
+
+// allStripesSkipped returns whether all the stripes were skipped by Recover.
+func (r *virtualWALReader) allStripesSkipped() bool {
+	for i := range r.stripes {
+		if !r.stripes[i].skipped {
+			return false
+		}
+	}
+	return true
+}
+
+// stripeReader reads the records of a stripe of a striped WAL.
+type stripeReader struct {
+	file   vfs.File
+	path   string
+	reader *record.Reader
+	// err is the error returned when reading the header of the stripe, which
+	// is returned by the reads of the stripe until Recover is called.
+	err error
+	// peeked holds the next record of the stripe if hasPeeked is set, and
+	// peekedOffset its offset.
+	peeked       bytes.Buffer
+	peekedOffset int64
+	hasPeeked    bool
+	// eof is set once the stripe is exhausted, and skipped once the caller
+	// chose to skip past it with Recover.
+	eof     bool
+	skipped bool
+}
+
+// next reads the next record of the stripe into buf, skipping the empty
+// records written to sync the stripe, and returns its offset.
+func (s *stripeReader) next(buf *bytes.Buffer) (offset int64, err error) {
+	if s.hasPeeked {
+		s.hasPeeked = false
+		_, err := buf.ReadFrom(&s.peeked)
+		return s.peekedOffset, err
+	}
+	if s.reader == nil {
+		s.eof = true
+		return 0, io.EOF
+	}
+	err = s.err
+	for err == nil {
+		offset = s.reader.Offset()
+		if err = readRecord(s.reader, buf); err == nil && buf.Len() > 0 {
+			return offset, nil
+		}
+	}
+	s.eof = errors.Is(err, io.EOF)
+	return s.reader.Offset(), err
+}
+
+// hasNext returns whether the stripe has a next record, which is the case if
+// it is corrupt.
+func (s *stripeReader) hasNext() bool {
+	if s.hasPeeked {
+		return true
+	}
+	s.peeked.Reset()
+	var err error
+	s.peekedOffset, err = s.next(&s.peeked)
+	s.hasPeeked = err == nil
+	return !errors.Is(err, io.EOF)
+}
+
+// recover implements Reader.Recover for the stripe: a corrupt record is
+// skipped, and an exhausted stripe is skipped by the rest of the
+// round-robin.
+func (s *stripeReader) recover() {
+	if s.eof {
+		s.skipped = true
+		return
+	}
+	s.err = nil
+	s.reader.Recover()
+}
+
+// readRecord reads the next record of rr into buf.
+func readRecord(rr *record.Reader, buf *bytes.Buffer) error {
+	rec, err := rr.Next()
+	if err == nil {
+		_, err = io.Copy(buf, rec)
+	}
+	return err
+}
@@ -170,6 +170,21 @@ func TestReader(t *testing.T) {
 
 					fmt.Fprintf(&buf, "%d..%d: batch #%d\n", offset, tailOffset, seq)
 					offset = tailOffset
+				case "stripe-header":
+					// Write the header of a stripe of a striped WAL.
+					index := fields.MustKeyValue("index").Int()
+					count := fields.MustKeyValue("count").Int()
+					tailOffset, err := w.WriteRecord(makeStripeHeader(index, count))
+					require.NoError(t, err)
+					fmt.Fprintf(&buf, "%d..%d: stripe header %d/%d\n", offset, tailOffset, index, count)
+					offset = tailOffset
+				case "empty":
+					// Write an empty record, like the ones used to sync the
+					// stripes of a striped WAL.
+					tailOffset, err := w.WriteRecord(nil)
+					require.NoError(t, err)
+					fmt.Fprintf(&buf, "%d..%d: empty\n", offset, tailOffset)
+					offset = tailOffset
 				case "write-garbage":
 					size := fields.MustKeyValue("size").Int()
 					garbage := make([]byte, size)
@@ -218,9 +233,18 @@ func TestReader(t *testing.T) {
 			}
 			ll := LogicalLog{Num: log.Num, segments: segments}
 			r := ll.OpenForRead()
+			if td.HasArg("keep-log-data") {
+				r = ll.OpenForReadWithLogData(func([]byte) bool { return true })
+			}
 			for {
 				rr, off, err := r.NextRecord()
 				fmt.Fprintf(&buf, "r.NextRecord() = (rr, %s, %v)\n", off, err)
+				if err != nil && err != io.EOF && td.HasArg("recover") {
+					// Skip past the corruption, like WALRecoverySkipCorruptedRecords.
+					fmt.Fprintf(&buf, "r.Recover()\n")
+					r.Recover()
+					continue
+				}
 				if err != nil {
 					break
 				}
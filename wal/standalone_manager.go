@@ -14,11 +14,15 @@ import (
 )
 
 // StandaloneManager implements Manager with a single log file per WAL (no
-// failover capability).
+// failover capability), or one log file per dir if the WAL is striped across
+// Options.Stripes.
 type StandaloneManager struct {
 	o        Options
 	recycler LogRecycler
-	walDir   vfs.File
+	// dirs are the primary dir followed by the stripes, and walDirs the
+	// corresponding open dirs.
+	dirs    []Dir
+	walDirs []vfs.File
 	// initialObsolete holds the set of DeletableLogs that formed the logs
 	// passed into Init. The initialObsolete logs are all obsolete. Once
 	// returned via Manager.Obsolete, initialObsolete is cleared. The
@@ -27,22 +31,43 @@ type StandaloneManager struct {
 	// multiple physical log files may form one logical WAL.
 	initialObsolete []DeletableLog
 
-	// External synchronization is relied on when accessing w in Manager.Create,
-	// Writer.{WriteRecord,Close}.
-	w *standaloneWriter
+	// External synchronization is relied on when accessing w in
+	// Manager.Create, Writer.{WriteRecord,Close}.
+	w Writer
 
 	mu struct {
 		sync.Mutex
 		// The queue of WALs, containing both flushed and unflushed WALs. The
 		// FileInfo.FileNum is also the NumWAL, since there is one log file for
-		// each WAL. The flushed logs are a prefix, the unflushed logs a suffix.
-		// If w != nil, the last entry here is that active WAL. For the active
-		// log, FileInfo.FileSize is the size when it was opened and can be
-		// greater than zero because of log recycling.
-		queue []base.FileInfo
+		// each WAL, or one per dir for a striped WAL. The flushed logs are a
+		// prefix, the unflushed logs a suffix. If w != nil, the last entry here
+		// is that active WAL. For the active log, FileInfo.FileSize is the size
+		// when it was opened and can be greater than zero because of log
+		// recycling.
+		queue []standaloneLog
 	}
 }
 
+// standaloneLog is a WAL of the StandaloneManager.
+type standaloneLog struct {
+	base.FileInfo
+	// striped is true if the WAL is striped across StandaloneManager.dirs, in
+	// which case FileInfo.FileSize is the sum of the sizes of its log files.
+	striped bool
+}
+
+// segments returns the log files of the WAL.
+func (m *StandaloneManager) segments(l standaloneLog) []segment {
+	if !l.striped {
+		return []segment{{dir: m.dirs[0]}}
+	}
+	segments := make([]segment, len(m.dirs))
+	for i := range m.dirs {
+		segments[i] = segment{logNameIndex: LogNameIndex(i), dir: m.dirs[i]}
+	}
+	return segments
+}
+
 var _ Manager = &StandaloneManager{}
 
 // init implements Manager.
@@ -50,21 +75,26 @@ func (m *StandaloneManager) init(o Options, initial Logs) error {
 	if o.Secondary.FS != nil {
 		return base.AssertionFailedf("cannot create StandaloneManager with a secondary")
 	}
-	var err error
-	var walDir vfs.File
-	if walDir, err = o.Primary.FS.OpenDir(o.Primary.Dirname); err != nil {
-		return err
-	}
 	*m = StandaloneManager{
-		o:      o,
-		walDir: walDir,
+		o:    o,
+		dirs: o.Dirs(),
 	}
-	m.recycler.Init(o.MaxNumRecyclableLogs)
-
 	closeAndReturnErr := func(err error) error {
-		err = firstError(err, walDir.Close())
+		for _, walDir := range m.walDirs {
+			err = firstError(err, walDir.Close())
+		}
 		return err
 	}
+	for _, dir := range m.dirs {
+		walDir, err := dir.FS.OpenDir(dir.Dirname)
+		if err != nil {
+			return closeAndReturnErr(err)
+		}
+		m.walDirs = append(m.walDirs, walDir)
+	}
+	m.recycler.Init(o.MaxNumRecyclableLogs)
+
+	var err error
 	for _, ll := range initial {
 		if m.recycler.MinRecycleLogNum() <= ll.Num {
 			m.recycler.SetMinRecycleLogNum(ll.Num + 1)
@@ -85,7 +115,7 @@ func (m *StandaloneManager) List() (Logs, error) {
 	for i := range m.mu.queue {
 		wals[i] = LogicalLog{
 			Num:      NumWAL(m.mu.queue[i].FileNum),
-			segments: []segment{{dir: m.o.Primary}},
+			segments: m.segments(m.mu.queue[i]),
 		}
 	}
 	return wals, nil
@@ -102,19 +132,27 @@ func (m *StandaloneManager) Obsolete(
 	// logs outside the queue.
 	toDelete, m.initialObsolete = m.initialObsolete, nil
 
+	// Striped WALs are not recycled, and neither are the other WALs when
+	// striping is configured, since they are only used until the format
+	// major version allows striping.
+	noRecycle = noRecycle || len(m.dirs) > 1
+
 	i := 0
 	for ; i < len(m.mu.queue); i++ {
 		fi := m.mu.queue[i]
 		if fi.FileNum >= base.DiskFileNum(minUnflushedNum) {
 			break
 		}
-		if noRecycle || !m.recycler.Add(fi) {
-			toDelete = append(toDelete, DeletableLog{
-				FS:             m.o.Primary.FS,
-				Path:           m.o.Primary.FS.PathJoin(m.o.Primary.Dirname, makeLogFilename(NumWAL(fi.FileNum), 000)),
-				NumWAL:         NumWAL(fi.FileNum),
-				ApproxFileSize: fi.FileSize,
-			})
+		if noRecycle || !m.recycler.Add(fi.FileInfo) {
+			segments := m.segments(fi)
+			for _, s := range segments {
+				toDelete = append(toDelete, DeletableLog{
+					FS:             s.dir.FS,
+					Path:           s.dir.FS.PathJoin(s.dir.Dirname, makeLogFilename(NumWAL(fi.FileNum), s.logNameIndex)),
+					NumWAL:         NumWAL(fi.FileNum),
+					ApproxFileSize: fi.FileSize / uint64(len(segments)),
+				})
+			}
 		}
 	}
 	m.mu.queue = m.mu.queue[i:]
@@ -125,7 +163,22 @@ func (m *StandaloneManager) Obsolete(
 func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 	// TODO(sumeer): check monotonicity of wn.
 	newLogNum := base.DiskFileNum(wn)
-	newLogName := m.o.Primary.FS.PathJoin(m.o.Primary.Dirname, makeLogFilename(wn, 0))
+	if m.o.stripeWALs() {
+		w, err := m.createStriped(wn, jobID)
+		if err != nil {
+			return nil, err
+		}
+		m.w = w
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.mu.queue = append(m.mu.queue, standaloneLog{
+			FileInfo: base.FileInfo{FileNum: newLogNum},
+			striped:  true,
+		})
+		return m.w, nil
+	}
+	dir := m.o.Primary
+	newLogName := dir.FS.PathJoin(dir.Dirname, makeLogFilename(wn, 0))
 
 	// Try to use a recycled log file. Recycling log files is an important
 	// performance optimization as it is faster to sync a file that has
@@ -139,12 +192,12 @@ func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 	var err error
 	recycleLog, recycleOK = m.recycler.Peek()
 	if recycleOK {
-		recycleLogName := m.o.Primary.FS.PathJoin(m.o.Primary.Dirname, makeLogFilename(NumWAL(recycleLog.FileNum), 0))
-		newLogFile, err = m.o.Primary.FS.ReuseForWrite(recycleLogName, newLogName, "pebble-wal")
-		base.MustExist(m.o.Primary.FS, newLogName, m.o.Logger, err)
+		recycleLogName := dir.FS.PathJoin(dir.Dirname, makeLogFilename(NumWAL(recycleLog.FileNum), 0))
+		newLogFile, err = dir.FS.ReuseForWrite(recycleLogName, newLogName, "pebble-wal")
+		base.MustExist(dir.FS, newLogName, m.o.Logger, err)
 	} else {
-		newLogFile, err = m.o.Primary.FS.Create(newLogName, "pebble-wal")
-		base.MustExist(m.o.Primary.FS, newLogName, m.o.Logger, err)
+		newLogFile, err = dir.FS.Create(newLogName, "pebble-wal")
+		base.MustExist(dir.FS, newLogName, m.o.Logger, err)
 	}
 	createInfo := CreateInfo{
 		JobID:           jobID,
@@ -184,7 +237,7 @@ func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 	}
 	// TODO(peter): RocksDB delays sync of the parent directory until the
 	// first time the log is synced. Is that worthwhile?
-	if err = m.walDir.Sync(); err != nil {
+	if err = m.walDirs[0].Sync(); err != nil {
 		err = firstError(err, newLogFile.Close())
 		return nil, err
 	}
@@ -194,9 +247,11 @@ func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 		PreallocateSize: m.o.PreallocateSize(),
 	})
 	w := record.NewLogWriter(newLogFile, newLogNum, record.LogWriterConfig{
-		WALFsyncLatency:    m.o.FsyncLatency,
-		WALMinSyncInterval: m.o.MinSyncInterval,
-		QueueSemChan:       m.o.QueueSemChan,
+		WALFsyncLatency:      m.o.FsyncLatency,
+		WALMinSyncInterval:   m.o.MinSyncInterval,
+		QueueSemChan:         m.o.QueueSemChan,
+		Compression:          m.o.compression(),
+		SyncedMarkerCallback: m.o.SyncedMarkerCallback,
 	})
 	m.w = &standaloneWriter{
 		m: m,
@@ -204,7 +259,9 @@ func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.mu.queue = append(m.mu.queue, base.FileInfo{FileNum: newLogNum, FileSize: newLogSize})
+	m.mu.queue = append(m.mu.queue, standaloneLog{
+		FileInfo: base.FileInfo{FileNum: newLogNum, FileSize: newLogSize},
+	})
 	return m.w, nil
 }
 
@@ -242,7 +299,10 @@ func (m *StandaloneManager) Close() error {
 	if m.w != nil {
 		_, err = m.w.Close()
 	}
-	return firstError(err, m.walDir.Close())
+	for _, walDir := range m.walDirs {
+		err = firstError(err, walDir.Close())
+	}
+	return err
 }
 
 // RecyclerForTesting implements Manager.
@@ -270,7 +330,14 @@ var _ Writer = &standaloneWriter{}
 func (w *standaloneWriter) WriteRecord(
 	p []byte, opts SyncOptions, _ RefFunc,
 ) (logicalOffset int64, err error) {
-	return w.w.SyncRecord(p, opts.Done, opts.Err)
+	if opts.Marker != 0 {
+		w.w.SetMarker(opts.Marker)
+	}
+	logicalOffset, err = w.w.SyncRecord(p, opts.Done, opts.Err)
+	if err == nil && opts.Done == nil && opts.SyncWithin > 0 {
+		w.w.SyncWithin(opts.SyncWithin)
+	}
+	return logicalOffset, err
 }
 
 // Close implements Writer.
@@ -281,16 +348,22 @@ func (w *standaloneWriter) Close() (logicalOffset int64, err error) {
 	// creating the new log file, otherwise a crash could leave both logs with
 	// unclean tails, and DB.Open will treat the previous log as corrupt.
 	err = w.w.Close()
-	w.m.mu.Lock()
-	defer w.m.mu.Unlock()
-	i := len(w.m.mu.queue) - 1
+	w.m.writerClosed(logicalOffset)
+	return logicalOffset, err
+}
+
+// writerClosed is called when the Writer of the active WAL is closed, with
+// its logical size.
+func (m *StandaloneManager) writerClosed(logicalOffset int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := len(m.mu.queue) - 1
 	// The log may have grown past its original physical size. Update its file
 	// size in the queue so we have a proper accounting of its file size.
-	if w.m.mu.queue[i].FileSize < uint64(logicalOffset) {
-		w.m.mu.queue[i].FileSize = uint64(logicalOffset)
+	if m.mu.queue[i].FileSize < uint64(logicalOffset) {
+		m.mu.queue[i].FileSize = uint64(logicalOffset)
 	}
-	w.m.w = nil
-	return logicalOffset, err
+	m.w = nil
 }
 
 // Metrics implements Writer.
@@ -0,0 +1,348 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package wal
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// A striped WAL is made of one log file per dir of Options.Dirs, the stripes,
+// where the log file in the i-th dir has the LogNameIndex i. The records are
+// written round-robin to the stripes: the k-th record is written to the
+// stripe k%n, where n is the number of stripes. The reader reads them back in
+// the same order, and the WAL ends at the first record missing from this
+// order, so that the records read are always a prefix of the records
+// written, even if the tails of the stripes were lost in a crash.
+//
+// Each stripe begins with a header record holding its index and the number
+// of stripes, which tells the reader that the WAL is striped. Since the
+// records that precede a synced record may be in any stripe, all the stripes
+// are synced when a sync is requested: the stripes that don't hold the synced
+// record are sent an empty record requesting the sync. The empty records, and
+// the header, are shorter than a batch, so that older versions, which don't
+// understand striped WALs, refuse to replay them.
+
+// maxStripes bounds the number of stripes of a WAL, which is encoded in the
+// stripe header.
+const maxStripes = math.MaxUint16
+
+// stripeHeaderMagic begins the header record of a stripe.
+const stripeHeaderMagic = "\xffS"
+
+// stripeHeaderLen is the length of the header record of a stripe: the magic,
+// followed by the index of the stripe and the number of stripes, as 16-bit
+// little-endian integers.
+const stripeHeaderLen = len(stripeHeaderMagic) + 4
+
+// makeStripeHeader returns the header record of the stripe with the given
+// index, in a WAL with n stripes.
+func makeStripeHeader(index, n int) []byte {
+	h := make([]byte, stripeHeaderLen)
+	copy(h, stripeHeaderMagic)
+	binary.LittleEndian.PutUint16(h[len(stripeHeaderMagic):], uint16(index))
+	binary.LittleEndian.PutUint16(h[len(stripeHeaderMagic)+2:], uint16(n))
+	return h
+}
+
+// ParseStripeHeader parses the header record of a stripe of a striped WAL,
+// returning the index of the stripe and the number of stripes. It returns
+// false if the record is not a stripe header.
+func ParseStripeHeader(p []byte) (index, n int, ok bool) {
+	if len(p) != stripeHeaderLen || string(p[:len(stripeHeaderMagic)]) != stripeHeaderMagic {
+		return 0, 0, false
+	}
+	index = int(binary.LittleEndian.Uint16(p[len(stripeHeaderMagic):]))
+	n = int(binary.LittleEndian.Uint16(p[len(stripeHeaderMagic)+2:]))
+	if index >= n {
+		return 0, 0, false
+	}
+	return index, n, true
+}
+
+// createStriped creates the log files of a striped WAL, one in each of the
+// dirs, and returns its Writer.
+func (m *StandaloneManager) createStriped(wn NumWAL, jobID int) (*stripedWriter, error) {
+	w := &stripedWriter{
+		m:                    m,
+		queueSemChan:         m.o.QueueSemChan,
+		syncedMarkerCallback: m.o.SyncedMarkerCallback,
+	}
+	closeAndReturnErr := func(err error) (*stripedWriter, error) {
+		for _, lw := range w.writers {
+			err = firstError(err, lw.Close())
+		}
+		return nil, err
+	}
+	compression := m.o.compression()
+	for i, dir := range m.dirs {
+		logName := dir.FS.PathJoin(dir.Dirname, makeLogFilename(wn, LogNameIndex(i)))
+		f, err := dir.FS.Create(logName, "pebble-wal")
+		base.MustExist(dir.FS, logName, m.o.Logger, err)
+		m.o.EventListener.LogCreated(CreateInfo{
+			JobID: jobID,
+			Path:  logName,
+			Num:   wn,
+			Err:   err,
+		})
+		if err != nil {
+			return closeAndReturnErr(err)
+		}
+		if err := m.walDirs[i].Sync(); err != nil {
+			return closeAndReturnErr(firstError(err, f.Close()))
+		}
+		f = vfs.NewSyncingFile(f, vfs.SyncingFileOptions{
+			NoSyncOnClose:   m.o.NoSyncOnClose,
+			BytesPerSync:    m.o.BytesPerSync,
+			PreallocateSize: m.o.PreallocateSize(),
+		})
+		// The syncs are tracked by the stripedWriter, which pops from the
+		// QueueSemChan and reports the synced markers once all the stripes
+		// are synced.
+		w.writers = append(w.writers, record.NewLogWriter(f, base.DiskFileNum(wn), record.LogWriterConfig{
+			WALFsyncLatency:           m.o.FsyncLatency,
+			WALMinSyncInterval:        m.o.MinSyncInterval,
+			ExternalSyncQueueCallback: w.doneSyncCallback(i),
+			Compression:               compression,
+		}))
+	}
+	n := len(w.writers)
+	w.sizes = make([]int64, n)
+	w.written = make([]int64, n)
+	w.syncRequested = make([]int64, n)
+	w.mu.synced = make([]int64, n)
+	for i := range w.writers {
+		w.syncRequested[i] = record.NoSyncIndex
+		w.mu.synced[i] = record.NoSyncIndex
+		if _, err := w.write(i, makeStripeHeader(i, n), false /* sync */); err != nil {
+			return closeAndReturnErr(err)
+		}
+	}
+	return w, nil
+}
+
+// stripedWriter is the Writer of a striped WAL. It writes to one
+// record.LogWriter per stripe, and tracks the syncs requested, so that a
+// sync is only reported once all the stripes are synced.
+type stripedWriter struct {
+	m       *StandaloneManager
+	writers []*record.LogWriter
+
+	// External synchronization is relied on when accessing the following
+	// fields in WriteRecord and Close.
+	//
+	// next is the stripe of the next record, and index the index of the next
+	// write to a stripe, across all the stripes. written and syncRequested are
+	// the index of the last write and of the last sync requested in each
+	// stripe, and sizes the size of each stripe.
+	next          int
+	index         int64
+	written       []int64
+	syncRequested []int64
+	sizes         []int64
+	// marker is the last marker of the records written.
+	marker uint64
+
+	queueSemChan         chan struct{}
+	syncedMarkerCallback func(marker uint64)
+
+	mu struct {
+		sync.Mutex
+		// synced is the index of the last write synced in each stripe.
+		synced []int64
+		// err is the first error encountered by a sync, which fails all the
+		// syncs completed after it.
+		err error
+		// pending are the syncs requested and not yet completed, in the order
+		// in which they were requested.
+		pending []stripedSync
+	}
+}
+
+// stripedSync is a sync requested from a stripedWriter.
+type stripedSync struct {
+	// syncRequested is the index up to which each stripe must be synced for
+	// the sync to complete.
+	syncRequested []int64
+	opts          SyncOptions
+}
+
+var _ Writer = &stripedWriter{}
+
+// write writes a record to the given stripe, requesting its sync if sync is
+// true.
+func (w *stripedWriter) write(stripe int, p []byte, sync bool) (int64, error) {
+	index := w.index
+	w.index++
+	w.written[stripe] = index
+	psi := record.PendingSyncIndex{Index: record.NoSyncIndex}
+	if sync {
+		psi.Index = index
+		w.syncRequested[stripe] = index
+	}
+	size, err := w.writers[stripe].SyncRecordGeneralized(p, &psi)
+	if err != nil {
+		return 0, err
+	}
+	w.sizes[stripe] = size
+	return size, nil
+}
+
+// WriteRecord implements Writer.
+func (w *stripedWriter) WriteRecord(
+	p []byte, opts SyncOptions, _ RefFunc,
+) (logicalOffset int64, err error) {
+	stripe := w.next
+	w.next = (w.next + 1) % len(w.writers)
+	if opts.Marker != 0 {
+		w.marker = opts.Marker
+	}
+	// The records written with SyncWithin are synced right away: the syncs
+	// of the stripes are not otherwise tracked, and their markers must be
+	// reported.
+	if opts.Done == nil && opts.SyncWithin <= 0 {
+		if _, err := w.write(stripe, p, false /* sync */); err != nil {
+			return 0, err
+		}
+		return w.logicalOffset(), nil
+	}
+
+	// The sync is queued before the writes requesting it, since the stripes
+	// may be synced as soon as they are written to. The stripe of the record
+	// is synced with it, and each of the other stripes is sent an empty record
+	// if some of its records are not covered by an earlier sync.
+	syncRequested := make([]int64, len(w.writers))
+	index := w.index
+	for i := range w.writers {
+		syncRequested[i] = w.syncRequested[i]
+		if i == stripe || w.written[i] > w.syncRequested[i] {
+			syncRequested[i] = index
+			index++
+		}
+	}
+	w.mu.Lock()
+	w.mu.pending = append(w.mu.pending, stripedSync{
+		syncRequested: syncRequested,
+		opts:          SyncOptions{Done: opts.Done, Err: opts.Err, Marker: w.marker},
+	})
+	w.mu.Unlock()
+	for i := range w.writers {
+		if i == stripe {
+			_, err = w.write(i, p, true /* sync */)
+		} else if syncRequested[i] != w.syncRequested[i] {
+			_, err = w.write(i, nil, true /* sync */)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.logicalOffset(), nil
+}
+
+// logicalOffset returns the sum of the sizes of the stripes.
+func (w *stripedWriter) logicalOffset() int64 {
+	var offset int64
+	for _, size := range w.sizes {
+		offset += size
+	}
+	return offset
+}
+
+// doneSyncCallback returns the record.ExternalSyncQueueCallback of the given
+// stripe, which completes the syncs covered by the syncs of all the stripes.
+func (w *stripedWriter) doneSyncCallback(stripe int) record.ExternalSyncQueueCallback {
+	return func(doneSync record.PendingSyncIndex, err error) {
+		w.mu.Lock()
+		w.mu.synced[stripe] = max(w.mu.synced[stripe], doneSync.Index)
+		if w.mu.err == nil {
+			w.mu.err = err
+		}
+		err = w.mu.err
+		n := 0
+		for ; n < len(w.mu.pending); n++ {
+			if !w.syncedLocked(w.mu.pending[n].syncRequested) {
+				break
+			}
+		}
+		done := w.mu.pending[:n:n]
+		w.mu.pending = w.mu.pending[n:]
+		w.mu.Unlock()
+		w.completeSyncs(done, err)
+	}
+}
+
+// syncedLocked returns whether each stripe is synced up to the given index.
+// w.mu must be held.
+func (w *stripedWriter) syncedLocked(syncRequested []int64) bool {
+	for i := range syncRequested {
+		if w.mu.synced[i] < syncRequested[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// completeSyncs notifies the waiters of the given syncs, and reports the
+// marker of the last one if they succeeded.
+func (w *stripedWriter) completeSyncs(syncs []stripedSync, err error) {
+	var marker uint64
+	for i := range syncs {
+		marker = max(marker, syncs[i].opts.Marker)
+		if syncs[i].opts.Done == nil {
+			continue
+		}
+		if err != nil {
+			*syncs[i].opts.Err = err
+		}
+		syncs[i].opts.Done.Done()
+		if w.queueSemChan != nil {
+			<-w.queueSemChan
+		}
+	}
+	if err == nil && marker != 0 && w.syncedMarkerCallback != nil {
+		w.syncedMarkerCallback(marker)
+	}
+}
+
+// Close implements Writer.
+func (w *stripedWriter) Close() (logicalOffset int64, err error) {
+	logicalOffset = w.logicalOffset()
+	// Close the stripes in parallel. Each close writes an EOF trailer and
+	// syncs the stripe, completing the syncs that were still pending.
+	errs := make([]error, len(w.writers))
+	var wg sync.WaitGroup
+	for i := range w.writers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = w.writers[i].CloseWithLastQueuedRecord(
+				record.PendingSyncIndex{Index: w.syncRequested[i]})
+		}(i)
+	}
+	wg.Wait()
+	for i := range errs {
+		err = firstError(err, errs[i])
+	}
+	if err == nil && w.marker != 0 && w.syncedMarkerCallback != nil {
+		w.syncedMarkerCallback(w.marker)
+	}
+	w.m.writerClosed(logicalOffset)
+	return logicalOffset, err
+}
+
+// Metrics implements Writer.
+func (w *stripedWriter) Metrics() record.LogWriterMetrics {
+	var metrics record.LogWriterMetrics
+	for _, lw := range w.writers {
+		m := lw.Metrics()
+		_ = metrics.Merge(&m)
+	}
+	return metrics
+}
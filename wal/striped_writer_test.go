@@ -0,0 +1,172 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package wal
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripedWriter(t *testing.T) {
+	fs := vfs.NewStrictMem()
+	dirs := []Dir{{FS: fs, Dirname: "pri"}, {FS: fs, Dirname: "s1"}, {FS: fs, Dirname: "s2"}}
+	for _, dir := range dirs {
+		require.NoError(t, fs.MkdirAll(dir.Dirname, 0755))
+	}
+	root, err := fs.OpenDir("")
+	require.NoError(t, err)
+	require.NoError(t, root.Sync())
+	require.NoError(t, root.Close())
+	var syncedMarker atomic.Uint64
+	queueSemChan := make(chan struct{}, record.SyncConcurrency-1)
+	m, err := Init(Options{
+		Primary:              dirs[0],
+		Stripes:              dirs[1:],
+		MaxNumRecyclableLogs: 1,
+		PreallocateSize:      func() int { return 0 },
+		QueueSemChan:         queueSemChan,
+		SyncedMarkerCallback: func(marker uint64) {
+			for {
+				prev := syncedMarker.Load()
+				if marker <= prev || syncedMarker.CompareAndSwap(prev, marker) {
+					return
+				}
+			}
+		},
+		EventListener: noopEventListener{},
+	}, nil)
+	require.NoError(t, err)
+
+	batch := func(seqNum uint64) []byte {
+		repr := make([]byte, batchrepr.HeaderLen+10)
+		batchrepr.SetSeqNum(repr, seqNum)
+		batchrepr.SetCount(repr, 1)
+		return repr
+	}
+	w, err := m.Create(1, 0)
+	require.NoError(t, err)
+	// Every fifth batch is synced. A synced batch is only reported once all
+	// the stripes are synced, along with its marker.
+	for seqNum := uint64(1); seqNum <= 20; seqNum++ {
+		opts := SyncOptions{Marker: seqNum + 1}
+		var wg sync.WaitGroup
+		var syncErr error
+		if seqNum%5 == 0 {
+			wg.Add(1)
+			opts.Done, opts.Err = &wg, &syncErr
+			queueSemChan <- struct{}{}
+		}
+		_, err := w.WriteRecord(batch(seqNum), opts, nil)
+		require.NoError(t, err)
+		wg.Wait()
+		require.NoError(t, syncErr)
+		if seqNum%5 == 0 {
+			require.LessOrEqual(t, seqNum+1, syncedMarker.Load())
+		}
+	}
+	require.Len(t, queueSemChan, 0)
+
+	// The batches written after the last sync are lost in a crash.
+	for seqNum := uint64(21); seqNum <= 25; seqNum++ {
+		_, err := w.WriteRecord(batch(seqNum), SyncOptions{Marker: seqNum + 1}, nil)
+		require.NoError(t, err)
+	}
+	fs.SetIgnoreSyncs(true)
+	require.NoError(t, m.Close())
+	fs.ResetToSyncedState()
+	fs.SetIgnoreSyncs(false)
+
+	// The WAL has a log file in each dir, and the batches are read back in
+	// order, up to the last one synced.
+	logs, err := Scan(dirs...)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, 3, logs[0].NumSegments())
+	for i := range dirs {
+		_, path := logs[0].SegmentLocation(i)
+		require.Equal(t, fs.PathJoin(dirs[i].Dirname, makeLogFilename(1, LogNameIndex(i))), path)
+	}
+	r := logs[0].OpenForRead()
+	for seqNum := uint64(1); ; seqNum++ {
+		rr, _, err := r.NextRecord()
+		if err != nil {
+			require.True(t, err == io.EOF || record.IsInvalidRecord(err), "%v", err)
+			require.Equal(t, uint64(21), seqNum)
+			break
+		}
+		b, err := io.ReadAll(rr)
+		require.NoError(t, err)
+		require.Equal(t, seqNum, batchrepr.ReadSeqNum(b), "%x", b)
+	}
+	require.NoError(t, r.Close())
+
+	// The log files of an obsolete striped WAL are all deleted.
+	m, err = Init(Options{
+		Primary:              dirs[0],
+		Stripes:              dirs[1:],
+		MaxNumRecyclableLogs: 1,
+		PreallocateSize:      func() int { return 0 },
+		EventListener:        noopEventListener{},
+	}, logs)
+	require.NoError(t, err)
+	w, err = m.Create(2, 0)
+	require.NoError(t, err)
+	_, err = w.Close()
+	require.NoError(t, err)
+	toDelete, err := m.Obsolete(3, false /* noRecycle */)
+	require.NoError(t, err)
+	var paths []string
+	for _, l := range toDelete {
+		paths = append(paths, l.Path)
+	}
+	require.Equal(t, []string{
+		"pri/000001.log", "s1/000001-001.log", "s2/000001-002.log",
+		"pri/000002.log", "s1/000002-001.log", "s2/000002-002.log",
+	}, paths)
+	require.NoError(t, m.Close())
+}
+
+// TestStripedWriterNotStriped tests that the WALs are only written to the
+// primary dir when Options.StripeWALs returns false.
+func TestStripedWriterNotStriped(t *testing.T) {
+	fs := vfs.NewMem()
+	dirs := []Dir{{FS: fs, Dirname: "pri"}, {FS: fs, Dirname: "s1"}}
+	for _, dir := range dirs {
+		require.NoError(t, fs.MkdirAll(dir.Dirname, 0755))
+	}
+	var striped atomic.Bool
+	m, err := Init(Options{
+		Primary:         dirs[0],
+		Stripes:         dirs[1:],
+		StripeWALs:      striped.Load,
+		PreallocateSize: func() int { return 0 },
+		EventListener:   noopEventListener{},
+	}, nil)
+	require.NoError(t, err)
+	for wn := NumWAL(1); wn <= 2; wn++ {
+		w, err := m.Create(wn, 0)
+		require.NoError(t, err)
+		_, err = w.Close()
+		require.NoError(t, err)
+		striped.Store(true)
+	}
+	logs, err := m.List()
+	require.NoError(t, err)
+	require.Equal(t, "000001: {(pri,000)}\n000002: {(pri,000), (s1,001)}",
+		fmt.Sprintf("%s\n%s", logs[0], logs[1]))
+	require.NoError(t, m.Close())
+}
+
+type noopEventListener struct{}
+
+func (noopEventListener) LogCreated(CreateInfo) {}
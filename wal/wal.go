@@ -99,6 +99,18 @@ type Options struct {
 	// Secondary is used for failover. Optional. It must already be created and
 	// synced up to the root.
 	Secondary Dir
+	// Stripes are additional dirs across which the WALs are striped with
+	// Primary: the records of a striped WAL are written round-robin to a log
+	// file in Primary and in each of the Stripes, so that they are written and
+	// synced in parallel, and they are read back in the same order. Optional,
+	// and incompatible with Secondary. They must already be created and synced
+	// up to the root. Log files are not recycled when Stripes is set.
+	Stripes []Dir
+	// StripeWALs returns whether a new WAL is striped across Primary and the
+	// Stripes; it is called when the WAL is created, and a WAL that isn't
+	// striped is written to Primary. If nil, the WALs are striped whenever
+	// Stripes is set.
+	StripeWALs func() bool
 
 	// MinUnflushedLogNum is the smallest WAL number corresponding to
 	// mutations that have not been flushed to a sstable.
@@ -121,6 +133,10 @@ type Options struct {
 
 	// MinSyncInterval is documented in Options.WALMinSyncInterval.
 	MinSyncInterval func() time.Duration
+	// Compression returns the compression applied to the records of a WAL; it
+	// is called when the WAL is created. If nil, the records are not
+	// compressed. See record.Compression.
+	Compression func() record.Compression
 	// FsyncLatency records fsync latency. This doesn't differentiate between
 	// fsyncs on the primary and secondary dir.
 	//
@@ -145,12 +161,26 @@ type Options struct {
 	// FailoverWriteAndSyncLatency is only populated when WAL failover is
 	// configured.
 	FailoverWriteAndSyncLatency prometheus.Histogram
+
+	// SyncedMarkerCallback, if non-nil, is invoked with the marker of the last
+	// record synced (see SyncOptions.Marker). It may be invoked concurrently
+	// and with markers lower than ones already reported, and must not block.
+	// In failover mode, only the syncs requested with SyncOptions.Done and the
+	// close of a Writer are reported, and for a striped WAL, only those
+	// requested with SyncOptions.Done or SyncOptions.SyncWithin and the close.
+	SyncedMarkerCallback func(marker uint64)
 }
 
 // Init constructs and initializes a WAL manager from the provided options and
 // the set of initial logs.
 func Init(o Options, initial Logs) (Manager, error) {
 	var m Manager
+	if o.Secondary != (Dir{}) && len(o.Stripes) > 0 {
+		return nil, base.AssertionFailedf("cannot stripe the WAL with a secondary")
+	}
+	if len(o.Stripes) >= maxStripes {
+		return nil, base.AssertionFailedf("cannot stripe the WAL across more than %d dirs", maxStripes)
+	}
 	if o.Secondary == (Dir{}) {
 		m = new(StandaloneManager)
 	} else {
@@ -162,10 +192,27 @@ func Init(o Options, initial Logs) (Manager, error) {
 	return m, nil
 }
 
-// Dirs returns the primary Dir and the secondary if provided.
+// compression returns the compression to apply to the records of a new WAL.
+func (o *Options) compression() record.Compression {
+	if o.Compression == nil {
+		return record.NoCompression
+	}
+	return o.Compression()
+}
+
+// stripeWALs returns whether a new WAL is striped across the Dirs.
+func (o *Options) stripeWALs() bool {
+	if len(o.Stripes) == 0 {
+		return false
+	}
+	return o.StripeWALs == nil || o.StripeWALs()
+}
+
+// Dirs returns the primary Dir, followed by the secondary or the stripes if
+// provided.
 func (o *Options) Dirs() []Dir {
 	if o.Secondary == (Dir{}) {
-		return []Dir{o.Primary}
+		return append([]Dir{o.Primary}, o.Stripes...)
 	}
 	return []Dir{o.Primary, o.Secondary}
 }
@@ -366,6 +413,14 @@ type DeletableLog struct {
 type SyncOptions struct {
 	Done *sync.WaitGroup
 	Err  *error
+	// SyncWithin, if positive and Done is nil, requests that the record be
+	// synced within the duration, without waiting for the sync. The sync may be
+	// shared with the other records written before it is performed.
+	SyncWithin time.Duration
+	// Marker, if non-zero, is reported to Options.SyncedMarkerCallback once the
+	// record is synced. Markers must not decrease across the records of a
+	// Writer. See record.LogWriter.SetMarker.
+	Marker uint64
 }
 
 // Writer writes to a virtual WAL. A Writer in standalone mode maps to a
@@ -406,6 +461,10 @@ type Reader interface {
 	// are no more records. The reader returned becomes stale after the next Next
 	// call, and should no longer be used.
 	NextRecord() (io.Reader, Offset, error)
+	// Recover clears the error returned by the last call to NextRecord if the
+	// record was corrupted, so that the next call to NextRecord skips to the
+	// next valid record (see record.Reader.Recover).
+	Recover()
 	// Close the reader.
 	Close() error
 }
@@ -0,0 +1,368 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/errors/oserror"
+	"github.com/cockroachdb/pebble/batchrepr"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/wal"
+)
+
+// walArchiveIndexPrefix is the prefix of the index entries of the archived
+// WALs, relative to WALArchiveOptions.Prefix. Each archived WAL has its own
+// index entry, <walArchiveIndexPrefix><WAL file name>, written once the WAL is
+// uploaded: archiving a WAL doesn't rewrite the entries of the other WALs.
+const walArchiveIndexPrefix = "wal-archive-index/"
+
+// ArchivedWAL describes a WAL archived to remote storage (see
+// WALArchiveOptions).
+type ArchivedWAL struct {
+	// ObjectName is the name of the object, including WALArchiveOptions.Prefix.
+	ObjectName string
+	// FileNum is the file number of the WAL.
+	FileNum base.DiskFileNum
+	// SmallestSeqNum and LargestSeqNum are the range of sequence numbers of the
+	// batches in the WAL. They are zero if the WAL contains no batch.
+	SmallestSeqNum uint64
+	LargestSeqNum  uint64
+	// Size is the size of the object.
+	Size int64
+}
+
+// ReadWALArchiveIndex returns the WALs archived with the given storage and
+// prefix (see WALArchiveOptions), ordered by file number.
+func ReadWALArchiveIndex(storage remote.Storage, prefix string) ([]ArchivedWAL, error) {
+	ctx := context.Background()
+	indexPrefix := prefix + walArchiveIndexPrefix
+	names, err := storage.List(indexPrefix, "" /* delimiter */)
+	if err != nil {
+		return nil, err
+	}
+	wals := make([]ArchivedWAL, 0, len(names))
+	for _, name := range names {
+		// Some implementations don't trim the prefix from the names.
+		name = indexPrefix + strings.TrimPrefix(name, indexPrefix)
+		data, err := readWALArchiveIndexEntry(ctx, storage, name)
+		if err != nil {
+			return nil, err
+		}
+		w, err := decodeWALArchiveIndexEntry(data)
+		if err != nil {
+			return nil, err
+		}
+		wals = append(wals, w)
+	}
+	slices.SortFunc(wals, func(a, b ArchivedWAL) int {
+		if c := cmp.Compare(a.FileNum, b.FileNum); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ObjectName, b.ObjectName)
+	})
+	return wals, nil
+}
+
+func readWALArchiveIndexEntry(
+	ctx context.Context, storage remote.Storage, objName string,
+) ([]byte, error) {
+	r, size, err := storage.ReadObject(ctx, objName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data := make([]byte, size)
+	if err := r.ReadAt(ctx, data, 0); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// decodeWALArchiveIndexEntry decodes an index entry: "<object name> <file
+// number> <smallest seqnum> <largest seqnum> <size>".
+func decodeWALArchiveIndexEntry(data []byte) (ArchivedWAL, error) {
+	var w ArchivedWAL
+	var fileNum uint64
+	if _, err := fmt.Sscanf(string(data), "%s %d %d %d %d\n",
+		&w.ObjectName, &fileNum, &w.SmallestSeqNum, &w.LargestSeqNum, &w.Size); err != nil {
+		return ArchivedWAL{}, base.CorruptionErrorf("pebble: invalid WAL archive index entry %q: %v", data, err)
+	}
+	w.FileNum = base.DiskFileNum(fileNum)
+	return w, nil
+}
+
+func encodeWALArchiveIndexEntry(w ArchivedWAL) []byte {
+	return fmt.Appendf(nil, "%s %d %d %d %d\n",
+		w.ObjectName, uint64(w.FileNum), w.SmallestSeqNum, w.LargestSeqNum, w.Size)
+}
+
+// walArchiver uploads the obsolete WALs to remote storage in the background.
+// See WALArchiveOptions.
+type walArchiver struct {
+	opts *Options
+	// deleteFn cleans the local file of a WAL once it is archived.
+	deleteFn func(jobID JobID, log wal.DeletableLog)
+	mu       struct {
+		sync.Mutex
+		// cond is signaled when a WAL is queued or archived, and when the
+		// archiver is closed.
+		cond    sync.Cond
+		queue   []queuedWAL
+		closed  bool
+		metrics walArchiveMetrics
+	}
+	// ctx is canceled when the archiver is closed, which interrupts the upload
+	// in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type queuedWAL struct {
+	jobID      JobID
+	log        wal.DeletableLog
+	enqueuedAt time.Time
+}
+
+type walArchiveMetrics struct {
+	queuedBytes   uint64
+	archivedFiles int64
+	archivedBytes uint64
+	largestSeqNum uint64
+	failures      int64
+	skipped       int64
+}
+
+func openWALArchiver(opts *Options, deleteFn func(JobID, wal.DeletableLog)) *walArchiver {
+	a := &walArchiver{opts: opts, deleteFn: deleteFn}
+	a.mu.cond.L = &a.mu.Mutex
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	a.wg.Add(1)
+	go a.mainLoop()
+	return a
+}
+
+// enqueue queues an obsolete WAL to be archived. It blocks while the queue is
+// full. If the archiver is closed, the WAL is left in place: it will be
+// archived when the DB is reopened.
+func (a *walArchiver) enqueue(jobID JobID, log wal.DeletableLog) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.mu.queue) > 0 && a.mu.metrics.queuedBytes >= a.opts.WALArchive.MaxQueuedBytes && !a.mu.closed {
+		a.mu.cond.Wait()
+	}
+	if a.mu.closed {
+		return
+	}
+	a.mu.queue = append(a.mu.queue, queuedWAL{jobID: jobID, log: log, enqueuedAt: time.Now()})
+	a.mu.metrics.queuedBytes += log.ApproxFileSize
+	a.mu.cond.Broadcast()
+}
+
+// close stops the archiver, without waiting for the queued WALs to be
+// archived.
+func (a *walArchiver) close() {
+	a.mu.Lock()
+	a.mu.closed = true
+	a.mu.cond.Broadcast()
+	a.mu.Unlock()
+	a.cancel()
+	a.wg.Wait()
+}
+
+func (a *walArchiver) mainLoop() {
+	defer a.wg.Done()
+	for {
+		a.mu.Lock()
+		for len(a.mu.queue) == 0 && !a.mu.closed {
+			a.mu.cond.Wait()
+		}
+		if a.mu.closed {
+			a.mu.Unlock()
+			return
+		}
+		q := a.mu.queue[0]
+		a.mu.Unlock()
+
+		err := a.archive(q.log)
+		if err != nil && a.ctx.Err() != nil {
+			// The archiver was closed during the upload.
+			return
+		}
+		permanent := err != nil && a.isPermanentError(err)
+		if err != nil {
+			a.opts.EventListener.BackgroundError(errors.Wrapf(err, "pebble: archiving WAL %s", q.log.Path))
+			a.mu.Lock()
+			a.mu.metrics.failures++
+			if permanent {
+				a.mu.metrics.skipped++
+			}
+			a.mu.Unlock()
+		}
+		if err != nil && !permanent {
+			// Transient failures, like network errors, are retried after a delay.
+			t := time.NewTimer(a.opts.WALArchive.RetryInterval)
+			select {
+			case <-a.ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			continue
+		}
+
+		a.mu.Lock()
+		a.mu.queue = a.mu.queue[1:]
+		a.mu.metrics.queuedBytes -= q.log.ApproxFileSize
+		a.mu.cond.Broadcast()
+		a.mu.Unlock()
+		// A WAL that can't be archived is skipped, and left on disk.
+		if !permanent {
+			a.deleteFn(q.jobID, q.log)
+		}
+	}
+}
+
+// isPermanentError returns true if the archival of a WAL failed with an error
+// that retrying would hit again: the WAL doesn't exist or can't be read, or the
+// remote location doesn't exist.
+func (a *walArchiver) isPermanentError(err error) bool {
+	return oserror.IsNotExist(err) || oserror.IsPermission(err) ||
+		errors.Is(err, base.ErrCorruption) || a.opts.WALArchive.Storage.IsNotExistError(err)
+}
+
+// archive uploads a WAL and writes its index entry.
+func (a *walArchiver) archive(log wal.DeletableLog) error {
+	storage, prefix := a.opts.WALArchive.Storage, a.opts.WALArchive.Prefix
+	f, err := log.FS.Open(log.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	archived := ArchivedWAL{
+		ObjectName: prefix + log.FS.PathBase(log.Path),
+		FileNum:    base.DiskFileNum(log.NumWAL),
+	}
+	w, err := storage.CreateObject(archived.ObjectName)
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: w}
+	// Read the records while uploading the file, to find the range of sequence
+	// numbers. The records end at the first invalid chunk, which is expected
+	// at the tail of a WAL; the rest of the file is uploaded as is.
+	src := &ctxReader{ctx: a.ctx, r: f}
+	rr := record.NewReader(io.TeeReader(src, cw), base.DiskFileNum(log.NumWAL))
+	var buf bytes.Buffer
+	for {
+		r, err := rr.Next()
+		if err == nil {
+			buf.Reset()
+			_, err = io.Copy(&buf, r)
+		}
+		if err != nil {
+			if cw.err != nil {
+				err = cw.err
+			}
+			if err == io.EOF || record.IsInvalidRecord(err) {
+				break
+			}
+			_ = w.Close()
+			return err
+		}
+		h, ok := batchrepr.ReadHeader(buf.Bytes())
+		if !ok || h.Count == 0 {
+			continue
+		}
+		if archived.SmallestSeqNum == 0 || h.SeqNum < archived.SmallestSeqNum {
+			archived.SmallestSeqNum = h.SeqNum
+		}
+		archived.LargestSeqNum = max(archived.LargestSeqNum, h.SeqNum+uint64(h.Count)-1)
+	}
+	if _, err := io.Copy(cw, src); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	archived.Size = cw.n
+
+	iw, err := storage.CreateObject(prefix + walArchiveIndexPrefix + log.FS.PathBase(log.Path))
+	if err != nil {
+		return err
+	}
+	if _, err := iw.Write(encodeWALArchiveIndexEntry(archived)); err != nil {
+		_ = iw.Close()
+		return err
+	}
+	if err := iw.Close(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.mu.metrics.archivedFiles++
+	a.mu.metrics.archivedBytes += uint64(archived.Size)
+	a.mu.metrics.largestSeqNum = max(a.mu.metrics.largestSeqNum, archived.LargestSeqNum)
+	return nil
+}
+
+// countingWriter counts the bytes written to w, and records the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// ctxReader reads from r until ctx is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// metrics populates m.WALArchive.
+func (a *walArchiver) metrics(m *Metrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m.WALArchive.QueuedFiles = int64(len(a.mu.queue))
+	m.WALArchive.QueuedBytes = a.mu.metrics.queuedBytes
+	m.WALArchive.ArchivedFiles = a.mu.metrics.archivedFiles
+	m.WALArchive.ArchivedBytes = a.mu.metrics.archivedBytes
+	m.WALArchive.LargestSeqNum = a.mu.metrics.largestSeqNum
+	m.WALArchive.Failures = a.mu.metrics.failures
+	m.WALArchive.SkippedFiles = a.mu.metrics.skipped
+	if len(a.mu.queue) > 0 {
+		m.WALArchive.Lag = time.Since(a.mu.queue[0].enqueuedAt)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/wal"
+	"github.com/stretchr/testify/require"
+)
+
+// failingStorage fails the creation of objects while fail is set.
+type failingStorage struct {
+	remote.Storage
+	fail atomic.Bool
+}
+
+func (s *failingStorage) CreateObject(objName string) (io.WriteCloser, error) {
+	if s.fail.Load() {
+		return nil, errors.New("injected error")
+	}
+	return s.Storage.CreateObject(objName)
+}
+
+func TestWALArchive(t *testing.T) {
+	mem := vfs.NewMem()
+	storage := &failingStorage{Storage: remote.NewInMem()}
+	open := func() *DB {
+		d, err := Open("", &Options{
+			FS: mem,
+			WALArchive: WALArchiveOptions{
+				Storage:       storage,
+				Prefix:        "wals/",
+				RetryInterval: time.Millisecond,
+			},
+			EventListener: &EventListener{BackgroundError: func(error) {}},
+		})
+		require.NoError(t, err)
+		return d
+	}
+	localWALs := func() []base.DiskFileNum {
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		var nums []base.DiskFileNum
+		for _, filename := range ls {
+			if num, _, ok := wal.ParseLogFilename(filename); ok {
+				nums = append(nums, base.DiskFileNum(num))
+			}
+		}
+		slices.Sort(nums)
+		return nums
+	}
+	waitFor := func(fn func(m *Metrics) bool, d *DB) *Metrics {
+		for i := 0; ; i++ {
+			m := d.Metrics()
+			if fn(m) {
+				return m
+			}
+			require.Less(t, i, 1000, "%s", m)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	ranges := func() []string {
+		wals, err := ReadWALArchiveIndex(storage, "wals/")
+		require.NoError(t, err)
+		var res []string
+		for _, w := range wals {
+			// The object holds the whole WAL.
+			r, size, err := storage.ReadObject(context.Background(), w.ObjectName)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			require.Equal(t, w.Size, size)
+			num, _, ok := wal.ParseLogFilename(strings.TrimPrefix(w.ObjectName, "wals/"))
+			require.True(t, ok)
+			require.Equal(t, w.FileNum, base.DiskFileNum(num))
+			res = append(res, fmt.Sprintf("%d-%d", w.SmallestSeqNum, w.LargestSeqNum))
+		}
+		return res
+	}
+
+	// Each flush makes a WAL obsolete, which is archived and then deleted.
+	d := open()
+	for _, keys := range [][]string{{"a", "b", "c"}, {"d", "e"}} {
+		for _, k := range keys {
+			require.NoError(t, d.Set([]byte(k), nil, nil))
+		}
+		require.NoError(t, d.Flush())
+	}
+	m := waitFor(func(m *Metrics) bool { return m.WALArchive.ArchivedFiles == 2 }, d)
+	require.Zero(t, m.WALArchive.QueuedFiles)
+	require.Zero(t, m.WALArchive.Lag)
+	require.Equal(t, uint64(14), m.WALArchive.LargestSeqNum)
+	require.Contains(t, m.String(), "WAL archive: queued: 0 (0B)  archived: 2")
+	require.Equal(t, []string{"10-12", "13-14"}, ranges())
+	d.cleanupManager.Wait()
+	require.Len(t, localWALs(), 1)
+
+	// While the uploads fail, the obsolete WALs are kept on disk.
+	storage.fail.Store(true)
+	require.NoError(t, d.Set([]byte("f"), nil, nil))
+	require.NoError(t, d.Flush())
+	m = waitFor(func(m *Metrics) bool { return m.WALArchive.Failures > 0 }, d)
+	require.Equal(t, int64(1), m.WALArchive.QueuedFiles)
+	require.NotZero(t, m.WALArchive.QueuedBytes)
+	require.NotZero(t, m.WALArchive.Lag)
+	require.Len(t, localWALs(), 2)
+	require.NoError(t, d.Close())
+
+	// The queued WAL is archived when the DB is reopened, along with the WAL
+	// that was live when the DB was closed, which has no batch.
+	storage.fail.Store(false)
+	d = open()
+	waitFor(func(m *Metrics) bool { return m.WALArchive.ArchivedFiles == 2 }, d)
+	require.Equal(t, []string{"10-12", "13-14", "15-15", "0-0"}, ranges())
+	d.cleanupManager.Wait()
+	require.Len(t, localWALs(), 1)
+	require.NoError(t, d.Close())
+}
+
+func TestWALArchiveBackPressure(t *testing.T) {
+	storage := &failingStorage{Storage: remote.NewInMem()}
+	storage.fail.Store(true)
+	opts := &Options{
+		WALArchive: WALArchiveOptions{
+			Storage:        storage,
+			MaxQueuedBytes: 1,
+			RetryInterval:  time.Millisecond,
+		},
+		EventListener: &EventListener{BackgroundError: func(error) {}},
+	}
+	opts.EnsureDefaults()
+	deleted := make(chan base.DiskFileNum, 2)
+	a := openWALArchiver(opts, func(_ JobID, log wal.DeletableLog) {
+		deleted <- base.DiskFileNum(log.NumWAL)
+	})
+	defer a.close()
+
+	mem := vfs.NewMem()
+	for i := 1; i <= 2; i++ {
+		f, err := mem.Create(fmt.Sprintf("%d.log", i), vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	// The first WAL is queued even though it exceeds the limit; the second one
+	// blocks until the first one is archived.
+	a.enqueue(1, wal.DeletableLog{FS: mem, Path: "1.log", NumWAL: 1, ApproxFileSize: 10})
+	enqueued := make(chan struct{})
+	go func() {
+		a.enqueue(1, wal.DeletableLog{FS: mem, Path: "2.log", NumWAL: 2, ApproxFileSize: 10})
+		close(enqueued)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-enqueued:
+		t.Fatal("enqueue did not block")
+	default:
+	}
+	storage.fail.Store(false)
+	<-enqueued
+	require.Equal(t, base.DiskFileNum(1), <-deleted)
+	require.Equal(t, base.DiskFileNum(2), <-deleted)
+}
+
+func TestWALArchivePermanentFailure(t *testing.T) {
+	storage := remote.NewInMem()
+	opts := &Options{
+		WALArchive: WALArchiveOptions{
+			Storage: storage,
+			// Permanent failures are not retried: the test would time out
+			// otherwise.
+			RetryInterval: time.Hour,
+		},
+	}
+	var bgErrs atomic.Int32
+	opts.EventListener = &EventListener{BackgroundError: func(error) { bgErrs.Add(1) }}
+	opts.EnsureDefaults()
+	deleted := make(chan base.DiskFileNum, 2)
+	a := openWALArchiver(opts, func(_ JobID, log wal.DeletableLog) {
+		deleted <- base.DiskFileNum(log.NumWAL)
+	})
+	defer a.close()
+
+	// The first WAL doesn't exist: it is skipped, and the second one is
+	// archived.
+	mem := vfs.NewMem()
+	f, err := mem.Create("2.log", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	a.enqueue(1, wal.DeletableLog{FS: mem, Path: "1.log", NumWAL: 1, ApproxFileSize: 10})
+	a.enqueue(1, wal.DeletableLog{FS: mem, Path: "2.log", NumWAL: 2, ApproxFileSize: 10})
+	require.Equal(t, base.DiskFileNum(2), <-deleted)
+	require.Equal(t, int32(1), bgErrs.Load())
+
+	var m Metrics
+	a.metrics(&m)
+	require.Equal(t, int64(1), m.WALArchive.ArchivedFiles)
+	require.Equal(t, int64(1), m.WALArchive.Failures)
+	require.Equal(t, int64(1), m.WALArchive.SkippedFiles)
+	require.Zero(t, m.WALArchive.QueuedFiles)
+	wals, err := ReadWALArchiveIndex(storage, "")
+	require.NoError(t, err)
+	require.Len(t, wals, 1)
+	require.Equal(t, base.DiskFileNum(2), wals[0].FileNum)
+}
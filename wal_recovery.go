@@ -0,0 +1,115 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+)
+
+// WALRecoveryMode configures how Open handles corrupted WALs when replaying
+// them. The data discarded because of a corruption is reported through
+// EventListener.WALDiscarded, except for the tail discarded by
+// WALRecoveryTolerateCorruptedTail, which cannot be told apart from the data
+// left by WAL preallocation and recycling.
+type WALRecoveryMode int8
+
+const (
+	// WALRecoveryTolerateCorruptedTail tolerates a corruption at the tail of the
+	// most recent WAL: the rest of the WAL is discarded. Such a corruption is
+	// expected after a crash, since the last writes may have been partially
+	// written (and WAL preallocation and recycling leave stale or zeroed data
+	// past the last record). The discarded tail is not reported to the
+	// EventListener. Any other corruption fails Open. This is the default.
+	WALRecoveryTolerateCorruptedTail WALRecoveryMode = iota
+	// WALRecoveryAbsoluteConsistency fails Open on any corruption, including
+	// at the tail of the most recent WAL. It is only suitable if the WALs are
+	// always closed cleanly.
+	WALRecoveryAbsoluteConsistency
+	// WALRecoveryPointInTime stops replaying at the first corruption: the rest
+	// of the corrupted WAL and all the later WALs are discarded, so that the
+	// DB is recovered to a consistent point in time.
+	WALRecoveryPointInTime
+	// WALRecoverySkipCorruptedRecords skips the corrupted records and replays
+	// all the valid ones. Reading resumes at the next 32KB block of the WAL,
+	// so the valid records that follow a corruption within the same block are
+	// discarded too. The DB may then be inconsistent, since it may contain
+	// batches that were applied after the discarded ones.
+	WALRecoverySkipCorruptedRecords
+)
+
+// String implements fmt.Stringer.
+func (m WALRecoveryMode) String() string {
+	switch m {
+	case WALRecoveryTolerateCorruptedTail:
+		return "tolerate-corrupted-tail"
+	case WALRecoveryAbsoluteConsistency:
+		return "absolute-consistency"
+	case WALRecoveryPointInTime:
+		return "point-in-time"
+	case WALRecoverySkipCorruptedRecords:
+		return "skip-corrupted-records"
+	default:
+		return fmt.Sprintf("WALRecoveryMode(%d)", int8(m))
+	}
+}
+
+// WALDiscardKind describes the data of a WAL discarded by WAL recovery.
+type WALDiscardKind int8
+
+const (
+	// WALDiscardRecord indicates that a corrupted record was discarded, along
+	// with the records that follow it in the same block of the WAL.
+	WALDiscardRecord WALDiscardKind = iota
+	// WALDiscardTail indicates that the WAL was discarded from the corruption
+	// to its end.
+	WALDiscardTail
+	// WALDiscardLog indicates that the entire WAL was discarded, because of a
+	// corruption in a previous WAL.
+	WALDiscardLog
+)
+
+// String implements fmt.Stringer.
+func (k WALDiscardKind) String() string {
+	switch k {
+	case WALDiscardRecord:
+		return "record"
+	case WALDiscardTail:
+		return "tail"
+	case WALDiscardLog:
+		return "log"
+	default:
+		return fmt.Sprintf("WALDiscardKind(%d)", int8(k))
+	}
+}
+
+// walDiscardKind returns what is discarded when replaying a WAL encounters the
+// given error, according to Options.WALRecoveryMode. It returns false if the
+// error must fail the replay instead. lastWAL is true if the WAL is the most
+// recent one.
+func (d *DB) walDiscardKind(err error, lastWAL bool) (WALDiscardKind, bool) {
+	// Only corruptions are tolerated; I/O errors always fail the replay.
+	if !record.IsInvalidRecord(err) && !errors.Is(err, base.ErrCorruption) {
+		return 0, false
+	}
+	switch d.opts.WALRecoveryMode {
+	case WALRecoveryTolerateCorruptedTail:
+		// It is common to encounter a zeroed or invalid chunk due to WAL
+		// preallocation and WAL recycling. We need to distinguish these
+		// errors from EOF in order to recognize that the record was
+		// truncated and to avoid replaying subsequent WALs, but want
+		// to otherwise treat them like EOF.
+		return WALDiscardTail, lastWAL && record.IsInvalidRecord(err)
+	case WALRecoveryPointInTime:
+		return WALDiscardTail, true
+	case WALRecoverySkipCorruptedRecords:
+		return WALDiscardRecord, true
+	default:
+		return 0, false
+	}
+}
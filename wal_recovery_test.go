@@ -0,0 +1,214 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/record"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/cockroachdb/pebble/vfs/errorfs"
+	"github.com/cockroachdb/pebble/wal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALRecoveryMode(t *testing.T) {
+	// The value of b2 spans two blocks of the WAL, so that the reader
+	// resynchronizes on b3 when b2 is skipped.
+	largeValue := bytes.Repeat([]byte("x"), 40<<10)
+
+	// makeDB returns a DB with three unflushed WALs: the first one contains
+	// the keys a1-a3, the second one b1-b3 and the third one c1-c3.
+	makeDB := func(t *testing.T) (*vfs.MemFS, []string) {
+		mem := vfs.NewMem()
+		d, err := Open("", &Options{FS: mem, Logger: testLogger{t}})
+		require.NoError(t, err)
+		d.mu.Lock()
+		// Disable the flushes, so that the WALs are replayed on Open.
+		d.mu.compact.flushing = true
+		d.mu.Unlock()
+		for _, prefix := range []string{"a", "b", "c"} {
+			for i := 1; i <= 3; i++ {
+				val := []byte("v")
+				if prefix == "b" && i == 2 {
+					val = largeValue
+				}
+				require.NoError(t, d.Set([]byte(fmt.Sprintf("%s%d", prefix, i)), val, nil))
+			}
+			if prefix != "c" {
+				_, err := d.AsyncFlush()
+				require.NoError(t, err)
+			}
+		}
+		d.mu.Lock()
+		d.mu.compact.flushing = false
+		d.mu.Unlock()
+		require.NoError(t, d.Close())
+
+		var wals []string
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		for _, filename := range ls {
+			if _, _, ok := wal.ParseLogFilename(filename); ok {
+				wals = append(wals, filename)
+			}
+		}
+		slices.Sort(wals)
+		require.Len(t, wals, 3)
+		return mem, wals
+	}
+
+	// corrupt returns an FS that corrupts the record of the given key when
+	// reading the given WAL.
+	corrupt := func(t *testing.T, mem *vfs.MemFS, walName, key string) vfs.FS {
+		f, err := mem.Open(walName)
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		off := bytes.Index(data, []byte(key))
+		require.GreaterOrEqual(t, off, 0)
+		return errorfs.Wrap(mem, errorfs.CorruptAt(errorfs.PathMatch(walName), int64(off)))
+	}
+
+	open := func(
+		fs vfs.FS, mode WALRecoveryMode, events *[]WALDiscardInfo,
+	) (*DB, error) {
+		return Open("", &Options{
+			FS:              fs,
+			WALRecoveryMode: mode,
+			EventListener: &EventListener{
+				WALDiscarded: func(info WALDiscardInfo) {
+					*events = append(*events, info)
+				},
+			},
+		})
+	}
+
+	keys := func(t *testing.T, d *DB) string {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		return strings.Join(keys, " ")
+	}
+
+	walNum := func(name string) base.DiskFileNum {
+		n, _, ok := wal.ParseLogFilename(name)
+		require.True(t, ok)
+		return base.DiskFileNum(n)
+	}
+
+	testCases := []struct {
+		mode WALRecoveryMode
+		// corruptWAL is the index of the corrupted WAL, and corruptKey the key
+		// of the corrupted record.
+		corruptWAL int
+		corruptKey string
+		// expectedKeys are the keys recovered by Open, or expectedErr is true
+		// if Open fails.
+		expectedKeys string
+		expectedErr  bool
+		// expectedEvents are the discarded data reported through the
+		// EventListener, as "<WAL index>:<kind>".
+		expectedEvents []string
+	}{
+		{
+			// The tolerated tail is not reported.
+			mode:         WALRecoveryTolerateCorruptedTail,
+			corruptWAL:   2,
+			corruptKey:   "c2",
+			expectedKeys: "a1 a2 a3 b1 b2 b3 c1",
+		},
+		{
+			mode:        WALRecoveryTolerateCorruptedTail,
+			corruptWAL:  1,
+			corruptKey:  "b1",
+			expectedErr: true,
+		},
+		{
+			mode:        WALRecoveryAbsoluteConsistency,
+			corruptWAL:  2,
+			corruptKey:  "c2",
+			expectedErr: true,
+		},
+		{
+			mode:           WALRecoveryPointInTime,
+			corruptWAL:     1,
+			corruptKey:     "b2",
+			expectedKeys:   "a1 a2 a3 b1",
+			expectedEvents: []string{"1:tail", "2:log"},
+		},
+		{
+			mode:           WALRecoveryPointInTime,
+			corruptWAL:     2,
+			corruptKey:     "c3",
+			expectedKeys:   "a1 a2 a3 b1 b2 b3 c1 c2",
+			expectedEvents: []string{"2:tail"},
+		},
+		{
+			mode:           WALRecoverySkipCorruptedRecords,
+			corruptWAL:     1,
+			corruptKey:     "b2",
+			expectedKeys:   "a1 a2 a3 b1 b3 c1 c2 c3",
+			expectedEvents: []string{"1:record"},
+		},
+		{
+			mode:           WALRecoverySkipCorruptedRecords,
+			corruptWAL:     0,
+			corruptKey:     "a1",
+			expectedKeys:   "b1 b2 b3 c1 c2 c3",
+			expectedEvents: []string{"0:record"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s/%s", tc.mode, tc.corruptKey), func(t *testing.T) {
+			mem, wals := makeDB(t)
+			fs := corrupt(t, mem, wals[tc.corruptWAL], tc.corruptKey)
+
+			var events []WALDiscardInfo
+			d, err := open(fs, tc.mode, &events)
+			if tc.expectedErr {
+				require.Error(t, err)
+				require.True(t, errors.Is(err, record.ErrInvalidChunk), "%v", err)
+				require.Empty(t, events)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedKeys, keys(t, d))
+			var got []string
+			for _, e := range events {
+				require.Equal(t, tc.mode, e.Mode)
+				require.Error(t, e.Err)
+				idx := -1
+				for i := range wals {
+					if walNum(wals[i]) == e.FileNum {
+						idx = i
+					}
+				}
+				got = append(got, fmt.Sprintf("%d:%s", idx, e.Kind))
+			}
+			require.Equal(t, tc.expectedEvents, got)
+			require.NoError(t, d.Close())
+
+			// The recovered state was made durable: the DB can be reopened
+			// without the corruption.
+			d, err = Open("", &Options{FS: mem})
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedKeys, keys(t, d))
+			require.NoError(t, d.Close())
+		})
+	}
+}